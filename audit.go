@@ -0,0 +1,595 @@
+package claudeagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditEvent names the kind of an audit record.
+type AuditEvent string
+
+const (
+	// AuditEventPreToolUse records a tool call about to run.
+	AuditEventPreToolUse AuditEvent = "PreToolUse"
+
+	// AuditEventPostToolUse records a tool call that completed, with its
+	// output.
+	AuditEventPostToolUse AuditEvent = "PostToolUse"
+
+	// AuditEventPostToolUseFailure records a tool call that failed.
+	AuditEventPostToolUseFailure AuditEvent = "PostToolUseFailure"
+
+	// AuditEventPermissionDecision records the SDK's answer to a
+	// permission request, from CanUseTool or a PermissionPolicy, and the
+	// decision of a PreToolUse middleware chain.
+	AuditEventPermissionDecision AuditEvent = "PermissionDecision"
+
+	// AuditEventPermissionDenied records a tool call the CLI denied on
+	// its own, such as in auto mode.
+	AuditEventPermissionDenied AuditEvent = "PermissionDenied"
+
+	// AuditEventConfigChange records a change to a settings file.
+	AuditEventConfigChange AuditEvent = "ConfigChange"
+
+	// AuditEventSessionStart records the start of a session.
+	AuditEventSessionStart AuditEvent = "SessionStart"
+
+	// AuditEventSessionEnd records the end of a session.
+	AuditEventSessionEnd AuditEvent = "SessionEnd"
+)
+
+// Decision makers recorded in AuditRecord.DecidedBy.
+const (
+	// AuditDecidedByCanUseTool marks decisions of the CanUseTool callback.
+	AuditDecidedByCanUseTool = "can_use_tool"
+
+	// AuditDecidedByPolicy marks decisions of a PermissionPolicy.
+	AuditDecidedByPolicy = "permission_policy"
+
+	// AuditDecidedByCLI marks decisions the CLI made itself.
+	AuditDecidedByCLI = "cli"
+
+	// AuditDecidedByHook marks decisions of PreToolUse hook middleware.
+	// The record's Details name the middleware that decided.
+	AuditDecidedByHook = "hook_middleware"
+)
+
+// AuditRecord is one line of an audit log.
+//
+// Each record carries the hash of the record before it, and its own hash
+// covers every other field, so that altering, removing or inserting a
+// record breaks the chain from that point on. VerifyAuditLog checks the
+// chain.
+type AuditRecord struct {
+	// Seq numbers records from 1.
+	Seq uint64 `json:"seq"`
+
+	// Time is when the record was written, in UTC.
+	Time time.Time `json:"time"`
+
+	// Event is the kind of record.
+	Event AuditEvent `json:"event"`
+
+	// SessionID, AgentID and Cwd identify where the event happened.
+	SessionID string `json:"session_id,omitempty"`
+	AgentID   string `json:"agent_id,omitempty"`
+	Cwd       string `json:"cwd,omitempty"`
+
+	// ToolName and ToolUseID identify the tool call, if any.
+	ToolName  string `json:"tool_name,omitempty"`
+	ToolUseID string `json:"tool_use_id,omitempty"`
+
+	// Input and Output are the tool input and response, after redaction.
+	Input  json.RawMessage `json:"input,omitempty"`
+	Output json.RawMessage `json:"output,omitempty"`
+
+	// Error is the error of a failed tool call.
+	Error string `json:"error,omitempty"`
+
+	// Decision is "allow", "ask" or "deny" for permission records, with
+	// the reason given and who decided.
+	Decision  string `json:"decision,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+	DecidedBy string `json:"decided_by,omitempty"`
+
+	// Details holds event specific fields, such as the source of a
+	// SessionStart or the file of a ConfigChange.
+	Details map[string]string `json:"details,omitempty"`
+
+	// PrevHash is the Hash of the previous record, empty for the first.
+	PrevHash string `json:"prev_hash"`
+
+	// Hash is the hex SHA-256 of the record encoded without it.
+	Hash string `json:"hash,omitempty"`
+}
+
+// hash computes the record's hash.
+func (r AuditRecord) hash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditConfig configures an AuditLogger.
+type AuditConfig struct {
+	// Path is the JSONL file records are appended to. It is created if it
+	// does not exist; an existing log is verified and extended.
+	Path string
+
+	// RedactKeys are JSON object keys, compared case-insensitively, whose
+	// values are replaced with "[REDACTED]" wherever they appear in tool
+	// inputs and outputs, such as "password" or "api_key".
+	RedactKeys []string
+
+	// RedactPatterns are regular expressions whose matches are replaced
+	// with "[REDACTED]" in every string of tool inputs and outputs, and
+	// in errors and reasons.
+	RedactPatterns []string
+
+	// Redactor, if set, also scrubs tool inputs, outputs, errors and
+	// reasons.
+	Redactor *Redactor
+
+	// Sync flushes each record to stable storage before the event it
+	// records proceeds.
+	Sync bool
+
+	// FailClosed denies tool calls, and stops Claude on other events,
+	// when a record cannot be written. By default the failure is logged
+	// and the event proceeds unrecorded.
+	FailClosed bool
+}
+
+// AuditLogger writes a tamper-evident, append-only log of what the agent
+// did: tool calls and their results, permission decisions and denials,
+// configuration changes and session boundaries. Register it with
+// WithAuditLogger; several clients may share one logger.
+//
+// The hash chain shows that records were not changed, but cannot by itself
+// show that trailing records were not removed. Keep the Head hash somewhere
+// the agent cannot write to anchor the end of the log.
+type AuditLogger struct {
+	path       string
+	sync       bool
+	failClosed bool
+
+	redactKeys     map[string]struct{}
+	redactPatterns []*regexp.Regexp
+	redactor       *Redactor
+
+	mu       sync.Mutex
+	file     *os.File
+	seq      uint64
+	lastHash string
+}
+
+// OpenAuditLogger opens the audit log at cfg.Path, verifying the records
+// already in it.
+func OpenAuditLogger(cfg AuditConfig) (*AuditLogger, error) {
+	if cfg.Path == "" {
+		return nil, &ErrInvalidConfiguration{
+			Field:  "AuditConfig.Path",
+			Reason: "path is required",
+		}
+	}
+
+	a := &AuditLogger{
+		path:       cfg.Path,
+		sync:       cfg.Sync,
+		failClosed: cfg.FailClosed,
+		redactor:   cfg.Redactor,
+		redactKeys: make(map[string]struct{}, len(cfg.RedactKeys)),
+	}
+	for _, key := range cfg.RedactKeys {
+		a.redactKeys[strings.ToLower(key)] = struct{}{}
+	}
+	for i, pattern := range cfg.RedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, &ErrInvalidConfiguration{
+				Field:  fmt.Sprintf("AuditConfig.RedactPatterns[%d]", i),
+				Reason: err.Error(),
+			}
+		}
+		a.redactPatterns = append(a.redactPatterns, re)
+	}
+
+	file, err := os.OpenFile(
+		cfg.Path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	head, err := verifyAuditChain(cfg.Path, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	a.file = file
+	a.seq = head.Seq
+	a.lastHash = head.Hash
+
+	return a, nil
+}
+
+// VerifyAuditLog checks the hash chain of the audit log at path and returns
+// its last record. It returns ErrAuditChainBroken if a record was altered,
+// removed or inserted. An empty log returns the zero record.
+func VerifyAuditLog(path string) (AuditRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return AuditRecord{}, fmt.Errorf("failed to open audit log: %w",
+			err)
+	}
+	defer file.Close()
+
+	return verifyAuditChain(path, file)
+}
+
+// verifyAuditChain reads the records from r and checks that each links to
+// the one before it.
+func verifyAuditChain(path string, r io.Reader) (AuditRecord, error) {
+	var last AuditRecord
+	reader := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			broken := func(reason string) error {
+				return &ErrAuditChainBroken{
+					Path:   path,
+					Line:   lineNum,
+					Reason: reason,
+				}
+			}
+
+			var record AuditRecord
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(&record); err != nil {
+				return AuditRecord{}, broken(err.Error())
+			}
+			if record.Seq != last.Seq+1 {
+				return AuditRecord{}, broken(fmt.Sprintf(
+					"sequence %d follows %d", record.Seq, last.Seq,
+				))
+			}
+			if record.PrevHash != last.Hash {
+				return AuditRecord{}, broken("previous hash mismatch")
+			}
+			hash, err := record.hash()
+			if err != nil {
+				return AuditRecord{}, broken(err.Error())
+			}
+			if hash != record.Hash {
+				return AuditRecord{}, broken("hash mismatch")
+			}
+			last = record
+		}
+
+		if errors.Is(err, io.EOF) {
+			return last, nil
+		}
+		if err != nil {
+			return AuditRecord{}, fmt.Errorf("failed to read audit "+
+				"log: %w", err)
+		}
+	}
+}
+
+// Head returns the sequence number and hash of the last record written.
+func (a *AuditLogger) Head() (uint64, string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.seq, a.lastHash
+}
+
+// Record appends record to the log, filling in its sequence number, time
+// and hashes. Applications can use it to add their own events to the
+// chain. Tool inputs, outputs, errors and reasons are redacted.
+func (a *AuditLogger) Record(record AuditRecord) error {
+	record.Input = a.redactJSON(record.Input)
+	record.Output = a.redactJSON(record.Output)
+	record.Error = a.redactString(record.Error)
+	record.Reason = a.redactString(record.Reason)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return fmt.Errorf("audit log %s is closed", a.path)
+	}
+
+	record.Seq = a.seq + 1
+	record.Time = time.Now().UTC()
+	record.PrevHash = a.lastHash
+	hash, err := record.hash()
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	record.Hash = hash
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	if a.sync {
+		if err := a.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+
+	a.seq = record.Seq
+	a.lastHash = record.Hash
+	return nil
+}
+
+// Close closes the log file. Records written afterwards fail.
+func (a *AuditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+// redactJSON redacts the keys and patterns in a JSON value. Values that are
+// not valid JSON are recorded as a redacted JSON string.
+func (a *AuditLogger) redactJSON(raw json.RawMessage) json.RawMessage {
+	if len(raw) == 0 {
+		return raw
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		value = string(raw)
+	}
+	data, err := json.Marshal(a.redactValue(value))
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// redactValue redacts value and everything within it.
+func (a *AuditLogger) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if _, ok := a.redactKeys[strings.ToLower(key)]; ok {
+				v[key] = DefaultRedaction
+				continue
+			}
+			v[key] = a.redactValue(inner)
+		}
+		return v
+
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = a.redactValue(inner)
+		}
+		return v
+
+	case string:
+		return a.redactString(v)
+
+	default:
+		return v
+	}
+}
+
+// redactString replaces the matches of the redaction patterns in s.
+func (a *AuditLogger) redactString(s string) string {
+	for _, re := range a.redactPatterns {
+		s = re.ReplaceAllLiteralString(s, DefaultRedaction)
+	}
+	return a.redactor.RedactString(s)
+}
+
+// auditHookTypes are the hook events an AuditLogger records.
+var auditHookTypes = []HookType{
+	HookTypePreToolUse,
+	HookTypePostToolUse,
+	HookTypePostToolUseFailure,
+	HookTypePermissionDenied,
+	HookTypeConfigChange,
+	HookTypeSessionStart,
+	HookTypeSessionEnd,
+}
+
+// middleware returns the hook middleware that records hook events. It runs
+// first in the chain for its event and matcher, so events are recorded even
+// when a later middleware in that chain denies or stops. Middleware with
+// other matchers form separate chains the CLI may call first; their
+// PreToolUse decisions are recorded by recordHookDecision instead.
+func (a *AuditLogger) middleware() HookMiddleware {
+	onError := HookFailOpen
+	if a.failClosed {
+		onError = HookFailClosed
+	}
+
+	return HookMiddleware{
+		Name:     "audit",
+		Priority: math.MinInt,
+		OnError:  onError,
+		Callback: a.recordHook,
+	}
+}
+
+// recordHook records a hook event.
+func (a *AuditLogger) recordHook(_ context.Context,
+	input HookInput) (HookResult, error) {
+
+	base := input.Base()
+	record := AuditRecord{
+		Event:     AuditEvent(input.HookType()),
+		SessionID: base.SessionID,
+		AgentID:   base.AgentID,
+		Cwd:       base.Cwd,
+	}
+
+	switch in := input.(type) {
+	case PreToolUseInput:
+		record.ToolName = in.ToolName
+		record.Input = in.ToolInput
+
+	case PostToolUseInput:
+		record.ToolName = in.ToolName
+		record.Input = in.ToolInput
+		record.Output = in.ToolResponse
+
+	case PostToolUseFailureInput:
+		record.ToolName = in.ToolName
+		record.Input = in.ToolInput
+		record.Error = in.Error
+		if in.IsInterrupt {
+			record.Details = map[string]string{"interrupt": "true"}
+		}
+
+	case PermissionDeniedInput:
+		record.ToolName = in.ToolName
+		record.ToolUseID = in.ToolUseID
+		record.Input = in.ToolInput
+		record.Decision = "deny"
+		record.Reason = in.Reason
+		record.DecidedBy = AuditDecidedByCLI
+
+	case ConfigChangeInput:
+		record.Details = map[string]string{
+			"source":    in.Source,
+			"file_path": in.FilePath,
+		}
+
+	case SessionStartInput:
+		record.Details = map[string]string{"source": in.Source}
+
+	case SessionEndInput:
+		record.Details = map[string]string{"reason": in.Reason}
+	}
+
+	if err := a.Record(record); err != nil {
+		return HookResult{}, err
+	}
+	return HookResult{Continue: true}, nil
+}
+
+// recordHookDecision records the merged result of a PreToolUse middleware
+// chain, decided by the middleware named decidedBy. Other events are not
+// recorded.
+func (a *AuditLogger) recordHookDecision(input HookInput, result HookResult,
+	decidedBy string) error {
+
+	pre, ok := input.(PreToolUseInput)
+	if !ok {
+		return nil
+	}
+
+	record := AuditRecord{
+		Event:     AuditEventPermissionDecision,
+		SessionID: pre.SessionID,
+		AgentID:   pre.AgentID,
+		Cwd:       pre.Cwd,
+		ToolName:  pre.ToolName,
+		Input:     pre.ToolInput,
+		DecidedBy: AuditDecidedByHook,
+		Details:   map[string]string{"middleware": decidedBy},
+	}
+	switch {
+	case result.Decision == "block":
+		record.Decision = "deny"
+		record.Reason = result.Reason
+
+	case result.Decision == "approve":
+		record.Decision = "allow"
+		record.Reason = result.Reason
+
+	case !result.Continue:
+		record.Decision = "deny"
+		record.Reason = result.StopReason
+
+	default:
+		hso := result.HookSpecificOutput
+		record.Decision, _ = hso["permissionDecision"].(string)
+		record.Reason, _ = hso["permissionDecisionReason"].(string)
+	}
+
+	return a.Record(record)
+}
+
+// canUseTool wraps fn so that its decisions are recorded. decidedBy names
+// the decision maker and sessionID returns the client's current session.
+func (a *AuditLogger) canUseTool(fn CanUseToolFunc, decidedBy string,
+	sessionID func() string, log *slog.Logger) CanUseToolFunc {
+
+	return func(ctx context.Context,
+		req ToolPermissionRequest) PermissionResult {
+
+		result := fn(ctx, req)
+
+		record := AuditRecord{
+			Event:     AuditEventPermissionDecision,
+			SessionID: sessionID(),
+			AgentID:   req.Context.AgentID,
+			ToolName:  req.ToolName,
+			ToolUseID: req.Context.ToolUseID,
+			Input:     req.Arguments,
+			Decision:  "allow",
+			DecidedBy: decidedBy,
+		}
+		switch r := result.(type) {
+		case PermissionAllow:
+			if r.UpdatedInput != nil {
+				record.Details = map[string]string{
+					"updated_input": string(
+						a.redactJSON(r.UpdatedInput),
+					),
+				}
+			}
+
+		case PermissionDeny:
+			record.Decision = "deny"
+			record.Reason = r.Reason
+		}
+		if !result.IsAllow() {
+			record.Decision = "deny"
+		}
+
+		if err := a.Record(record); err != nil {
+			log.Error("Failed to record permission decision",
+				"tool", req.ToolName, "err", err)
+			if a.failClosed {
+				return PermissionDeny{
+					Reason: fmt.Sprintf("audit log unavailable: %v",
+						err),
+				}
+			}
+		}
+		return result
+	}
+}
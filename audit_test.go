@@ -0,0 +1,280 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readAuditRecords returns the records in the audit log at path.
+func readAuditRecords(t *testing.T, path string) []AuditRecord {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var records []AuditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record AuditRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		records = append(records, record)
+	}
+	return records
+}
+
+// TestAuditLoggerChain verifies that records are chained across reopens and
+// that tampering is detected.
+func TestAuditLoggerChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	logger, err := OpenAuditLogger(AuditConfig{Path: path, Sync: true})
+	require.NoError(t, err)
+	require.NoError(t, logger.Record(AuditRecord{
+		Event: AuditEventSessionStart,
+	}))
+	require.NoError(t, logger.Record(AuditRecord{
+		Event:    AuditEventPreToolUse,
+		ToolName: "Bash",
+		Input:    json.RawMessage(`{"command": "ls"}`),
+	}))
+	require.NoError(t, logger.Close())
+	assert.Error(t, logger.Record(AuditRecord{}))
+
+	// Reopening continues the chain.
+	logger, err = OpenAuditLogger(AuditConfig{Path: path})
+	require.NoError(t, err)
+	require.NoError(t, logger.Record(AuditRecord{
+		Event: AuditEventSessionEnd,
+	}))
+	seq, hash := logger.Head()
+	require.NoError(t, logger.Close())
+	assert.EqualValues(t, 3, seq)
+
+	last, err := VerifyAuditLog(path)
+	require.NoError(t, err)
+	assert.Equal(t, hash, last.Hash)
+
+	records := readAuditRecords(t, path)
+	require.Len(t, records, 3)
+	assert.Empty(t, records[0].PrevHash)
+	assert.Equal(t, records[0].Hash, records[1].PrevHash)
+	assert.Equal(t, records[1].Hash, records[2].PrevHash)
+
+	// Changing a record breaks the chain at that line.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	tampered := strings.Replace(string(data), `"ls"`, `"rm"`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(tampered), 0o600))
+
+	_, err = VerifyAuditLog(path)
+	var broken *ErrAuditChainBroken
+	require.ErrorAs(t, err, &broken)
+	assert.Equal(t, 2, broken.Line)
+
+	_, err = OpenAuditLogger(AuditConfig{Path: path})
+	assert.ErrorAs(t, err, &broken)
+
+	// So does removing one.
+	lines := strings.SplitAfter(string(data), "\n")
+	removed := lines[0] + lines[2]
+	require.NoError(t, os.WriteFile(path, []byte(removed), 0o600))
+
+	_, err = VerifyAuditLog(path)
+	require.ErrorAs(t, err, &broken)
+	assert.Equal(t, 2, broken.Line)
+}
+
+// TestAuditLoggerRedaction verifies that keys and patterns are redacted
+// from tool inputs, outputs and errors.
+func TestAuditLoggerRedaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	logger, err := OpenAuditLogger(AuditConfig{
+		Path:           path,
+		RedactKeys:     []string{"Password"},
+		RedactPatterns: []string{`sk-[a-z0-9]+`},
+	})
+	require.NoError(t, err)
+	defer logger.Close()
+
+	require.NoError(t, logger.Record(AuditRecord{
+		Event: AuditEventPostToolUseFailure,
+		Input: json.RawMessage(`{"user":"gopher","password":"hunter2",` +
+			`"args":["--key","sk-abc123"]}`),
+		Output: json.RawMessage(`not json sk-abc123`),
+		Error:  "rejected key sk-abc123",
+	}))
+
+	records := readAuditRecords(t, path)
+	require.Len(t, records, 1)
+	assert.JSONEq(t, `{"user":"gopher","password":"[REDACTED]",`+
+		`"args":["--key","[REDACTED]"]}`, string(records[0].Input))
+	assert.JSONEq(t, `"not json [REDACTED]"`, string(records[0].Output))
+	assert.Equal(t, "rejected key [REDACTED]", records[0].Error)
+
+	_, err = OpenAuditLogger(AuditConfig{
+		Path:           path,
+		RedactPatterns: []string{"("},
+	})
+	var invalid *ErrInvalidConfiguration
+	assert.ErrorAs(t, err, &invalid)
+}
+
+// TestClientAuditLogger verifies that a client records hook events and
+// permission decisions with their provenance.
+func TestClientAuditLogger(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	logger, err := OpenAuditLogger(AuditConfig{Path: path})
+	require.NoError(t, err)
+	defer logger.Close()
+
+	client, err := NewClient(
+		WithAuditLogger(logger),
+		WithHookMiddleware(HookTypePreToolUse, HookMiddleware{
+			Name: "no-tools",
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				return PreToolUseDeny("no").Result(), nil
+			},
+		}),
+		WithPermissionPolicy(&PermissionPolicy{
+			Rules: []PolicyRule{{
+				Name:    "no-rm",
+				Action:  PolicyActionDeny,
+				Command: "rm",
+			}},
+			Default: PolicyActionAllow,
+		}),
+	)
+	require.NoError(t, err)
+
+	chains := hookChainConfigs(client.options.HookMiddleware,
+		client.options.Audit, discardLogger)
+	require.Len(t, chains[HookTypePreToolUse], 1)
+
+	// The audit middleware runs before the one that denies.
+	result, err := chains[HookTypePreToolUse][0].Callback(ctx,
+		PreToolUseInput{
+			BaseHookInput: BaseHookInput{SessionID: "sess_1"},
+			ToolName:      "Bash",
+			ToolInput:     json.RawMessage(`{"command":"rm -rf /"}`),
+		})
+	require.NoError(t, err)
+	assert.Equal(t, "deny", result.HookSpecificOutput["permissionDecision"])
+
+	decision := client.options.CanUseTool(ctx, ToolPermissionRequest{
+		ToolName:  "Bash",
+		Arguments: json.RawMessage(`{"command":"rm -rf /"}`),
+		Context:   PermissionContext{ToolUseID: "toolu_1"},
+	})
+	assert.False(t, decision.IsAllow())
+
+	_, err = chains[HookTypeSessionEnd][0].Callback(ctx, SessionEndInput{
+		BaseHookInput: BaseHookInput{SessionID: "sess_1"},
+		Reason:        "exit",
+	})
+	require.NoError(t, err)
+
+	records := readAuditRecords(t, path)
+	require.Len(t, records, 4)
+
+	assert.Equal(t, AuditEventPreToolUse, records[0].Event)
+	assert.Equal(t, "sess_1", records[0].SessionID)
+	assert.Equal(t, "Bash", records[0].ToolName)
+
+	// The chain's decision is recorded after it has run.
+	assert.Equal(t, AuditEventPermissionDecision, records[1].Event)
+	assert.Equal(t, "sess_1", records[1].SessionID)
+	assert.Equal(t, "deny", records[1].Decision)
+	assert.Equal(t, "no", records[1].Reason)
+	assert.Equal(t, AuditDecidedByHook, records[1].DecidedBy)
+	assert.Equal(t, map[string]string{"middleware": "no-tools"},
+		records[1].Details)
+
+	assert.Equal(t, AuditEventPermissionDecision, records[2].Event)
+	assert.Equal(t, "toolu_1", records[2].ToolUseID)
+	assert.Equal(t, "deny", records[2].Decision)
+	assert.Equal(t, AuditDecidedByPolicy, records[2].DecidedBy)
+	assert.Contains(t, records[2].Reason, "no-rm")
+
+	assert.Equal(t, AuditEventSessionEnd, records[3].Event)
+	assert.Equal(t, map[string]string{"reason": "exit"}, records[3].Details)
+
+	_, err = VerifyAuditLog(path)
+	assert.NoError(t, err)
+}
+
+// TestAuditLoggerHookDecision verifies that the decision of a PreToolUse
+// chain is recorded even when the audit middleware is not part of it, and
+// that chains which decide nothing record no decision.
+func TestAuditLoggerHookDecision(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	logger, err := OpenAuditLogger(AuditConfig{Path: path})
+	require.NoError(t, err)
+	defer logger.Close()
+
+	client, err := NewClient(
+		WithAuditLogger(logger),
+		WithHookMiddleware(HookTypePreToolUse, HookMiddleware{
+			Name:    "bash-review",
+			Matcher: "Bash",
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				return PreToolUseAsk("review").Result(), nil
+			},
+		}, HookMiddleware{
+			Name:     "bash-guard",
+			Matcher:  "Bash",
+			Priority: 1,
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				return PreToolUseDeny("no shell").Result(), nil
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	chains := hookChainConfigs(client.options.HookMiddleware,
+		client.options.Audit, discardLogger)
+	require.Len(t, chains[HookTypePreToolUse], 2)
+
+	input := PreToolUseInput{
+		ToolName:  "Bash",
+		ToolInput: json.RawMessage(`{"command":"ls"}`),
+	}
+	for _, chain := range chains[HookTypePreToolUse] {
+		result, err := chain.Callback(ctx, input)
+		require.NoError(t, err)
+		if chain.Matcher == "Bash" {
+			assert.Equal(t, "deny",
+				result.HookSpecificOutput["permissionDecision"])
+		}
+	}
+
+	records := readAuditRecords(t, path)
+	var decisions []AuditRecord
+	for _, record := range records {
+		if record.Event == AuditEventPermissionDecision {
+			decisions = append(decisions, record)
+		}
+	}
+	require.Len(t, decisions, 1)
+	assert.Equal(t, "deny", decisions[0].Decision)
+	assert.Equal(t, "no shell", decisions[0].Reason)
+	assert.Equal(t, "Bash", decisions[0].ToolName)
+	assert.Equal(t, map[string]string{"middleware": "bash-guard"},
+		decisions[0].Details)
+}
@@ -0,0 +1,334 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// DefaultMessageBufferSize is the number of messages the client buffers
+// between reading them from the CLI and handing them to consumers when
+// BufferPolicy.Size is zero.
+const DefaultMessageBufferSize = 256
+
+// BackpressureMode selects what the client does with messages from the CLI
+// while its consumers are not keeping up.
+type BackpressureMode string
+
+const (
+	// BackpressureBlock stops reading from the CLI once the buffer is full
+	// until consumers catch up. The CLI then blocks writing its output.
+	//
+	// Control requests read after the buffer filled up wait too, so a
+	// consumer that stops reading while it waits for a permission prompt
+	// to be answered deadlocks the client. Only use this mode when every
+	// consumer keeps reading.
+	BackpressureBlock BackpressureMode = "block"
+
+	// BackpressureDropPartial discards StreamEvent messages, the partial
+	// message deltas enabled by WithIncludePartialMessages, that arrive
+	// while the buffer is full. Other messages are kept in memory beyond
+	// the buffer size, so reading from the CLI never stops.
+	BackpressureDropPartial BackpressureMode = "drop_partial"
+
+	// BackpressureSpill writes messages that don't fit in the buffer to a
+	// temporary file and delivers them from there in order, so reading
+	// from the CLI never stops. If the file cannot be created, they are
+	// kept in memory instead. This is the default.
+	BackpressureSpill BackpressureMode = "spill"
+)
+
+// BufferPolicy configures buffering between the CLI and the client's
+// queries and streams.
+//
+// Control requests from the CLI, such as permission prompts, hook callbacks
+// and SDK MCP calls, are not buffered: they are handled as soon as they are
+// read, on their own path, and never wait for consumers. Every mode except
+// BackpressureBlock keeps reading while the buffer is full, so control
+// requests are still read and answered while consumers are stalled.
+type BufferPolicy struct {
+	// Mode is what happens once the buffer is full. The zero value is
+	// BackpressureSpill.
+	Mode BackpressureMode
+
+	// Size is the number of messages buffered in memory.
+	Size int
+
+	// SpillDir is the directory for BackpressureSpill files. Defaults to
+	// os.TempDir.
+	SpillDir string
+}
+
+// withDefaults returns the policy with zero values replaced by defaults.
+func (p BufferPolicy) withDefaults() BufferPolicy {
+	if p.Mode == "" {
+		p.Mode = BackpressureSpill
+	}
+	if p.Size <= 0 {
+		p.Size = DefaultMessageBufferSize
+	}
+	return p
+}
+
+// validate checks that the mode is known.
+func (p BufferPolicy) validate() error {
+	switch p.Mode {
+	case "", BackpressureBlock, BackpressureDropPartial, BackpressureSpill:
+		return nil
+	default:
+		return &ErrInvalidConfiguration{
+			Field:  "MessageBuffer.Mode",
+			Reason: fmt.Sprintf("unknown backpressure mode %q", p.Mode),
+		}
+	}
+}
+
+// messageQueue buffers messages between the reader, which pushes them as
+// they arrive from the CLI, and the goroutine that routes them to
+// consumers. It is safe for concurrent use.
+type messageQueue struct {
+	policy BufferPolicy
+
+	mu  sync.Mutex
+	mem []Message
+
+	// spill holds the messages pushed after the buffer filled up in
+	// BackpressureSpill mode. They follow every message in mem.
+	spill *spillFile
+
+	closed bool
+
+	// pushed and popped are signaled when a message is pushed or popped.
+	pushed chan struct{}
+	popped chan struct{}
+}
+
+// newMessageQueue creates an empty queue.
+func newMessageQueue(policy BufferPolicy) *messageQueue {
+	return &messageQueue{
+		policy: policy.withDefaults(),
+		pushed: make(chan struct{}, 1),
+		popped: make(chan struct{}, 1),
+	}
+}
+
+// signal wakes a goroutine waiting on ch, if any.
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// push adds msg to the queue. Only BackpressureBlock waits for room.
+// It returns false if the queue was closed or ctx is done first.
+func (q *messageQueue) push(ctx context.Context, msg Message) bool {
+	q.mu.Lock()
+	for {
+		if q.closed {
+			q.mu.Unlock()
+			return false
+		}
+
+		// Once messages are spilled, later ones follow them through
+		// the file to keep their order.
+		if q.spill != nil {
+			q.spill.write(msg)
+			q.mu.Unlock()
+			signal(q.pushed)
+			return true
+		}
+
+		if len(q.mem) < q.policy.Size {
+			q.mem = append(q.mem, msg)
+			q.mu.Unlock()
+			signal(q.pushed)
+			return true
+		}
+
+		switch q.policy.Mode {
+		case BackpressureDropPartial:
+			if _, ok := msg.(StreamEvent); ok {
+				q.mu.Unlock()
+				return true
+			}
+			q.mem = append(q.mem, msg)
+			q.mu.Unlock()
+			signal(q.pushed)
+			return true
+
+		case BackpressureSpill:
+			spill, err := newSpillFile(q.policy.SpillDir)
+			if err == nil {
+				q.spill = spill
+				continue
+			}
+
+			// Without a file, keep reading rather than stall
+			// control requests behind consumers.
+			q.mem = append(q.mem, msg)
+			q.mu.Unlock()
+			signal(q.pushed)
+			return true
+		}
+
+		q.mu.Unlock()
+		select {
+		case <-q.popped:
+		case <-ctx.Done():
+			return false
+		}
+		q.mu.Lock()
+	}
+}
+
+// pop removes the oldest message, waiting for one if the queue is empty.
+// It returns false once the queue is closed and drained, or when ctx is
+// done.
+func (q *messageQueue) pop(ctx context.Context) (Message, bool) {
+	q.mu.Lock()
+	for {
+		if len(q.mem) > 0 {
+			msg := q.mem[0]
+			q.mem[0] = nil
+			q.mem = q.mem[1:]
+			q.mu.Unlock()
+			signal(q.popped)
+			return msg, true
+		}
+
+		if q.spill != nil {
+			msg := q.spill.read()
+			if q.spill.len() == 0 {
+				// The reader caught up, so new messages can
+				// be buffered in memory again.
+				q.spill.close()
+				q.spill = nil
+			}
+			q.mu.Unlock()
+			return msg, true
+		}
+
+		if q.closed {
+			q.mu.Unlock()
+			return nil, false
+		}
+
+		q.mu.Unlock()
+		select {
+		case <-q.pushed:
+		case <-ctx.Done():
+			return nil, false
+		}
+		q.mu.Lock()
+	}
+}
+
+// close ends the queue. Messages already pushed can still be popped.
+func (q *messageQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	signal(q.pushed)
+}
+
+// discard drops any messages left and removes the spill file.
+func (q *messageQueue) discard() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.mem = nil
+	if q.spill != nil {
+		q.spill.close()
+		q.spill = nil
+	}
+}
+
+// spillFile stores messages in a temporary file in the order they were
+// written. It is not safe for concurrent use.
+type spillFile struct {
+	f       *os.File
+	records []spillRecord
+
+	writeOff int64
+	readOff  int64
+}
+
+// spillRecord is one message in a spill file: size bytes of JSON, or msg
+// itself for a message that cannot be encoded.
+type spillRecord struct {
+	size int
+	msg  Message
+}
+
+// newSpillFile creates an empty spill file in dir.
+func newSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "claude-agent-spill-*.jsonl")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	return &spillFile{f: f}, nil
+}
+
+// write appends msg. Messages that do not survive a round trip through
+// JSON, such as errors, or that fail to be written are kept in memory.
+func (s *spillFile) write(msg Message) {
+	data, err := json.Marshal(msg)
+	if err == nil {
+		parsed, perr := ParseMessage(data)
+		if perr != nil ||
+			reflect.TypeOf(parsed) != reflect.TypeOf(msg) {
+
+			err = fmt.Errorf("%T cannot be encoded", msg)
+		}
+	}
+	if err == nil {
+		_, err = s.f.WriteAt(data, s.writeOff)
+	}
+	if err != nil {
+		s.records = append(s.records, spillRecord{msg: msg})
+		return
+	}
+
+	s.writeOff += int64(len(data))
+	s.records = append(s.records, spillRecord{size: len(data)})
+}
+
+// read removes and returns the oldest message. The caller must check len
+// first. A message that cannot be read back is returned as a pumpError.
+func (s *spillFile) read() Message {
+	rec := s.records[0]
+	s.records = s.records[1:]
+	if rec.msg != nil {
+		return rec.msg
+	}
+
+	data := make([]byte, rec.size)
+	_, err := s.f.ReadAt(data, s.readOff)
+	s.readOff += int64(rec.size)
+	if err != nil {
+		return pumpError{err: fmt.Errorf("failed to read spill "+
+			"file: %w", err)}
+	}
+
+	msg, err := ParseMessage(data)
+	if err != nil {
+		return pumpError{err: err}
+	}
+	return msg
+}
+
+// len returns the number of messages waiting to be read.
+func (s *spillFile) len() int {
+	return len(s.records)
+}
+
+// close closes and removes the file.
+func (s *spillFile) close() {
+	_ = s.f.Close()
+	_ = os.Remove(s.f.Name())
+}
@@ -0,0 +1,198 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assistantText builds an assistant message with a single text block.
+func assistantText(text string) AssistantMessage {
+	msg := AssistantMessage{Type: "assistant"}
+	msg.Message.Role = "assistant"
+	msg.Message.Content = []ContentBlock{{Type: "text", Text: text}}
+	return msg
+}
+
+// TestMessageQueueDropPartial verifies that partial messages are dropped
+// once the buffer is full and other messages are kept without waiting.
+func TestMessageQueueDropPartial(t *testing.T) {
+	q := newMessageQueue(BufferPolicy{
+		Mode: BackpressureDropPartial,
+		Size: 2,
+	})
+	ctx := context.Background()
+
+	require.True(t, q.push(ctx, StreamEvent{Type: "stream_event"}))
+	require.True(t, q.push(ctx, assistantText("one")))
+	require.True(t, q.push(ctx, StreamEvent{Type: "stream_event"}))
+
+	// A full message is kept beyond the buffer size.
+	shortCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	require.True(t, q.push(shortCtx, assistantText("two")))
+	require.True(t, q.push(ctx, StreamEvent{Type: "stream_event"}))
+
+	msg, ok := q.pop(ctx)
+	require.True(t, ok)
+	assert.IsType(t, StreamEvent{}, msg)
+
+	q.close()
+	var texts []string
+	for {
+		msg, ok := q.pop(ctx)
+		if !ok {
+			break
+		}
+		texts = append(texts, msg.(AssistantMessage).ContentText())
+	}
+	assert.Equal(t, []string{"one", "two"}, texts)
+}
+
+// TestMessageQueueBlock verifies that pushing to a full blocking queue waits
+// for room.
+func TestMessageQueueBlock(t *testing.T) {
+	q := newMessageQueue(BufferPolicy{Mode: BackpressureBlock, Size: 1})
+	ctx := context.Background()
+
+	require.True(t, q.push(ctx, assistantText("one")))
+
+	shortCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.False(t, q.push(shortCtx, assistantText("two")))
+
+	_, ok := q.pop(ctx)
+	require.True(t, ok)
+	assert.True(t, q.push(ctx, assistantText("two")))
+}
+
+// TestMessageQueueSpill verifies that messages beyond the buffer are spilled
+// to disk without blocking and come back in order, including ones that
+// cannot be encoded.
+func TestMessageQueueSpill(t *testing.T) {
+	dir := t.TempDir()
+	q := newMessageQueue(BufferPolicy{
+		Mode:     BackpressureSpill,
+		Size:     2,
+		SpillDir: dir,
+	})
+	ctx := context.Background()
+
+	crash := errors.New("crash")
+	for i := range 10 {
+		require.True(t, q.push(ctx, assistantText(fmt.Sprint(i))))
+	}
+	require.True(t, q.push(ctx, pumpError{err: crash}))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	for i := range 10 {
+		msg, ok := q.pop(ctx)
+		require.True(t, ok)
+		assert.Equal(t, fmt.Sprint(i), msg.(AssistantMessage).ContentText())
+	}
+	msg, ok := q.pop(ctx)
+	require.True(t, ok)
+	assert.ErrorIs(t, msg.(pumpError).err, crash)
+
+	// The file is removed once drained.
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+// TestClientSlowConsumerPermission verifies that a permission prompt is
+// answered while the query's consumer has stopped reading, in every mode
+// that keeps reading from the CLI.
+func TestClientSlowConsumerPermission(t *testing.T) {
+	modes := []BackpressureMode{
+		"", BackpressureDropPartial, BackpressureSpill,
+	}
+	for _, mode := range modes {
+		t.Run(fmt.Sprintf("mode=%q", mode), func(t *testing.T) {
+			testClientSlowConsumerPermission(t, mode)
+		})
+	}
+}
+
+// testClientSlowConsumerPermission stops reading a query after its first
+// message, with a backlog larger than the buffer queued before a permission
+// prompt, and waits for the prompt to be answered.
+func testClientSlowConsumerPermission(t *testing.T, mode BackpressureMode) {
+	const backlog = 200
+
+	transport, server := NewPipeTransport()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	answered := make(chan struct{})
+	go func() {
+		for msg, err := range server.Messages(ctx) {
+			if err != nil {
+				continue
+			}
+
+			switch m := msg.(type) {
+			case SDKControlRequest:
+				_ = server.RespondControl(ctx, m.RequestID, nil)
+
+			case SDKControlResponse:
+				close(answered)
+				_ = server.SendResult(ctx, "sess_pipe", "done")
+
+			case UserMessage:
+				for i := range backlog {
+					_ = server.SendAssistantText(
+						ctx, "sess_pipe", fmt.Sprint(i),
+					)
+				}
+				_ = server.Write(ctx, SDKControlRequest{
+					Type:      "control_request",
+					RequestID: "perm_1",
+					Request: SDKControlRequestBody{
+						Subtype:  "can_use_tool",
+						ToolName: "Bash",
+					},
+				})
+			}
+		}
+	}()
+
+	client, err := NewClient(
+		WithTransport(transport),
+		WithCanUseTool(func(context.Context,
+			ToolPermissionRequest) PermissionResult {
+
+			return PermissionAllow{}
+		}),
+		WithMessageBuffer(BufferPolicy{
+			Mode:     mode,
+			Size:     8,
+			SpillDir: t.TempDir(),
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var count int
+	for range client.Query(ctx, "go") {
+		if count == 0 {
+			select {
+			case <-answered:
+			case <-ctx.Done():
+				t.Fatal("permission prompt not answered")
+			}
+		}
+		count++
+	}
+	require.NoError(t, ctx.Err())
+	assert.Equal(t, backlog+1, count)
+}
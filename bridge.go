@@ -0,0 +1,423 @@
+package claudeagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// Bridge wire protocol.
+//
+// A bridge connection carries the CLI's newline-delimited stream-json
+// unchanged in both directions. The bridge adds a handful of its own lines,
+// all JSON objects whose type starts with "bridge_", which never collide
+// with CLI message types:
+//
+//	client -> bridge  bridge_hello      first line: CLI args, env, cwd, token
+//	bridge -> client  bridge_ready      the CLI was started
+//	bridge -> client  bridge_error      the hello was rejected; connection ends
+//	bridge -> client  bridge_stderr     one line of the CLI's stderr
+//	bridge -> client  bridge_exit       the CLI exited; connection ends
+//	client -> bridge  bridge_end_input  close the CLI's stdin
+const (
+	bridgeTypeHello    = "bridge_hello"
+	bridgeTypeReady    = "bridge_ready"
+	bridgeTypeError    = "bridge_error"
+	bridgeTypeStderr   = "bridge_stderr"
+	bridgeTypeExit     = "bridge_exit"
+	bridgeTypeEndInput = "bridge_end_input"
+)
+
+// bridgeLinePrefix starts every line generated by the bridge protocol, as
+// encoded by encoding/json.
+var bridgeLinePrefix = []byte(`{"type":"bridge_`)
+
+const (
+	// DefaultBridgeHandshakeTimeout bounds how long the bridge waits for a
+	// client's hello when BridgeServer.HandshakeTimeout is zero.
+	DefaultBridgeHandshakeTimeout = 10 * time.Second
+
+	// bridgeKillTimeout is how long the bridge lets the CLI exit on its
+	// own after the client disconnects before killing it.
+	bridgeKillTimeout = 5 * time.Second
+
+	// maxBridgeLineSize matches the largest stream-json line accepted from
+	// a local CLI.
+	maxBridgeLineSize = 10 * 1024 * 1024
+)
+
+// bridgeHello is the first line a client sends. Token is only set for TCP
+// connections; WebSocket clients authenticate in the upgrade request.
+type bridgeHello struct {
+	Type  string   `json:"type"`
+	Args  []string `json:"args"`
+	Env   []string `json:"env,omitempty"`
+	Cwd   string   `json:"cwd,omitempty"`
+	Token string   `json:"token,omitempty"`
+}
+
+// bridgeEvent is any other bridge protocol line.
+type bridgeEvent struct {
+	Type     string `json:"type"`
+	Error    string `json:"error,omitempty"`
+	Line     string `json:"line,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"`
+}
+
+// writeBridgeLine writes v to w as a single JSON line.
+func writeBridgeLine(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	data = append(data, '\n')
+
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write: %w", err)
+	}
+	return nil
+}
+
+// newLineScanner returns a scanner for stream-json lines read from r.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBridgeLineSize)
+	return scanner
+}
+
+// isBridgeLine reports whether line belongs to the bridge protocol rather
+// than the CLI.
+func isBridgeLine(line []byte) bool {
+	return bytes.HasPrefix(line, bridgeLinePrefix)
+}
+
+// withNewline returns a copy of line terminated by a newline. Appending to a
+// scanner's token in place would overwrite its buffered input.
+func withNewline(line []byte) []byte {
+	out := make([]byte, len(line)+1)
+	copy(out, line)
+	out[len(line)] = '\n'
+	return out
+}
+
+// BridgeServer exposes Claude CLI subprocesses to NetworkTransport clients.
+// Each connection gets its own CLI, started with the arguments the client
+// built from its options and stopped when the connection ends.
+//
+// The token grants full control over the CLI on this host, including
+// permission mode and tools, so the bridge should only be reachable by
+// trusted orchestrators, over TLS when it leaves the machine.
+//
+// Serve accepts TCP (or TLS) connections; BridgeServer is also an
+// http.Handler that accepts WebSocket connections.
+type BridgeServer struct {
+	// Token is the bearer token clients must present. It must not be
+	// empty.
+	Token string
+
+	// CLIPath is the CLI executable. If empty, it is discovered from PATH.
+	CLIPath string
+
+	// Cwd is the working directory for clients that don't set one. If
+	// empty, the bridge's own working directory is used.
+	Cwd string
+
+	// NewRunner creates the runner for each CLI. If nil, local
+	// subprocesses of CLIPath are used.
+	NewRunner func() SubprocessRunner
+
+	// PassEnv names the bridge's environment variables each CLI
+	// receives, in addition to those its client sends. If nil,
+	// DefaultIsolationPassEnv is used. Credentials the CLI needs on this
+	// host, such as ANTHROPIC_API_KEY, must be listed explicitly.
+	PassEnv []string
+
+	// HandshakeTimeout bounds how long a client may take to send its
+	// hello. Defaults to DefaultBridgeHandshakeTimeout.
+	HandshakeTimeout time.Duration
+
+	// ErrorLog receives connection errors. If nil, they are discarded.
+	ErrorLog io.Writer
+}
+
+// Serve accepts connections on ln until it is closed, running a CLI for
+// each. Clients authenticate with the token in their hello.
+func (s *BridgeServer) Serve(ln net.Listener) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn, false)
+	}
+}
+
+// ServeHTTP upgrades an authenticated request to a WebSocket and runs a CLI
+// for it. The token is expected as "Authorization: Bearer <token>".
+func (s *BridgeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := s.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || !s.checkToken(token) {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	ws, err := websocket.Accept(w, r, nil)
+	if err != nil {
+		s.logf("websocket accept: %v", err)
+		return
+	}
+	ws.SetReadLimit(maxBridgeLineSize)
+
+	s.serveConn(websocket.NetConn(
+		context.Background(), ws, websocket.MessageText,
+	), true)
+}
+
+// validate checks that the server can authenticate clients.
+func (s *BridgeServer) validate() error {
+	if s.Token == "" {
+		return &ErrInvalidConfiguration{
+			Field:  "BridgeServer.Token",
+			Reason: "token must be specified",
+		}
+	}
+	return nil
+}
+
+// checkToken compares token with the server's in constant time.
+func (s *BridgeServer) checkToken(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
+
+// logf writes a line to the error log, if any.
+func (s *BridgeServer) logf(format string, args ...any) {
+	if s.ErrorLog != nil {
+		fmt.Fprintf(s.ErrorLog, "claude-bridge: "+format+"\n", args...)
+	}
+}
+
+// newRunner returns the runner for a new CLI.
+func (s *BridgeServer) newRunner() (SubprocessRunner, error) {
+	if s.NewRunner != nil {
+		return s.NewRunner(), nil
+	}
+
+	cliPath, err := DiscoverCLIPath(&Options{CLIPath: s.CLIPath})
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalSubprocessRunner(cliPath), nil
+}
+
+// serveConn runs one bridge session. authenticated is true if the client
+// already presented the token, as WebSocket clients do.
+func (s *BridgeServer) serveConn(conn net.Conn, authenticated bool) {
+	defer conn.Close()
+
+	timeout := s.HandshakeTimeout
+	if timeout <= 0 {
+		timeout = DefaultBridgeHandshakeTimeout
+	}
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	reject := func(reason string) {
+		s.logf("%v: rejected: %s", conn.RemoteAddr(), reason)
+		_ = writeBridgeLine(conn, bridgeEvent{
+			Type:  bridgeTypeError,
+			Error: reason,
+		})
+	}
+
+	scanner := newLineScanner(conn)
+	if !scanner.Scan() {
+		s.logf("%v: no hello: %v", conn.RemoteAddr(), scanner.Err())
+		return
+	}
+
+	var hello bridgeHello
+	err := json.Unmarshal(scanner.Bytes(), &hello)
+	switch {
+	case err != nil || hello.Type != bridgeTypeHello:
+		reject("expected " + bridgeTypeHello)
+		return
+
+	case !authenticated && !s.checkToken(hello.Token):
+		reject("invalid token")
+		return
+	}
+
+	runner, err := s.newRunner()
+	if err != nil {
+		reject(err.Error())
+		return
+	}
+
+	cwd := hello.Cwd
+	if cwd == "" {
+		cwd = s.Cwd
+	}
+
+	// The bridge's own environment may hold its token and other
+	// secrets, so only the allowed variables are passed on.
+	pass := s.PassEnv
+	if pass == nil {
+		pass = DefaultIsolationPassEnv
+	}
+	env := append(hostEnv(pass), hello.Env...)
+
+	// The runner outlives the handshake; Kill stops it.
+	stdin, stdout, stderr, err := runner.Start(
+		context.Background(), hello.Args, env, cwd,
+	)
+	if err != nil {
+		reject(err.Error())
+		return
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	session := &bridgeSession{
+		server: s,
+		conn:   conn,
+		runner: runner,
+	}
+	if err := session.send(bridgeEvent{Type: bridgeTypeReady}); err != nil {
+		_ = runner.Kill()
+		return
+	}
+
+	session.run(scanner, stdin, stdout, stderr)
+}
+
+// bridgeSession relays between one connection and its CLI.
+type bridgeSession struct {
+	server *BridgeServer
+	conn   net.Conn
+	runner SubprocessRunner
+
+	// writeMu serializes writes to conn from the stdout and stderr
+	// relays.
+	writeMu sync.Mutex
+}
+
+// send writes a bridge protocol line to the client.
+func (b *bridgeSession) send(event bridgeEvent) error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+	return writeBridgeLine(b.conn, event)
+}
+
+// run relays until the CLI exits, then reports its exit status.
+func (b *bridgeSession) run(scanner *bufio.Scanner, stdin io.WriteCloser,
+	stdout, stderr io.ReadCloser) {
+
+	exited := make(chan struct{})
+	go b.relayInput(scanner, stdin, exited)
+
+	stderrDone := make(chan struct{})
+	go func() {
+		defer close(stderrDone)
+
+		lines := newLineScanner(stderr)
+		for lines.Scan() {
+			_ = b.send(bridgeEvent{
+				Type: bridgeTypeStderr,
+				Line: lines.Text(),
+			})
+		}
+	}()
+
+	// Relay stdout lines verbatim until the CLI closes it.
+	lines := newLineScanner(stdout)
+	for lines.Scan() {
+		b.writeMu.Lock()
+		_, err := b.conn.Write(withNewline(lines.Bytes()))
+		b.writeMu.Unlock()
+		if err != nil {
+			break
+		}
+	}
+
+	// Drain stderr before reaping the process: Wait closes the pipes, which
+	// would cut off the final lines.
+	select {
+	case <-stderrDone:
+	case <-time.After(stderrDrainTimeout):
+	}
+
+	exitErr := b.runner.Wait()
+	close(exited)
+
+	event := bridgeEvent{Type: bridgeTypeExit}
+	if exitErr != nil {
+		event.Error = exitErr.Error()
+		event.ExitCode = -1
+
+		var coded interface{ ExitCode() int }
+		if errors.As(exitErr, &coded) {
+			event.ExitCode = coded.ExitCode()
+		}
+	}
+	_ = b.send(event)
+}
+
+// relayInput copies client lines to the CLI's stdin. When the client
+// disconnects, stdin is closed and the CLI is killed if it doesn't exit
+// within bridgeKillTimeout.
+func (b *bridgeSession) relayInput(scanner *bufio.Scanner,
+	stdin io.WriteCloser, exited <-chan struct{}) {
+
+	defer stdin.Close()
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if isBridgeLine(line) {
+			var event bridgeEvent
+			if err := json.Unmarshal(line, &event); err == nil &&
+				event.Type == bridgeTypeEndInput {
+
+				stdin.Close()
+			}
+			continue
+		}
+
+		if _, err := stdin.Write(withNewline(line)); err != nil {
+			break
+		}
+	}
+
+	// Either the client went away or the CLI exited and run closed the
+	// connection.
+	stdin.Close()
+	select {
+	case <-exited:
+	case <-time.After(bridgeKillTimeout):
+		b.server.logf("%v: killing CLI after disconnect",
+			b.conn.RemoteAddr())
+		_ = b.runner.Kill()
+	}
+}
@@ -0,0 +1,265 @@
+package claudeagent
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBudgetWarnAt is the fraction of a budget at which BudgetGuard warns
+// when BudgetLimits.WarnAt is nil.
+const DefaultBudgetWarnAt = 0.8
+
+// budgetInterruptTimeout bounds the interrupt sent to a client whose turn is
+// running when its budget runs out.
+const budgetInterruptTimeout = 10 * time.Second
+
+// BudgetLimits are the caps a BudgetGuard enforces. A zero limit is not
+// enforced.
+type BudgetLimits struct {
+	// MaxCostUSD caps the cost of all turns, in US dollars.
+	MaxCostUSD float64
+
+	// MaxTokens caps the tokens used by all turns: input, output, cache
+	// read and cache creation tokens combined.
+	MaxTokens int
+
+	// WarnAt lists fractions of the limits, such as 0.5 and 0.9, at which
+	// OnWarning is called and a warning is logged. Each is reported once,
+	// when the cost or tokens first reach it. Defaults to
+	// DefaultBudgetWarnAt.
+	WarnAt []float64
+
+	// OnWarning, if set, is called when usage reaches a WarnAt threshold.
+	// It is called from the client's message pump and must not block.
+	OnWarning func(BudgetWarning)
+}
+
+// BudgetUsage is what the turns counted by a BudgetGuard have used.
+type BudgetUsage struct {
+	// CostUSD is the cost in US dollars.
+	CostUSD float64
+
+	// Tokens is the number of input, output and cache tokens.
+	Tokens int
+}
+
+// BudgetWarning reports that usage reached a WarnAt threshold.
+type BudgetWarning struct {
+	// Threshold is the WarnAt fraction reached.
+	Threshold float64
+
+	// Usage is the usage at the time.
+	Usage BudgetUsage
+}
+
+// BudgetGuard enforces cost and token caps across the turns of one or more
+// clients. Share a guard between clients, for example every client of a
+// Pool, to give them a common budget.
+//
+// The CLI reports the cost and tokens of a turn in its result, so the guard
+// counts each turn once it completes. Once a limit is reached, clients
+// refuse new turns with ErrBudgetExceeded and the turns still running on
+// other clients sharing the guard are interrupted. A turn that starts within
+// budget can therefore overshoot it; WithMaxBudgetUsd also limits the CLI
+// within a single query.
+//
+// Example:
+//
+//	guard := claudeagent.NewBudgetGuard(claudeagent.BudgetLimits{
+//	    MaxCostUSD: 25,
+//	    WarnAt:     []float64{0.5, 0.9},
+//	    OnWarning: func(w claudeagent.BudgetWarning) {
+//	        log.Printf("customer at %.0f%% of budget", w.Threshold*100)
+//	    },
+//	})
+//	client, _ := claudeagent.NewClient(claudeagent.WithBudgetGuard(guard))
+//
+//	for msg, err := range client.QueryWithErrors(ctx, prompt) {
+//	    var exceeded *claudeagent.ErrBudgetExceeded
+//	    if errors.As(err, &exceeded) {
+//	        // Out of budget.
+//	    }
+//	}
+type BudgetGuard struct {
+	limits BudgetLimits
+
+	mu    sync.Mutex
+	usage BudgetUsage
+
+	// warned is the number of WarnAt thresholds reported so far.
+	warned int
+
+	// clients are the connected clients using the guard, interrupted when
+	// the budget runs out.
+	clients map[*Client]struct{}
+}
+
+// NewBudgetGuard creates a guard that enforces limits.
+func NewBudgetGuard(limits BudgetLimits) *BudgetGuard {
+	warnAt := limits.WarnAt
+	if warnAt == nil {
+		warnAt = []float64{DefaultBudgetWarnAt}
+	}
+	limits.WarnAt = append([]float64(nil), warnAt...)
+	sort.Float64s(limits.WarnAt)
+
+	return &BudgetGuard{
+		limits:  limits,
+		clients: make(map[*Client]struct{}),
+	}
+}
+
+// Usage returns what the counted turns have used so far.
+func (g *BudgetGuard) Usage() BudgetUsage {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.usage
+}
+
+// Err returns an ErrBudgetExceeded if a limit has been reached, and nil
+// otherwise. It is safe to call on a nil guard.
+func (g *BudgetGuard) Err() error {
+	if g == nil {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.exceeded()
+}
+
+// Reset clears the usage and warnings, for example at the start of a new
+// billing period. Turns are allowed again.
+func (g *BudgetGuard) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.usage = BudgetUsage{}
+	g.warned = 0
+}
+
+// exceeded returns an ErrBudgetExceeded for the first limit reached. The
+// caller must hold mu.
+func (g *BudgetGuard) exceeded() error {
+	limits := g.limits
+	if limits.MaxCostUSD > 0 && g.usage.CostUSD >= limits.MaxCostUSD {
+		return &ErrBudgetExceeded{
+			Limit: BudgetLimitCost,
+			Spent: g.usage.CostUSD,
+			Max:   limits.MaxCostUSD,
+		}
+	}
+	if limits.MaxTokens > 0 && g.usage.Tokens >= limits.MaxTokens {
+		return &ErrBudgetExceeded{
+			Limit: BudgetLimitTokens,
+			Spent: float64(g.usage.Tokens),
+			Max:   float64(limits.MaxTokens),
+		}
+	}
+	return nil
+}
+
+// fraction returns the largest fraction of a limit used. The caller must
+// hold mu.
+func (g *BudgetGuard) fraction() float64 {
+	var used float64
+	if g.limits.MaxCostUSD > 0 {
+		used = g.usage.CostUSD / g.limits.MaxCostUSD
+	}
+	if g.limits.MaxTokens > 0 {
+		used = max(used,
+			float64(g.usage.Tokens)/float64(g.limits.MaxTokens))
+	}
+	return used
+}
+
+// register adds c to the clients interrupted when the budget runs out.
+func (g *BudgetGuard) register(c *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.clients[c] = struct{}{}
+}
+
+// unregister removes c.
+func (g *BudgetGuard) unregister(c *Client) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.clients, c)
+}
+
+// charge counts a completed turn. If it reaches a WarnAt threshold, the
+// warning is logged and passed to OnWarning. If it uses up the budget, the
+// turns running on the guard's clients are interrupted.
+func (g *BudgetGuard) charge(log *slog.Logger, turn TurnMetrics) {
+	g.mu.Lock()
+	wasExceeded := g.exceeded() != nil
+
+	g.usage.CostUSD += turn.CostUSD
+	g.usage.Tokens += turn.Usage.InputTokens + turn.Usage.OutputTokens +
+		turn.Usage.CacheReadInputTokens +
+		turn.Usage.CacheCreationInputTokens
+
+	var warnings []BudgetWarning
+	used := g.fraction()
+	for ; g.warned < len(g.limits.WarnAt); g.warned++ {
+		threshold := g.limits.WarnAt[g.warned]
+		if used < threshold {
+			break
+		}
+		warnings = append(warnings, BudgetWarning{
+			Threshold: threshold,
+			Usage:     g.usage,
+		})
+	}
+
+	exceeded := g.exceeded()
+	var running []*Client
+	if exceeded != nil && !wasExceeded {
+		for c := range g.clients {
+			if c.router.busy() {
+				running = append(running, c)
+			}
+		}
+	}
+	g.mu.Unlock()
+
+	for _, w := range warnings {
+		log.Warn("Budget threshold reached", "threshold", w.Threshold,
+			"cost_usd", w.Usage.CostUSD, "tokens", w.Usage.Tokens)
+		if g.limits.OnWarning != nil {
+			g.limits.OnWarning(w)
+		}
+	}
+
+	if exceeded == nil || wasExceeded {
+		return
+	}
+	log.Warn("Budget exhausted, interrupting running turns",
+		"err", exceeded, "running", len(running))
+
+	// Interrupts are answered through the message pump that may be
+	// calling us, so they must not be waited for here.
+	for _, c := range running {
+		go c.interruptForBudget()
+	}
+}
+
+// interruptForBudget interrupts the client's running turn after its budget
+// ran out.
+func (c *Client) interruptForBudget() {
+	ctx, cancel := context.WithTimeout(
+		context.Background(), budgetInterruptTimeout,
+	)
+	defer cancel()
+
+	_, err := c.sendSDKControlRequest(ctx, SDKControlRequestBody{
+		Subtype: "interrupt",
+	})
+	if err != nil {
+		c.options.logger().Warn("Failed to interrupt turn over budget",
+			"err", err)
+	}
+}
@@ -0,0 +1,125 @@
+package claudeagent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestBudgetGuardWarnings verifies that each threshold is reported once and
+// that the guard reports the first limit reached.
+func TestBudgetGuardWarnings(t *testing.T) {
+	var warnings []float64
+	guard := NewBudgetGuard(BudgetLimits{
+		MaxCostUSD: 1,
+		MaxTokens:  1000,
+		WarnAt:     []float64{0.9, 0.5},
+		OnWarning: func(w BudgetWarning) {
+			warnings = append(warnings, w.Threshold)
+		},
+	})
+
+	guard.charge(discardLogger, TurnMetrics{CostUSD: 0.2})
+	assert.Empty(t, warnings)
+
+	// Tokens reach half the limit before the cost does.
+	guard.charge(discardLogger, TurnMetrics{
+		CostUSD: 0.1,
+		Usage:   NonNullableUsage{InputTokens: 400, OutputTokens: 200},
+	})
+	assert.Equal(t, []float64{0.5}, warnings)
+	require.NoError(t, guard.Err())
+
+	guard.charge(discardLogger, TurnMetrics{CostUSD: 0.7})
+	assert.Equal(t, []float64{0.5, 0.9}, warnings)
+	assert.Equal(t, BudgetUsage{CostUSD: 1, Tokens: 600}, guard.Usage())
+
+	var exceeded *ErrBudgetExceeded
+	require.ErrorAs(t, guard.Err(), &exceeded)
+	assert.Equal(t, BudgetLimitCost, exceeded.Limit)
+	assert.Equal(t, 1.0, exceeded.Max)
+
+	guard.Reset()
+	require.NoError(t, guard.Err())
+	assert.Equal(t, BudgetUsage{}, guard.Usage())
+}
+
+// TestClientBudgetExceeded verifies that a client whose turn uses up a
+// shared budget refuses further turns, and that the turn running on another
+// client sharing the budget is interrupted.
+func TestClientBudgetExceeded(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	guard := NewBudgetGuard(BudgetLimits{MaxCostUSD: 1})
+
+	// The other client works until it is interrupted.
+	otherTransport, otherServer := NewPipeTransport()
+	go servePipeInterruptible(ctx, otherServer, nil)
+
+	other, err := NewClient(
+		WithTransport(otherTransport), WithBudgetGuard(guard),
+	)
+	require.NoError(t, err)
+	defer other.Close()
+	require.NoError(t, other.Connect(ctx))
+
+	interrupted := make(chan []Message)
+	go func() {
+		interrupted <- collectQuery(t, other, "work")
+	}()
+	require.Eventually(t, other.router.busy, time.Second,
+		5*time.Millisecond)
+
+	transport, server := NewPipeTransport()
+	go func() {
+		for msg, err := range server.Messages(ctx) {
+			if err != nil {
+				continue
+			}
+
+			switch m := msg.(type) {
+			case SDKControlRequest:
+				_ = server.RespondControl(ctx, m.RequestID, nil)
+
+			case UserMessage:
+				_ = server.Write(ctx, ResultMessage{
+					Type:         "result",
+					Subtype:      "success",
+					SessionID:    "sess_pipe",
+					TotalCostUSD: 1.5,
+				})
+			}
+		}
+	}()
+
+	client, err := NewClient(
+		WithTransport(transport), WithBudgetGuard(guard),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	for _, err := range client.QueryWithErrors(ctx, "spend") {
+		require.NoError(t, err)
+	}
+
+	select {
+	case msgs := <-interrupted:
+		result, ok := msgs[len(msgs)-1].(ResultMessage)
+		require.True(t, ok)
+		assert.Equal(t, "interrupted", result.Result)
+	case <-ctx.Done():
+		t.Fatal("turn over budget not interrupted")
+	}
+
+	var refused error
+	for _, err := range client.QueryWithErrors(ctx, "more") {
+		refused = err
+	}
+	var exceeded *ErrBudgetExceeded
+	require.ErrorAs(t, refused, &exceeded)
+	assert.Equal(t, 1.5, exceeded.Spent)
+}
@@ -0,0 +1,248 @@
+// Package claudeagentprom exports the measurements of claudeagent clients as
+// Prometheus metrics.
+//
+// A Collector implements both claudeagent.Metrics and prometheus.Collector.
+// Register it once and share it between every client in the process:
+//
+//	collector := claudeagentprom.NewCollector(claudeagentprom.Opts{})
+//	prometheus.MustRegister(collector)
+//
+//	client, _ := claudeagent.NewClient(
+//	    claudeagent.WithMetrics(collector),
+//	)
+package claudeagentprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	claudeagent "github.com/roasbeef/claude-agent-sdk-go"
+)
+
+// DefaultNamespace prefixes metric names when Opts.Namespace is empty.
+const DefaultNamespace = "claude_agent"
+
+// Opts configures a Collector.
+type Opts struct {
+	// Namespace prefixes every metric name. Defaults to DefaultNamespace.
+	Namespace string
+
+	// ConstLabels are added to every metric, for example to identify the
+	// application.
+	ConstLabels prometheus.Labels
+
+	// LatencyBuckets are the histogram buckets, in seconds, for turn, tool
+	// and hook durations. Defaults to prometheus.ExponentialBuckets(0.05,
+	// 2, 14), from 50ms to about 7 minutes.
+	LatencyBuckets []float64
+}
+
+// Collector records claudeagent.Metrics as Prometheus metrics. It is safe for
+// concurrent use.
+type Collector struct {
+	turns        *prometheus.CounterVec
+	turnDuration *prometheus.HistogramVec
+	turnCost     prometheus.Counter
+
+	tokens      *prometheus.CounterVec
+	modelCost   *prometheus.CounterVec
+	webSearches *prometheus.CounterVec
+
+	apiRetries     *prometheus.CounterVec
+	rateLimits     *prometheus.CounterVec
+	rateLimitUsage *prometheus.GaugeVec
+
+	toolDuration *prometheus.HistogramVec
+	hookDuration *prometheus.HistogramVec
+	permissions  *prometheus.CounterVec
+
+	// collectors holds every metric above for Describe and Collect.
+	collectors []prometheus.Collector
+}
+
+// Compile-time checks that Collector implements both interfaces.
+var (
+	_ claudeagent.Metrics  = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// NewCollector creates a Collector. It must be registered with a
+// prometheus.Registerer to be scraped.
+func NewCollector(opts Opts) *Collector {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	if opts.LatencyBuckets == nil {
+		opts.LatencyBuckets = prometheus.ExponentialBuckets(0.05, 2, 14)
+	}
+
+	counter := func(name, help string,
+		labels ...string) *prometheus.CounterVec {
+
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+		}, labels)
+	}
+	histogram := func(name, help string,
+		labels ...string) *prometheus.HistogramVec {
+
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   opts.Namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: opts.ConstLabels,
+			Buckets:     opts.LatencyBuckets,
+		}, labels)
+	}
+
+	c := &Collector{
+		turns: counter("turns_total",
+			"Completed turns by result subtype.",
+			"subtype", "error"),
+		turnDuration: histogram("turn_duration_seconds",
+			"Wall clock duration of turns as reported by the CLI.",
+			"subtype"),
+		turnCost: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   opts.Namespace,
+			Name:        "cost_usd_total",
+			Help:        "Cost of all turns in US dollars.",
+			ConstLabels: opts.ConstLabels,
+		}),
+		tokens: counter("model_tokens_total",
+			"Tokens used per model by type: input, output, "+
+				"cache_read or cache_creation.",
+			"model", "type"),
+		modelCost: counter("model_cost_usd_total",
+			"Cost per model in US dollars.", "model"),
+		webSearches: counter("model_web_search_requests_total",
+			"Web search requests per model.", "model"),
+		apiRetries: counter("api_retries_total",
+			"API requests retried by the CLI by error category.",
+			"error"),
+		rateLimits: counter("rate_limit_events_total",
+			"Rate limit events by limit type and status.",
+			"type", "status"),
+		rateLimitUsage: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: opts.Namespace,
+			Name:      "rate_limit_utilization_ratio",
+			Help: "Last reported utilization of each rate limit, " +
+				"from 0 to 1.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{"type"}),
+		toolDuration: histogram("tool_duration_seconds",
+			"Time from a tool use to its result.",
+			"tool", "error"),
+		hookDuration: histogram("hook_duration_seconds",
+			"Time taken by hook callbacks.", "event", "error"),
+		permissions: counter("permission_decisions_total",
+			"Tool permission requests by decision: allow or deny.",
+			"tool", "decision"),
+	}
+	c.collectors = []prometheus.Collector{
+		c.turns, c.turnDuration, c.turnCost, c.tokens, c.modelCost,
+		c.webSearches, c.apiRetries, c.rateLimits, c.rateLimitUsage,
+		c.toolDuration, c.hookDuration, c.permissions,
+	}
+
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors {
+		collector.Collect(ch)
+	}
+}
+
+// TurnCompleted implements claudeagent.Metrics.
+func (c *Collector) TurnCompleted(turn claudeagent.TurnMetrics) {
+	c.turns.WithLabelValues(
+		turn.Subtype, strconv.FormatBool(turn.IsError),
+	).Inc()
+	c.turnDuration.WithLabelValues(turn.Subtype).Observe(
+		turn.Duration.Seconds(),
+	)
+	if turn.CostUSD > 0 {
+		c.turnCost.Add(turn.CostUSD)
+	}
+}
+
+// ModelUsage implements claudeagent.Metrics.
+func (c *Collector) ModelUsage(model string, usage claudeagent.ModelUsage) {
+	tokens := map[string]int{
+		"input":          usage.InputTokens,
+		"output":         usage.OutputTokens,
+		"cache_read":     usage.CacheReadInputTokens,
+		"cache_creation": usage.CacheCreationInputTokens,
+	}
+	for kind, n := range tokens {
+		if n > 0 {
+			c.tokens.WithLabelValues(model, kind).Add(float64(n))
+		}
+	}
+	if usage.CostUSD > 0 {
+		c.modelCost.WithLabelValues(model).Add(usage.CostUSD)
+	}
+	if usage.WebSearchRequests > 0 {
+		c.webSearches.WithLabelValues(model).Add(
+			float64(usage.WebSearchRequests),
+		)
+	}
+}
+
+// APIRetry implements claudeagent.Metrics.
+func (c *Collector) APIRetry(msg claudeagent.APIRetryMessage) {
+	c.apiRetries.WithLabelValues(string(msg.Error)).Inc()
+}
+
+// RateLimit implements claudeagent.Metrics.
+func (c *Collector) RateLimit(info claudeagent.RateLimitInfo) {
+	limit := "unknown"
+	if info.RateLimitType != nil {
+		limit = string(*info.RateLimitType)
+	}
+
+	c.rateLimits.WithLabelValues(limit, string(info.Status)).Inc()
+	if info.Utilization != nil {
+		c.rateLimitUsage.WithLabelValues(limit).Set(*info.Utilization)
+	}
+}
+
+// ToolCompleted implements claudeagent.Metrics.
+func (c *Collector) ToolCompleted(tool string, latency time.Duration,
+	isError bool) {
+
+	c.toolDuration.WithLabelValues(
+		tool, strconv.FormatBool(isError),
+	).Observe(latency.Seconds())
+}
+
+// HookCompleted implements claudeagent.Metrics.
+func (c *Collector) HookCompleted(event string, latency time.Duration,
+	failed bool) {
+
+	c.hookDuration.WithLabelValues(
+		event, strconv.FormatBool(failed),
+	).Observe(latency.Seconds())
+}
+
+// PermissionDecision implements claudeagent.Metrics.
+func (c *Collector) PermissionDecision(tool string, allowed bool) {
+	decision := "deny"
+	if allowed {
+		decision = "allow"
+	}
+	c.permissions.WithLabelValues(tool, decision).Inc()
+}
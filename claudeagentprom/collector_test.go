@@ -0,0 +1,88 @@
+package claudeagentprom
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	claudeagent "github.com/roasbeef/claude-agent-sdk-go"
+)
+
+// TestCollector verifies that measurements are exported under the expected
+// names and labels.
+func TestCollector(t *testing.T) {
+	c := NewCollector(Opts{
+		ConstLabels: prometheus.Labels{"app": "test"},
+	})
+	registry := prometheus.NewPedanticRegistry()
+	require.NoError(t, registry.Register(c))
+
+	c.TurnCompleted(claudeagent.TurnMetrics{
+		Subtype:  "success",
+		Duration: 2 * time.Second,
+		CostUSD:  0.5,
+	})
+	c.ModelUsage("claude-sonnet", claudeagent.ModelUsage{
+		InputTokens:  100,
+		OutputTokens: 40,
+		CostUSD:      0.5,
+	})
+	c.ModelUsage("claude-sonnet", claudeagent.ModelUsage{
+		InputTokens: 50,
+	})
+	c.APIRetry(claudeagent.APIRetryMessage{
+		Error: claudeagent.APIRetryErrorRateLimit,
+	})
+
+	limit := claudeagent.RateLimitTypeFiveHour
+	utilization := 0.9
+	c.RateLimit(claudeagent.RateLimitInfo{
+		Status:        claudeagent.RateLimitStatusAllowedWarning,
+		RateLimitType: &limit,
+		Utilization:   &utilization,
+	})
+	c.ToolCompleted("Bash", 300*time.Millisecond, false)
+	c.HookCompleted("PreToolUse", 10*time.Millisecond, false)
+	c.PermissionDecision("Bash", true)
+	c.PermissionDecision("Write", false)
+
+	assert.Equal(t, 0.5, testutil.ToFloat64(c.turnCost))
+	assert.Equal(t, 150.0, testutil.ToFloat64(
+		c.tokens.WithLabelValues("claude-sonnet", "input"),
+	))
+	assert.Equal(t, 40.0, testutil.ToFloat64(
+		c.tokens.WithLabelValues("claude-sonnet", "output"),
+	))
+	assert.Equal(t, 1.0, testutil.ToFloat64(
+		c.apiRetries.WithLabelValues("rate_limit"),
+	))
+	assert.Equal(t, 0.9, testutil.ToFloat64(
+		c.rateLimitUsage.WithLabelValues("five_hour"),
+	))
+
+	expected := `
+# HELP claude_agent_permission_decisions_total Tool permission requests by decision: allow or deny.
+# TYPE claude_agent_permission_decisions_total counter
+claude_agent_permission_decisions_total{app="test",decision="allow",tool="Bash"} 1
+claude_agent_permission_decisions_total{app="test",decision="deny",tool="Write"} 1
+# HELP claude_agent_turns_total Completed turns by result subtype.
+# TYPE claude_agent_turns_total counter
+claude_agent_turns_total{app="test",error="false",subtype="success"} 1
+`
+	require.NoError(t, testutil.GatherAndCompare(
+		registry, strings.NewReader(expected),
+		"claude_agent_permission_decisions_total",
+		"claude_agent_turns_total",
+	))
+
+	count, err := testutil.GatherAndCount(registry,
+		"claude_agent_tool_duration_seconds",
+		"claude_agent_hook_duration_seconds")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
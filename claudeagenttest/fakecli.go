@@ -0,0 +1,810 @@
+// Package claudeagenttest provides an in-process fake of the Claude Code CLI
+// for testing code built on the claudeagent SDK.
+//
+// A FakeCLI implements claudeagent.Transport and speaks the stream-json
+// control protocol described in docs/cli-protocol.md. It answers initialize,
+// emits a system init message per turn, and follows a Script to produce
+// assistant messages, tool calls, permission requests, hook callbacks and
+// in-process MCP tool calls, finishing each turn with a ResultMessage. This
+// allows permission callbacks, hooks and MCP tools to be exercised without a
+// live model.
+//
+// Example:
+//
+//	script := claudeagenttest.NewScript()
+//	script.WhenUserSays("clean up").
+//	    CallTool("Bash", map[string]any{"command": "rm -rf /"}).
+//	    ExpectDenied().
+//	    Reply("I was not allowed to do that.")
+//
+//	fake := claudeagenttest.NewFakeCLI(script)
+//	client, _ := claudeagent.NewClient(
+//	    claudeagent.WithTransport(fake),
+//	    claudeagent.WithCanUseTool(myPolicy),
+//	)
+//	for msg := range client.Query(ctx, "clean up") {
+//	    // ...
+//	}
+//	if err := fake.Err(); err != nil {
+//	    t.Fatal(err)
+//	}
+package claudeagenttest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"iter"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	claudeagent "github.com/roasbeef/claude-agent-sdk-go"
+)
+
+// requestTimeout bounds how long the fake waits for the SDK to answer a
+// control request before recording a failure.
+const requestTimeout = 10 * time.Second
+
+// FakeCLI is an in-process claudeagent.Transport driven by a Script.
+type FakeCLI struct {
+	script *Script
+
+	out  chan claudeagent.Message
+	done chan struct{}
+
+	// endedCh is closed once the message stream has ended after
+	// EndInput. out is never closed, so late emits cannot panic.
+	endedCh chan struct{}
+
+	// turnMu serializes turns so their messages do not interleave.
+	turnMu sync.Mutex
+	turns  sync.WaitGroup
+
+	mu              sync.Mutex
+	connected       bool
+	closed          bool
+	ended           bool
+	used            []bool
+	hooks           map[string][]claudeagent.SDKHookCallbackMatcher
+	mcpServers      map[string]bool
+	pending         map[string]chan claudeagent.SDKControlResponse
+	nextRequestID   int
+	nextToolUseID   int
+	prompts         []string
+	controlRequests []claudeagent.SDKControlRequest
+	toolCalls       []ToolCall
+	failures        []error
+
+	closeOnce sync.Once
+}
+
+// Compile-time check that FakeCLI implements Transport.
+var _ claudeagent.Transport = (*FakeCLI)(nil)
+
+// NewFakeCLI creates a fake CLI that follows script.
+func NewFakeCLI(script *Script) *FakeCLI {
+	return &FakeCLI{
+		script:     script,
+		out:        make(chan claudeagent.Message, 64),
+		done:       make(chan struct{}),
+		endedCh:    make(chan struct{}),
+		used:       make([]bool, len(script.turns)),
+		hooks:      make(map[string][]claudeagent.SDKHookCallbackMatcher),
+		mcpServers: make(map[string]bool),
+		pending:    make(map[string]chan claudeagent.SDKControlResponse),
+	}
+}
+
+// Connect marks the fake ready.
+func (f *FakeCLI) Connect(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &claudeagent.ErrTransportClosed{}
+	}
+	f.connected = true
+	return nil
+}
+
+// Write handles a message sent by the SDK. Once EndInput is called, only
+// control responses for running turns are accepted, and nothing is once the
+// message stream has ended.
+func (f *FakeCLI) Write(ctx context.Context, msg claudeagent.Message) error {
+	f.mu.Lock()
+	closed, ended := f.closed, f.ended
+	f.mu.Unlock()
+	if closed || f.streamEnded() {
+		return &claudeagent.ErrTransportClosed{}
+	}
+	if ended && msg.MessageType() != "control_response" {
+		return &claudeagent.ErrTransportClosed{}
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	switch msg.MessageType() {
+	case "control_request":
+		var req claudeagent.SDKControlRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			return err
+		}
+		return f.handleControlRequest(req)
+
+	case "control_response":
+		var resp claudeagent.SDKControlResponse
+		if err := json.Unmarshal(data, &resp); err != nil {
+			return err
+		}
+		f.deliverResponse(resp)
+		return nil
+
+	case "user":
+		var user claudeagent.UserMessage
+		if err := json.Unmarshal(data, &user); err != nil {
+			return err
+		}
+		return f.startTurn(promptText(user))
+	}
+
+	return nil
+}
+
+// ReadMessages yields the messages the fake emits. The iterator ends when
+// the fake is closed, or after EndInput once all running turns complete.
+func (f *FakeCLI) ReadMessages(ctx context.Context) iter.Seq2[claudeagent.Message, error] {
+	return func(yield func(claudeagent.Message, error) bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-f.done:
+				return
+			case msg := <-f.out:
+				if !yield(msg, nil) {
+					return
+				}
+			case <-f.endedCh:
+				f.drain(yield)
+				return
+			}
+		}
+	}
+}
+
+// drain yields the messages emitted before the stream ended.
+func (f *FakeCLI) drain(yield func(claudeagent.Message, error) bool) {
+	for {
+		select {
+		case msg := <-f.out:
+			if !yield(msg, nil) {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// streamEnded reports whether the message stream ended after EndInput.
+func (f *FakeCLI) streamEnded() bool {
+	select {
+	case <-f.endedCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// EndInput stops accepting prompts. The message stream ends once every
+// running turn has finished, mirroring the CLI exiting on stdin EOF.
+func (f *FakeCLI) EndInput() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.ended {
+		return nil
+	}
+	f.ended = true
+
+	go func() {
+		f.turns.Wait()
+		close(f.endedCh)
+	}()
+	return nil
+}
+
+// Close stops the fake and unblocks any pending reads.
+func (f *FakeCLI) Close() error {
+	f.closeOnce.Do(func() {
+		f.mu.Lock()
+		f.closed = true
+		f.mu.Unlock()
+		close(f.done)
+	})
+	return nil
+}
+
+// IsReady reports whether the fake is connected and not closed.
+func (f *FakeCLI) IsReady() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.connected && !f.closed
+}
+
+// Prompts returns the user prompts received so far.
+func (f *FakeCLI) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.prompts...)
+}
+
+// ControlRequests returns the control requests the SDK sent to the fake,
+// including initialize.
+func (f *FakeCLI) ControlRequests() []claudeagent.SDKControlRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]claudeagent.SDKControlRequest(nil), f.controlRequests...)
+}
+
+// ToolCalls returns the outcome of every scripted tool call so far.
+func (f *FakeCLI) ToolCalls() []ToolCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]ToolCall(nil), f.toolCalls...)
+}
+
+// Err returns every failed expectation, unmatched prompt and unused turn,
+// joined into a single error. It returns nil if the script ran as written.
+func (f *FakeCLI) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	errs := append([]error(nil), f.failures...)
+	for i, used := range f.used {
+		if !used {
+			errs = append(errs, fmt.Errorf("turn %d never ran", i+1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleControlRequest answers a control request sent by the SDK.
+func (f *FakeCLI) handleControlRequest(req claudeagent.SDKControlRequest) error {
+	f.mu.Lock()
+	f.controlRequests = append(f.controlRequests, req)
+
+	response := map[string]interface{}{}
+	if req.Request.Subtype == "initialize" {
+		for event, matchers := range req.Request.Hooks {
+			f.hooks[event] = matchers
+		}
+		for _, name := range req.Request.SDKMCPServers {
+			f.mcpServers[name] = true
+		}
+		response = map[string]interface{}{
+			"commands":                []interface{}{},
+			"agents":                  []interface{}{},
+			"output_style":            "default",
+			"available_output_styles": []string{"default"},
+			"models":                  []interface{}{},
+			"account":                 map[string]interface{}{},
+		}
+	}
+	f.mu.Unlock()
+
+	f.emit(claudeagent.SDKControlResponse{
+		Type: "control_response",
+		Response: claudeagent.SDKControlResponseBody{
+			Subtype:   "success",
+			RequestID: req.RequestID,
+			Response:  response,
+		},
+	})
+	return nil
+}
+
+// deliverResponse routes a control response to the waiting request.
+func (f *FakeCLI) deliverResponse(resp claudeagent.SDKControlResponse) {
+	f.mu.Lock()
+	ch, ok := f.pending[resp.Response.RequestID]
+	delete(f.pending, resp.Response.RequestID)
+	f.mu.Unlock()
+
+	if ok {
+		ch <- resp
+	}
+}
+
+// startTurn runs the first unused turn that matches prompt.
+func (f *FakeCLI) startTurn(prompt string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.ended {
+		return &claudeagent.ErrTransportClosed{}
+	}
+	f.prompts = append(f.prompts, prompt)
+
+	index := -1
+	for i, turn := range f.script.turns {
+		if !f.used[i] && turn.match(prompt) {
+			index = i
+			break
+		}
+	}
+
+	var turn *Turn
+	if index >= 0 {
+		f.used[index] = true
+		turn = f.script.turns[index]
+	} else {
+		err := fmt.Errorf("no scripted turn for prompt %q", prompt)
+		f.failures = append(f.failures, err)
+		turn = &Turn{
+			resultSubtype: "error_during_execution",
+			resultErrors:  []string{err.Error()},
+		}
+	}
+
+	f.turns.Add(1)
+	go f.runTurn(index+1, turn)
+	return nil
+}
+
+// runTurn plays a turn's steps and finishes with a result message.
+func (f *FakeCLI) runTurn(num int, turn *Turn) {
+	defer f.turns.Done()
+
+	f.turnMu.Lock()
+	defer f.turnMu.Unlock()
+
+	if !f.emit(f.systemInit()) {
+		return
+	}
+
+	var (
+		lastText string
+		denials  []claudeagent.PermissionDenial
+	)
+	for _, s := range turn.steps {
+		switch s.kind {
+		case stepReply:
+			lastText = s.text
+			msg := f.assistant(claudeagent.ContentBlock{
+				Type: "text",
+				Text: s.text,
+			})
+			if !f.emit(msg) {
+				return
+			}
+
+		case stepToolCall:
+			call, ok := f.runToolCall(num, s)
+			if !ok {
+				return
+			}
+			if call.Behavior == "deny" {
+				denials = append(denials, claudeagent.PermissionDenial{
+					ToolName:  call.Name,
+					ToolInput: call.Input,
+					Reason:    call.Message,
+				})
+			}
+
+		case stepHook:
+			f.fireHooks(num, s.hookEvent, "", "", s.hookInput)
+		}
+	}
+
+	result := claudeagent.ResultMessage{
+		Type:              "result",
+		Status:            "success",
+		Subtype:           "success",
+		SessionID:         f.script.sessionID,
+		Result:            lastText,
+		NumTurns:          1,
+		PermissionDenials: denials,
+	}
+	if turn.resultSubtype != "" {
+		result.Status = "error"
+		result.Subtype = turn.resultSubtype
+		result.Result = ""
+		result.Errors = turn.resultErrors
+		result.IsError = true
+	}
+	f.emit(result)
+}
+
+// runToolCall emits a tool_use block and drives hooks, permission and MCP
+// execution for it. It returns false if the fake was closed.
+func (f *FakeCLI) runToolCall(num int, s step) (ToolCall, bool) {
+	f.mu.Lock()
+	f.nextToolUseID++
+	toolUseID := fmt.Sprintf("toolu_fake_%d", f.nextToolUseID)
+	f.mu.Unlock()
+
+	input := s.toolInput
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		f.fail(fmt.Errorf("turn %d: tool %s: %w", num, s.toolName, err))
+		return ToolCall{}, true
+	}
+
+	call := ToolCall{
+		ToolUseID: toolUseID,
+		Name:      s.toolName,
+		Input:     inputJSON,
+	}
+
+	msg := f.assistant(claudeagent.ContentBlock{
+		Type:  "tool_use",
+		ID:    toolUseID,
+		Name:  s.toolName,
+		Input: inputJSON,
+	})
+	if !f.emit(msg) {
+		return call, false
+	}
+
+	hookInput := map[string]interface{}{
+		"tool_name":   s.toolName,
+		"tool_input":  input,
+		"tool_use_id": toolUseID,
+	}
+	pre := f.fireHooks(
+		num, claudeagent.HookTypePreToolUse, s.toolName, toolUseID,
+		hookInput,
+	)
+
+	decision, updated := preToolUseDecision(pre)
+	switch decision {
+	case "deny":
+		call.Behavior = "deny"
+		call.BlockedByHook = true
+
+	case "allow":
+		call.Behavior = "allow"
+		call.UpdatedInput = updated
+
+	default:
+		resp, ok := f.request(claudeagent.SDKControlRequestBody{
+			Subtype:   "can_use_tool",
+			ToolName:  s.toolName,
+			Input:     input,
+			ToolUseID: toolUseID,
+		})
+		switch {
+		case !ok:
+			return call, false
+
+		case resp.Response.Subtype == "error":
+			f.fail(fmt.Errorf("turn %d: tool %s: permission request "+
+				"failed: %s", num, s.toolName, resp.Response.Error))
+			call.Behavior = "deny"
+			call.Message = resp.Response.Error
+
+		default:
+			body := resp.Response.Response
+			call.Behavior, _ = body["behavior"].(string)
+			call.Message, _ = body["message"].(string)
+			call.UpdatedInput, _ = body["updatedInput"].(map[string]interface{})
+		}
+	}
+
+	if s.expect != "" && s.expect != call.Behavior {
+		f.fail(fmt.Errorf("turn %d: tool %s: expected permission %q, "+
+			"got %q", num, s.toolName, s.expect, call.Behavior))
+	}
+
+	if call.Behavior == "allow" {
+		if call.UpdatedInput != nil {
+			input = call.UpdatedInput
+		}
+		if server, tool, ok := f.mcpTarget(s.toolName); ok {
+			call.McpResult = f.callMcpTool(num, server, tool, input)
+		}
+
+		toolResponse := interface{}(map[string]interface{}{})
+		if call.McpResult != nil {
+			toolResponse = call.McpResult
+		}
+		hookInput["tool_input"] = input
+		hookInput["tool_response"] = toolResponse
+		f.fireHooks(
+			num, claudeagent.HookTypePostToolUse, s.toolName, toolUseID,
+			hookInput,
+		)
+	}
+
+	f.mu.Lock()
+	f.toolCalls = append(f.toolCalls, call)
+	f.mu.Unlock()
+
+	return call, true
+}
+
+// mcpTarget splits an mcp__<server>__<tool> name and reports whether the
+// server is an in-process SDK server.
+func (f *FakeCLI) mcpTarget(name string) (string, string, bool) {
+	parts := strings.SplitN(name, "__", 3)
+	if len(parts) != 3 || parts[0] != "mcp" {
+		return "", "", false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return parts[1], parts[2], f.mcpServers[parts[1]]
+}
+
+// callMcpTool routes a tools/call JSON-RPC message to an SDK MCP server and
+// returns the JSON-RPC result.
+func (f *FakeCLI) callMcpTool(num int, server, tool string,
+	input map[string]interface{}) map[string]interface{} {
+
+	f.mu.Lock()
+	f.nextRequestID++
+	id := f.nextRequestID
+	f.mu.Unlock()
+
+	resp, ok := f.request(claudeagent.SDKControlRequestBody{
+		Subtype:    "mcp_message",
+		ServerName: server,
+		Message: map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"method":  "tools/call",
+			"params": map[string]interface{}{
+				"name":      tool,
+				"arguments": input,
+			},
+		},
+	})
+	if !ok {
+		return nil
+	}
+	if resp.Response.Subtype == "error" {
+		f.fail(fmt.Errorf("turn %d: mcp tool %s/%s failed: %s",
+			num, server, tool, resp.Response.Error))
+		return nil
+	}
+
+	mcpResp, _ := resp.Response.Response["mcp_response"].(map[string]interface{})
+	result, _ := mcpResp["result"].(map[string]interface{})
+	return result
+}
+
+// fireHooks sends a hook_callback request for every callback registered for
+// event whose matcher accepts toolName, and returns the hook outputs.
+func (f *FakeCLI) fireHooks(num int, event claudeagent.HookType, toolName,
+	toolUseID string, extra map[string]interface{}) []map[string]interface{} {
+
+	f.mu.Lock()
+	matchers := f.hooks[string(event)]
+	f.mu.Unlock()
+
+	var outputs []map[string]interface{}
+	for _, m := range matchers {
+		if toolName != "" && !matcherAccepts(m.Matcher, toolName) {
+			continue
+		}
+
+		for _, callbackID := range m.HookCallbackIDs {
+			input := map[string]interface{}{
+				"hook_event_name": string(event),
+				"session_id":      f.script.sessionID,
+				"cwd":             "",
+				"permission_mode": "default",
+			}
+			for k, v := range extra {
+				input[k] = v
+			}
+
+			resp, ok := f.request(claudeagent.SDKControlRequestBody{
+				Subtype:    "hook_callback",
+				CallbackID: callbackID,
+				Input:      input,
+				ToolUseID:  toolUseID,
+			})
+			if !ok {
+				return outputs
+			}
+			if resp.Response.Subtype == "error" {
+				f.fail(fmt.Errorf("turn %d: %s hook %s failed: %s",
+					num, event, callbackID, resp.Response.Error))
+				continue
+			}
+			outputs = append(outputs, resp.Response.Response)
+		}
+	}
+	return outputs
+}
+
+// request sends a control request to the SDK and waits for its response. It
+// returns false if the fake was closed or the SDK did not answer in time.
+func (f *FakeCLI) request(
+	body claudeagent.SDKControlRequestBody,
+) (claudeagent.SDKControlResponse, bool) {
+
+	f.mu.Lock()
+	f.nextRequestID++
+	requestID := fmt.Sprintf("fake_req_%d", f.nextRequestID)
+	ch := make(chan claudeagent.SDKControlResponse, 1)
+	f.pending[requestID] = ch
+	f.mu.Unlock()
+
+	sent := f.emit(claudeagent.SDKControlRequest{
+		Type:      "control_request",
+		RequestID: requestID,
+		Request:   body,
+	})
+	if !sent {
+		return claudeagent.SDKControlResponse{}, false
+	}
+
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+
+	select {
+	case resp := <-ch:
+		return resp, true
+
+	case <-timer.C:
+		f.mu.Lock()
+		delete(f.pending, requestID)
+		f.mu.Unlock()
+
+		f.fail(fmt.Errorf("%s request %s: no response from SDK",
+			body.Subtype, requestID))
+		return claudeagent.SDKControlResponse{}, false
+
+	case <-f.done:
+		return claudeagent.SDKControlResponse{}, false
+	}
+}
+
+// emit round-trips msg through its JSON encoding, exactly as the SDK would
+// see it from the real CLI, and queues it for ReadMessages. It returns false
+// if the fake was closed or its message stream has ended.
+func (f *FakeCLI) emit(msg claudeagent.Message) bool {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		f.fail(fmt.Errorf("failed to marshal %s: %w",
+			msg.MessageType(), err))
+		return true
+	}
+	parsed, err := claudeagent.ParseMessage(data)
+	if err != nil {
+		f.fail(fmt.Errorf("failed to parse %s: %w",
+			msg.MessageType(), err))
+		return true
+	}
+
+	select {
+	case f.out <- parsed:
+		return true
+	case <-f.done:
+		return false
+	case <-f.endedCh:
+		return false
+	}
+}
+
+// fail records a failed expectation.
+func (f *FakeCLI) fail(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.failures = append(f.failures, err)
+}
+
+// systemInit builds the system init message emitted at the start of a turn.
+func (f *FakeCLI) systemInit() claudeagent.SystemMessage {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var servers []claudeagent.MCPServerInfo
+	for name := range f.mcpServers {
+		servers = append(servers, claudeagent.MCPServerInfo{
+			Name:   name,
+			Status: "connected",
+		})
+	}
+
+	return claudeagent.SystemMessage{
+		Type:              "system",
+		Subtype:           "init",
+		SessionID:         f.script.sessionID,
+		Model:             f.script.model,
+		Tools:             f.script.tools,
+		MCPServers:        servers,
+		PermissionMode:    claudeagent.PermissionModeDefault,
+		ClaudeCodeVersion: "fake",
+		APIKeySource:      "none",
+	}
+}
+
+// assistant builds an assistant message with a single content block.
+func (f *FakeCLI) assistant(block claudeagent.ContentBlock) claudeagent.AssistantMessage {
+	msg := claudeagent.AssistantMessage{
+		Type:      "assistant",
+		SessionID: f.script.sessionID,
+	}
+	msg.Message.Role = "assistant"
+	msg.Message.Content = []claudeagent.ContentBlock{block}
+	return msg
+}
+
+// preToolUseDecision folds PreToolUse hook outputs into a single decision:
+// "deny" if any hook blocked, "allow" if any hook pre-approved, or empty to
+// fall through to the permission callback. Any updatedInput supplied with an
+// allow decision is returned alongside it.
+func preToolUseDecision(
+	outputs []map[string]interface{},
+) (string, map[string]interface{}) {
+
+	var (
+		decision string
+		updated  map[string]interface{}
+	)
+	for _, out := range outputs {
+		if cont, ok := out["continue"].(bool); ok && !cont {
+			return "deny", nil
+		}
+		if d, _ := out["decision"].(string); d == "block" {
+			return "deny", nil
+		}
+
+		specific, _ := out["hookSpecificOutput"].(map[string]interface{})
+		switch specific["permissionDecision"] {
+		case "deny":
+			return "deny", nil
+		case "allow":
+			decision = "allow"
+			if input, ok := specific["updatedInput"].(map[string]interface{}); ok {
+				updated = input
+			}
+		}
+	}
+	return decision, updated
+}
+
+// matcherAccepts reports whether a hook matcher applies to toolName. Empty
+// and "*" match everything; otherwise the matcher is treated as an anchored
+// regular expression such as "Bash" or "Edit|Write".
+func matcherAccepts(matcher, toolName string) bool {
+	if matcher == "" || matcher == "*" {
+		return true
+	}
+
+	re, err := regexp.Compile("^(?:" + matcher + ")$")
+	if err != nil {
+		return matcher == toolName
+	}
+	return re.MatchString(toolName)
+}
+
+// promptText extracts the text of a user message.
+func promptText(msg claudeagent.UserMessage) string {
+	var parts []string
+	for _, block := range msg.Message.Content {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
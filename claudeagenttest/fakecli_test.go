@@ -0,0 +1,310 @@
+package claudeagenttest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	claudeagent "github.com/roasbeef/claude-agent-sdk-go"
+)
+
+// runQuery connects a client to fake and collects every message yielded for
+// prompt.
+func runQuery(t *testing.T, fake *FakeCLI, prompt string,
+	opts ...claudeagent.Option) []claudeagent.Message {
+
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts = append(opts, claudeagent.WithTransport(fake))
+	client, err := claudeagent.NewClient(opts...)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var msgs []claudeagent.Message
+	for msg := range client.Query(ctx, prompt) {
+		msgs = append(msgs, msg)
+	}
+	require.NoError(t, ctx.Err(), "query timed out")
+	return msgs
+}
+
+// lastResult returns the final ResultMessage in msgs.
+func lastResult(t *testing.T, msgs []claudeagent.Message) claudeagent.ResultMessage {
+	t.Helper()
+
+	require.NotEmpty(t, msgs)
+	result, ok := msgs[len(msgs)-1].(claudeagent.ResultMessage)
+	require.True(t, ok, "last message should be a result, got %T",
+		msgs[len(msgs)-1])
+	return result
+}
+
+// TestFakeCLIPermissionDenied verifies that the permission callback is
+// consulted and its decision is reported on the tool call and result.
+func TestFakeCLIPermissionDenied(t *testing.T) {
+	script := NewScript()
+	script.WhenUserSays("clean up").
+		CallTool("Bash", map[string]interface{}{"command": "rm -rf /"}).
+		ExpectDenied().
+		Reply("I was not allowed to do that.")
+
+	fake := NewFakeCLI(script)
+	var seen []string
+	msgs := runQuery(t, fake, "clean up",
+		claudeagent.WithCanUseTool(func(ctx context.Context,
+			req claudeagent.ToolPermissionRequest) claudeagent.PermissionResult {
+
+			seen = append(seen, req.ToolName)
+			return claudeagent.PermissionDeny{Reason: "destructive"}
+		}),
+	)
+	require.NoError(t, fake.Err())
+
+	var types []string
+	for _, msg := range msgs {
+		types = append(types, msg.MessageType())
+	}
+	assert.Equal(t,
+		[]string{"system", "assistant", "assistant", "result"}, types,
+	)
+	assert.Equal(t, []string{"Bash"}, seen)
+
+	result := lastResult(t, msgs)
+	assert.Equal(t, "success", result.Subtype)
+	assert.Equal(t, "I was not allowed to do that.", result.Result)
+	require.Len(t, result.PermissionDenials, 1)
+	assert.Equal(t, "destructive", result.PermissionDenials[0].Reason)
+
+	calls := fake.ToolCalls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "deny", calls[0].Behavior)
+	assert.Equal(t, "destructive", calls[0].Message)
+	assert.False(t, calls[0].BlockedByHook)
+}
+
+// TestFakeCLIPreToolUseHookBlocks verifies that a blocking PreToolUse hook
+// prevents the permission request, and that PostToolUse runs for allowed
+// calls only.
+func TestFakeCLIPreToolUseHookBlocks(t *testing.T) {
+	script := NewScript()
+	script.WhenUserSays("edit then run").
+		CallTool("Edit", map[string]interface{}{"file_path": "a.go"}).
+		ExpectAllowed().
+		CallTool("Bash", map[string]interface{}{"command": "make"}).
+		ExpectDenied().
+		Reply("done")
+
+	fake := NewFakeCLI(script)
+	var (
+		permissionCalls []string
+		postToolUse     []string
+	)
+	runQuery(t, fake, "edit then run",
+		claudeagent.WithCanUseTool(func(ctx context.Context,
+			req claudeagent.ToolPermissionRequest) claudeagent.PermissionResult {
+
+			permissionCalls = append(permissionCalls, req.ToolName)
+			return claudeagent.PermissionAllow{}
+		}),
+		claudeagent.WithHooks(map[claudeagent.HookType][]claudeagent.HookConfig{
+			claudeagent.HookTypePreToolUse: {{
+				Matcher: "Bash",
+				Callback: func(ctx context.Context,
+					input claudeagent.HookInput) (claudeagent.HookResult, error) {
+
+					return claudeagent.HookResult{Continue: false}, nil
+				},
+			}},
+			claudeagent.HookTypePostToolUse: {{
+				Matcher: "*",
+				Callback: func(ctx context.Context,
+					input claudeagent.HookInput) (claudeagent.HookResult, error) {
+
+					post := input.(claudeagent.PostToolUseInput)
+					postToolUse = append(postToolUse, post.ToolName)
+					return claudeagent.HookResult{Continue: true}, nil
+				},
+			}},
+		}),
+	)
+	require.NoError(t, fake.Err())
+
+	assert.Equal(t, []string{"Edit"}, permissionCalls)
+	assert.Equal(t, []string{"Edit"}, postToolUse)
+
+	calls := fake.ToolCalls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, "allow", calls[0].Behavior)
+	assert.True(t, calls[1].BlockedByHook)
+}
+
+// TestFakeCLIMcpTool verifies that MCP tool calls are routed to in-process
+// servers through mcp_message control requests.
+func TestFakeCLIMcpTool(t *testing.T) {
+	type addArgs struct {
+		A int `json:"a"`
+		B int `json:"b"`
+	}
+	server := claudeagent.CreateMcpServer(claudeagent.McpServerOptions{
+		Name: "calc",
+		Tools: []claudeagent.ToolRegistrar{
+			claudeagent.Tool("add", "Add two numbers",
+				func(ctx context.Context, args addArgs) (claudeagent.ToolResult, error) {
+					return claudeagent.TextResult(
+						fmt.Sprintf("%d", args.A+args.B),
+					), nil
+				},
+			),
+		},
+	})
+
+	script := NewScript()
+	script.WhenUserSays("add 2 and 3").
+		CallMcpTool("calc", "add", map[string]interface{}{"a": 2, "b": 3}).
+		ExpectAllowed().
+		Reply("5")
+
+	fake := NewFakeCLI(script)
+	runQuery(t, fake, "add 2 and 3",
+		claudeagent.WithMcpServer("calc", server),
+	)
+	require.NoError(t, fake.Err())
+
+	calls := fake.ToolCalls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "mcp__calc__add", calls[0].Name)
+	require.NotNil(t, calls[0].McpResult)
+
+	content, ok := calls[0].McpResult["content"].([]interface{})
+	require.True(t, ok)
+	require.Len(t, content, 1)
+	block, ok := content[0].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "5", block["text"])
+}
+
+// TestFakeCLIFireHook verifies that arbitrary hook events reach callbacks.
+func TestFakeCLIFireHook(t *testing.T) {
+	script := NewScript()
+	script.WhenUserSays("hi").
+		FireHook(claudeagent.HookTypeNotification, map[string]interface{}{
+			"message": "heads up",
+		}).
+		Reply("hello")
+
+	fake := NewFakeCLI(script)
+	var got string
+	runQuery(t, fake, "hi",
+		claudeagent.WithHooks(map[claudeagent.HookType][]claudeagent.HookConfig{
+			claudeagent.HookTypeNotification: {{
+				Callback: func(ctx context.Context,
+					input claudeagent.HookInput) (claudeagent.HookResult, error) {
+
+					got = input.(claudeagent.NotificationInput).Message
+					return claudeagent.HookResult{Continue: true}, nil
+				},
+			}},
+		}),
+	)
+	require.NoError(t, fake.Err())
+	assert.Equal(t, "heads up", got)
+}
+
+// TestFakeCLIReportsFailures verifies that unmet expectations, unmatched
+// prompts and unused turns surface through Err.
+func TestFakeCLIReportsFailures(t *testing.T) {
+	t.Run("expectation mismatch", func(t *testing.T) {
+		script := NewScript()
+		script.WhenUserSays("run").
+			CallTool("Bash", map[string]interface{}{"command": "ls"}).
+			ExpectDenied()
+
+		fake := NewFakeCLI(script)
+		runQuery(t, fake, "run")
+
+		err := fake.Err()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `expected permission "deny"`)
+	})
+
+	t.Run("unmatched prompt", func(t *testing.T) {
+		script := NewScript()
+		script.WhenUserSays("expected").Reply("ok")
+
+		fake := NewFakeCLI(script)
+		msgs := runQuery(t, fake, "something else")
+
+		result := lastResult(t, msgs)
+		assert.True(t, result.IsError)
+		assert.Equal(t, "error_during_execution", result.Subtype)
+
+		err := fake.Err()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "no scripted turn")
+		assert.Contains(t, err.Error(), "turn 1 never ran")
+	})
+
+	t.Run("scripted failure", func(t *testing.T) {
+		script := NewScript()
+		script.WhenUserSays("loop").FailWith("error_max_turns")
+
+		fake := NewFakeCLI(script)
+		result := lastResult(t, runQuery(t, fake, "loop"))
+		assert.Equal(t, "error_max_turns", result.Subtype)
+		require.NoError(t, fake.Err())
+	})
+}
+
+// TestFakeCLIEndInput verifies that the message stream ends after EndInput
+// once the running turn finishes, and that messages written afterwards are
+// rejected rather than answered on the ended stream.
+func TestFakeCLIEndInput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	script := NewScript()
+	script.WhenUserSays("hi").Reply("hello")
+
+	fake := NewFakeCLI(script)
+	require.NoError(t, fake.Connect(ctx))
+	defer fake.Close()
+
+	prompt := claudeagent.UserMessage{Type: "user"}
+	prompt.Message.Role = "user"
+	prompt.Message.Content = []claudeagent.UserContentBlock{
+		claudeagent.TextBlock("hi"),
+	}
+	require.NoError(t, fake.Write(ctx, prompt))
+	require.NoError(t, fake.EndInput())
+
+	setModel := claudeagent.SDKControlRequest{
+		Type:      "control_request",
+		RequestID: "req_1",
+		Request: claudeagent.SDKControlRequestBody{
+			Subtype: "set_model",
+		},
+	}
+	var closed *claudeagent.ErrTransportClosed
+	assert.ErrorAs(t, fake.Write(ctx, setModel), &closed)
+
+	var result bool
+	for msg, err := range fake.ReadMessages(ctx) {
+		require.NoError(t, err)
+		if _, ok := msg.(claudeagent.ResultMessage); ok {
+			result = true
+		}
+	}
+	require.NoError(t, ctx.Err(), "message stream did not end")
+	assert.True(t, result)
+
+	assert.ErrorAs(t, fake.Write(ctx, setModel), &closed)
+	assert.ErrorAs(t, fake.Write(ctx, prompt), &closed)
+	require.NoError(t, fake.Err())
+}
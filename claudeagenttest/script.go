@@ -0,0 +1,232 @@
+package claudeagenttest
+
+import (
+	"encoding/json"
+
+	claudeagent "github.com/roasbeef/claude-agent-sdk-go"
+)
+
+// DefaultSessionID is the session ID reported by a FakeCLI unless the script
+// overrides it with WithSessionID.
+const DefaultSessionID = "fake-session"
+
+// DefaultModel is the model reported by a FakeCLI unless the script
+// overrides it with WithModel.
+const DefaultModel = "claude-fake"
+
+// Script describes how a FakeCLI responds to user prompts. Build one with
+// NewScript and add turns with WhenUserSays or WhenUserMatches.
+type Script struct {
+	sessionID string
+	model     string
+	tools     []string
+	turns     []*Turn
+}
+
+// NewScript creates an empty script.
+func NewScript() *Script {
+	return &Script{
+		sessionID: DefaultSessionID,
+		model:     DefaultModel,
+	}
+}
+
+// WithSessionID sets the session ID reported in system and result messages.
+func (s *Script) WithSessionID(id string) *Script {
+	s.sessionID = id
+	return s
+}
+
+// WithModel sets the model reported in the system init message.
+func (s *Script) WithModel(model string) *Script {
+	s.model = model
+	return s
+}
+
+// WithTools sets the tool list reported in the system init message.
+func (s *Script) WithTools(tools ...string) *Script {
+	s.tools = tools
+	return s
+}
+
+// WhenUserSays adds a turn that runs when the user prompt equals text.
+func (s *Script) WhenUserSays(text string) *Turn {
+	return s.WhenUserMatches(func(prompt string) bool {
+		return prompt == text
+	})
+}
+
+// WhenUserMatches adds a turn that runs when match returns true for the
+// user prompt.
+func (s *Script) WhenUserMatches(match func(prompt string) bool) *Turn {
+	turn := &Turn{
+		script: s,
+		match:  match,
+	}
+	s.turns = append(s.turns, turn)
+	return turn
+}
+
+// Turn is a scripted response to a single user prompt. Each turn runs at most
+// once, and turns are matched in the order they were added. Steps run in
+// order and the turn always finishes with a ResultMessage.
+//
+// Example:
+//
+//	script := claudeagenttest.NewScript()
+//	script.WhenUserSays("list files").
+//	    CallTool("Bash", map[string]any{"command": "ls"}).
+//	    ExpectAllowed().
+//	    Reply("There are two files.")
+type Turn struct {
+	script *Script
+	match  func(prompt string) bool
+	steps  []step
+
+	resultSubtype string
+	resultErrors  []string
+}
+
+// stepKind identifies the action a step performs.
+type stepKind int
+
+const (
+	stepReply stepKind = iota
+	stepToolCall
+	stepHook
+)
+
+// step is a single scripted action within a turn.
+type step struct {
+	kind stepKind
+
+	// text is the assistant reply for stepReply.
+	text string
+
+	// toolName and toolInput describe the call for stepToolCall.
+	toolName  string
+	toolInput map[string]interface{}
+
+	// expect is the expected permission behavior for stepToolCall, or
+	// empty if the decision is not checked.
+	expect string
+
+	// hookEvent and hookInput describe the event for stepHook.
+	hookEvent claudeagent.HookType
+	hookInput map[string]interface{}
+}
+
+// Reply emits an AssistantMessage containing a single text block.
+func (t *Turn) Reply(text string) *Turn {
+	t.steps = append(t.steps, step{kind: stepReply, text: text})
+	return t
+}
+
+// CallTool emits an AssistantMessage with a tool_use block and then drives
+// the tool through the same lifecycle the CLI uses: PreToolUse hooks, a
+// can_use_tool permission request, execution, and PostToolUse hooks.
+//
+// Tools named mcp__<server>__<tool> whose server was registered in-process
+// with WithMcpServer are executed through an mcp_message control request.
+// All other tools are not executed; their output is empty.
+func (t *Turn) CallTool(name string, input map[string]interface{}) *Turn {
+	t.steps = append(t.steps, step{
+		kind:      stepToolCall,
+		toolName:  name,
+		toolInput: input,
+	})
+	return t
+}
+
+// CallMcpTool is shorthand for CallTool with the mcp__<server>__<tool> name
+// the CLI uses for MCP tools.
+func (t *Turn) CallMcpTool(server, tool string,
+	input map[string]interface{}) *Turn {
+
+	return t.CallTool("mcp__"+server+"__"+tool, input)
+}
+
+// ExpectAllowed asserts that the SDK allows the preceding CallTool. A
+// mismatch is reported by FakeCLI.Err.
+func (t *Turn) ExpectAllowed() *Turn {
+	return t.expectPermission("allow")
+}
+
+// ExpectDenied asserts that the SDK denies the preceding CallTool, either
+// through the permission callback or a blocking PreToolUse hook. A mismatch
+// is reported by FakeCLI.Err.
+func (t *Turn) ExpectDenied() *Turn {
+	return t.expectPermission("deny")
+}
+
+// expectPermission sets the expected behavior on the last tool call step.
+func (t *Turn) expectPermission(behavior string) *Turn {
+	for i := len(t.steps) - 1; i >= 0; i-- {
+		if t.steps[i].kind == stepToolCall {
+			t.steps[i].expect = behavior
+			return t
+		}
+	}
+	panic("claudeagenttest: expectation set before CallTool")
+}
+
+// FireHook sends a hook_callback control request for every callback the SDK
+// registered for event. The fields in input are merged into the hook input
+// alongside hook_event_name and session_id.
+func (t *Turn) FireHook(event claudeagent.HookType,
+	input map[string]interface{}) *Turn {
+
+	t.steps = append(t.steps, step{
+		kind:      stepHook,
+		hookEvent: event,
+		hookInput: input,
+	})
+	return t
+}
+
+// FailWith ends the turn with an error ResultMessage of the given subtype,
+// such as "error_during_execution" or "error_max_turns".
+func (t *Turn) FailWith(subtype string, errs ...string) *Turn {
+	t.resultSubtype = subtype
+	t.resultErrors = errs
+	return t
+}
+
+// WhenUserSays adds another turn to the parent script.
+func (t *Turn) WhenUserSays(text string) *Turn {
+	return t.script.WhenUserSays(text)
+}
+
+// WhenUserMatches adds another turn to the parent script.
+func (t *Turn) WhenUserMatches(match func(prompt string) bool) *Turn {
+	return t.script.WhenUserMatches(match)
+}
+
+// ToolCall records how the SDK handled a scripted tool call.
+type ToolCall struct {
+	// ToolUseID is the ID of the emitted tool_use block.
+	ToolUseID string
+
+	// Name is the tool name.
+	Name string
+
+	// Input is the tool input as sent in the tool_use block.
+	Input json.RawMessage
+
+	// Behavior is "allow" or "deny".
+	Behavior string
+
+	// Message is the denial message returned by the SDK, if any.
+	Message string
+
+	// BlockedByHook is true when a PreToolUse hook blocked the call before
+	// the permission request was sent.
+	BlockedByHook bool
+
+	// UpdatedInput is the input returned in an allow response.
+	UpdatedInput map[string]interface{}
+
+	// McpResult is the JSON-RPC result returned for an in-process MCP
+	// tool, or nil if the tool was not routed to an MCP server.
+	McpResult map[string]interface{}
+}
@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"iter"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,6 +20,16 @@ var ErrNotInitialized = errors.New("sdk not initialized")
 // Client manages the subprocess transport, control protocol, and provides
 // ergonomic methods for querying and streaming interactions. It uses Go 1.23+
 // iter.Seq for streaming message iteration.
+//
+// A Client is safe for concurrent use. Query, QueryContent, Questions and
+// any number of Streams may run from different goroutines, and each receives
+// only the messages produced for its own prompts. The CLI behind a client
+// works on one prompt at a time, so prompts are queued and sent in the order
+// they were submitted: a prompt is written only after the previous one's
+// result message arrived, and its caller waits, subject to its context, until
+// then. A query that stops iterating early still holds its place until the
+// CLI finishes its turn; use Stream.Interrupt to cut a turn short. For
+// prompts that should run in parallel, use one client per conversation.
 type Client struct {
 	options   Options
 	transport Transport
@@ -26,8 +38,35 @@ type Client struct {
 	mu        sync.Mutex
 	connected bool
 
-	// Message routing.
-	msgCh     chan Message
+	// connMu guards transport and protocol, which are replaced when the
+	// supervisor restarts the CLI, lastSessionID and pumpErr.
+	connMu        sync.RWMutex
+	lastSessionID string
+
+	// pumpErr is the error that ended the message stream, if any.
+	pumpErr error
+
+	// turns counts completed turns and costUSD is the session cost last
+	// reported by the CLI. Both are guarded by connMu.
+	turns   int
+	costUSD float64
+
+	// restarts counts restart attempts. It is only accessed by the
+	// message pump.
+	restarts int
+
+	// stopping is set by Shutdown, after which the CLI is not restarted.
+	stopping atomic.Bool
+
+	// tools traces the tool uses of the active turn, and meter reports
+	// turn costs to Options.Metrics.
+	tools toolTracker
+	meter usageMeter
+
+	// Message routing. queue buffers messages between the reader and
+	// the router according to Options.MessageBuffer.
+	router    *messageRouter
+	queue     *messageQueue
 	msgCtx    context.Context
 	msgCancel context.CancelFunc
 }
@@ -57,21 +96,53 @@ func NewClient(opts ...Option) (*Client, error) {
 		return nil, err
 	}
 
+	// Compile the permission policy into the CanUseTool callback.
+	if options.PermissionPolicy != nil {
+		canUseTool, err := compileOptionsPolicy(&options)
+		if err != nil {
+			return nil, err
+		}
+		options.CanUseTool = canUseTool
+	}
+
+	// Redact the values passed with WithEnv, and everything logged.
+	if options.Redactor != nil {
+		options.Redactor = options.Redactor.withEnv(options.Env)
+		options.Logger = options.Redactor.Logger(options.Logger)
+	}
+
+	// Wrap hook callbacks with their SDK-side filters.
+	if err := compileHookFilters(&options); err != nil {
+		return nil, err
+	}
+
 	client := &Client{
 		options: options,
 	}
 
+	// Record permission decisions in the audit log.
+	if options.Audit != nil && options.CanUseTool != nil {
+		decidedBy := AuditDecidedByCanUseTool
+		if options.PermissionPolicy != nil {
+			decidedBy = AuditDecidedByPolicy
+		}
+		client.options.CanUseTool = options.Audit.canUseTool(
+			options.CanUseTool, decidedBy, client.currentSessionID,
+			options.logger(),
+		)
+	}
+
 	// Load Skills if enabled
 	if options.SkillsConfig.EnableSkills {
 		loader := NewSkillLoader(
 			options.SkillsConfig.UserSkillsDir,
 			options.SkillsConfig.ProjectSkillsDir,
 		)
+		loader.SetLogger(options.logger())
 		skills, err := loader.Load()
 		if err != nil {
-			// Log warning but continue (Skills loading is not critical)
-			// In production, use structured logging here
-			_ = err
+			// Skills loading is not critical.
+			options.logger().Warn("Failed to load skills", "err", err)
 		}
 		client.skills = skills
 	}
@@ -95,33 +166,26 @@ func (c *Client) Connect(ctx context.Context) error {
 	if c.options.Transport != nil {
 		transport = c.options.Transport
 	} else {
-		subprocess, err := NewSubprocessTransport(&c.options)
+		var err error
+		transport, err = c.newTransport(&c.options)
 		if err != nil {
 			return err
 		}
-
-		// Wire stderr callback to transport if configured. The Options.Stderr
-		// callback receives each line as a string, while the transport expects
-		// an io.Writer. The adapter bridges the two interfaces.
-		if c.options.Stderr != nil {
-			subprocess.SetStderrLogger(&stderrCallbackWriter{
-				callback: c.options.Stderr,
-			})
-		}
-		transport = subprocess
 	}
 
 	// Connect transport.
 	if err := transport.Connect(ctx); err != nil {
 		return err
 	}
-	c.transport = transport
-
 	// Create protocol handler.
+	c.connMu.Lock()
+	c.transport = transport
 	c.protocol = NewProtocol(transport, &c.options)
+	c.connMu.Unlock()
 
-	// Create message channel for routing.
-	c.msgCh = make(chan Message, 64)
+	// Create the router that hands messages to queries and streams.
+	c.router = newMessageRouter()
+	c.queue = newMessageQueue(c.options.MessageBuffer)
 	c.msgCtx, c.msgCancel = context.WithCancel(context.Background())
 
 	// Start message pump that routes all messages.
@@ -134,34 +198,323 @@ func (c *Client) Connect(ctx context.Context) error {
 	if err := c.protocol.Initialize(ctx); err != nil {
 		c.msgCancel()
 		transport.Close()
+		c.options.logger().Error("Failed to initialize CLI", "err", err)
 		return fmt.Errorf("failed to initialize: %w", err)
 	}
 
+	c.options.logger().Debug("Connected to CLI")
 	c.connected = true
+	if c.options.Budget != nil {
+		c.options.Budget.register(c)
+	}
 	return nil
 }
 
-// messagePump reads from transport and routes messages.
+// newTransport creates the transport for opts: a NetworkTransport if
+// opts.Network is set and a CLI subprocess otherwise. The Stderr callback is
+// wired if one is configured.
+func (c *Client) newTransport(opts *Options) (Transport, error) {
+	var (
+		transport interface {
+			Transport
+			SetStderrLogger(w io.Writer)
+		}
+		err error
+	)
+	if opts.Network != nil {
+		transport, err = NewNetworkTransport(*opts.Network, opts)
+	} else {
+		transport, err = NewSubprocessTransport(opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Wire stderr callback to transport if configured. The Options.Stderr
+	// callback receives each line as a string, while the transport expects
+	// an io.Writer. The adapter bridges the two interfaces.
+	if opts.Stderr != nil {
+		transport.SetStderrLogger(&stderrCallbackWriter{
+			callback: opts.Stderr,
+		})
+	}
+	return transport, nil
+}
+
+// conn returns the current transport and protocol.
+func (c *Client) conn() (Transport, *Protocol) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.transport, c.protocol
+}
+
+// messagePump routes messages from the transport. If automatic reconnection
+// is enabled, it restarts the CLI whenever the transport's message stream
+// ends before the client is closed.
 func (c *Client) messagePump() {
-	defer close(c.msgCh)
-	for msg, err := range c.transport.ReadMessages(c.msgCtx) {
+	go c.routeQueued()
+	defer c.queue.close()
+
+	transport, protocol := c.conn()
+	done := c.startReader(transport, protocol)
+	for {
+		<-done
+
+		if c.msgCtx.Err() != nil || c.options.Reconnect == nil ||
+			c.stopping.Load() {
+
+			return
+		}
+
+		transport, _ = c.conn()
+		done = c.restart(transport)
+		if done == nil {
+			return
+		}
+	}
+}
+
+// pumpTransport reads from transport and queues messages for their
+// consumers until its stream ends. Subprocess failures are recorded for Err;
+// other errors, such as unknown message types, are forwarded to consumers as
+// pumpError values.
+//
+// Control messages bypass the queue. Responses are handled as they are
+// read. Requests are handled one at a time, in order, on their own
+// goroutines, so that neither a slow callback nor a slow consumer holds up
+// the other.
+func (c *Client) pumpTransport(transport Transport, protocol *Protocol) {
+	prev := make(chan struct{})
+	close(prev)
+
+	for msg, err := range transport.ReadMessages(c.msgCtx) {
 		if err != nil {
+			var failed *ErrSubprocessFailed
+			if errors.As(err, &failed) {
+				c.options.logger().Error("CLI exited", "err", err)
+				c.setPumpErr(err)
+				continue
+			}
+
+			c.options.logger().Warn("Failed to read message",
+				"err", err)
+			if !c.enqueue(pumpError{err: err}) {
+				return
+			}
 			continue
 		}
 		// Route control messages to protocol handler.
+		if isControlRequest(msg) {
+			prev = c.handleControlRequest(protocol, msg, prev)
+			continue
+		}
 		if isControlMessage(msg) {
-			_ = c.protocol.HandleControlMessage(c.msgCtx, msg)
+			c.handleControlMessage(c.msgCtx, protocol, msg)
 			continue
 		}
-		// Send non-control messages to consumer channel.
+		c.trackSessionID(msg)
+		c.trackUsage(msg)
+		c.tools.observe(c.options.tracer(), c.options.metrics(),
+			c.router.activeSpan(), msg)
+		if c.options.RateLimits != nil {
+			c.options.RateLimits.observe(c.options.logger(), msg)
+		}
+		turn, ok := c.meter.observe(c.options.metrics(), msg)
+		if ok && c.options.Budget != nil {
+			c.options.Budget.charge(c.options.logger(), turn)
+		}
+
+		// Queue non-control messages for their consumers, without
+		// their secrets.
+		if !c.enqueue(c.options.Redactor.redactMessage(msg)) {
+			return
+		}
+	}
+}
+
+// handleControlRequest handles a control request from the CLI once the
+// request before it, whose handling closes prev, is done. It returns a
+// channel closed when this one is done.
+func (c *Client) handleControlRequest(protocol *Protocol, msg Message,
+	prev <-chan struct{}) chan struct{} {
+
+	// Spans for the request belong to the turn it was made for.
+	ctx := c.router.activeSpan().context(c.msgCtx)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
 		select {
-		case c.msgCh <- msg:
+		case <-prev:
 		case <-c.msgCtx.Done():
 			return
 		}
+		c.handleControlMessage(ctx, protocol, msg)
+	}()
+	return done
+}
+
+// handleControlMessage passes msg to protocol, logging failures.
+func (c *Client) handleControlMessage(ctx context.Context, protocol *Protocol,
+	msg Message) {
+
+	err := protocol.HandleControlMessage(ctx, msg)
+	if err != nil && ctx.Err() == nil {
+		c.options.logger().Debug("Failed to handle control message",
+			"type", fmt.Sprintf("%T", msg), "err", err)
+	}
+}
+
+// enqueue queues msg for its consumers. It returns false if the client was
+// closed.
+func (c *Client) enqueue(msg Message) bool {
+	return c.queue.push(c.msgCtx, msg)
+}
+
+// routeQueued hands queued messages to their consumers until the queue is
+// closed and drained or the client is closed, and then ends the message
+// stream.
+func (c *Client) routeQueued() {
+	defer c.router.close()
+	defer c.queue.discard()
+
+	for {
+		msg, ok := c.queue.pop(c.msgCtx)
+		if !ok || !c.deliver(msg) {
+			return
+		}
 	}
 }
 
+// deliver hands msg to the queries and streams it is routed to. Consumers
+// that stopped reading are skipped. It returns false if the client was
+// closed.
+func (c *Client) deliver(msg Message) bool {
+	for _, sub := range c.router.route(msg) {
+		select {
+		case sub.ch <- msg:
+		case <-sub.done:
+		case <-c.msgCtx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// startTurn waits until the CLI is free, then writes a user message with
+// the given content as a new turn owned by sub. Every message the CLI
+// produces for the turn, up to and including its result, is routed to sub.
+func (c *Client) startTurn(ctx context.Context, sub *subscriber,
+	sessionID string, content []UserContentBlock) error {
+
+	t, err := c.router.acquire(ctx, sub)
+	if errors.Is(err, errRouterClosed) {
+		return c.streamEndErr()
+	}
+	if errors.Is(err, errRouterStopped) {
+		return &ErrClientShutdown{}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Checked once the turn is ours, as turns queued before it may have
+	// used up the budget.
+	if err := c.options.Budget.Err(); err != nil {
+		c.router.release(t)
+		return err
+	}
+
+	if scheduler := c.options.RateLimits; scheduler != nil {
+		release, err := scheduler.acquire(ctx)
+		if err != nil {
+			c.router.release(t)
+			return err
+		}
+		c.router.setRelease(t, release)
+	}
+
+	ctx, span := c.options.tracer().Start(ctx, spanTurn)
+	c.router.setSpan(t, &turnSpan{span: span})
+
+	// Send user message in TypeScript SDK format.
+	userMsg := UserMessage{
+		Type:      "user",
+		SessionID: sessionID,
+		Message: APIUserMessage{
+			Role:    "user",
+			Content: content,
+		},
+		ParentToolUseID: nil,
+	}
+
+	_, protocol := c.conn()
+	if err := protocol.SendMessage(ctx, userMsg); err != nil {
+		span.RecordError(err)
+		c.router.release(t)
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+// trackUsage counts completed turns and records the session cost reported
+// by result messages.
+func (c *Client) trackUsage(msg Message) {
+	result, ok := msg.(ResultMessage)
+	if !ok {
+		return
+	}
+
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+
+	c.turns++
+
+	// The CLI reports the cost accumulated over its session.
+	c.costUSD = max(c.costUSD, result.TotalCostUSD)
+}
+
+// usage returns the number of completed turns and the session cost so far.
+func (c *Client) usage() (int, float64) {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.turns, c.costUSD
+}
+
+// pumpError carries a non-fatal transport error through the message channel.
+// The WithErrors iterators yield it; the others drop it.
+type pumpError struct {
+	err error
+}
+
+// MessageType implements Message.
+func (pumpError) MessageType() string { return "error" }
+
+// setPumpErr records the error that ended the message stream.
+func (c *Client) setPumpErr(err error) {
+	c.connMu.Lock()
+	c.pumpErr = err
+	c.connMu.Unlock()
+}
+
+// Err returns the error that ended the client's message stream, such as an
+// ErrSubprocessFailed carrying the CLI's exit code and stderr tail. It
+// returns nil while the stream is healthy or if it ended cleanly.
+func (c *Client) Err() error {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+	return c.pumpErr
+}
+
+// streamEndErr returns the error yielded when the message stream closes.
+func (c *Client) streamEndErr() error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return &ErrTransportClosed{}
+}
+
 // Query performs a one-shot query and returns an iterator over response messages.
 //
 // The iterator yields messages as they arrive from Claude, including:
@@ -176,6 +529,7 @@ func (c *Client) messagePump() {
 // - Otherwise, a QuestionMessage is yielded. Call its Respond() method to answer.
 //
 // The iterator stops when the result message is received or the context is canceled.
+// Errors are not reported; use QueryWithErrors to find out why a query ended early.
 //
 // Example:
 //
@@ -191,67 +545,158 @@ func (c *Client) messagePump() {
 //	    }
 //	}
 func (c *Client) Query(ctx context.Context, prompt string) iter.Seq[Message] {
+	return dropErrors(c.queryWithErrors(ctx, []UserContentBlock{TextBlock(prompt)}))
+}
+
+// QueryWithErrors is like Query but also yields errors, so that a query that
+// ends early can be diagnosed.
+//
+// Connection, send and validation failures, context cancellation, and the
+// message stream closing before the result all yield a final error and end
+// the iteration; the stream closing carries the error returned by Err, such
+// as ErrSubprocessFailed with the CLI's exit code and stderr tail. Errors
+// for individual messages, such as ErrUnknownMessageType, are yielded with a
+// nil message and iteration continues.
+//
+// Example:
+//
+//	for msg, err := range client.QueryWithErrors(ctx, prompt) {
+//	    if err != nil {
+//	        var failed *claudeagent.ErrSubprocessFailed
+//	        if errors.As(err, &failed) {
+//	            log.Printf("CLI exited %d: %s", failed.ExitCode, failed.Stderr)
+//	        }
+//	        continue
+//	    }
+//	    // handle msg
+//	}
+func (c *Client) QueryWithErrors(ctx context.Context,
+	prompt string) iter.Seq2[Message, error] {
+
+	return c.queryWithErrors(ctx, []UserContentBlock{TextBlock(prompt)})
+}
+
+// QueryContent performs a one-shot query with arbitrary content blocks, such
+// as images, documents and tool results, and returns an iterator over the
+// response messages. It behaves like Query; if the blocks fail validation
+// the iterator yields nothing. Use QueryContentWithErrors to see why.
+//
+// Example:
+//
+//	img, err := claudeagent.ImageBlockFromFile("screenshot.png")
+//	if err != nil {
+//	    return err
+//	}
+//	for msg := range client.QueryContent(ctx,
+//	    claudeagent.TextBlock("Describe this screenshot."), img,
+//	) {
+//	    // ...
+//	}
+func (c *Client) QueryContent(ctx context.Context,
+	blocks ...UserContentBlock) iter.Seq[Message] {
+
+	return dropErrors(c.queryWithErrors(ctx, blocks))
+}
+
+// QueryContentWithErrors is like QueryContent but also yields errors, as
+// described for QueryWithErrors.
+func (c *Client) QueryContentWithErrors(ctx context.Context,
+	blocks ...UserContentBlock) iter.Seq2[Message, error] {
+
+	return c.queryWithErrors(ctx, blocks)
+}
+
+// dropErrors adapts an iterator of messages and errors to one that yields
+// only the messages.
+func dropErrors(seq iter.Seq2[Message, error]) iter.Seq[Message] {
 	return func(yield func(Message) bool) {
-		// Ensure connected.
-		if !c.connected {
-			if err := c.Connect(ctx); err != nil {
+		for msg, err := range seq {
+			if err != nil {
+				continue
+			}
+			if !yield(msg) {
 				return
 			}
 		}
+	}
+}
 
-		// Send user message in TypeScript SDK format.
-		userMsg := UserMessage{
-			Type:      "user",
-			SessionID: c.options.SessionOptions.SessionID,
-			Message: APIUserMessage{
-				Role: "user",
-				Content: []UserContentBlock{
-					{Type: "text", Text: prompt},
-				},
-			},
-			ParentToolUseID: nil,
+// queryWithErrors sends a user message with the given content and yields
+// responses until the result message.
+func (c *Client) queryWithErrors(ctx context.Context,
+	content []UserContentBlock) iter.Seq2[Message, error] {
+
+	return func(yield func(Message, error) bool) {
+		if err := validateUserContent(content); err != nil {
+			yield(nil, err)
+			return
 		}
 
-		if err := c.protocol.SendMessage(ctx, userMsg); err != nil {
+		// Ensure connected.
+		if err := c.Connect(ctx); err != nil {
+			yield(nil, err)
+			return
+		}
+
+		sub := newSubscriber()
+		defer sub.leave()
+
+		err := c.startTurn(
+			ctx, sub, c.options.SessionOptions.SessionID, content,
+		)
+		if err != nil {
+			yield(nil, err)
 			return
 		}
 
-		// Read messages from channel until result.
+		// Read this turn's messages until the result.
 		for {
-			select {
-			case <-ctx.Done():
-				return
-			case msg, ok := <-c.msgCh:
-				if !ok {
-					return // Channel closed.
+			msg, ok := sub.next(ctx, c.router)
+			if !ok {
+				if err := ctx.Err(); err != nil {
+					yield(nil, err)
+					return
 				}
 
-				// Check for AskUserQuestion tool calls.
-				if c.options.AskUserQuestionHandler != nil {
-					// Handler configured - use callback API.
-					if handled := c.handleAskUserQuestion(ctx, msg); handled {
-						continue
-					}
-				} else {
-					// No handler - yield QuestionMessage if present.
-					if questionMsg := c.extractQuestionMessage(ctx, msg); questionMsg != nil {
-						if !yield(*questionMsg) {
-							return
-						}
-						continue
-					}
-				}
+				// Stream closed before the result.
+				yield(nil, c.streamEndErr())
+				return
+			}
 
-				// Yield message to consumer.
-				if !yield(msg) {
+			if pe, ok := msg.(pumpError); ok {
+				if !yield(nil, pe.err) {
 					return
 				}
+				continue
+			}
 
-				// Stop on result message.
-				if _, ok := msg.(ResultMessage); ok {
-					return
+			// Check for AskUserQuestion tool calls.
+			if c.options.AskUserQuestionHandler != nil {
+				// Handler configured - use callback API.
+				if handled := c.handleAskUserQuestion(ctx, msg); handled {
+					continue
+				}
+			} else {
+				// No handler - yield QuestionMessage if present.
+				if questionMsg := c.extractQuestionMessage(ctx, msg); questionMsg != nil {
+					if !yield(*questionMsg, nil) {
+						return
+					}
+					continue
 				}
 			}
+
+			// Yield message to consumer.
+			if !yield(msg, nil) {
+				return
+			}
+
+			// Stop on result message. A reconnect means the CLI
+			// died mid-turn, so no result will follow.
+			switch msg.(type) {
+			case ResultMessage, ReconnectedMessage:
+				return
+			}
 		}
 	}
 }
@@ -370,75 +815,65 @@ func (c *Client) handleAskUserQuestion(ctx context.Context, msg Message) bool {
 func (c *Client) Questions(ctx context.Context, prompt string) iter.Seq2[QuestionSet, AnswerFunc] {
 	return func(yield func(QuestionSet, AnswerFunc) bool) {
 		// Ensure connected.
-		if !c.connected {
-			if err := c.Connect(ctx); err != nil {
-				return
-			}
+		if err := c.Connect(ctx); err != nil {
+			return
 		}
 
-		// Send user message.
-		userMsg := UserMessage{
-			Type:      "user",
-			SessionID: c.options.SessionOptions.SessionID,
-			Message: APIUserMessage{
-				Role: "user",
-				Content: []UserContentBlock{
-					{Type: "text", Text: prompt},
-				},
-			},
-			ParentToolUseID: nil,
-		}
+		sub := newSubscriber()
+		defer sub.leave()
 
-		if err := c.protocol.SendMessage(ctx, userMsg); err != nil {
+		err := c.startTurn(
+			ctx, sub, c.options.SessionOptions.SessionID,
+			[]UserContentBlock{TextBlock(prompt)},
+		)
+		if err != nil {
 			return
 		}
 
-		// Read messages from channel until result.
+		// Read this turn's messages until the result.
 		for {
-			select {
-			case <-ctx.Done():
+			msg, ok := sub.next(ctx, c.router)
+			if !ok {
 				return
-			case msg, ok := <-c.msgCh:
-				if !ok {
-					return // Channel closed.
-				}
+			}
+
+			// Check for AskUserQuestion tool calls in assistant messages.
+			if assistant, ok := msg.(AssistantMessage); ok {
+				for _, block := range assistant.Message.Content {
+					if block.Type == "tool_use" && block.Name == "AskUserQuestion" {
+						// Parse the question input.
+						var input AskUserQuestionInput
+						if err := json.Unmarshal(block.Input, &input); err != nil {
+							continue
+						}
+
+						// Create QuestionSet.
+						qs := QuestionSet{
+							ToolUseID:       block.ID,
+							Questions:       input.Questions,
+							SessionID:       c.options.SessionOptions.SessionID,
+							ParentToolUseID: assistant.ParentToolUseID,
+						}
 
-				// Check for AskUserQuestion tool calls in assistant messages.
-				if assistant, ok := msg.(AssistantMessage); ok {
-					for _, block := range assistant.Message.Content {
-						if block.Type == "tool_use" && block.Name == "AskUserQuestion" {
-							// Parse the question input.
-							var input AskUserQuestionInput
-							if err := json.Unmarshal(block.Input, &input); err != nil {
-								continue
-							}
-
-							// Create QuestionSet.
-							qs := QuestionSet{
-								ToolUseID:       block.ID,
-								Questions:       input.Questions,
-								SessionID:       c.options.SessionOptions.SessionID,
-								ParentToolUseID: assistant.ParentToolUseID,
-							}
-
-							// Create answer function that sends tool result.
-							toolUseID := block.ID
-							answerFunc := func(answers Answers) error {
-								return c.sendToolResult(ctx, toolUseID, answers)
-							}
-
-							// Yield to consumer.
-							if !yield(qs, answerFunc) {
-								return
-							}
+						// Create answer function that sends tool result.
+						toolUseID := block.ID
+						answerFunc := func(answers Answers) error {
+							return c.sendToolResult(ctx, toolUseID, answers)
+						}
+
+						// Yield to consumer.
+						if !yield(qs, answerFunc) {
+							return
 						}
 					}
 				}
+			}
 
-				// Stop on result message.
-				if _, ok := msg.(ResultMessage); ok {
-					return
-				}
+			// Stop on result message, or on a reconnect after
+			// which no result will follow.
+			switch msg.(type) {
+			case ResultMessage, ReconnectedMessage:
+				return
 			}
 		}
 	}
@@ -469,7 +904,8 @@ func (c *Client) sendToolResult(ctx context.Context, toolUseID string, answers A
 		},
 	}
 
-	return c.protocol.SendMessage(ctx, msg)
+	_, protocol := c.conn()
+	return protocol.SendMessage(ctx, msg)
 }
 
 // sendToolError sends an error result back to Claude for a tool use.
@@ -498,7 +934,8 @@ func (c *Client) sendToolError(ctx context.Context, toolUseID string, errMsg str
 		},
 	}
 
-	return c.protocol.SendMessage(ctx, msg)
+	_, protocol := c.conn()
+	return protocol.SendMessage(ctx, msg)
 }
 
 // Stream returns a bidirectional stream for interactive conversations.
@@ -518,17 +955,17 @@ func (c *Client) sendToolError(ctx context.Context, toolUseID string, errMsg str
 //	}
 func (c *Client) Stream(ctx context.Context) (*Stream, error) {
 	// Ensure connected
-	if !c.connected {
-		if err := c.Connect(ctx); err != nil {
-			return nil, err
-		}
+	if err := c.Connect(ctx); err != nil {
+		return nil, err
 	}
 
 	return &Stream{
 		client:    c,
 		ctx:       ctx,
 		sessionID: c.options.SessionOptions.SessionID,
-		sendCh:    make(chan string, 4),
+		sub:       newSubscriber(),
+		sendCh:    make(chan []UserContentBlock, 4),
+		errCh:     make(chan error, 16),
 		closeCh:   make(chan struct{}),
 	}, nil
 }
@@ -546,14 +983,17 @@ func (c *Client) Close() error {
 	}
 
 	c.connected = false
+	if c.options.Budget != nil {
+		c.options.Budget.unregister(c)
+	}
 
 	// Cancel message pump.
 	if c.msgCancel != nil {
 		c.msgCancel()
 	}
 
-	if c.transport != nil {
-		return c.transport.Close()
+	if transport, _ := c.conn(); transport != nil {
+		return transport.Close()
 	}
 
 	return nil
@@ -605,6 +1045,7 @@ func (c *Client) ReloadSkills() error {
 		c.options.SkillsConfig.UserSkillsDir,
 		c.options.SkillsConfig.ProjectSkillsDir,
 	)
+	loader.SetLogger(c.options.logger())
 
 	skills, err := loader.Load()
 	if err != nil {
@@ -658,7 +1099,9 @@ type Stream struct {
 	client    *Client
 	ctx       context.Context
 	sessionID string
-	sendCh    chan string
+	sub       *subscriber
+	sendCh    chan []UserContentBlock
+	errCh     chan error
 	closeCh   chan struct{}
 	closeOnce sync.Once
 }
@@ -668,20 +1111,51 @@ type Stream struct {
 // Messages are queued and sent asynchronously. The response will appear
 // in the Messages() iterator.
 func (s *Stream) Send(ctx context.Context, prompt string) error {
+	return s.queue(ctx, []UserContentBlock{TextBlock(prompt)})
+}
+
+// SendContent submits a user message made of arbitrary content blocks, such
+// as images, documents and tool results. The blocks are validated before
+// they are queued.
+//
+// Example:
+//
+//	pdf, err := claudeagent.DocumentBlockFromFile("report.pdf")
+//	if err != nil {
+//	    return err
+//	}
+//	err = stream.SendContent(ctx,
+//	    claudeagent.TextBlock("Summarize this report."), pdf,
+//	)
+func (s *Stream) SendContent(ctx context.Context,
+	blocks ...UserContentBlock) error {
+
+	if err := validateUserContent(blocks); err != nil {
+		return err
+	}
+	return s.queue(ctx, blocks)
+}
+
+// queue hands content to the send loop.
+func (s *Stream) queue(ctx context.Context, content []UserContentBlock) error {
 	select {
 	case <-s.closeCh:
 		return &ErrTransportClosed{}
 	case <-ctx.Done():
 		return ctx.Err()
-	case s.sendCh <- prompt:
+	case s.sendCh <- content:
 		return nil
 	}
 }
 
 // Messages returns an iterator over response messages.
 //
-// The iterator yields all messages from the stream until Close() is called
-// or the context is canceled.
+// The iterator yields the responses to prompts sent on this stream, along
+// with messages that are not part of any prompt's turn, such as a
+// ReconnectedMessage, until Close() is called or the context is canceled.
+// Responses to other streams and queries on the same client are not
+// included. Each prompt is sent once earlier prompts on the client have
+// completed.
 //
 // Example:
 //
@@ -696,32 +1170,68 @@ func (s *Stream) Send(ctx context.Context, prompt string) error {
 //	    }
 //	}
 func (s *Stream) Messages() iter.Seq[Message] {
-	return func(yield func(Message) bool) {
+	return dropErrors(s.MessagesWithErrors())
+}
+
+// MessagesWithErrors is like Messages but also yields errors: failures to
+// send queued prompts, per-message errors such as ErrUnknownMessageType,
+// and, as the final value, context cancellation or the error that closed
+// the client's message stream (see Client.Err). Errors other than the final
+// one are yielded with a nil message and iteration continues.
+func (s *Stream) MessagesWithErrors() iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
 		// Start send handler.
 		go s.handleSends()
 
-		// Read from the shared message channel.
+		// Receive messages for this stream's turns, and those outside
+		// any turn, while we are reading.
+		router := s.client.router
+		router.listen(s.sub)
+		defer router.unlisten(s.sub)
+
 		for {
+			var (
+				msg Message
+				ok  bool
+			)
 			select {
 			case <-s.closeCh:
 				return
 			case <-s.ctx.Done():
+				yield(nil, s.ctx.Err())
 				return
-			case msg, ok := <-s.client.msgCh:
+			case err := <-s.errCh:
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			case msg = <-s.sub.ch:
+			case <-router.closed:
+				// Drain what was routed before the close.
+				msg, ok = s.sub.next(s.ctx, router)
 				if !ok {
-					return // Channel closed.
+					yield(nil, s.client.streamEndErr())
+					return
 				}
+			}
 
-				// Yield message to consumer.
-				if !yield(msg) {
+			if pe, ok := msg.(pumpError); ok {
+				if !yield(nil, pe.err) {
 					return
 				}
+				continue
+			}
+
+			// Yield message to consumer.
+			if !yield(msg, nil) {
+				return
 			}
 		}
 	}
 }
 
-// handleSends processes queued user messages.
+// handleSends processes queued user messages. Send failures are reported
+// through MessagesWithErrors.
 func (s *Stream) handleSends() {
 	for {
 		select {
@@ -729,22 +1239,15 @@ func (s *Stream) handleSends() {
 			return
 		case <-s.ctx.Done():
 			return
-		case prompt := <-s.sendCh:
-			userMsg := UserMessage{
-				Type:      "user",
-				SessionID: s.sessionID,
-				Message: APIUserMessage{
-					Role: "user",
-					Content: []UserContentBlock{
-						{Type: "text", Text: prompt},
-					},
-				},
-				ParentToolUseID: nil,
-			}
-
-			if err := s.client.protocol.SendMessage(s.ctx, userMsg); err != nil {
-				// Log error but continue.
-				continue
+		case content := <-s.sendCh:
+			// Each prompt is a turn; wait for earlier ones to finish.
+			err := s.client.startTurn(s.ctx, s.sub, s.sessionID, content)
+			if err != nil {
+				// Report the failure without blocking the queue.
+				select {
+				case s.errCh <- err:
+				default:
+				}
 			}
 		}
 	}
@@ -913,7 +1416,15 @@ func (s *Stream) StopTask(ctx context.Context, taskID string) error {
 func (s *Stream) sendSDKControlRequest(
 	ctx context.Context, body SDKControlRequestBody,
 ) (*SDKControlResponse, error) {
-	p := s.client.protocol
+	return s.client.sendSDKControlRequest(ctx, body)
+}
+
+// sendSDKControlRequest sends an SDK-initiated control request to the CLI
+// and waits for its response.
+func (c *Client) sendSDKControlRequest(
+	ctx context.Context, body SDKControlRequestBody,
+) (*SDKControlResponse, error) {
+	transport, p := c.conn()
 	requestID := p.nextRequestID()
 	req := SDKControlRequest{
 		Type:      "control_request",
@@ -925,7 +1436,7 @@ func (s *Stream) sendSDKControlRequest(
 	ch := make(chan SDKControlResponse, 1)
 	p.pendingReqs.Store(requestID, ch)
 
-	if err := s.client.transport.Write(ctx, req); err != nil {
+	if err := transport.Write(ctx, req); err != nil {
 		p.pendingReqs.Delete(requestID)
 		return nil, fmt.Errorf("control request %q: write: %w", body.Subtype, err)
 	}
@@ -944,7 +1455,8 @@ func (s *Stream) sendSDKControlRequest(
 
 // InitializationResult returns the cached initialize response.
 func (s *Stream) InitializationResult() (*SDKControlInitializeResponse, error) {
-	initResp := s.client.protocol.initResult()
+	_, protocol := s.client.conn()
+	initResp := protocol.initResult()
 	if initResp == nil {
 		return nil, ErrNotInitialized
 	}
@@ -955,7 +1467,8 @@ func (s *Stream) InitializationResult() (*SDKControlInitializeResponse, error) {
 // The context is accepted for API compatibility and is not used.
 func (s *Stream) SupportedCommands(ctx context.Context) ([]SlashCommand, error) {
 	_ = ctx
-	initResp := s.client.protocol.initResult()
+	_, protocol := s.client.conn()
+	initResp := protocol.initResult()
 	if initResp == nil {
 		return nil, ErrNotInitialized
 	}
@@ -966,7 +1479,8 @@ func (s *Stream) SupportedCommands(ctx context.Context) ([]SlashCommand, error)
 // The context is accepted for API compatibility and is not used.
 func (s *Stream) SupportedModels(ctx context.Context) ([]ModelInfo, error) {
 	_ = ctx
-	initResp := s.client.protocol.initResult()
+	_, protocol := s.client.conn()
+	initResp := protocol.initResult()
 	if initResp == nil {
 		return nil, ErrNotInitialized
 	}
@@ -977,7 +1491,8 @@ func (s *Stream) SupportedModels(ctx context.Context) ([]ModelInfo, error) {
 // The context is accepted for API compatibility and is not used.
 func (s *Stream) SupportedAgents(ctx context.Context) ([]AgentInfo, error) {
 	_ = ctx
-	initResp := s.client.protocol.initResult()
+	_, protocol := s.client.conn()
+	initResp := protocol.initResult()
 	if initResp == nil {
 		return nil, ErrNotInitialized
 	}
@@ -1010,7 +1525,8 @@ func (s *Stream) McpServerStatus(ctx context.Context) ([]McpServerStatus, error)
 // AccountInfo returns account information for the current session.
 func (s *Stream) AccountInfo(ctx context.Context) (*AccountInfo, error) {
 	_ = ctx
-	initResp := s.client.protocol.initResult()
+	_, protocol := s.client.conn()
+	initResp := protocol.initResult()
 	if initResp == nil {
 		return nil, ErrNotInitialized
 	}
@@ -1118,12 +1634,15 @@ func (s *Stream) SessionID() string {
 func (s *Stream) Close() error {
 	s.closeOnce.Do(func() {
 		close(s.closeCh)
+		if s.sub != nil {
+			s.sub.leave()
+		}
 	})
 	return nil
 }
 
 // stderrCallbackWriter adapts a func(string) callback to the io.Writer
-// interface so it can be passed to SubprocessTransport.SetStderrLogger.
+// interface so it can be passed to a transport's SetStderrLogger.
 // Each Write call invokes the callback with the written data as a string.
 type stderrCallbackWriter struct {
 	callback func(data string)
@@ -1146,6 +1665,20 @@ func validateOptions(opts *Options) error {
 		}
 	}
 
+	// A custom transport cannot be respawned without a factory.
+	if opts.Reconnect != nil && opts.Transport != nil &&
+		opts.Reconnect.NewTransport == nil {
+
+		return &ErrInvalidConfiguration{
+			Field:  "Reconnect.NewTransport",
+			Reason: "required when a custom transport is used",
+		}
+	}
+
+	if err := opts.MessageBuffer.validate(); err != nil {
+		return err
+	}
+
 	// Validate permission mode
 	validModes := map[PermissionMode]bool{
 		PermissionModeDefault:     true,
@@ -1173,6 +1706,17 @@ func validateOptions(opts *Options) error {
 	return nil
 }
 
+// isControlRequest reports whether msg is a request from the CLI that the
+// SDK must answer.
+func isControlRequest(msg Message) bool {
+	switch msg.(type) {
+	case ControlRequest, SDKControlRequest:
+		return true
+	default:
+		return false
+	}
+}
+
 // isControlMessage checks if a message is a control protocol message.
 func isControlMessage(msg Message) bool {
 	switch msg.(type) {
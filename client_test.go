@@ -1,8 +1,15 @@
 package claudeagent
 
 import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -27,3 +34,204 @@ func TestNewClientAcceptsPermissionModeConstants(t *testing.T) {
 		})
 	}
 }
+
+// faultyItem is a message or error produced by faultyTransport.
+type faultyItem struct {
+	msg Message
+	err error
+}
+
+// faultyTransport answers initialize and replies to each user message with
+// a fixed sequence of messages and errors, after which its stream ends.
+type faultyTransport struct {
+	mu       sync.Mutex
+	incoming chan faultyItem
+	reply    []faultyItem
+	userErr  error
+	closed   atomic.Bool
+}
+
+func newFaultyTransport(reply ...faultyItem) *faultyTransport {
+	return &faultyTransport{
+		incoming: make(chan faultyItem, len(reply)+1),
+		reply:    reply,
+	}
+}
+
+func (f *faultyTransport) Connect(context.Context) error { return nil }
+
+func (f *faultyTransport) Write(_ context.Context, msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch m := msg.(type) {
+	case SDKControlRequest:
+		f.incoming <- faultyItem{msg: SDKControlResponse{
+			Type: "control_response",
+			Response: SDKControlResponseBody{
+				Subtype:   "success",
+				RequestID: m.RequestID,
+				Response:  map[string]interface{}{},
+			},
+		}}
+
+	case UserMessage:
+		if f.userErr != nil {
+			return f.userErr
+		}
+		for _, item := range f.reply {
+			f.incoming <- item
+		}
+		close(f.incoming)
+	}
+	return nil
+}
+
+func (f *faultyTransport) ReadMessages(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case item, ok := <-f.incoming:
+				if !ok || !yield(item.msg, item.err) {
+					return
+				}
+			}
+		}
+	}
+}
+
+func (f *faultyTransport) EndInput() error { return nil }
+
+func (f *faultyTransport) Close() error {
+	f.closed.Store(true)
+	return nil
+}
+
+func (f *faultyTransport) IsReady() bool { return !f.closed.Load() }
+
+// TestClientQueryWithErrors verifies that per-message errors are yielded
+// in order and that a subprocess failure ends the query with its details.
+func TestClientQueryWithErrors(t *testing.T) {
+	assistant := AssistantMessage{Type: "assistant"}
+	crash := &ErrSubprocessFailed{
+		Cause:    errors.New("signal: killed"),
+		ExitCode: 137,
+		Stderr:   "FATAL: JavaScript heap out of memory\n",
+	}
+	reply := []faultyItem{
+		{err: &ErrUnknownMessageType{Type: "mystery"}},
+		{msg: assistant},
+		{err: crash},
+	}
+
+	client, err := NewClient(WithTransport(newFaultyTransport(reply...)))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var (
+		msgs []Message
+		errs []error
+	)
+	for msg, err := range client.QueryWithErrors(ctx, "hello") {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+
+	assert.Equal(t, []Message{assistant}, msgs)
+	require.Len(t, errs, 2)
+
+	var unknown *ErrUnknownMessageType
+	require.ErrorAs(t, errs[0], &unknown)
+	assert.Equal(t, "mystery", unknown.Type)
+
+	var failed *ErrSubprocessFailed
+	require.ErrorAs(t, errs[1], &failed)
+	assert.Equal(t, 137, failed.ExitCode)
+	assert.Contains(t, failed.Error(), "heap out of memory")
+	assert.Equal(t, crash, client.Err())
+}
+
+// TestClientQueryWithErrorsEarlyFailures covers failures before any message
+// is received.
+func TestClientQueryWithErrorsEarlyFailures(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	firstErr := func(seq iter.Seq2[Message, error]) error {
+		for _, err := range seq {
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	t.Run("invalid content", func(t *testing.T) {
+		client, err := NewClient(WithTransport(newFaultyTransport()))
+		require.NoError(t, err)
+		defer client.Close()
+
+		err = firstErr(client.QueryContentWithErrors(ctx, UserContentBlock{
+			Type: "image",
+		}))
+		var invalid *ErrInvalidConfiguration
+		assert.ErrorAs(t, err, &invalid)
+	})
+
+	t.Run("send failure", func(t *testing.T) {
+		transport := newFaultyTransport()
+		transport.userErr = &ErrTransportClosed{}
+
+		client, err := NewClient(WithTransport(transport))
+		require.NoError(t, err)
+		defer client.Close()
+
+		err = firstErr(client.QueryWithErrors(ctx, "hello"))
+		var closed *ErrTransportClosed
+		assert.ErrorAs(t, err, &closed)
+	})
+
+	t.Run("stream closed without error", func(t *testing.T) {
+		client, err := NewClient(WithTransport(newFaultyTransport()))
+		require.NoError(t, err)
+		defer client.Close()
+
+		err = firstErr(client.QueryWithErrors(ctx, "hello"))
+		var closed *ErrTransportClosed
+		assert.ErrorAs(t, err, &closed)
+		assert.NoError(t, client.Err())
+	})
+}
+
+// TestStreamMessagesWithErrorsReportsSendFailures verifies that a prompt
+// that cannot be written surfaces as an error on the stream.
+func TestStreamMessagesWithErrorsReportsSendFailures(t *testing.T) {
+	transport := newFaultyTransport()
+	transport.userErr = errors.New("broken pipe")
+
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Stream(ctx)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	require.NoError(t, stream.Send(ctx, "hello"))
+	for _, err := range stream.MessagesWithErrors() {
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "broken pipe")
+		break
+	}
+}
@@ -0,0 +1,156 @@
+// Command claude-bridge runs Claude CLI subprocesses on this host for
+// remote clients using NetworkTransport.
+//
+// Each client connection gets its own CLI, started with the arguments the
+// client built from its options, and the CLI's stream-json is relayed over
+// the connection. The token grants full control over the CLI on this host,
+// so serve over TLS unless the bridge is only reachable on a trusted network.
+// Each CLI receives only the variables its client sends plus those named by
+// -pass-env, never the bridge's token.
+//
+// Usage:
+//
+//	export CLAUDE_BRIDGE_TOKEN=$(openssl rand -hex 32)
+//	go build -o claude-bridge ./cmd/claude-bridge
+//	./claude-bridge -listen :7777 -mode ws -tls-cert cert.pem -tls-key key.pem
+//
+//	# Then configure your client:
+//	# WithNetworkTransport(NetworkConfig{
+//	#     Address: "wss://sandbox:7777",
+//	#     Token:   os.Getenv("CLAUDE_BRIDGE_TOKEN"),
+//	# })
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	claudeagent "github.com/roasbeef/claude-agent-sdk-go"
+)
+
+func main() {
+	var (
+		listen    = flag.String("listen", ":7777", "address to listen on")
+		mode      = flag.String("mode", "ws", "protocol to serve: ws or tcp")
+		tlsCert   = flag.String("tls-cert", "", "TLS certificate file")
+		tlsKey    = flag.String("tls-key", "", "TLS private key file")
+		tokenFile = flag.String("token-file", "", "file containing the "+
+			"bearer token (default: $CLAUDE_BRIDGE_TOKEN)")
+		cliPath = flag.String("cli", "", "path to the claude CLI "+
+			"(default: discovered from PATH)")
+		cwd = flag.String("cwd", "", "working directory for clients "+
+			"that don't set one")
+		passEnv = flag.String("pass-env", "", "comma-separated "+
+			"environment variables passed to each CLI (default: "+
+			"PATH, HOME, USER, LANG, LC_ALL, TERM, TMPDIR)")
+	)
+	flag.Parse()
+
+	token, err := loadToken(*tokenFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Keep the token out of reach of the CLIs and the tools they run.
+	os.Unsetenv(tokenEnv)
+
+	server := &claudeagent.BridgeServer{
+		Token:    token,
+		CLIPath:  *cliPath,
+		Cwd:      *cwd,
+		ErrorLog: os.Stderr,
+	}
+	if *passEnv != "" {
+		server.PassEnv = strings.Split(*passEnv, ",")
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	scheme := *mode
+	if *tlsCert != "" || *tlsKey != "" {
+		cert, err := tls.LoadX509KeyPair(*tlsCert, *tlsKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ln = tls.NewListener(ln, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		scheme = map[string]string{"ws": "wss", "tcp": "tls"}[*mode]
+	}
+
+	ctx, stop := signal.NotifyContext(
+		context.Background(), os.Interrupt, syscall.SIGTERM,
+	)
+	defer stop()
+
+	var serve func() error
+	switch *mode {
+	case "ws":
+		httpServer := &http.Server{Handler: server}
+		go func() {
+			<-ctx.Done()
+			_ = httpServer.Close()
+		}()
+		serve = func() error {
+			err := httpServer.Serve(ln)
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+
+	case "tcp":
+		go func() {
+			<-ctx.Done()
+			_ = ln.Close()
+		}()
+		serve = func() error {
+			return server.Serve(ln)
+		}
+
+	default:
+		log.Fatalf("unknown mode %q, want ws or tcp", *mode)
+	}
+
+	log.Printf("claude-bridge listening on %s://%s", scheme, ln.Addr())
+	if err := serve(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// tokenEnv is the environment variable holding the bearer token.
+const tokenEnv = "CLAUDE_BRIDGE_TOKEN"
+
+// loadToken reads the bearer token from path, or from the
+// CLAUDE_BRIDGE_TOKEN environment variable if path is empty.
+func loadToken(path string) (string, error) {
+	token := os.Getenv(tokenEnv)
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token: %w", err)
+		}
+		token = string(data)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("a token is required: set " +
+			"CLAUDE_BRIDGE_TOKEN or use -token-file")
+	}
+	return token, nil
+}
@@ -0,0 +1,383 @@
+package claudeagent
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Citation links a span of assistant text to the source it was drawn from.
+//
+// The location fields that are populated depend on Type:
+// - char_location: DocumentIndex, StartCharIndex, EndCharIndex
+// - page_location: DocumentIndex, StartPageNumber, EndPageNumber
+// - content_block_location: DocumentIndex, StartBlockIndex, EndBlockIndex
+// - web_search_result_location: URL, Title, EncryptedIndex
+// - search_result_location: Source, SearchResultIndex, StartBlockIndex, EndBlockIndex
+type Citation struct {
+	Type              string `json:"type"`                          // Location type
+	CitedText         string `json:"cited_text,omitempty"`          // Quoted source text
+	DocumentIndex     int    `json:"document_index,omitempty"`      // Index of the cited document
+	DocumentTitle     string `json:"document_title,omitempty"`      // Title of the cited document
+	StartCharIndex    int    `json:"start_char_index,omitempty"`    // For char_location
+	EndCharIndex      int    `json:"end_char_index,omitempty"`      // For char_location
+	StartPageNumber   int    `json:"start_page_number,omitempty"`   // For page_location
+	EndPageNumber     int    `json:"end_page_number,omitempty"`     // For page_location
+	StartBlockIndex   int    `json:"start_block_index,omitempty"`   // For content_block_location
+	EndBlockIndex     int    `json:"end_block_index,omitempty"`     // For content_block_location
+	URL               string `json:"url,omitempty"`                 // For web_search_result_location
+	Title             string `json:"title,omitempty"`               // For web_search_result_location
+	EncryptedIndex    string `json:"encrypted_index,omitempty"`     // For web_search_result_location
+	Source            string `json:"source,omitempty"`              // For search_result_location
+	SearchResultIndex int    `json:"search_result_index,omitempty"` // For search_result_location
+}
+
+// UnmarshalJSON implements json.Unmarshaler and keeps a copy of the original
+// encoding in Raw.
+func (c *ContentBlock) UnmarshalJSON(data []byte) error {
+	type plain ContentBlock
+	var block plain
+	if err := json.Unmarshal(data, &block); err != nil {
+		return err
+	}
+	*c = ContentBlock(block)
+	c.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Blocks decoded from JSON are
+// emitted exactly as received unless a field was changed since, in which
+// case the changed fields replace their originals and fields the SDK does
+// not model are kept. Blocks built in code are encoded from their fields.
+func (c ContentBlock) MarshalJSON() ([]byte, error) {
+	type plain ContentBlock
+	if len(c.Raw) == 0 {
+		return json.Marshal(plain(c))
+	}
+
+	var orig plain
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(c.Raw, &orig) != nil ||
+		json.Unmarshal(c.Raw, &fields) != nil || fields == nil {
+
+		c.Raw = nil
+		return json.Marshal(plain(c))
+	}
+
+	changed := false
+	cur, old := reflect.ValueOf(c), reflect.ValueOf(ContentBlock(orig))
+	for i := range cur.NumField() {
+		tag := cur.Type().Field(i).Tag.Get("json")
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		value := cur.Field(i)
+		if reflect.DeepEqual(value.Interface(), old.Field(i).Interface()) {
+			continue
+		}
+		changed = true
+
+		if isEmptyJSONValue(value) {
+			delete(fields, name)
+			continue
+		}
+		data, err := json.Marshal(value.Interface())
+		if err != nil {
+			return nil, err
+		}
+		fields[name] = data
+	}
+	if !changed {
+		return c.Raw, nil
+	}
+	return json.Marshal(fields)
+}
+
+// isEmptyJSONValue reports whether v is omitted by an omitempty tag.
+func isEmptyJSONValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	default:
+		return v.IsZero()
+	}
+}
+
+// TypedContentBlock is a per-type view of an assistant content block. The
+// concrete type is one of TextContentBlock, ThinkingContentBlock,
+// RedactedThinkingContentBlock, ToolUseContentBlock,
+// ServerToolUseContentBlock, ToolResultContentBlock,
+// WebSearchToolResultContentBlock or RawContentBlock.
+//
+// Example:
+//
+//	for _, block := range msg.Blocks() {
+//	    switch b := block.(type) {
+//	    case claudeagent.ThinkingContentBlock:
+//	        audit.Reasoning(b.Thinking, b.Signature)
+//	    case claudeagent.ToolUseContentBlock:
+//	        audit.ToolCall(b.ID, b.Name, b.Input)
+//	    }
+//	}
+type TypedContentBlock interface {
+	// BlockType returns the block's type field.
+	BlockType() string
+
+	// sealedContentBlock restricts implementations to this package.
+	sealedContentBlock()
+}
+
+// TextContentBlock is a text block with optional citations.
+type TextContentBlock struct {
+	Text      string     `json:"text"`
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// BlockType implements TypedContentBlock.
+func (TextContentBlock) BlockType() string { return "text" }
+
+func (TextContentBlock) sealedContentBlock() {}
+
+// ThinkingContentBlock is an extended thinking block. The signature must be
+// passed back unchanged when the block is replayed to the API.
+type ThinkingContentBlock struct {
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// BlockType implements TypedContentBlock.
+func (ThinkingContentBlock) BlockType() string { return "thinking" }
+
+func (ThinkingContentBlock) sealedContentBlock() {}
+
+// RedactedThinkingContentBlock is thinking content that was encrypted by the
+// API. Data is opaque.
+type RedactedThinkingContentBlock struct {
+	Data string `json:"data"`
+}
+
+// BlockType implements TypedContentBlock.
+func (RedactedThinkingContentBlock) BlockType() string { return "redacted_thinking" }
+
+func (RedactedThinkingContentBlock) sealedContentBlock() {}
+
+// ToolUseContentBlock is a request to execute a client-side tool.
+type ToolUseContentBlock struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// BlockType implements TypedContentBlock.
+func (ToolUseContentBlock) BlockType() string { return "tool_use" }
+
+func (ToolUseContentBlock) sealedContentBlock() {}
+
+// ServerToolUseContentBlock is a tool call executed by the API itself, such
+// as web_search.
+type ServerToolUseContentBlock struct {
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// BlockType implements TypedContentBlock.
+func (ServerToolUseContentBlock) BlockType() string { return "server_tool_use" }
+
+func (ServerToolUseContentBlock) sealedContentBlock() {}
+
+// ToolResultContentBlock is the output of a tool call. Content is either a
+// JSON string or an array of content blocks, exactly as sent.
+type ToolResultContentBlock struct {
+	ToolUseID string          `json:"tool_use_id"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+}
+
+// BlockType implements TypedContentBlock.
+func (ToolResultContentBlock) BlockType() string { return "tool_result" }
+
+func (ToolResultContentBlock) sealedContentBlock() {}
+
+// WebSearchResult is a single hit returned by the web_search server tool.
+type WebSearchResult struct {
+	URL              string `json:"url"`
+	Title            string `json:"title"`
+	EncryptedContent string `json:"encrypted_content,omitempty"`
+	PageAge          string `json:"page_age,omitempty"`
+}
+
+// WebSearchToolResultContentBlock is the result of a web_search server tool
+// call. Either Results or ErrorCode is set; Content always holds the
+// original payload.
+type WebSearchToolResultContentBlock struct {
+	ToolUseID string
+	Results   []WebSearchResult
+	ErrorCode string
+	Content   json.RawMessage
+}
+
+// BlockType implements TypedContentBlock.
+func (WebSearchToolResultContentBlock) BlockType() string {
+	return "web_search_tool_result"
+}
+
+func (WebSearchToolResultContentBlock) sealedContentBlock() {}
+
+// RawContentBlock is any block type the SDK does not model. Raw holds the
+// complete JSON encoding of the block.
+type RawContentBlock struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+// BlockType implements TypedContentBlock.
+func (b RawContentBlock) BlockType() string { return b.Type }
+
+func (RawContentBlock) sealedContentBlock() {}
+
+// Typed returns the per-type view of the block. Block types without a
+// dedicated struct, or blocks that fail to decode, are returned as a
+// RawContentBlock.
+func (c ContentBlock) Typed() TypedContentBlock {
+	data, err := c.MarshalJSON()
+	if err != nil {
+		return RawContentBlock{Type: c.Type}
+	}
+	raw := RawContentBlock{Type: c.Type, Raw: data}
+
+	switch c.Type {
+	case "text":
+		return decodeTypedBlock[TextContentBlock](data, raw)
+
+	case "thinking":
+		block := decodeTypedBlock[ThinkingContentBlock](data, raw)
+
+		// Blocks built in code historically carried thinking text in
+		// the Text field.
+		if thinking, ok := block.(ThinkingContentBlock); ok &&
+			thinking.Thinking == "" {
+
+			thinking.Thinking = c.Text
+			return thinking
+		}
+		return block
+
+	case "redacted_thinking":
+		return decodeTypedBlock[RedactedThinkingContentBlock](data, raw)
+
+	case "tool_use":
+		return decodeTypedBlock[ToolUseContentBlock](data, raw)
+
+	case "server_tool_use":
+		return decodeTypedBlock[ServerToolUseContentBlock](data, raw)
+
+	case "tool_result":
+		return decodeTypedBlock[ToolResultContentBlock](data, raw)
+
+	case "web_search_tool_result":
+		return decodeWebSearchToolResult(data, raw)
+
+	default:
+		return raw
+	}
+}
+
+// decodeTypedBlock decodes data into T, falling back to raw on error.
+func decodeTypedBlock[T TypedContentBlock](data []byte,
+	raw RawContentBlock) TypedContentBlock {
+
+	var block T
+	if err := json.Unmarshal(data, &block); err != nil {
+		return raw
+	}
+	return block
+}
+
+// decodeWebSearchToolResult decodes a web_search_tool_result block, whose
+// content is either a list of results or an error object.
+func decodeWebSearchToolResult(data []byte,
+	raw RawContentBlock) TypedContentBlock {
+
+	var wire struct {
+		ToolUseID string          `json:"tool_use_id"`
+		Content   json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return raw
+	}
+
+	block := WebSearchToolResultContentBlock{
+		ToolUseID: wire.ToolUseID,
+		Content:   wire.Content,
+	}
+
+	content := bytes.TrimSpace(wire.Content)
+	switch {
+	case len(content) == 0:
+
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &block.Results); err != nil {
+			return raw
+		}
+
+	default:
+		var errResult struct {
+			ErrorCode string `json:"error_code"`
+		}
+		if err := json.Unmarshal(content, &errResult); err != nil {
+			return raw
+		}
+		block.ErrorCode = errResult.ErrorCode
+	}
+
+	return block
+}
+
+// Blocks returns the typed view of every content block, in order.
+func (m AssistantMessage) Blocks() []TypedContentBlock {
+	blocks := make([]TypedContentBlock, 0, len(m.Message.Content))
+	for _, block := range m.Message.Content {
+		blocks = append(blocks, block.Typed())
+	}
+	return blocks
+}
+
+// ToolUses returns the client-side tool calls in the message.
+func (m AssistantMessage) ToolUses() []ToolUseContentBlock {
+	return blocksOfType[ToolUseContentBlock](m)
+}
+
+// ServerToolUses returns the server-side tool calls in the message.
+func (m AssistantMessage) ServerToolUses() []ServerToolUseContentBlock {
+	return blocksOfType[ServerToolUseContentBlock](m)
+}
+
+// Thinking returns the thinking blocks in the message, including their
+// signatures. Redacted thinking is not included.
+func (m AssistantMessage) Thinking() []ThinkingContentBlock {
+	return blocksOfType[ThinkingContentBlock](m)
+}
+
+// Citations returns the citations attached to all text blocks, in order.
+func (m AssistantMessage) Citations() []Citation {
+	var citations []Citation
+	for _, block := range blocksOfType[TextContentBlock](m) {
+		citations = append(citations, block.Citations...)
+	}
+	return citations
+}
+
+// blocksOfType returns the content blocks of m whose typed view is T.
+func blocksOfType[T TypedContentBlock](m AssistantMessage) []T {
+	var out []T
+	for _, block := range m.Message.Content {
+		if typed, ok := block.Typed().(T); ok {
+			out = append(out, typed)
+		}
+	}
+	return out
+}
@@ -0,0 +1,212 @@
+package claudeagent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// richAssistantContent is an assistant content array covering every block
+// type with a dedicated typed view, plus one unknown type.
+const richAssistantContent = `[
+	{"type":"thinking","thinking":"Let me search.","signature":"sig_abc"},
+	{"type":"redacted_thinking","data":"opaque"},
+	{"type":"server_tool_use","id":"srvtoolu_1","name":"web_search",
+	 "input":{"query":"go iterators"}},
+	{"type":"web_search_tool_result","tool_use_id":"srvtoolu_1",
+	 "content":[{"type":"web_search_result","url":"https://go.dev/blog",
+	 "title":"Range over func","encrypted_content":"enc","page_age":"1 day"}]},
+	{"type":"web_search_tool_result","tool_use_id":"srvtoolu_2",
+	 "content":{"type":"web_search_tool_result_error",
+	 "error_code":"max_uses_exceeded"}},
+	{"type":"text","text":"Go 1.23 added range-over-func.",
+	 "citations":[{"type":"web_search_result_location",
+	 "url":"https://go.dev/blog","title":"Range over func",
+	 "encrypted_index":"idx","cited_text":"range over func"}]},
+	{"type":"tool_use","id":"toolu_1","name":"Read",
+	 "input":{"file_path":"main.go"}},
+	{"type":"tool_result","tool_use_id":"toolu_0","content":"ok",
+	 "is_error":false},
+	{"type":"container_upload","file_id":"file_1"}
+]`
+
+// parseRichAssistant parses an assistant message carrying
+// richAssistantContent.
+func parseRichAssistant(t *testing.T) AssistantMessage {
+	t.Helper()
+
+	data := []byte(`{"type":"assistant","message":{"role":"assistant",` +
+		`"content":` + richAssistantContent + `}}`)
+	msg, err := ParseMessage(data)
+	require.NoError(t, err)
+
+	assistant, ok := msg.(AssistantMessage)
+	require.True(t, ok)
+	return assistant
+}
+
+// TestContentBlockTyped verifies the typed view of each block type.
+func TestContentBlockTyped(t *testing.T) {
+	msg := parseRichAssistant(t)
+	blocks := msg.Blocks()
+	require.Len(t, blocks, 9)
+
+	thinking, ok := blocks[0].(ThinkingContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "Let me search.", thinking.Thinking)
+	assert.Equal(t, "sig_abc", thinking.Signature)
+
+	redacted, ok := blocks[1].(RedactedThinkingContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "opaque", redacted.Data)
+
+	serverTool, ok := blocks[2].(ServerToolUseContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "web_search", serverTool.Name)
+	assert.JSONEq(t, `{"query":"go iterators"}`, string(serverTool.Input))
+
+	search, ok := blocks[3].(WebSearchToolResultContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "srvtoolu_1", search.ToolUseID)
+	require.Len(t, search.Results, 1)
+	assert.Equal(t, "https://go.dev/blog", search.Results[0].URL)
+	assert.Equal(t, "1 day", search.Results[0].PageAge)
+
+	searchErr, ok := blocks[4].(WebSearchToolResultContentBlock)
+	require.True(t, ok)
+	assert.Empty(t, searchErr.Results)
+	assert.Equal(t, "max_uses_exceeded", searchErr.ErrorCode)
+
+	text, ok := blocks[5].(TextContentBlock)
+	require.True(t, ok)
+	require.Len(t, text.Citations, 1)
+
+	toolUse, ok := blocks[6].(ToolUseContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "toolu_1", toolUse.ID)
+
+	toolResult, ok := blocks[7].(ToolResultContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "toolu_0", toolResult.ToolUseID)
+	assert.JSONEq(t, `"ok"`, string(toolResult.Content))
+
+	raw, ok := blocks[8].(RawContentBlock)
+	require.True(t, ok)
+	assert.Equal(t, "container_upload", raw.BlockType())
+	assert.JSONEq(t, `{"type":"container_upload","file_id":"file_1"}`,
+		string(raw.Raw))
+}
+
+// TestAssistantMessageBlockAccessors covers the convenience accessors.
+func TestAssistantMessageBlockAccessors(t *testing.T) {
+	msg := parseRichAssistant(t)
+
+	toolUses := msg.ToolUses()
+	require.Len(t, toolUses, 1)
+	assert.Equal(t, "Read", toolUses[0].Name)
+
+	serverToolUses := msg.ServerToolUses()
+	require.Len(t, serverToolUses, 1)
+	assert.Equal(t, "srvtoolu_1", serverToolUses[0].ID)
+
+	thinking := msg.Thinking()
+	require.Len(t, thinking, 1)
+	assert.Equal(t, "sig_abc", thinking[0].Signature)
+
+	citations := msg.Citations()
+	require.Len(t, citations, 1)
+	assert.Equal(t, "web_search_result_location", citations[0].Type)
+	assert.Equal(t, "range over func", citations[0].CitedText)
+	assert.Equal(t, "idx", citations[0].EncryptedIndex)
+
+	assert.Equal(t, "Go 1.23 added range-over-func.", msg.ContentText())
+}
+
+// TestContentBlockRoundTripLossless verifies that decoded blocks re-encode
+// to the exact JSON they were parsed from.
+func TestContentBlockRoundTripLossless(t *testing.T) {
+	msg := parseRichAssistant(t)
+
+	data, err := json.Marshal(msg.Message.Content)
+	require.NoError(t, err)
+	assert.JSONEq(t, richAssistantContent, string(data))
+}
+
+// TestContentBlockMutated verifies that changes to a decoded block are
+// encoded and seen by Typed, and that fields the SDK does not model are
+// kept.
+func TestContentBlockMutated(t *testing.T) {
+	var blocks []ContentBlock
+	require.NoError(t, json.Unmarshal([]byte(`[
+		{"type":"text","text":"my key is sk-secret",
+		 "cache_control":{"type":"ephemeral"}},
+		{"type":"tool_use","id":"toolu_1","name":"Bash",
+		 "input":{"command":"rm -rf /"}},
+		{"type":"thinking","thinking":"hmm","signature":"sig_abc"}
+	]`), &blocks))
+
+	blocks[0].Text = "my key is [REDACTED]"
+	blocks[1].Input = json.RawMessage(`{"command":"ls"}`)
+	blocks[2].Signature = ""
+
+	data, err := json.Marshal(blocks)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"type":"text","text":"my key is [REDACTED]",
+		 "cache_control":{"type":"ephemeral"}},
+		{"type":"tool_use","id":"toolu_1","name":"Bash",
+		 "input":{"command":"ls"}},
+		{"type":"thinking","thinking":"hmm"}
+	]`, string(data))
+
+	assert.Equal(t, TextContentBlock{Text: "my key is [REDACTED]"},
+		blocks[0].Typed())
+	assert.Equal(t, ToolUseContentBlock{
+		ID:    "toolu_1",
+		Name:  "Bash",
+		Input: json.RawMessage(`{"command":"ls"}`),
+	}, blocks[1].Typed())
+}
+
+// TestContentBlockTypedFromFields verifies the typed view of blocks built in
+// code rather than decoded from JSON.
+func TestContentBlockTypedFromFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		block ContentBlock
+		want  TypedContentBlock
+	}{
+		{
+			name:  "text",
+			block: ContentBlock{Type: "text", Text: "hi"},
+			want:  TextContentBlock{Text: "hi"},
+		},
+		{
+			name:  "thinking in text field",
+			block: ContentBlock{Type: "thinking", Text: "hmm"},
+			want:  ThinkingContentBlock{Thinking: "hmm"},
+		},
+		{
+			name: "tool use",
+			block: ContentBlock{
+				Type:  "tool_use",
+				ID:    "toolu_1",
+				Name:  "Bash",
+				Input: json.RawMessage(`{"command":"ls"}`),
+			},
+			want: ToolUseContentBlock{
+				ID:    "toolu_1",
+				Name:  "Bash",
+				Input: json.RawMessage(`{"command":"ls"}`),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.block.Typed())
+		})
+	}
+}
@@ -2,6 +2,7 @@ package claudeagent
 
 import (
 	"fmt"
+	"strings"
 )
 
 // ErrUnknownMessageType indicates that a message with an unrecognized type
@@ -19,11 +20,22 @@ func (e *ErrUnknownMessageType) Error() string {
 // to start or terminated unexpectedly.
 type ErrSubprocessFailed struct {
 	Cause error
+
+	// ExitCode is the process exit code, or -1 if it is unknown. It is
+	// only meaningful when the process terminated.
+	ExitCode int
+
+	// Stderr holds the tail of the CLI's stderr output, if any.
+	Stderr string
 }
 
 // Error implements the error interface.
 func (e *ErrSubprocessFailed) Error() string {
-	return fmt.Sprintf("subprocess failed: %v", e.Cause)
+	msg := fmt.Sprintf("subprocess failed: %v", e.Cause)
+	if stderr := lastLine(e.Stderr); stderr != "" {
+		msg += ": " + stderr
+	}
+	return msg
 }
 
 // Unwrap implements the unwrap interface for error chains.
@@ -210,3 +222,150 @@ type ErrNoQuestionHandler struct {
 func (e *ErrNoQuestionHandler) Error() string {
 	return fmt.Sprintf("no handler for question: %s (set WithAskUserQuestionHandler or use Questions())", e.ToolUseID)
 }
+
+// ErrCassetteMismatch indicates that a write made during cassette replay did
+// not match the message recorded at that point in the session.
+type ErrCassetteMismatch struct {
+	// Index is the position of the expected entry in the cassette. It is
+	// equal to the cassette length when the write was not expected at all.
+	Index int
+
+	// Expected is the recorded message, or nil if none was expected.
+	Expected []byte
+
+	// Got is the message the SDK actually wrote.
+	Got []byte
+}
+
+// Error implements the error interface.
+func (e *ErrCassetteMismatch) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("cassette mismatch: unexpected write %s", e.Got)
+	}
+	return fmt.Sprintf("cassette mismatch at entry %d: expected %s, got %s",
+		e.Index, e.Expected, e.Got)
+}
+
+// ErrUnsupportedMediaType indicates that content passed to an image or
+// document constructor has a MIME type the API does not accept.
+type ErrUnsupportedMediaType struct {
+	MediaType string
+}
+
+// Error implements the error interface.
+func (e *ErrUnsupportedMediaType) Error() string {
+	return fmt.Sprintf("unsupported media type: %s", e.MediaType)
+}
+
+// ErrContentTooLarge indicates that image or document content exceeds the
+// size accepted by the API.
+type ErrContentTooLarge struct {
+	MediaType string
+	Size      int
+	Limit     int
+}
+
+// Error implements the error interface.
+func (e *ErrContentTooLarge) Error() string {
+	return fmt.Sprintf("%s content is %d bytes, exceeds limit of %d bytes",
+		e.MediaType, e.Size, e.Limit)
+}
+
+// ErrUnknownToolInput indicates that no input type is registered for a tool,
+// so its input cannot be decoded by DecodeToolInput.
+type ErrUnknownToolInput struct {
+	Name string
+}
+
+// Error implements the error interface.
+func (e *ErrUnknownToolInput) Error() string {
+	return fmt.Sprintf("no input type registered for tool: %s", e.Name)
+}
+
+// ErrBridgeRejected indicates that a claude-bridge server refused a
+// NetworkTransport connection, for example because the token was wrong or
+// the CLI could not be started.
+type ErrBridgeRejected struct {
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ErrBridgeRejected) Error() string {
+	return fmt.Sprintf("bridge rejected connection: %s", e.Reason)
+}
+
+// ErrPoolClosed indicates an attempt to lease a client from a ClientPool
+// that has been shut down.
+type ErrPoolClosed struct{}
+
+// Error implements the error interface.
+func (e *ErrPoolClosed) Error() string {
+	return "client pool is closed"
+}
+
+// ErrClientShutdown indicates a prompt was sent to a client that is shutting
+// down.
+type ErrClientShutdown struct{}
+
+// Error implements the error interface.
+func (e *ErrClientShutdown) Error() string {
+	return "client is shutting down"
+}
+
+// Budget limits reported by ErrBudgetExceeded.
+const (
+	// BudgetLimitCost is BudgetLimits.MaxCostUSD.
+	BudgetLimitCost = "cost"
+
+	// BudgetLimitTokens is BudgetLimits.MaxTokens.
+	BudgetLimitTokens = "tokens"
+)
+
+// ErrBudgetExceeded indicates that a BudgetGuard refused a turn because a
+// limit was reached.
+type ErrBudgetExceeded struct {
+	// Limit is the limit reached: BudgetLimitCost or BudgetLimitTokens.
+	Limit string
+
+	// Spent and Max are the usage and the limit, in US dollars or tokens.
+	Spent float64
+	Max   float64
+}
+
+// Error implements the error interface.
+func (e *ErrBudgetExceeded) Error() string {
+	if e.Limit == BudgetLimitTokens {
+		return fmt.Sprintf("token budget exceeded: used %.0f of %.0f "+
+			"tokens", e.Spent, e.Max)
+	}
+	return fmt.Sprintf("cost budget exceeded: spent $%.4f of $%.2f",
+		e.Spent, e.Max)
+}
+
+// ErrAuditChainBroken indicates that an audit log failed verification: a
+// record was altered, removed or inserted, or could not be parsed.
+type ErrAuditChainBroken struct {
+	// Path is the audit log file.
+	Path string
+
+	// Line is the 1-based line of the first record that failed.
+	Line int
+
+	// Reason describes the failure.
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *ErrAuditChainBroken) Error() string {
+	return fmt.Sprintf("audit log %s broken at line %d: %s", e.Path,
+		e.Line, e.Reason)
+}
+
+// lastLine returns the last non-empty line of s.
+func lastLine(s string) string {
+	s = strings.TrimRight(s, "\n")
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,452 @@
+package claudeagent
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strings"
+	"time"
+)
+
+// HookErrorPolicy decides what a hook chain does when a middleware fails,
+// times out or panics.
+type HookErrorPolicy int
+
+const (
+	// HookFailOpen logs the failure and carries on as if the middleware
+	// had returned HookContinue. This is the default.
+	HookFailOpen HookErrorPolicy = iota
+
+	// HookFailClosed ends the chain with the most restrictive outcome
+	// for the event: a PreToolUse or PermissionRequest hook denies the
+	// tool, and any other hook stops Claude, with the failure as the
+	// reason.
+	HookFailClosed
+)
+
+// HookMiddleware is a hook callback that runs as part of a chain. Unlike
+// the HookConfigs passed to WithHooks, each of which the CLI calls on its
+// own, the middleware registered for an event and matcher run in order
+// within the SDK and their results are merged into a single answer.
+type HookMiddleware struct {
+	// Name identifies the middleware in logs and errors.
+	Name string
+
+	// Priority orders the chain: lower values run first, and middleware
+	// with the same priority run in the order they were registered.
+	Priority int
+
+	// Matcher is the CLI matcher for the hook, such as a tool name
+	// pattern for tool hooks. Middleware with different matchers form
+	// separate chains.
+	Matcher string
+
+	// Filter is evaluated by the SDK before Callback. Middleware whose
+	// filter rejects an event are skipped for it.
+	Filter HookFilter
+
+	// Timeout bounds the callback, enforced by the SDK. Zero means no
+	// limit beyond the caller's. A callback that overruns is treated as
+	// failed and left running.
+	Timeout time.Duration
+
+	// OnError is the policy when the callback returns an error, times
+	// out or panics.
+	OnError HookErrorPolicy
+
+	// Callback is invoked with the event's input. For PreToolUse, it sees
+	// the tool input as updated by the middleware before it.
+	Callback HookCallback
+}
+
+// hookChain runs the middleware registered for one event and matcher.
+type hookChain struct {
+	hookType    HookType
+	middlewares []HookMiddleware
+	audit       *AuditLogger
+	log         *slog.Logger
+}
+
+// hookChainConfigs builds one HookConfig per event and matcher that runs
+// the middleware registered for it as a chain. If audit is set, the
+// PreToolUse decision of each chain is recorded to it.
+func hookChainConfigs(middleware map[HookType][]HookMiddleware,
+	audit *AuditLogger, log *slog.Logger) map[HookType][]HookConfig {
+
+	configs := make(map[HookType][]HookConfig)
+	for hookType, mws := range middleware {
+		var matchers []string
+		byMatcher := make(map[string][]HookMiddleware)
+		for _, mw := range mws {
+			if _, ok := byMatcher[mw.Matcher]; !ok {
+				matchers = append(matchers, mw.Matcher)
+			}
+			byMatcher[mw.Matcher] = append(byMatcher[mw.Matcher], mw)
+		}
+
+		for _, matcher := range matchers {
+			chain := &hookChain{
+				hookType:    hookType,
+				middlewares: slices.Clone(byMatcher[matcher]),
+				audit:       audit,
+				log:         log,
+			}
+			slices.SortStableFunc(chain.middlewares,
+				func(a, b HookMiddleware) int {
+					return cmp.Compare(a.Priority, b.Priority)
+				})
+
+			configs[hookType] = append(configs[hookType], HookConfig{
+				Type:     hookType,
+				Matcher:  matcher,
+				Timeout:  chain.cliTimeout(),
+				Callback: chain.run,
+			})
+		}
+	}
+	return configs
+}
+
+// cliTimeout returns the timeout in seconds to register with the CLI, so
+// that it does not give up on the chain before the SDK does. It is zero,
+// the CLI's default, unless every middleware has a timeout.
+func (c *hookChain) cliTimeout() int {
+	var total time.Duration
+	for _, mw := range c.middlewares {
+		if mw.Timeout <= 0 {
+			return 0
+		}
+		total += mw.Timeout
+	}
+	return int(math.Ceil(total.Seconds())) + 1
+}
+
+// run invokes the middleware in order and merges their results. The chain
+// ends early at the first result that denies, blocks or stops.
+func (c *hookChain) run(ctx context.Context,
+	input HookInput) (HookResult, error) {
+
+	original := input
+	merged := newHookMerge()
+
+	// decider is the middleware whose result set the chain's current
+	// decision, if any.
+	var (
+		decider *HookMiddleware
+		failed  *HookResult
+	)
+	for i, mw := range c.middlewares {
+		result, err := c.invoke(ctx, mw, input)
+		if err != nil {
+			if mw.OnError == HookFailClosed {
+				c.log.Warn("Hook middleware failed closed",
+					"hook", c.hookType, "middleware", mw.Name,
+					"err", err)
+				result := failClosedResult(c.hookType, err)
+				decider, failed = &c.middlewares[i], &result
+				break
+			}
+
+			c.log.Warn("Hook middleware failed open",
+				"hook", c.hookType, "middleware", mw.Name,
+				"err", err)
+			continue
+		}
+
+		wire := buildHookResponse(string(c.hookType), result)
+		before := merged.outcome()
+		final := merged.add(wire)
+		if merged.outcome() != before {
+			decider = &c.middlewares[i]
+		}
+		if final {
+			break
+		}
+		input = withUpdatedInput(input, wire)
+	}
+
+	result := merged.result()
+	if failed != nil {
+		result = *failed
+	}
+	if c.audit == nil || decider == nil {
+		return result, nil
+	}
+
+	err := c.audit.recordHookDecision(original, result, decider.Name)
+	if err != nil {
+		if c.audit.failClosed {
+			c.log.Warn("Failed to record hook decision, failing "+
+				"closed", "hook", c.hookType, "err", err)
+			return failClosedResult(c.hookType, err), nil
+		}
+		c.log.Warn("Failed to record hook decision",
+			"hook", c.hookType, "err", err)
+	}
+	return result, nil
+}
+
+// invoke calls mw's callback, enforcing its timeout and recovering from
+// panics.
+func (c *hookChain) invoke(ctx context.Context, mw HookMiddleware,
+	input HookInput) (HookResult, error) {
+
+	if mw.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, mw.Timeout)
+		defer cancel()
+	}
+
+	type outcome struct {
+		result HookResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Errorf("panic: %v", r)}
+			}
+		}()
+
+		result, err := mw.Callback(ctx, input)
+		done <- outcome{result: result, err: err}
+	}()
+
+	var out outcome
+	select {
+	case out = <-done:
+	case <-ctx.Done():
+		out.err = ctx.Err()
+	}
+	if out.err != nil {
+		return HookResult{}, &ErrHookFailed{
+			HookType: string(c.hookType),
+			Cause:    fmt.Errorf("middleware %q: %w", mw.Name, out.err),
+		}
+	}
+	return out.result, nil
+}
+
+// failClosedResult is the result of a chain whose middleware failed under
+// HookFailClosed.
+func failClosedResult(hookType HookType, err error) HookResult {
+	switch hookType {
+	case HookTypePreToolUse:
+		return PreToolUseDeny(err.Error()).Result()
+
+	case HookTypePermissionRequest:
+		return PermissionRequestDecision(PermissionDeny{
+			Reason: err.Error(),
+		}).Result()
+
+	default:
+		return HookResult{StopReason: err.Error()}
+	}
+}
+
+// withUpdatedInput returns input with the tool input replaced by the
+// updatedInput of a PreToolUse response, so later middleware see it.
+func withUpdatedInput(input HookInput,
+	wire map[string]interface{}) HookInput {
+
+	pre, ok := input.(PreToolUseInput)
+	if !ok {
+		return input
+	}
+	hso, _ := wire["hookSpecificOutput"].(map[string]interface{})
+	updated, ok := hso["updatedInput"]
+	if !ok {
+		return input
+	}
+
+	data, err := json.Marshal(updated)
+	if err != nil {
+		return input
+	}
+	pre.ToolInput = data
+	return pre
+}
+
+// permissionDecisionRank orders PreToolUse decisions from least to most
+// restrictive.
+var permissionDecisionRank = map[string]int{
+	"allow": 1,
+	"ask":   2,
+	"deny":  3,
+}
+
+// hookMerge accumulates the wire responses of a chain's middleware.
+type hookMerge struct {
+	stopped    bool
+	stopReason string
+	decision   string
+	reason     string
+	suppress   bool
+	messages   []string
+	contexts   []string
+	watchPaths []string
+	modify     map[string]interface{}
+	hso        map[string]interface{}
+}
+
+// newHookMerge creates an empty merge.
+func newHookMerge() *hookMerge {
+	return &hookMerge{
+		modify: make(map[string]interface{}),
+		hso:    make(map[string]interface{}),
+	}
+}
+
+// add merges one response and reports whether it ends the chain: the first
+// denial, block or stop wins over everything after it.
+func (m *hookMerge) add(wire map[string]interface{}) bool {
+	if msg, _ := wire["systemMessage"].(string); msg != "" {
+		m.messages = append(m.messages, msg)
+	}
+	if suppress, _ := wire["suppressOutput"].(bool); suppress {
+		m.suppress = true
+	}
+	if modify, ok := wire["modify"].(map[string]interface{}); ok {
+		for key, value := range modify {
+			if _, ok := m.modify[key]; !ok {
+				m.modify[key] = value
+			}
+		}
+	}
+
+	final := false
+	if hso, ok := wire["hookSpecificOutput"].(map[string]interface{}); ok {
+		final = m.addSpecific(hso)
+	}
+
+	switch decision, _ := wire["decision"].(string); decision {
+	case "block":
+		m.decision = decision
+		m.reason, _ = wire["reason"].(string)
+		return true
+
+	case "":
+		if cont, ok := wire["continue"].(bool); ok && !cont {
+			m.stopped = true
+			m.stopReason, _ = wire["stopReason"].(string)
+			return true
+		}
+
+	default:
+		m.decision = decision
+		m.reason, _ = wire["reason"].(string)
+	}
+	return final
+}
+
+// addSpecific merges a hookSpecificOutput and reports whether it denies.
+func (m *hookMerge) addSpecific(hso map[string]interface{}) bool {
+	for key, value := range hso {
+		switch key {
+		case "additionalContext":
+			if text, _ := value.(string); text != "" {
+				m.contexts = append(m.contexts, text)
+			}
+
+		case "watchPaths":
+			paths, _ := value.([]string)
+			for _, path := range paths {
+				if !slices.Contains(m.watchPaths, path) {
+					m.watchPaths = append(m.watchPaths, path)
+				}
+			}
+
+		case "updatedInput":
+			// Each middleware sees the input updated by the ones
+			// before it, so the last update includes them all.
+			m.hso[key] = value
+
+		case "permissionDecision", "permissionDecisionReason":
+			// Merged below.
+
+		case "decision":
+			// A PermissionRequest denial overrides an earlier
+			// approval.
+			_, seen := m.hso[key]
+			if !seen || isDenyDecision(value) {
+				m.hso[key] = value
+			}
+
+		default:
+			if _, ok := m.hso[key]; !ok {
+				m.hso[key] = value
+			}
+		}
+	}
+
+	if decision, ok := hso["permissionDecision"].(string); ok {
+		current, _ := m.hso["permissionDecision"].(string)
+		if permissionDecisionRank[decision] >
+			permissionDecisionRank[current] {
+
+			m.hso["permissionDecision"] = decision
+			delete(m.hso, "permissionDecisionReason")
+			if reason, ok := hso["permissionDecisionReason"]; ok {
+				m.hso["permissionDecisionReason"] = reason
+			}
+		}
+		if decision == "deny" {
+			return true
+		}
+	}
+
+	return isDenyDecision(hso["decision"])
+}
+
+// isDenyDecision reports whether value is a PermissionRequest decision that
+// denies the tool.
+func isDenyDecision(value interface{}) bool {
+	decision, ok := value.(map[string]interface{})
+	return ok && decision["behavior"] == "deny"
+}
+
+// outcome returns the decision merged so far: the legacy decision, "stop",
+// or the PreToolUse permission decision. It is empty until a middleware
+// decides.
+func (m *hookMerge) outcome() string {
+	switch {
+	case m.decision != "":
+		return m.decision
+
+	case m.stopped:
+		return "stop"
+	}
+	decision, _ := m.hso["permissionDecision"].(string)
+	return decision
+}
+
+// result returns the merged HookResult.
+func (m *hookMerge) result() HookResult {
+	result := HookResult{
+		Continue:       !m.stopped,
+		StopReason:     m.stopReason,
+		Decision:       m.decision,
+		Reason:         m.reason,
+		SystemMessage:  strings.Join(m.messages, "\n"),
+		SuppressOutput: m.suppress,
+	}
+	if len(m.modify) > 0 {
+		result.Modify = m.modify
+	}
+
+	if len(m.contexts) > 0 {
+		m.hso["additionalContext"] = strings.Join(m.contexts, "\n\n")
+	}
+	if len(m.watchPaths) > 0 {
+		m.hso["watchPaths"] = m.watchPaths
+	}
+	if len(m.hso) > 0 {
+		result.HookSpecificOutput = m.hso
+	}
+	return result
+}
@@ -0,0 +1,292 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runChain builds the chains for middleware and runs the only one for
+// hookType with input.
+func runChain(t *testing.T, hookType HookType, input HookInput,
+	middleware ...HookMiddleware) HookResult {
+
+	t.Helper()
+
+	configs := hookChainConfigs(map[HookType][]HookMiddleware{
+		hookType: middleware,
+	}, nil, discardLogger)
+	require.Len(t, configs[hookType], 1)
+
+	result, err := configs[hookType][0].Callback(
+		context.Background(), input,
+	)
+	require.NoError(t, err)
+	return result
+}
+
+// TestHookChainOrderAndMerge verifies that middleware run by priority and
+// that their contexts, messages and updated inputs are combined.
+func TestHookChainOrderAndMerge(t *testing.T) {
+	var order []string
+	var seen string
+	result := runChain(t, HookTypePreToolUse, PreToolUseInput{
+		ToolName:  "Bash",
+		ToolInput: json.RawMessage(`{"command":"rm -rf /tmp/x"}`),
+	}, HookMiddleware{
+		Name:     "second",
+		Priority: 10,
+		Callback: func(_ context.Context,
+			input HookInput) (HookResult, error) {
+
+			order = append(order, "second")
+			seen = string(input.(PreToolUseInput).ToolInput)
+			return PreToolUseAsk("check this").
+				WithSystemMessage("asked").Result(), nil
+		},
+	}, HookMiddleware{
+		Name:     "first",
+		Priority: -10,
+		Callback: func(context.Context, HookInput) (HookResult, error) {
+			order = append(order, "first")
+			return PreToolUseAllow(map[string]interface{}{
+				"command": "rm -ri /tmp/x",
+			}).WithSystemMessage("rewrote").Result(), nil
+		},
+	})
+
+	assert.Equal(t, []string{"first", "second"}, order)
+	assert.JSONEq(t, `{"command":"rm -ri /tmp/x"}`, seen)
+
+	assert.JSONEq(t, `{"continue":true,"systemMessage":"rewrote\nasked",`+
+		`"hookSpecificOutput":{"hookEventName":"PreToolUse",`+
+		`"permissionDecision":"ask",`+
+		`"permissionDecisionReason":"check this",`+
+		`"updatedInput":{"command":"rm -ri /tmp/x"}}}`,
+		hookWire(t, HookTypePreToolUse, result))
+}
+
+// TestHookChainFirstDenyWins verifies that a denial ends the chain.
+func TestHookChainFirstDenyWins(t *testing.T) {
+	ran := false
+	result := runChain(t, HookTypeUserPromptSubmit, UserPromptSubmitInput{},
+		HookMiddleware{
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				return UserPromptSubmitAddContext("a").Result(), nil
+			},
+		}, HookMiddleware{
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				return UserPromptSubmitAddContext("b").Result(), nil
+			},
+		}, HookMiddleware{
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				return UserPromptSubmitBlock("secrets").Result(), nil
+			},
+		}, HookMiddleware{
+			Callback: func(context.Context,
+				HookInput) (HookResult, error) {
+
+				ran = true
+				return HookResult{Continue: true}, nil
+			},
+		})
+
+	assert.False(t, ran)
+	assert.JSONEq(t, `{"decision":"block","reason":"secrets",`+
+		`"hookSpecificOutput":{"hookEventName":"UserPromptSubmit",`+
+		`"additionalContext":"a\n\nb"}}`,
+		hookWire(t, HookTypeUserPromptSubmit, result))
+}
+
+// TestHookChainErrorPolicy verifies how failing, panicking and slow
+// middleware are handled under each policy.
+func TestHookChainErrorPolicy(t *testing.T) {
+	failing := func(context.Context, HookInput) (HookResult, error) {
+		return HookResult{}, errors.New("boom")
+	}
+	panicking := func(context.Context, HookInput) (HookResult, error) {
+		panic("oops")
+	}
+	slow := func(ctx context.Context, _ HookInput) (HookResult, error) {
+		<-ctx.Done()
+		return HookResult{}, ctx.Err()
+	}
+	allow := func(context.Context, HookInput) (HookResult, error) {
+		return PreToolUseAllow(nil).Result(), nil
+	}
+
+	tests := []struct {
+		name     string
+		callback HookCallback
+		timeout  time.Duration
+		policy   HookErrorPolicy
+		want     string
+	}{{
+		name:     "error fails open",
+		callback: failing,
+		want:     "allow",
+	}, {
+		name:     "panic fails open",
+		callback: panicking,
+		want:     "allow",
+	}, {
+		name:     "error fails closed",
+		callback: failing,
+		policy:   HookFailClosed,
+		want:     "deny",
+	}, {
+		name:     "panic fails closed",
+		callback: panicking,
+		policy:   HookFailClosed,
+		want:     "deny",
+	}, {
+		name:     "timeout fails closed",
+		callback: slow,
+		timeout:  20 * time.Millisecond,
+		policy:   HookFailClosed,
+		want:     "deny",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := runChain(t, HookTypePreToolUse, PreToolUseInput{},
+				HookMiddleware{
+					Name:     "guard",
+					Timeout:  tc.timeout,
+					OnError:  tc.policy,
+					Callback: tc.callback,
+				}, HookMiddleware{
+					Name:     "allow",
+					Callback: allow,
+				})
+
+			assert.Equal(t, tc.want,
+				result.HookSpecificOutput["permissionDecision"])
+		})
+	}
+
+	// Outside tool hooks, failing closed stops Claude.
+	result := runChain(t, HookTypeStop, StopInput{}, HookMiddleware{
+		Name:     "guard",
+		OnError:  HookFailClosed,
+		Callback: failing,
+	})
+	assert.False(t, result.Continue)
+	assert.Contains(t, result.StopReason, "boom")
+}
+
+// TestHookChainConfigs verifies that middleware are grouped by matcher and
+// that the CLI timeout covers the whole chain.
+func TestHookChainConfigs(t *testing.T) {
+	callback := func(context.Context, HookInput) (HookResult, error) {
+		return HookResult{Continue: true}, nil
+	}
+
+	configs := hookChainConfigs(map[HookType][]HookMiddleware{
+		HookTypePreToolUse: {
+			{Matcher: "Bash", Timeout: time.Second, Callback: callback},
+			{Matcher: "Read", Callback: callback},
+			{Matcher: "Bash", Timeout: 1500 * time.Millisecond,
+				Callback: callback},
+		},
+	}, nil, discardLogger)
+
+	chains := configs[HookTypePreToolUse]
+	require.Len(t, chains, 2)
+	assert.Equal(t, "Bash", chains[0].Matcher)
+	assert.Equal(t, 4, chains[0].Timeout)
+	assert.Equal(t, "Read", chains[1].Matcher)
+	assert.Zero(t, chains[1].Timeout)
+}
+
+// TestClientHookMiddleware verifies that middleware registered with
+// WithHookMiddleware are sent to the CLI alongside WithHooks and answer its
+// callbacks as one chain.
+func TestClientHookMiddleware(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	transport, server := NewPipeTransport()
+	defer server.Close()
+
+	deny := func(context.Context, HookInput) (HookResult, error) {
+		return PreToolUseDeny("no shell").Result(), nil
+	}
+	allow := func(context.Context, HookInput) (HookResult, error) {
+		return PreToolUseAllow(nil).Result(), nil
+	}
+
+	client, err := NewClient(
+		WithTransport(transport),
+		WithHooks(map[HookType][]HookConfig{
+			HookTypeStop: {{Callback: allow}},
+		}),
+		WithHookMiddleware(HookTypePreToolUse, HookMiddleware{
+			Name:     "allow",
+			Matcher:  "Bash",
+			Callback: allow,
+		}),
+		WithHookMiddleware(HookTypePreToolUse, HookMiddleware{
+			Name:     "deny",
+			Matcher:  "Bash",
+			Priority: -1,
+			Callback: deny,
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	initDone := make(chan SDKControlRequest, 1)
+	go func() {
+		msg, err := server.Read(ctx)
+		if err != nil {
+			return
+		}
+		req := msg.(SDKControlRequest)
+		initDone <- req
+		_ = server.RespondControl(ctx, req.RequestID, nil)
+	}()
+
+	require.NoError(t, client.Connect(ctx))
+	initReq := <-initDone
+
+	assert.Len(t, initReq.Request.Hooks[string(HookTypeStop)], 1)
+	matchers := initReq.Request.Hooks[string(HookTypePreToolUse)]
+	require.Len(t, matchers, 1)
+	assert.Equal(t, "Bash", matchers[0].Matcher)
+	require.Len(t, matchers[0].HookCallbackIDs, 1)
+
+	require.NoError(t, server.Write(ctx, SDKControlRequest{
+		Type:      "control_request",
+		RequestID: "req_hook",
+		Request: SDKControlRequestBody{
+			Subtype:    "hook_callback",
+			CallbackID: matchers[0].HookCallbackIDs[0],
+			Input: map[string]interface{}{
+				"hook_event_name": "PreToolUse",
+				"tool_name":       "Bash",
+				"tool_input":      map[string]interface{}{},
+			},
+		},
+	}))
+
+	msg, err := server.Read(ctx)
+	require.NoError(t, err)
+	resp, ok := msg.(SDKControlResponse)
+	require.True(t, ok, "unexpected message %T", msg)
+
+	hso := resp.Response.Response["hookSpecificOutput"].(map[string]interface{})
+	assert.Equal(t, "deny", hso["permissionDecision"])
+	assert.Equal(t, "no shell", hso["permissionDecisionReason"])
+}
@@ -0,0 +1,318 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+)
+
+// HookFilter narrows the events that reach a hook callback. Unlike the
+// hook's Matcher, which is sent to the CLI as is, a filter is evaluated by
+// the SDK before the callback is invoked, and an event it rejects is
+// answered as if the callback had returned HookContinue.
+//
+// Every field that is set must match; the zero HookFilter matches every
+// event. Fields about tool calls only match PreToolUse, PostToolUse,
+// PostToolUseFailure, PermissionRequest and PermissionDenied events, so
+// setting one also restricts the hook to those.
+//
+// Example:
+//
+//	HookConfig{
+//	    Type:     HookTypePreToolUse,
+//	    Filter:   HookFilter{Command: `\bgit\s+push\b`},
+//	    Callback: reviewPush,
+//	}
+type HookFilter struct {
+	// Tool is a glob over the tool name, such as "Bash", "Web*" or
+	// "mcp__github__*".
+	Tool string
+
+	// ToolRegexp is a regular expression that must match the whole tool
+	// name, such as "Edit|Write".
+	ToolRegexp string
+
+	// Command is a regular expression searched for in the command of
+	// Bash tool calls. Setting it restricts the hook to Bash.
+	Command string
+
+	// Input is a predicate over the raw tool input. MatchInput builds one
+	// from a function over a decoded input type.
+	Input func(input json.RawMessage) bool
+
+	// Path is a glob over the file path of FileChanged, ConfigChange and
+	// InstructionsLoaded events, and over the target path of file tool
+	// calls (Read, Edit, MultiEdit, Write, NotebookEdit, Glob, Grep, LS).
+	// Relative patterns are matched against the path relative to the
+	// session's working directory, absolute patterns against the absolute
+	// path. Setting it restricts the hook to events with a path.
+	Path string
+
+	// NotificationTypes restricts Notification hooks to the listed
+	// notification types, such as "permission_prompt" or "idle_prompt".
+	// Setting it restricts the hook to Notification events.
+	NotificationTypes []string
+}
+
+// MatchInput returns a HookFilter.Input predicate that decodes the tool
+// input into T and calls fn. Inputs that fail to decode do not match.
+//
+// Example:
+//
+//	Filter: HookFilter{
+//	    Tool: "Write",
+//	    Input: MatchInput(func(in FileWriteInput) bool {
+//	        return len(in.Content) > 1<<20
+//	    }),
+//	}
+func MatchInput[T any](fn func(T) bool) func(json.RawMessage) bool {
+	return func(raw json.RawMessage) bool {
+		input, err := As[T](raw)
+		if err != nil {
+			return false
+		}
+		return fn(input)
+	}
+}
+
+// isZero reports whether the filter matches every event.
+func (f HookFilter) isZero() bool {
+	return f.Tool == "" && f.ToolRegexp == "" && f.Command == "" &&
+		f.Input == nil && f.Path == "" && len(f.NotificationTypes) == 0
+}
+
+// hookFilter is a compiled HookFilter.
+type hookFilter struct {
+	tool       *regexp.Regexp
+	toolRegexp *regexp.Regexp
+	command    *regexp.Regexp
+	input      func(json.RawMessage) bool
+
+	path    *regexp.Regexp
+	pathAbs bool
+
+	notificationTypes []string
+}
+
+// compile validates the filter's patterns. field names the filter in
+// errors.
+func (f HookFilter) compile(field string) (*hookFilter, error) {
+	invalid := func(name string, err error) error {
+		return &ErrInvalidConfiguration{
+			Field:  field + "." + name,
+			Reason: err.Error(),
+		}
+	}
+
+	compiled := &hookFilter{
+		input:             f.Input,
+		pathAbs:           filepath.IsAbs(f.Path),
+		notificationTypes: f.NotificationTypes,
+	}
+
+	var err error
+	if f.Tool != "" {
+		if compiled.tool, err = globToRegexp(f.Tool); err != nil {
+			return nil, invalid("Tool", err)
+		}
+	}
+	if f.ToolRegexp != "" {
+		compiled.toolRegexp, err = regexp.Compile(
+			"^(?:" + f.ToolRegexp + ")$",
+		)
+		if err != nil {
+			return nil, invalid("ToolRegexp", err)
+		}
+	}
+	if f.Command != "" {
+		if compiled.command, err = regexp.Compile(f.Command); err != nil {
+			return nil, invalid("Command", err)
+		}
+	}
+	if f.Path != "" {
+		compiled.path, err = globToRegexp(filepath.ToSlash(f.Path))
+		if err != nil {
+			return nil, invalid("Path", err)
+		}
+	}
+
+	return compiled, nil
+}
+
+// matches reports whether the event passes every part of the filter.
+func (f *hookFilter) matches(input HookInput) bool {
+	if f.tool != nil || f.toolRegexp != nil || f.command != nil ||
+		f.input != nil {
+
+		name, raw, ok := hookToolCall(input)
+		if !ok {
+			return false
+		}
+		if f.tool != nil && !f.tool.MatchString(name) {
+			return false
+		}
+		if f.toolRegexp != nil && !f.toolRegexp.MatchString(name) {
+			return false
+		}
+		if f.command != nil {
+			if name != "Bash" {
+				return false
+			}
+			bash, err := As[BashInput](raw)
+			if err != nil || !f.command.MatchString(bash.Command) {
+				return false
+			}
+		}
+		if f.input != nil && !f.input(raw) {
+			return false
+		}
+	}
+
+	if f.path != nil {
+		path, ok := hookFilePath(input)
+		if !ok || !f.matchPath(input.Base().Cwd, path) {
+			return false
+		}
+	}
+
+	if len(f.notificationTypes) > 0 {
+		notification, ok := input.(NotificationInput)
+		if !ok || !slices.Contains(
+			f.notificationTypes, notification.NotificationType,
+		) {
+
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchPath matches path, relative to cwd, against the path glob.
+func (f *hookFilter) matchPath(cwd, path string) bool {
+	if !filepath.IsAbs(path) && cwd != "" {
+		path = filepath.Join(cwd, path)
+	}
+	path = filepath.Clean(path)
+
+	if !f.pathAbs && filepath.IsAbs(path) {
+		if cwd == "" {
+			return false
+		}
+		rel, ok := pathWithin(filepath.Clean(cwd), path)
+		if !ok {
+			return false
+		}
+		path = rel
+	}
+
+	return f.path.MatchString(filepath.ToSlash(path))
+}
+
+// hookToolCall returns the tool name and input of events about a tool call.
+func hookToolCall(input HookInput) (string, json.RawMessage, bool) {
+	switch in := input.(type) {
+	case PreToolUseInput:
+		return in.ToolName, in.ToolInput, true
+	case PostToolUseInput:
+		return in.ToolName, in.ToolInput, true
+	case PostToolUseFailureInput:
+		return in.ToolName, in.ToolInput, true
+	case PermissionRequestInput:
+		return in.ToolName, in.ToolInput, true
+	case PermissionDeniedInput:
+		return in.ToolName, in.ToolInput, true
+	default:
+		return "", nil, false
+	}
+}
+
+// hookFilePath returns the path an event is about, if any.
+func hookFilePath(input HookInput) (string, bool) {
+	switch in := input.(type) {
+	case FileChangedInput:
+		return in.FilePath, in.FilePath != ""
+	case ConfigChangeInput:
+		return in.FilePath, in.FilePath != ""
+	case InstructionsLoadedInput:
+		return in.FilePath, in.FilePath != ""
+	}
+
+	name, raw, ok := hookToolCall(input)
+	if !ok || !isPolicyFileTool(name) {
+		return "", false
+	}
+	path, err := policyFileTarget(name, raw)
+	return path, err == nil
+}
+
+// filteredHookCallback wraps callback so that it is only invoked for events
+// that pass filter.
+func filteredHookCallback(filter *hookFilter,
+	callback HookCallback) HookCallback {
+
+	return func(ctx context.Context, input HookInput) (HookResult, error) {
+		if !filter.matches(input) {
+			return HookResult{Continue: true}, nil
+		}
+		return callback(ctx, input)
+	}
+}
+
+// compileHookFilters wraps the callbacks of hooks and hook middleware that
+// have a filter. The maps are copied so the caller's are left untouched.
+func compileHookFilters(opts *Options) error {
+	if len(opts.Hooks) > 0 {
+		hooks := make(map[HookType][]HookConfig, len(opts.Hooks))
+		for hookType, configs := range opts.Hooks {
+			configs = slices.Clone(configs)
+			for i := range configs {
+				if configs[i].Filter.isZero() {
+					continue
+				}
+
+				field := fmt.Sprintf("Hooks[%s][%d].Filter", hookType, i)
+				filter, err := configs[i].Filter.compile(field)
+				if err != nil {
+					return err
+				}
+				configs[i].Callback = filteredHookCallback(
+					filter, configs[i].Callback,
+				)
+			}
+			hooks[hookType] = configs
+		}
+		opts.Hooks = hooks
+	}
+
+	if len(opts.HookMiddleware) > 0 {
+		middleware := make(
+			map[HookType][]HookMiddleware, len(opts.HookMiddleware),
+		)
+		for hookType, mws := range opts.HookMiddleware {
+			mws = slices.Clone(mws)
+			for i := range mws {
+				if mws[i].Filter.isZero() {
+					continue
+				}
+
+				field := fmt.Sprintf("HookMiddleware[%s][%d].Filter",
+					hookType, i)
+				filter, err := mws[i].Filter.compile(field)
+				if err != nil {
+					return err
+				}
+				mws[i].Callback = filteredHookCallback(
+					filter, mws[i].Callback,
+				)
+			}
+			middleware[hookType] = mws
+		}
+		opts.HookMiddleware = middleware
+	}
+
+	return nil
+}
@@ -0,0 +1,248 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestHookFilterMatches verifies each filter field against the events it
+// applies to.
+func TestHookFilterMatches(t *testing.T) {
+	base := BaseHookInput{Cwd: "/src/app"}
+	bash := func(command string) PreToolUseInput {
+		return PreToolUseInput{
+			BaseHookInput: base,
+			ToolName:      "Bash",
+			ToolInput: json.RawMessage(
+				`{"command":` + mustJSON(t, command) + `}`,
+			),
+		}
+	}
+	write := func(path string, content string) PostToolUseInput {
+		return PostToolUseInput{
+			BaseHookInput: base,
+			ToolName:      "Write",
+			ToolInput: json.RawMessage(`{"file_path":` +
+				mustJSON(t, path) + `,"content":` +
+				mustJSON(t, content) + `}`),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter HookFilter
+		input  HookInput
+		want   bool
+	}{{
+		name:   "zero filter",
+		filter: HookFilter{},
+		input:  StopInput{},
+		want:   true,
+	}, {
+		name:   "tool glob",
+		filter: HookFilter{Tool: "mcp__github__*"},
+		input: PreToolUseInput{
+			ToolName: "mcp__github__create_issue",
+		},
+		want: true,
+	}, {
+		name:   "tool glob mismatch",
+		filter: HookFilter{Tool: "mcp__github__*"},
+		input:  bash("ls"),
+		want:   false,
+	}, {
+		name:   "tool filter skips non tool events",
+		filter: HookFilter{Tool: "*"},
+		input:  StopInput{},
+		want:   false,
+	}, {
+		name:   "tool regexp is anchored",
+		filter: HookFilter{ToolRegexp: "Edit|Write"},
+		input:  PreToolUseInput{ToolName: "NotebookEdit"},
+		want:   false,
+	}, {
+		name:   "tool regexp",
+		filter: HookFilter{ToolRegexp: "Edit|Write"},
+		input:  write("main.go", ""),
+		want:   true,
+	}, {
+		name:   "bash command",
+		filter: HookFilter{Command: `\bgit\s+push\b`},
+		input:  bash("go test ./... && git push origin main"),
+		want:   true,
+	}, {
+		name:   "bash command mismatch",
+		filter: HookFilter{Command: `\bgit\s+push\b`},
+		input:  bash("git status"),
+		want:   false,
+	}, {
+		name:   "command restricts to bash",
+		filter: HookFilter{Command: ".*"},
+		input:  write("main.go", ""),
+		want:   false,
+	}, {
+		name: "input predicate",
+		filter: HookFilter{
+			Input: MatchInput(func(in FileWriteInput) bool {
+				return len(in.Content) > 3
+			}),
+		},
+		input: write("main.go", "package main"),
+		want:  true,
+	}, {
+		name:   "relative path glob on tool",
+		filter: HookFilter{Path: "**/*.go"},
+		input:  write("/src/app/cmd/main.go", ""),
+		want:   true,
+	}, {
+		name:   "relative path glob outside cwd",
+		filter: HookFilter{Path: "**/*.go"},
+		input:  write("/tmp/main.go", ""),
+		want:   false,
+	}, {
+		name:   "absolute path glob on file changed",
+		filter: HookFilter{Path: "/src/app/.env*"},
+		input: FileChangedInput{
+			BaseHookInput: base,
+			FilePath:      "/src/app/.env.local",
+		},
+		want: true,
+	}, {
+		name:   "relative path glob on escaping glob pattern",
+		filter: HookFilter{Path: "**"},
+		input: PreToolUseInput{
+			BaseHookInput: base,
+			ToolName:      "Glob",
+			ToolInput:     json.RawMessage(`{"pattern":"/etc/**/*"}`),
+		},
+		want: false,
+	}, {
+		name:   "absolute path glob on glob pattern",
+		filter: HookFilter{Path: "/etc"},
+		input: PreToolUseInput{
+			BaseHookInput: base,
+			ToolName:      "Glob",
+			ToolInput:     json.RawMessage(`{"pattern":"/etc/**/*"}`),
+		},
+		want: true,
+	}, {
+		name:   "grep glob with undeterminable target",
+		filter: HookFilter{Path: "/**"},
+		input: PreToolUseInput{
+			BaseHookInput: base,
+			ToolName:      "Grep",
+			ToolInput: json.RawMessage(
+				`{"pattern":"x","glob":"**/../../*.pem"}`,
+			),
+		},
+		want: false,
+	}, {
+		name:   "path restricts to events with a path",
+		filter: HookFilter{Path: "**"},
+		input:  bash("ls"),
+		want:   false,
+	}, {
+		name: "notification type",
+		filter: HookFilter{
+			NotificationTypes: []string{"idle_prompt"},
+		},
+		input: NotificationInput{NotificationType: "idle_prompt"},
+		want:  true,
+	}, {
+		name: "notification type mismatch",
+		filter: HookFilter{
+			NotificationTypes: []string{"idle_prompt"},
+		},
+		input: NotificationInput{NotificationType: "permission_prompt"},
+		want:  false,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := tc.filter.compile("Filter")
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, filter.matches(tc.input))
+		})
+	}
+}
+
+// mustJSON encodes v as a JSON string.
+func mustJSON(t *testing.T, v string) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// TestNewClientHookFilters verifies that NewClient wraps filtered hooks
+// without modifying the caller's configuration and rejects invalid
+// patterns.
+func TestNewClientHookFilters(t *testing.T) {
+	called := 0
+	callback := func(context.Context, HookInput) (HookResult, error) {
+		called++
+		return PreToolUseDeny("no").Result(), nil
+	}
+
+	hooks := map[HookType][]HookConfig{
+		HookTypePreToolUse: {{
+			Filter:   HookFilter{Command: "rm"},
+			Callback: callback,
+		}},
+	}
+	client, err := NewClient(
+		WithHooks(hooks),
+		WithHookMiddleware(HookTypeNotification, HookMiddleware{
+			Filter: HookFilter{
+				NotificationTypes: []string{"idle_prompt"},
+			},
+			Callback: callback,
+		}),
+	)
+	require.NoError(t, err)
+
+	hook := client.options.Hooks[HookTypePreToolUse][0].Callback
+	result, err := hook(context.Background(), PreToolUseInput{
+		ToolName:  "Bash",
+		ToolInput: json.RawMessage(`{"command":"ls"}`),
+	})
+	require.NoError(t, err)
+	assert.True(t, result.Continue)
+	assert.Zero(t, called)
+
+	_, err = hook(context.Background(), PreToolUseInput{
+		ToolName:  "Bash",
+		ToolInput: json.RawMessage(`{"command":"rm -rf /"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, called)
+
+	mw := client.options.HookMiddleware[HookTypeNotification][0].Callback
+	_, err = mw(context.Background(), NotificationInput{
+		NotificationType: "auth_success",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, called)
+
+	// The caller's map still holds the unwrapped callback.
+	_, err = hooks[HookTypePreToolUse][0].Callback(
+		context.Background(), StopInput{},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, 2, called)
+
+	_, err = NewClient(WithHooks(map[HookType][]HookConfig{
+		HookTypePreToolUse: {{
+			Filter:   HookFilter{ToolRegexp: "("},
+			Callback: callback,
+		}},
+	}))
+	var invalid *ErrInvalidConfiguration
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "Hooks[PreToolUse][0].Filter.ToolRegexp", invalid.Field)
+}
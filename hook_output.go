@@ -0,0 +1,391 @@
+package claudeagent
+
+import (
+	"context"
+	"fmt"
+)
+
+// HookOutput is the result of a hook for the event whose input type is I,
+// such as HookOutput[PreToolUseInput]. Unlike HookResult, it can only be
+// built by the constructors for that event, which set just the fields the
+// CLI honors for it, and by the event-agnostic HookContinue and HookStop.
+//
+// Register callbacks returning a HookOutput with TypedHook, so that
+// returning the output of another event fails to compile:
+//
+//	hook := claudeagent.TypedHook("Bash", func(ctx context.Context,
+//	    in claudeagent.PreToolUseInput) (
+//	    claudeagent.HookOutput[claudeagent.PreToolUseInput], error) {
+//
+//	    if strings.Contains(string(in.ToolInput), "rm -rf") {
+//	        return claudeagent.PreToolUseDeny("destructive command"), nil
+//	    }
+//	    return claudeagent.HookContinue[claudeagent.PreToolUseInput](), nil
+//	})
+//	client, _ := claudeagent.NewClient(claudeagent.WithHooks(
+//	    map[claudeagent.HookType][]claudeagent.HookConfig{
+//	        hook.Type: {hook},
+//	    },
+//	))
+type HookOutput[I HookInput] struct {
+	result HookResult
+}
+
+// Result returns the output as a HookResult, for callbacks registered as a
+// plain HookCallback.
+func (o HookOutput[I]) Result() HookResult {
+	return o.result
+}
+
+// WithSystemMessage adds a message shown to the user.
+func (o HookOutput[I]) WithSystemMessage(msg string) HookOutput[I] {
+	o.result.SystemMessage = msg
+	return o
+}
+
+// WithSuppressOutput hides the hook's output from the transcript.
+func (o HookOutput[I]) WithSuppressOutput() HookOutput[I] {
+	o.result.SuppressOutput = true
+	return o
+}
+
+// HookContinue lets execution proceed unchanged. It is valid for every
+// event.
+func HookContinue[I HookInput]() HookOutput[I] {
+	return HookOutput[I]{result: HookResult{Continue: true}}
+}
+
+// HookStop stops Claude after the hook, ending the turn with reason shown
+// to the user. It is valid for every event.
+func HookStop[I HookInput](reason string) HookOutput[I] {
+	return HookOutput[I]{result: HookResult{StopReason: reason}}
+}
+
+// TypedHook registers fn for the event of its input type, I, on tools
+// matching matcher. fn receives the input as I and must return output
+// built for the same event.
+func TypedHook[I HookInput](matcher string,
+	fn func(context.Context, I) (HookOutput[I], error)) HookConfig {
+
+	var zero I
+	hookType := zero.HookType()
+
+	return HookConfig{
+		Type:    hookType,
+		Matcher: matcher,
+		Callback: func(ctx context.Context,
+			input HookInput) (HookResult, error) {
+
+			typed, ok := input.(I)
+			if !ok {
+				return HookResult{}, &ErrHookFailed{
+					HookType: string(hookType),
+					Cause: fmt.Errorf("unexpected input %T "+
+						"for %s hook", input, hookType),
+				}
+			}
+
+			out, err := fn(ctx, typed)
+			if err != nil {
+				return HookResult{}, err
+			}
+			return out.result, nil
+		},
+	}
+}
+
+// specificOutput builds output carrying the hookSpecificOutput fields for
+// the event of I.
+func specificOutput[I HookInput](fields map[string]interface{}) HookOutput[I] {
+	var zero I
+	fields["hookEventName"] = string(zero.HookType())
+
+	return HookOutput[I]{result: HookResult{
+		Continue:           true,
+		HookSpecificOutput: fields,
+	}}
+}
+
+// additionalContext builds output that adds text to Claude's context, for
+// the events that accept additionalContext.
+func additionalContext[I HookInput](text string) HookOutput[I] {
+	return specificOutput[I](map[string]interface{}{
+		"additionalContext": text,
+	})
+}
+
+// PreToolUseOutput is the decision of a PreToolUse hook.
+type PreToolUseOutput struct {
+	// Decision is PermissionBehaviorAllow, PermissionBehaviorDeny or
+	// PermissionBehaviorAsk. Empty leaves the decision to the usual
+	// permission flow.
+	Decision PermissionBehavior
+
+	// Reason explains the decision. For a denial it is shown to Claude.
+	Reason string
+
+	// UpdatedInput replaces the tool input.
+	UpdatedInput map[string]interface{}
+
+	// AdditionalContext is added to Claude's context.
+	AdditionalContext string
+}
+
+// PreToolUseResult builds the output of a PreToolUse hook from out.
+func PreToolUseResult(out PreToolUseOutput) HookOutput[PreToolUseInput] {
+	fields := make(map[string]interface{})
+	if out.Decision != "" {
+		fields["permissionDecision"] = string(out.Decision)
+	}
+	if out.Reason != "" {
+		fields["permissionDecisionReason"] = out.Reason
+	}
+	if out.UpdatedInput != nil {
+		fields["updatedInput"] = out.UpdatedInput
+	}
+	if out.AdditionalContext != "" {
+		fields["additionalContext"] = out.AdditionalContext
+	}
+	return specificOutput[PreToolUseInput](fields)
+}
+
+// PreToolUseAllow allows the tool to run without asking. A non-nil
+// updatedInput replaces the tool input.
+func PreToolUseAllow(
+	updatedInput map[string]interface{}) HookOutput[PreToolUseInput] {
+
+	return PreToolUseResult(PreToolUseOutput{
+		Decision:     PermissionBehaviorAllow,
+		UpdatedInput: updatedInput,
+	})
+}
+
+// PreToolUseDeny blocks the tool, telling Claude why.
+func PreToolUseDeny(reason string) HookOutput[PreToolUseInput] {
+	return PreToolUseResult(PreToolUseOutput{
+		Decision: PermissionBehaviorDeny,
+		Reason:   reason,
+	})
+}
+
+// PreToolUseAsk asks the user to approve the tool, showing reason.
+func PreToolUseAsk(reason string) HookOutput[PreToolUseInput] {
+	return PreToolUseResult(PreToolUseOutput{
+		Decision: PermissionBehaviorAsk,
+		Reason:   reason,
+	})
+}
+
+// PostToolUseAddContext adds text to Claude's context after the tool ran.
+func PostToolUseAddContext(text string) HookOutput[PostToolUseInput] {
+	return additionalContext[PostToolUseInput](text)
+}
+
+// PostToolUseReplaceMCPOutput replaces the output of an MCP tool before
+// Claude sees it.
+func PostToolUseReplaceMCPOutput(
+	output interface{}) HookOutput[PostToolUseInput] {
+
+	return specificOutput[PostToolUseInput](map[string]interface{}{
+		"updatedMCPToolOutput": output,
+	})
+}
+
+// PostToolUseBlock tells Claude the tool's result was rejected, giving
+// reason.
+func PostToolUseBlock(reason string) HookOutput[PostToolUseInput] {
+	return HookOutput[PostToolUseInput]{result: HookResult{
+		Decision: "block",
+		Reason:   reason,
+	}}
+}
+
+// PostToolUseFailureAddContext adds text to Claude's context after the
+// tool failed.
+func PostToolUseFailureAddContext(
+	text string) HookOutput[PostToolUseFailureInput] {
+
+	return additionalContext[PostToolUseFailureInput](text)
+}
+
+// UserPromptSubmitAddContext adds text to Claude's context along with the
+// prompt.
+func UserPromptSubmitAddContext(
+	text string) HookOutput[UserPromptSubmitInput] {
+
+	return additionalContext[UserPromptSubmitInput](text)
+}
+
+// UserPromptSubmitBlock rejects the prompt, showing reason to the user.
+func UserPromptSubmitBlock(reason string) HookOutput[UserPromptSubmitInput] {
+	return HookOutput[UserPromptSubmitInput]{result: HookResult{
+		Decision: "block",
+		Reason:   reason,
+	}}
+}
+
+// SessionStartAdditionalContext adds text to Claude's context at the start
+// of the session.
+func SessionStartAdditionalContext(
+	text string) HookOutput[SessionStartInput] {
+
+	return additionalContext[SessionStartInput](text)
+}
+
+// SessionStartWatch asks the CLI to run the hook again when any of paths
+// change.
+func SessionStartWatch(paths ...string) HookOutput[SessionStartInput] {
+	return specificOutput[SessionStartInput](map[string]interface{}{
+		"watchPaths": paths,
+	})
+}
+
+// SetupAdditionalContext adds text to Claude's context after setup.
+func SetupAdditionalContext(text string) HookOutput[SetupInput] {
+	return additionalContext[SetupInput](text)
+}
+
+// SubagentStartAdditionalContext adds text to the subagent's context.
+func SubagentStartAdditionalContext(
+	text string) HookOutput[SubagentStartInput] {
+
+	return additionalContext[SubagentStartInput](text)
+}
+
+// PermissionRequestDecision answers the permission prompt with result,
+// a PermissionAllow or PermissionDeny, instead of asking the user.
+func PermissionRequestDecision(
+	result PermissionResult) HookOutput[PermissionRequestInput] {
+
+	decision := map[string]interface{}{"behavior": "deny"}
+	switch r := result.(type) {
+	case PermissionAllow:
+		decision["behavior"] = "allow"
+		if r.UpdatedInput != nil {
+			decision["updatedInput"] = r.UpdatedInput
+		}
+		if len(r.UpdatedPermissions) > 0 {
+			decision["updatedPermissions"] = r.UpdatedPermissions
+		}
+
+	case PermissionDeny:
+		if r.Reason != "" {
+			decision["message"] = r.Reason
+		}
+		if r.Interrupt {
+			decision["interrupt"] = true
+		}
+
+	default:
+		if result != nil && result.IsAllow() {
+			decision["behavior"] = "allow"
+		}
+	}
+
+	return specificOutput[PermissionRequestInput](map[string]interface{}{
+		"decision": decision,
+	})
+}
+
+// PermissionDeniedRetry lets Claude retry the denied tool call.
+func PermissionDeniedRetry() HookOutput[PermissionDeniedInput] {
+	return specificOutput[PermissionDeniedInput](map[string]interface{}{
+		"retry": true,
+	})
+}
+
+// elicitationAction builds output answering an elicitation.
+func elicitationAction[I HookInput](action string,
+	content map[string]interface{}) HookOutput[I] {
+
+	fields := map[string]interface{}{"action": action}
+	if content != nil {
+		fields["content"] = content
+	}
+	return specificOutput[I](fields)
+}
+
+// ElicitationAccept answers the MCP server's elicitation with content
+// instead of asking the user.
+func ElicitationAccept(
+	content map[string]interface{}) HookOutput[ElicitationInput] {
+
+	return elicitationAction[ElicitationInput](
+		ElicitationActionAccept, content,
+	)
+}
+
+// ElicitationDecline declines the MCP server's elicitation.
+func ElicitationDecline() HookOutput[ElicitationInput] {
+	return elicitationAction[ElicitationInput](
+		ElicitationActionDecline, nil,
+	)
+}
+
+// ElicitationCancel cancels the MCP server's elicitation.
+func ElicitationCancel() HookOutput[ElicitationInput] {
+	return elicitationAction[ElicitationInput](
+		ElicitationActionCancel, nil,
+	)
+}
+
+// ElicitationResultOverride replaces the user's answer to an elicitation
+// before it is sent to the MCP server. action is one of the
+// ElicitationAction constants.
+func ElicitationResultOverride(action string,
+	content map[string]interface{}) HookOutput[ElicitationResultInput] {
+
+	return elicitationAction[ElicitationResultInput](action, content)
+}
+
+// CwdChangedWatch asks the CLI to run the hook again when any of paths
+// change.
+func CwdChangedWatch(paths ...string) HookOutput[CwdChangedInput] {
+	return specificOutput[CwdChangedInput](map[string]interface{}{
+		"watchPaths": paths,
+	})
+}
+
+// FileChangedWatch asks the CLI to run the hook again when any of paths
+// change.
+func FileChangedWatch(paths ...string) HookOutput[FileChangedInput] {
+	return specificOutput[FileChangedInput](map[string]interface{}{
+		"watchPaths": paths,
+	})
+}
+
+// WorktreeCreated reports the path of the worktree the hook created.
+func WorktreeCreated(path string) HookOutput[WorktreeCreateInput] {
+	return specificOutput[WorktreeCreateInput](map[string]interface{}{
+		"worktreePath": path,
+	})
+}
+
+// StopApprove lets Claude stop.
+func StopApprove() HookOutput[StopInput] {
+	return HookOutput[StopInput]{result: HookResult{Decision: "approve"}}
+}
+
+// StopBlock keeps Claude working, with prompt as its next instruction.
+func StopBlock(prompt string) HookOutput[StopInput] {
+	return HookOutput[StopInput]{result: HookResult{
+		Decision: "block",
+		Reason:   prompt,
+	}}
+}
+
+// SubagentStopApprove lets the subagent stop.
+func SubagentStopApprove() HookOutput[SubagentStopInput] {
+	return HookOutput[SubagentStopInput]{result: HookResult{
+		Decision: "approve",
+	}}
+}
+
+// SubagentStopBlock keeps the subagent working, with prompt as its next
+// instruction.
+func SubagentStopBlock(prompt string) HookOutput[SubagentStopInput] {
+	return HookOutput[SubagentStopInput]{result: HookResult{
+		Decision: "block",
+		Reason:   prompt,
+	}}
+}
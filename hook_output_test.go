@@ -0,0 +1,148 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hookWire returns the JSON the CLI receives for result from a hookType
+// hook.
+func hookWire(t *testing.T, hookType HookType, result HookResult) string {
+	t.Helper()
+
+	data, err := json.Marshal(buildHookResponse(string(hookType), result))
+	require.NoError(t, err)
+	return string(data)
+}
+
+// TestHookOutputWire verifies the response each typed constructor produces.
+func TestHookOutputWire(t *testing.T) {
+	tests := []struct {
+		name     string
+		hookType HookType
+		result   HookResult
+		want     string
+	}{{
+		name:     "pre tool use allow",
+		hookType: HookTypePreToolUse,
+		result: PreToolUseAllow(map[string]interface{}{
+			"command": "ls",
+		}).Result(),
+		want: `{"continue":true,"hookSpecificOutput":{` +
+			`"hookEventName":"PreToolUse",` +
+			`"permissionDecision":"allow",` +
+			`"updatedInput":{"command":"ls"}}}`,
+	}, {
+		name:     "pre tool use deny",
+		hookType: HookTypePreToolUse,
+		result:   PreToolUseDeny("no").Result(),
+		want: `{"continue":true,"hookSpecificOutput":{` +
+			`"hookEventName":"PreToolUse",` +
+			`"permissionDecision":"deny",` +
+			`"permissionDecisionReason":"no"}}`,
+	}, {
+		name:     "user prompt context",
+		hookType: HookTypeUserPromptSubmit,
+		result:   UserPromptSubmitAddContext("today is friday").Result(),
+		want: `{"continue":true,"hookSpecificOutput":{` +
+			`"additionalContext":"today is friday",` +
+			`"hookEventName":"UserPromptSubmit"}}`,
+	}, {
+		name:     "user prompt block",
+		hookType: HookTypeUserPromptSubmit,
+		result:   UserPromptSubmitBlock("secrets").Result(),
+		want:     `{"decision":"block","reason":"secrets"}`,
+	}, {
+		name:     "session start watch",
+		hookType: HookTypeSessionStart,
+		result:   SessionStartWatch(".env").Result(),
+		want: `{"continue":true,"hookSpecificOutput":{` +
+			`"hookEventName":"SessionStart",` +
+			`"watchPaths":[".env"]}}`,
+	}, {
+		name:     "permission request deny",
+		hookType: HookTypePermissionRequest,
+		result: PermissionRequestDecision(PermissionDeny{
+			Reason:    "not on weekends",
+			Interrupt: true,
+		}).Result(),
+		want: `{"continue":true,"hookSpecificOutput":{"decision":{` +
+			`"behavior":"deny","interrupt":true,` +
+			`"message":"not on weekends"},` +
+			`"hookEventName":"PermissionRequest"}}`,
+	}, {
+		name:     "permission request allow",
+		hookType: HookTypePermissionRequest,
+		result: PermissionRequestDecision(PermissionAllow{
+			UpdatedInput: json.RawMessage(`{"path":"/tmp/x"}`),
+		}).Result(),
+		want: `{"continue":true,"hookSpecificOutput":{"decision":{` +
+			`"behavior":"allow","updatedInput":{"path":"/tmp/x"}},` +
+			`"hookEventName":"PermissionRequest"}}`,
+	}, {
+		name:     "elicitation accept",
+		hookType: HookTypeElicitation,
+		result: ElicitationAccept(map[string]interface{}{
+			"name": "gopher",
+		}).Result(),
+		want: `{"continue":true,"hookSpecificOutput":{` +
+			`"action":"accept","content":{"name":"gopher"},` +
+			`"hookEventName":"Elicitation"}}`,
+	}, {
+		name:     "worktree created",
+		hookType: HookTypeWorktreeCreate,
+		result:   WorktreeCreated("/src/wt").Result(),
+		want: `{"continue":true,"hookSpecificOutput":{` +
+			`"hookEventName":"WorktreeCreate",` +
+			`"worktreePath":"/src/wt"}}`,
+	}, {
+		name:     "stop block",
+		hookType: HookTypeStop,
+		result: StopBlock("keep going").
+			WithSystemMessage("iteration 2").Result(),
+		want: `{"decision":"block","reason":"keep going",` +
+			`"systemMessage":"iteration 2"}`,
+	}, {
+		name:     "generic stop",
+		hookType: HookTypeTaskCompleted,
+		result: HookStop[TaskCompletedInput]("tests fail").
+			WithSuppressOutput().Result(),
+		want: `{"continue":false,"stopReason":"tests fail",` +
+			`"suppressOutput":true}`,
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.JSONEq(t, tc.want, hookWire(t, tc.hookType, tc.result))
+		})
+	}
+}
+
+// TestTypedHook verifies that TypedHook registers the callback for its
+// input's event and passes it the typed input.
+func TestTypedHook(t *testing.T) {
+	hook := TypedHook("Bash", func(_ context.Context,
+		in PreToolUseInput) (HookOutput[PreToolUseInput], error) {
+
+		if in.ToolName == "Bash" {
+			return PreToolUseDeny("no shell"), nil
+		}
+		return HookContinue[PreToolUseInput](), nil
+	})
+	assert.Equal(t, HookTypePreToolUse, hook.Type)
+	assert.Equal(t, "Bash", hook.Matcher)
+
+	result, err := hook.Callback(context.Background(), PreToolUseInput{
+		ToolName: "Bash",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, PreToolUseDeny("no shell").Result(), result)
+
+	_, err = hook.Callback(context.Background(), StopInput{})
+	var failed *ErrHookFailed
+	assert.ErrorAs(t, err, &failed)
+}
@@ -0,0 +1,471 @@
+package claudeagent
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// DefaultIsolationPassEnv lists the host environment variables an isolated
+// CLI receives when IsolationOptions.PassEnv is nil and no Command template
+// is used.
+var DefaultIsolationPassEnv = []string{
+	"PATH", "HOME", "USER", "LANG", "LC_ALL", "TERM", "TMPDIR",
+}
+
+// IsolationOptions isolates the CLI subprocess from the host. It is applied
+// by IsolatedRunner, which NewSubprocessTransport uses when
+// Options.Isolation is set.
+//
+// Unlike a plain subprocess, an isolated CLI does not inherit the host
+// environment: it receives only the variables named in PassEnv, plus
+// Options.Env and the variables the SDK sets itself. Pass credentials such
+// as ANTHROPIC_API_KEY explicitly with WithEnv.
+//
+// Command and Bubblewrap choose how the CLI is launched and are mutually
+// exclusive. User and Limits apply to the local process tree and may be
+// combined with Bubblewrap.
+type IsolationOptions struct {
+	// Command launches the CLI through another program, such as
+	// "docker exec" or "kubectl exec". Each element may contain the
+	// placeholders "{cli}" for the CLI path and "{cwd}" for the working
+	// directory. An element that is exactly "{env}" expands to EnvFlag
+	// followed by the name of each variable the CLI receives, so the
+	// launcher forwards them without their values appearing in argv. The
+	// CLI arguments are appended at the end. For example:
+	//
+	//	[]string{"docker", "exec", "-i", "-w", "{cwd}", "{env}",
+	//	    "agent-box", "claude"}
+	Command []string
+
+	// EnvFlag is the launcher flag that forwards a variable, used to
+	// expand "{env}" in Command. Defaults to "-e".
+	EnvFlag string
+
+	// Bubblewrap, if set, runs the CLI in fresh Linux namespaces with
+	// bwrap.
+	Bubblewrap *BubblewrapOptions
+
+	// User, if set, runs the CLI as another user. The SDK's process needs
+	// the privileges to switch to it. Linux only.
+	User *IsolationUser
+
+	// Limits, if set, runs the CLI in its own cgroup with resource limits.
+	// Linux only.
+	Limits *ResourceLimits
+
+	// PassEnv names the host environment variables the CLI receives. If
+	// nil, DefaultIsolationPassEnv is used without a Command and no
+	// variables are passed with one, since the launcher would forward
+	// them into the container.
+	PassEnv []string
+}
+
+// DefaultBubblewrapReadOnlyPaths are the host paths a bwrap sandbox mounts
+// read-only unless BubblewrapOptions.BindHostRoot is set: system binaries
+// and libraries, CA certificates and the files needed to resolve names.
+// Paths missing on the host are skipped.
+var DefaultBubblewrapReadOnlyPaths = []string{
+	"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64",
+	"/etc/alternatives", "/etc/ssl", "/etc/pki", "/etc/ca-certificates",
+	"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf",
+	"/etc/localtime", "/etc/passwd", "/etc/group",
+}
+
+// BubblewrapOptions configures a bwrap sandbox. Only
+// DefaultBubblewrapReadOnlyPaths, the directory holding the CLI and
+// ReadOnlyPaths are mounted from the host, read-only, with a private /tmp,
+// /dev and /proc and an empty home directory. The working directory,
+// Options.AdditionalDirectories and CLAUDE_CONFIG_DIR, if set, are mounted
+// read-write. Host credentials, such as cloud provider configuration in the
+// home directory, are therefore not visible to the CLI.
+//
+// The CLI stores session transcripts in ~/.claude unless CLAUDE_CONFIG_DIR
+// is set. Since the home directory is empty and discarded on exit, either
+// add ~/.claude to WritablePaths or set CLAUDE_CONFIG_DIR with WithEnv,
+// otherwise sessions cannot be resumed.
+type BubblewrapOptions struct {
+	// Path is the bwrap executable. Defaults to "bwrap" from PATH.
+	Path string
+
+	// ShareNetwork keeps the host network namespace. The CLI needs
+	// network access to reach the API unless a proxy is mounted in.
+	ShareNetwork bool
+
+	// ReadOnlyPaths are additional host paths mounted read-only, for
+	// example a Node.js installation outside /usr.
+	ReadOnlyPaths []string
+
+	// BindHostRoot mounts the whole host file system read-only instead of
+	// DefaultBubblewrapReadOnlyPaths. The CLI can then read every file
+	// the SDK's user can, except HiddenPaths and the home directory.
+	BindHostRoot bool
+
+	// WritablePaths are mounted read-write, for example ~/.claude, the
+	// CLI's default config directory.
+	WritablePaths []string
+
+	// HiddenPaths are replaced by empty directories, for example
+	// directories holding the host's credentials.
+	HiddenPaths []string
+
+	// ExtraArgs are passed to bwrap before the command.
+	ExtraArgs []string
+}
+
+// IsolationUser is the identity an isolated CLI runs as.
+type IsolationUser struct {
+	UID    uint32
+	GID    uint32
+	Groups []uint32
+}
+
+// ResourceLimits are the cgroup v2 limits for an isolated CLI and every
+// process it starts. Zero values leave a limit unset.
+type ResourceLimits struct {
+	// CgroupParent is a cgroup v2 directory delegated to this process,
+	// with the needed controllers enabled in its cgroup.subtree_control,
+	// for example "/sys/fs/cgroup/claude-agents". Each CLI gets a child
+	// cgroup that is removed when it exits.
+	CgroupParent string
+
+	// MemoryMaxBytes is written to memory.max.
+	MemoryMaxBytes int64
+
+	// CPUs is the CPU bandwidth in cores, written to cpu.max.
+	CPUs float64
+
+	// PidsMax is written to pids.max.
+	PidsMax int64
+}
+
+// validate checks that the options can be applied on this platform.
+func (s *IsolationOptions) validate() error {
+	switch {
+	case len(s.Command) > 0 && s.Bubblewrap != nil:
+		return &ErrInvalidConfiguration{
+			Field:  "Isolation",
+			Reason: "Command and Bubblewrap are mutually exclusive",
+		}
+
+	case len(s.Command) > 0 && s.Limits != nil:
+		return &ErrInvalidConfiguration{
+			Field: "Isolation.Limits",
+			Reason: "limits apply to local processes, use the " +
+				"launcher's own limits with Command",
+		}
+
+	case s.Limits != nil && s.Limits.CgroupParent == "":
+		return &ErrInvalidConfiguration{
+			Field:  "Isolation.Limits.CgroupParent",
+			Reason: "a delegated cgroup directory must be specified",
+		}
+	}
+
+	return validatePlatformIsolation(s)
+}
+
+// environ returns the environment for an isolated CLI: the allowed host
+// variables followed by the CLI's own.
+func (s *IsolationOptions) environ(cliEnv []string) []string {
+	pass := s.PassEnv
+	if pass == nil && len(s.Command) == 0 {
+		pass = DefaultIsolationPassEnv
+	}
+
+	return append(hostEnv(pass), cliEnv...)
+}
+
+// hostEnv returns the named variables from the host environment as
+// KEY=value pairs, skipping any that are unset.
+func hostEnv(names []string) []string {
+	var env []string
+	for _, name := range names {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+// command returns the program and arguments that launch the CLI.
+func (s *IsolationOptions) command(cliPath string, args, env []string,
+	cwd string) []string {
+
+	switch {
+	case len(s.Command) > 0:
+		return s.templateCommand(cliPath, args, env, cwd)
+
+	case s.Bubblewrap != nil:
+		return s.bubblewrapCommand(cliPath, args, env, cwd)
+	}
+
+	return append([]string{cliPath}, args...)
+}
+
+// templateCommand expands the Command template.
+func (s *IsolationOptions) templateCommand(cliPath string, args, env []string,
+	cwd string) []string {
+
+	flag := s.EnvFlag
+	if flag == "" {
+		flag = "-e"
+	}
+
+	replacer := strings.NewReplacer("{cli}", cliPath, "{cwd}", cwd)
+
+	var argv []string
+	for _, elem := range s.Command {
+		if elem != "{env}" {
+			argv = append(argv, replacer.Replace(elem))
+			continue
+		}
+
+		for _, kv := range env {
+			name, _, _ := strings.Cut(kv, "=")
+			argv = append(argv, flag, name)
+		}
+	}
+	return append(argv, args...)
+}
+
+// bubblewrapCommand wraps the CLI in bwrap. The home directory named by
+// HOME in env is replaced by an empty one, and the directories the CLI is
+// told to use in args and env are mounted read-write.
+func (s *IsolationOptions) bubblewrapCommand(cliPath string, args, env []string,
+	cwd string) []string {
+
+	opts := s.Bubblewrap
+	path := opts.Path
+	if path == "" {
+		path = "bwrap"
+	}
+
+	argv := []string{
+		path,
+		"--die-with-parent",
+		"--new-session",
+		"--unshare-all",
+	}
+	if opts.ShareNetwork {
+		argv = append(argv, "--share-net")
+	}
+
+	if opts.BindHostRoot {
+		argv = append(argv, "--ro-bind", "/", "/")
+	} else {
+		readOnly := slices.Clone(DefaultBubblewrapReadOnlyPaths)
+		for _, dir := range bubblewrapCLIDirs(cliPath) {
+			if !bubblewrapCovered(readOnly, dir) {
+				readOnly = append(readOnly, dir)
+			}
+		}
+		for _, dir := range readOnly {
+			argv = append(argv, "--ro-bind-try", dir, dir)
+		}
+	}
+	argv = append(argv,
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+	)
+	if home := envValue(env, "HOME"); home != "" && home != "/" {
+		argv = append(argv, "--tmpfs", home)
+	}
+	for _, dir := range opts.ReadOnlyPaths {
+		argv = append(argv, "--ro-bind", dir, dir)
+	}
+	for _, dir := range opts.HiddenPaths {
+		argv = append(argv, "--tmpfs", dir)
+	}
+	for _, dir := range opts.WritablePaths {
+		argv = append(argv, "--bind", dir, dir)
+	}
+	for _, dir := range bubblewrapCLIWritableDirs(args, env, cwd) {
+		argv = append(argv, "--bind", dir, dir)
+	}
+	if cwd != "" {
+		argv = append(argv, "--bind", cwd, cwd, "--chdir", cwd)
+	}
+	argv = append(argv, opts.ExtraArgs...)
+	argv = append(argv, "--", cliPath)
+	return append(argv, args...)
+}
+
+// bubblewrapCLIDirs returns the directories a sandboxed CLI at cliPath needs:
+// its own and, if it is a symlink, its target's.
+func bubblewrapCLIDirs(cliPath string) []string {
+	if !filepath.IsAbs(cliPath) {
+		return nil
+	}
+
+	dirs := []string{filepath.Dir(cliPath)}
+	if target, err := filepath.EvalSymlinks(cliPath); err == nil {
+		if dir := filepath.Dir(target); dir != dirs[0] {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// bubblewrapCLIWritableDirs returns the directories the CLI writes to
+// besides the working directory: CLAUDE_CONFIG_DIR from env and each
+// --add-dir in args. Relative paths are resolved against cwd, as the CLI
+// would.
+func bubblewrapCLIWritableDirs(args, env []string, cwd string) []string {
+	var dirs []string
+	if dir := envValue(env, "CLAUDE_CONFIG_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	for i, arg := range args {
+		switch {
+		case arg == "--add-dir" && i+1 < len(args):
+			dirs = append(dirs, args[i+1])
+
+		case strings.HasPrefix(arg, "--add-dir="):
+			dirs = append(dirs, strings.TrimPrefix(arg, "--add-dir="))
+		}
+	}
+
+	for i, dir := range dirs {
+		if !filepath.IsAbs(dir) && cwd != "" {
+			dirs[i] = filepath.Join(cwd, dir)
+		}
+	}
+	return dirs
+}
+
+// bubblewrapCovered reports whether dir lies within one of roots.
+func bubblewrapCovered(roots []string, dir string) bool {
+	for _, root := range roots {
+		if _, ok := pathWithin(root, dir); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// envValue returns the value of name in env, a list of KEY=value pairs. The
+// last occurrence wins, as with exec.Cmd.
+func envValue(env []string, name string) string {
+	var value string
+	for _, kv := range env {
+		if key, v, ok := strings.Cut(kv, "="); ok && key == name {
+			value = v
+		}
+	}
+	return value
+}
+
+// IsolatedRunner runs the CLI isolated from the host as described by
+// IsolationOptions: in a bwrap sandbox or through a launcher such as docker
+// exec, optionally as another user and with cgroup resource limits.
+type IsolatedRunner struct {
+	cliPath string
+	opts    IsolationOptions
+
+	cmd    *exec.Cmd
+	exit   *processExit
+	cgroup *isolationCgroup
+}
+
+// NewIsolatedRunner creates a runner for the CLI at cliPath. With a Command
+// template, cliPath is the path inside the launcher's environment.
+func NewIsolatedRunner(cliPath string,
+	opts IsolationOptions) (*IsolatedRunner, error) {
+
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	return &IsolatedRunner{
+		cliPath: cliPath,
+		opts:    opts,
+	}, nil
+}
+
+// Start launches the isolated CLI. The environment is passed as given;
+// NewSubprocessTransport has already filtered it by PassEnv.
+func (r *IsolatedRunner) Start(
+	ctx context.Context,
+	args []string,
+	env []string,
+	cwd string,
+) (io.WriteCloser, io.ReadCloser, io.ReadCloser, error) {
+	argv := r.opts.command(r.cliPath, args, env, cwd)
+	r.cmd = exec.Command(argv[0], argv[1:]...)
+	r.cmd.Env = env
+
+	// The working directory belongs to the launcher's environment when a
+	// Command is used.
+	if cwd != "" && len(r.opts.Command) == 0 {
+		if err := checkWorkingDir(cwd); err != nil {
+			return nil, nil, nil, err
+		}
+		r.cmd.Dir = cwd
+	}
+
+	cgroup, err := prepareIsolation(r.cmd, &r.opts)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	stdin, stdout, stderr, exit, err := startWithPipes(r.cmd)
+	if cgroup != nil {
+		cgroup.started()
+		if err != nil {
+			cgroup.remove()
+			cgroup = nil
+		}
+	}
+	r.cgroup = cgroup
+	r.exit = exit
+
+	return stdin, stdout, stderr, err
+}
+
+// Wait blocks until the CLI exits and removes its cgroup, if any.
+func (r *IsolatedRunner) Wait() error {
+	if r.exit == nil {
+		return fmt.Errorf("subprocess not started")
+	}
+
+	err := r.exit.wait()
+	if r.cgroup != nil {
+		r.cgroup.remove()
+	}
+	return err
+}
+
+// Signal sends sig to the CLI and the processes it started.
+func (r *IsolatedRunner) Signal(sig os.Signal) error {
+	if r.cmd == nil || r.cmd.Process == nil {
+		return nil
+	}
+	return signalProcessGroup(r.cmd.Process, sig)
+}
+
+// Kill terminates the CLI and the processes it started. With resource
+// limits, every process in its cgroup is killed, including any that left
+// its process group.
+func (r *IsolatedRunner) Kill() error {
+	if r.cmd == nil || r.cmd.Process == nil {
+		return nil
+	}
+	if r.cgroup != nil && r.cgroup.kill() == nil {
+		return nil
+	}
+	return r.Signal(os.Kill)
+}
+
+// IsAlive returns true if the CLI was started and has not exited.
+func (r *IsolatedRunner) IsAlive() bool {
+	return r.exit != nil && !r.exit.exited()
+}
+
+var _ SubprocessRunner = (*IsolatedRunner)(nil)
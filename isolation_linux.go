@@ -0,0 +1,145 @@
+package claudeagent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// cgroupRemoveTimeout bounds how long removing a cgroup waits for the
+// processes left in it to exit after they were killed.
+const cgroupRemoveTimeout = 2 * time.Second
+
+// isolationCgroup is the cgroup an isolated CLI runs in.
+type isolationCgroup struct {
+	dir string
+	fd  *os.File
+}
+
+// validatePlatformIsolation reports options this platform cannot apply.
+func validatePlatformIsolation(*IsolationOptions) error {
+	return nil
+}
+
+// prepareIsolation sets the user and cgroup cmd starts with. It returns the
+// cgroup created for the CLI, if any.
+func prepareIsolation(cmd *exec.Cmd, opts *IsolationOptions) (*isolationCgroup,
+	error) {
+
+	if opts.User == nil && opts.Limits == nil {
+		return nil, nil
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if user := opts.User; user != nil {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    user.UID,
+			Gid:    user.GID,
+			Groups: user.Groups,
+		}
+	}
+
+	if opts.Limits == nil {
+		return nil, nil
+	}
+
+	cgroup, err := newIsolationCgroup(opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(cgroup.fd.Fd())
+	return cgroup, nil
+}
+
+// newIsolationCgroup creates a child of limits.CgroupParent with the limits
+// applied.
+func newIsolationCgroup(limits *ResourceLimits) (*isolationCgroup, error) {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(
+		limits.CgroupParent, "claude-"+hex.EncodeToString(suffix[:]),
+	)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	cgroup := &isolationCgroup{dir: dir}
+
+	var settings [][2]string
+	if limits.MemoryMaxBytes > 0 {
+		settings = append(settings, [2]string{
+			"memory.max", strconv.FormatInt(limits.MemoryMaxBytes, 10),
+		})
+	}
+	if limits.CPUs > 0 {
+		const period = 100000
+		quota := int64(limits.CPUs * period)
+		settings = append(settings, [2]string{
+			"cpu.max", fmt.Sprintf("%d %d", quota, period),
+		})
+	}
+	if limits.PidsMax > 0 {
+		settings = append(settings, [2]string{
+			"pids.max", strconv.FormatInt(limits.PidsMax, 10),
+		})
+	}
+
+	for _, setting := range settings {
+		path := filepath.Join(dir, setting[0])
+		err := os.WriteFile(path, []byte(setting[1]), 0)
+		if err != nil {
+			cgroup.remove()
+			return nil, fmt.Errorf("failed to set %s: %w", setting[0],
+				err)
+		}
+	}
+
+	fd, err := os.Open(dir)
+	if err != nil {
+		cgroup.remove()
+		return nil, fmt.Errorf("failed to open cgroup: %w", err)
+	}
+	cgroup.fd = fd
+	return cgroup, nil
+}
+
+// started releases the descriptor used to start the CLI in the cgroup.
+func (c *isolationCgroup) started() {
+	if c.fd != nil {
+		c.fd.Close()
+		c.fd = nil
+	}
+}
+
+// kill kills every process in the cgroup.
+func (c *isolationCgroup) kill() error {
+	return os.WriteFile(filepath.Join(c.dir, "cgroup.kill"), []byte("1"), 0)
+}
+
+// remove deletes the cgroup, killing any processes the CLI left behind.
+func (c *isolationCgroup) remove() {
+	c.started()
+
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err := os.Remove(c.dir)
+		if err == nil || errors.Is(err, os.ErrNotExist) ||
+			time.Now().After(deadline) {
+
+			return
+		}
+
+		_ = c.kill()
+		time.Sleep(10 * time.Millisecond)
+	}
+}
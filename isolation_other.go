@@ -0,0 +1,39 @@
+//go:build !linux
+
+package claudeagent
+
+import (
+	"os/exec"
+)
+
+// isolationCgroup is unused on platforms without cgroups.
+type isolationCgroup struct{}
+
+// validatePlatformIsolation reports options this platform cannot apply.
+func validatePlatformIsolation(opts *IsolationOptions) error {
+	switch {
+	case opts.User != nil:
+		return &ErrInvalidConfiguration{
+			Field:  "Isolation.User",
+			Reason: "running as another user requires Linux",
+		}
+
+	case opts.Limits != nil:
+		return &ErrInvalidConfiguration{
+			Field:  "Isolation.Limits",
+			Reason: "resource limits require Linux cgroups",
+		}
+	}
+	return nil
+}
+
+// prepareIsolation has nothing to set up on this platform.
+func prepareIsolation(*exec.Cmd, *IsolationOptions) (*isolationCgroup, error) {
+	return nil, nil
+}
+
+func (c *isolationCgroup) started() {}
+
+func (c *isolationCgroup) kill() error { return nil }
+
+func (c *isolationCgroup) remove() {}
@@ -0,0 +1,218 @@
+package claudeagent
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestIsolationBubblewrapCommand verifies the bwrap invocation.
+func TestIsolationBubblewrapCommand(t *testing.T) {
+	opts := IsolationOptions{
+		Bubblewrap: &BubblewrapOptions{
+			ShareNetwork:  true,
+			ReadOnlyPaths: []string{"/opt/node"},
+			WritablePaths: []string{"/home/agent/.claude"},
+			HiddenPaths:   []string{"/etc/secrets"},
+		},
+	}
+
+	argv := opts.command("/opt/claude/bin/claude",
+		[]string{"--verbose", "--add-dir", "/data", "--add-dir", "out"},
+		[]string{"HOME=/home/agent", "CLAUDE_CONFIG_DIR=/srv/config"},
+		"/work")
+
+	want := []string{
+		"bwrap", "--die-with-parent", "--new-session", "--unshare-all",
+		"--share-net",
+	}
+	readOnly := append(slices.Clone(DefaultBubblewrapReadOnlyPaths),
+		"/opt/claude/bin")
+	for _, dir := range readOnly {
+		want = append(want, "--ro-bind-try", dir, dir)
+	}
+	want = append(want,
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--tmpfs", "/home/agent",
+		"--ro-bind", "/opt/node", "/opt/node",
+		"--tmpfs", "/etc/secrets",
+		"--bind", "/home/agent/.claude", "/home/agent/.claude",
+		"--bind", "/srv/config", "/srv/config",
+		"--bind", "/data", "/data",
+		"--bind", "/work/out", "/work/out",
+		"--bind", "/work", "/work", "--chdir", "/work",
+		"--", "/opt/claude/bin/claude",
+		"--verbose", "--add-dir", "/data", "--add-dir", "out",
+	)
+	assert.Equal(t, want, argv)
+	assert.NotContains(t, argv, "/")
+}
+
+// TestIsolationBubblewrapHostRoot verifies that the host root is only
+// mounted when requested, with the home directory still hidden.
+func TestIsolationBubblewrapHostRoot(t *testing.T) {
+	opts := IsolationOptions{
+		Bubblewrap: &BubblewrapOptions{BindHostRoot: true},
+	}
+
+	argv := opts.command("/usr/bin/claude", nil,
+		[]string{"HOME=/root"}, "")
+	assert.Equal(t, []string{
+		"bwrap", "--die-with-parent", "--new-session", "--unshare-all",
+		"--ro-bind", "/", "/",
+		"--dev", "/dev",
+		"--proc", "/proc",
+		"--tmpfs", "/tmp",
+		"--tmpfs", "/root",
+		"--", "/usr/bin/claude",
+	}, argv)
+}
+
+// TestIsolationTemplateCommand verifies placeholder expansion in a
+// launcher command.
+func TestIsolationTemplateCommand(t *testing.T) {
+	opts := IsolationOptions{
+		Command: []string{
+			"docker", "exec", "-i", "-w", "{cwd}", "{env}", "box", "{cli}",
+		},
+	}
+
+	argv := opts.command("claude", []string{"--verbose"},
+		[]string{"ANTHROPIC_API_KEY=sk-test", "FOO=a=b"}, "/work")
+	assert.Equal(t, []string{
+		"docker", "exec", "-i", "-w", "/work",
+		"-e", "ANTHROPIC_API_KEY", "-e", "FOO",
+		"box", "claude", "--verbose",
+	}, argv)
+}
+
+// TestIsolationEnviron verifies that an isolated CLI only receives the
+// allowed host variables and its own.
+func TestIsolationEnviron(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("SERVICE_TOKEN", "secret")
+
+	cliEnv := []string{"FOO=bar"}
+
+	env := (&IsolationOptions{}).environ(cliEnv)
+	assert.Contains(t, env, "PATH=/usr/bin")
+	assert.Contains(t, env, "FOO=bar")
+	assert.NotContains(t, env, "SERVICE_TOKEN=secret")
+
+	// A launcher forwards everything it is given, so nothing is passed
+	// from the host by default.
+	env = (&IsolationOptions{Command: []string{"docker"}}).environ(cliEnv)
+	assert.Equal(t, []string{"FOO=bar"}, env)
+
+	env = (&IsolationOptions{
+		PassEnv: []string{"SERVICE_TOKEN"},
+	}).environ(cliEnv)
+	assert.Equal(t, []string{"SERVICE_TOKEN=secret", "FOO=bar"}, env)
+}
+
+// TestIsolationValidate verifies that conflicting options are rejected.
+func TestIsolationValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  IsolationOptions
+		field string
+	}{
+		{
+			name: "command and bubblewrap",
+			opts: IsolationOptions{
+				Command:    []string{"docker"},
+				Bubblewrap: &BubblewrapOptions{},
+			},
+			field: "Isolation",
+		},
+		{
+			name: "command and limits",
+			opts: IsolationOptions{
+				Command: []string{"docker"},
+				Limits:  &ResourceLimits{CgroupParent: "/sys/fs/cgroup/x"},
+			},
+			field: "Isolation.Limits",
+		},
+		{
+			name:  "limits without parent",
+			opts:  IsolationOptions{Limits: &ResourceLimits{PidsMax: 10}},
+			field: "Isolation.Limits.CgroupParent",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewIsolatedRunner("claude", tc.opts)
+			var invalid *ErrInvalidConfiguration
+			require.ErrorAs(t, err, &invalid)
+			assert.Equal(t, tc.field, invalid.Field)
+		})
+	}
+}
+
+// TestIsolatedRunnerLauncher verifies that the CLI is started through a
+// launcher command and is reported dead once it exits.
+func TestIsolatedRunnerLauncher(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	runner, err := NewIsolatedRunner("fake-cli", IsolationOptions{
+		Command: []string{sh, "-c", `echo "$0 $* $FOO"`, "{cli}"},
+	})
+	require.NoError(t, err)
+	assert.False(t, runner.IsAlive())
+
+	stdin, stdout, _, err := runner.Start(
+		context.Background(), []string{"--verbose"}, []string{"FOO=bar"},
+		"/does/not/matter",
+	)
+	require.NoError(t, err)
+	stdin.Close()
+
+	out, err := io.ReadAll(stdout)
+	require.NoError(t, err)
+	require.NoError(t, runner.Wait())
+	assert.Equal(t, "fake-cli --verbose bar\n", string(out))
+	assert.False(t, runner.IsAlive())
+}
+
+// TestSubprocessTransportIsolationEnv verifies that the transport filters
+// the host environment for an isolated CLI and uses a custom runner.
+func TestSubprocessTransportIsolationEnv(t *testing.T) {
+	t.Setenv("SERVICE_TOKEN", "secret")
+
+	var (
+		cliPath string
+		runner  = NewMockSubprocessRunner()
+	)
+	opts := DefaultOptions()
+	for _, opt := range []Option{
+		WithCLIPath("/opt/claude"),
+		WithEnv(map[string]string{"ANTHROPIC_API_KEY": "sk-test"}),
+		WithIsolation(IsolationOptions{PassEnv: []string{}}),
+		WithSubprocessRunner(func(path string) SubprocessRunner {
+			cliPath = path
+			return runner
+		}),
+	} {
+		opt(&opts)
+	}
+
+	transport, err := NewSubprocessTransport(&opts)
+	require.NoError(t, err)
+	require.NoError(t, transport.Connect(context.Background()))
+	defer runner.Exit(nil)
+
+	assert.Equal(t, "/opt/claude", cliPath)
+	assert.Contains(t, runner.StartEnv, "ANTHROPIC_API_KEY=sk-test")
+	assert.NotContains(t, runner.StartEnv, "SERVICE_TOKEN=secret")
+}
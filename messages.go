@@ -36,9 +36,30 @@ type APIUserMessage struct {
 }
 
 // UserContentBlock represents a content block in a user message.
+//
+// Text blocks only use Text. Image and document blocks carry a Source, and
+// tool_result blocks reference the originating tool call via ToolUseID. Use
+// the constructors in user_content.go (TextBlock, ImageBlock, DocumentBlock,
+// ToolResultBlock, ...) rather than building blocks by hand.
 type UserContentBlock struct {
-	Type string `json:"type"`           // "text" or other types
-	Text string `json:"text,omitempty"` // Text content
+	Type      string             `json:"type"`                  // "text", "image", "document" or "tool_result"
+	Text      string             `json:"text,omitempty"`        // Text content
+	Source    *ContentSource     `json:"source,omitempty"`      // For image and document blocks
+	Title     string             `json:"title,omitempty"`       // For document blocks
+	Context   string             `json:"context,omitempty"`     // For document blocks
+	ToolUseID string             `json:"tool_use_id,omitempty"` // For tool_result blocks
+	Content   []UserContentBlock `json:"content,omitempty"`     // For tool_result blocks
+	IsError   bool               `json:"is_error,omitempty"`    // For tool_result blocks
+}
+
+// ContentSource describes where the data for an image or document block
+// comes from.
+type ContentSource struct {
+	Type      string `json:"type"`                 // "base64", "url", "text" or "file"
+	MediaType string `json:"media_type,omitempty"` // MIME type for base64 and text sources
+	Data      string `json:"data,omitempty"`       // Base64 payload or plain text
+	URL       string `json:"url,omitempty"`        // For url sources
+	FileID    string `json:"file_id,omitempty"`    // For file sources (Files API)
 }
 
 // UserMessageReplay represents a replayed user message during session resume.
@@ -104,15 +125,34 @@ func (m AssistantMessage) ContentText() string {
 // ContentBlock represents a single content element in an assistant message.
 //
 // Content blocks can be:
-// - text: Plain text response
+// - text: Plain text response, optionally with citations
 // - tool_use: Request to execute a tool
 // - thinking: Claude's reasoning process (when extended thinking is enabled)
+// - redacted_thinking: Encrypted reasoning
+// - server_tool_use / web_search_tool_result: Server-side tool calls
+// - tool_result: Tool output (in subagent transcripts)
+//
+// The flat fields cover the common cases. Blocks decoded from JSON keep the
+// original encoding in Raw, so nothing is lost for block types or fields the
+// struct does not model; use Typed to get a per-type view.
 type ContentBlock struct {
-	Type  string          `json:"type"`            // "text", "tool_use", or "thinking"
-	Text  string          `json:"text,omitempty"`  // For text and thinking blocks
-	ID    string          `json:"id,omitempty"`    // For tool_use blocks (unique ID)
-	Name  string          `json:"name,omitempty"`  // For tool_use blocks (tool name)
-	Input json.RawMessage `json:"input,omitempty"` // For tool_use blocks (arguments)
+	Type      string          `json:"type"`                  // Block type
+	Text      string          `json:"text,omitempty"`        // For text blocks
+	ID        string          `json:"id,omitempty"`          // For tool_use and server_tool_use blocks
+	Name      string          `json:"name,omitempty"`        // For tool_use and server_tool_use blocks
+	Input     json.RawMessage `json:"input,omitempty"`       // For tool_use and server_tool_use blocks
+	Thinking  string          `json:"thinking,omitempty"`    // For thinking blocks
+	Signature string          `json:"signature,omitempty"`   // For thinking blocks
+	Data      string          `json:"data,omitempty"`        // For redacted_thinking blocks
+	ToolUseID string          `json:"tool_use_id,omitempty"` // For tool_result and *_tool_result blocks
+	Content   json.RawMessage `json:"content,omitempty"`     // For tool_result and *_tool_result blocks
+	IsError   bool            `json:"is_error,omitempty"`    // For tool_result blocks
+	Citations []Citation      `json:"citations,omitempty"`   // For text blocks
+
+	// Raw is the JSON the block was decoded from. When set, MarshalJSON
+	// emits it with any changed fields replaced, so blocks round-trip
+	// losslessly.
+	Raw json.RawMessage `json:"-"`
 }
 
 // BlockType returns the type of this content block.
@@ -254,6 +294,9 @@ type SDKControlRequestBody struct {
 	Input                  map[string]interface{}              `json:"input,omitempty"`                  // For can_use_tool/hook_callback
 	ToolUseID              string                              `json:"tool_use_id,omitempty"`            // For can_use_tool/hooks
 	AgentID                string                              `json:"agent_id,omitempty"`               // For can_use_tool
+	PermissionSuggestions  []PermissionUpdate                  `json:"permission_suggestions,omitempty"` // For can_use_tool
+	BlockedPath            string                              `json:"blocked_path,omitempty"`           // For can_use_tool
+	DecisionReason         string                              `json:"decision_reason,omitempty"`        // For can_use_tool
 	CallbackID             string                              `json:"callback_id,omitempty"`            // For hook_callback
 	Mode                   string                              `json:"mode,omitempty"`                   // For set_permission_mode
 	Model                  string                              `json:"model,omitempty"`                  // For set_model
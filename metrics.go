@@ -0,0 +1,176 @@
+package claudeagent
+
+import (
+	"sync"
+	"time"
+)
+
+// Metrics receives measurements from a Client, for export to a monitoring
+// system. The claudeagentprom package provides a Prometheus implementation.
+//
+// Methods are called from the client's message pump and control handlers,
+// so implementations must be safe for concurrent use and must not block.
+// Embed NoopMetrics to implement only some of them.
+type Metrics interface {
+	// TurnCompleted is called for each result message.
+	TurnCompleted(turn TurnMetrics)
+
+	// ModelUsage is called after each turn with the tokens and cost a
+	// model used during it. The CLI reports totals for its session; the
+	// client converts them to increments.
+	ModelUsage(model string, usage ModelUsage)
+
+	// APIRetry is called when the CLI retries a failed API request.
+	APIRetry(msg APIRetryMessage)
+
+	// RateLimit is called for each rate limit event.
+	RateLimit(info RateLimitInfo)
+
+	// ToolCompleted is called with the time between a tool use and its
+	// result.
+	ToolCompleted(tool string, latency time.Duration, isError bool)
+
+	// HookCompleted is called with the time a hook callback took.
+	HookCompleted(event string, latency time.Duration, failed bool)
+
+	// PermissionDecision is called for each permission request answered
+	// by CanUseTool or a PermissionPolicy.
+	PermissionDecision(tool string, allowed bool)
+}
+
+// TurnMetrics describes a completed turn.
+type TurnMetrics struct {
+	// Subtype is the result subtype, such as "success" or
+	// "error_max_turns".
+	Subtype string
+
+	// IsError reports whether the turn failed.
+	IsError bool
+
+	// Duration and APIDuration are the turn's wall clock and API time as
+	// reported by the CLI.
+	Duration    time.Duration
+	APIDuration time.Duration
+
+	// CostUSD is the cost of the turn.
+	CostUSD float64
+
+	// Usage is the turn's token usage, if reported.
+	Usage NonNullableUsage
+}
+
+// NoopMetrics implements Metrics by discarding everything.
+type NoopMetrics struct{}
+
+// TurnCompleted implements Metrics.
+func (NoopMetrics) TurnCompleted(TurnMetrics) {}
+
+// ModelUsage implements Metrics.
+func (NoopMetrics) ModelUsage(string, ModelUsage) {}
+
+// APIRetry implements Metrics.
+func (NoopMetrics) APIRetry(APIRetryMessage) {}
+
+// RateLimit implements Metrics.
+func (NoopMetrics) RateLimit(RateLimitInfo) {}
+
+// ToolCompleted implements Metrics.
+func (NoopMetrics) ToolCompleted(string, time.Duration, bool) {}
+
+// HookCompleted implements Metrics.
+func (NoopMetrics) HookCompleted(string, time.Duration, bool) {}
+
+// PermissionDecision implements Metrics.
+func (NoopMetrics) PermissionDecision(string, bool) {}
+
+// Compile-time check that NoopMetrics implements Metrics.
+var _ Metrics = NoopMetrics{}
+
+// metrics returns the configured Metrics, or NoopMetrics.
+func (o *Options) metrics() Metrics {
+	if o == nil || o.Metrics == nil {
+		return NoopMetrics{}
+	}
+	return o.Metrics
+}
+
+// usageMeter turns the session totals reported by result messages into
+// per-turn increments for Metrics. It is safe for concurrent use.
+type usageMeter struct {
+	mu      sync.Mutex
+	costUSD float64
+	models  map[string]ModelUsage
+}
+
+// observe reports the messages Metrics covers. Result messages are
+// reported as increments over the previous result, and the turn reported is
+// also returned.
+func (u *usageMeter) observe(metrics Metrics, msg Message) (TurnMetrics,
+	bool) {
+
+	switch m := msg.(type) {
+	case APIRetryMessage:
+		metrics.APIRetry(m)
+
+	case RateLimitEventMessage:
+		metrics.RateLimit(m.RateLimitInfo)
+
+	case ResultMessage:
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		turn := TurnMetrics{
+			Subtype: m.Subtype,
+			IsError: m.IsError,
+			Duration: time.Duration(m.DurationMs) *
+				time.Millisecond,
+			APIDuration: time.Duration(m.DurationAPIMs) *
+				time.Millisecond,
+			CostUSD: increment(m.TotalCostUSD, u.costUSD),
+		}
+		if m.Usage != nil {
+			turn.Usage = *m.Usage
+		}
+		u.costUSD = m.TotalCostUSD
+		metrics.TurnCompleted(turn)
+
+		if u.models == nil {
+			u.models = make(map[string]ModelUsage)
+		}
+		for model, total := range m.ModelUsage {
+			prev := u.models[model]
+			u.models[model] = total
+
+			metrics.ModelUsage(model, ModelUsage{
+				InputTokens: increment(total.InputTokens,
+					prev.InputTokens),
+				OutputTokens: increment(total.OutputTokens,
+					prev.OutputTokens),
+				CacheReadInputTokens: increment(
+					total.CacheReadInputTokens,
+					prev.CacheReadInputTokens),
+				CacheCreationInputTokens: increment(
+					total.CacheCreationInputTokens,
+					prev.CacheCreationInputTokens),
+				WebSearchRequests: increment(
+					total.WebSearchRequests,
+					prev.WebSearchRequests),
+				CostUSD: increment(total.CostUSD,
+					prev.CostUSD),
+				ContextWindow:   total.ContextWindow,
+				MaxOutputTokens: total.MaxOutputTokens,
+			})
+		}
+		return turn, true
+	}
+	return TurnMetrics{}, false
+}
+
+// increment returns how much a session total grew since prev. A total below
+// prev means the CLI started a new session, so all of it is new.
+func increment[T int | float64](total, prev T) T {
+	if total < prev {
+		return total
+	}
+	return total - prev
+}
@@ -0,0 +1,182 @@
+package claudeagent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingMetrics records the measurements it receives.
+type recordingMetrics struct {
+	NoopMetrics
+
+	mu          sync.Mutex
+	turns       []TurnMetrics
+	models      []ModelUsage
+	retries     int
+	tools       []string
+	permissions map[string]bool
+}
+
+func (m *recordingMetrics) TurnCompleted(turn TurnMetrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns = append(m.turns, turn)
+}
+
+func (m *recordingMetrics) ModelUsage(_ string, usage ModelUsage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.models = append(m.models, usage)
+}
+
+func (m *recordingMetrics) APIRetry(APIRetryMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries++
+}
+
+func (m *recordingMetrics) ToolCompleted(tool string, _ time.Duration,
+	_ bool) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tools = append(m.tools, tool)
+}
+
+func (m *recordingMetrics) PermissionDecision(tool string, allowed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.permissions == nil {
+		m.permissions = make(map[string]bool)
+	}
+	m.permissions[tool] = allowed
+}
+
+// TestClientMetrics verifies that turn costs are reported as increments over
+// the session totals, along with retries, tool uses and permission
+// decisions.
+func TestClientMetrics(t *testing.T) {
+	transport, server := NewPipeTransport()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		var turns int
+		for msg, err := range server.Messages(ctx) {
+			if err != nil {
+				continue
+			}
+
+			switch m := msg.(type) {
+			case SDKControlRequest:
+				_ = server.RespondControl(ctx, m.RequestID, nil)
+
+			case SDKControlResponse:
+				_ = server.Write(ctx, UserMessage{
+					Type: "user",
+					Message: APIUserMessage{
+						Role: "user",
+						Content: []UserContentBlock{{
+							Type:      "tool_result",
+							ToolUseID: "tool_1",
+							IsError:   true,
+						}},
+					},
+				})
+				_ = server.Write(ctx, ResultMessage{
+					Type:         "result",
+					Subtype:      "success",
+					SessionID:    "sess_pipe",
+					TotalCostUSD: 0.25,
+					ModelUsage: map[string]ModelUsage{
+						"claude-sonnet": {
+							InputTokens: 100,
+							CostUSD:     0.25,
+						},
+					},
+				})
+
+			case UserMessage:
+				turns++
+				if turns == 2 {
+					_ = server.Write(ctx, APIRetryMessage{
+						Type:    "system",
+						Subtype: "api_retry",
+						Error:   APIRetryErrorRateLimit,
+					})
+					_ = server.Write(ctx, ResultMessage{
+						Type:         "result",
+						Subtype:      "success",
+						SessionID:    "sess_pipe",
+						TotalCostUSD: 0.75,
+						ModelUsage: map[string]ModelUsage{
+							"claude-sonnet": {
+								InputTokens: 150,
+								CostUSD:     0.75,
+							},
+						},
+					})
+					continue
+				}
+
+				assistant := AssistantMessage{Type: "assistant"}
+				assistant.Message.Role = "assistant"
+				assistant.Message.Content = []ContentBlock{{
+					Type: "tool_use",
+					ID:   "tool_1",
+					Name: "Bash",
+				}}
+				_ = server.Write(ctx, assistant)
+				_ = server.Write(ctx, SDKControlRequest{
+					Type:      "control_request",
+					RequestID: "perm_1",
+					Request: SDKControlRequestBody{
+						Subtype:   "can_use_tool",
+						ToolName:  "Bash",
+						ToolUseID: "tool_1",
+					},
+				})
+			}
+		}
+	}()
+
+	metrics := &recordingMetrics{}
+	client, err := NewClient(
+		WithTransport(transport),
+		WithMetrics(metrics),
+		WithCanUseTool(func(context.Context,
+			ToolPermissionRequest) PermissionResult {
+
+			return PermissionDeny{Reason: "no"}
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	for range client.Query(ctx, "run ls") {
+	}
+	for range client.Query(ctx, "again") {
+	}
+	require.NoError(t, ctx.Err())
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	require.Len(t, metrics.turns, 2)
+	assert.InDelta(t, 0.25, metrics.turns[0].CostUSD, 1e-9)
+	assert.InDelta(t, 0.5, metrics.turns[1].CostUSD, 1e-9)
+
+	require.Len(t, metrics.models, 2)
+	assert.Equal(t, 100, metrics.models[0].InputTokens)
+	assert.Equal(t, 50, metrics.models[1].InputTokens)
+	assert.InDelta(t, 0.5, metrics.models[1].CostUSD, 1e-9)
+
+	assert.Equal(t, 1, metrics.retries)
+	assert.Equal(t, []string{"Bash"}, metrics.tools)
+	assert.Equal(t, map[string]bool{"Bash": false}, metrics.permissions)
+}
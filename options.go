@@ -4,6 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Options holds configuration for a Claude agent client.
@@ -60,6 +63,10 @@ type Options struct {
 	// Return PermissionAllow to proceed or PermissionDeny to block.
 	CanUseTool CanUseToolFunc
 
+	// PermissionPolicy is a declarative policy compiled into CanUseTool.
+	// A CanUseTool callback set alongside it resolves ask decisions.
+	PermissionPolicy *PermissionPolicy
+
 	// OnElicitation handles MCP server requests for user input.
 	OnElicitation OnElicitationFunc
 
@@ -90,6 +97,18 @@ type Options struct {
 	// SessionOptions configure session behavior (create/resume/fork).
 	SessionOptions SessionOptions
 
+	// Reconnect enables automatic restart of the CLI when it exits
+	// unexpectedly. Nil disables it.
+	Reconnect *ReconnectPolicy
+
+	// MessageBuffer configures buffering between the CLI and slow
+	// consumers. Zero-valued fields use defaults.
+	MessageBuffer BufferPolicy
+
+	// Shutdown sets the deadlines used by Client.Shutdown and when the CLI
+	// subprocess is closed. Zero-valued fields use defaults.
+	Shutdown ShutdownPolicy
+
 	// MCPServers configure MCP servers for custom tool integration.
 	MCPServers map[string]MCPServerConfig
 
@@ -186,11 +205,61 @@ type Options struct {
 	// Stderr is a callback for stderr output from the CLI.
 	Stderr func(data string)
 
+	// Logger receives the SDK's own log records: CLI lifecycle, control
+	// requests, restarts and failures. Nil disables logging.
+	Logger *slog.Logger `json:"-"`
+
+	// TracerProvider, when non-nil, provides the tracer for OpenTelemetry
+	// spans covering each turn, tool use, permission decision, hook
+	// callback and SDK MCP call.
+	TracerProvider trace.TracerProvider `json:"-"`
+
+	// Metrics, when non-nil, receives cost, token, retry, rate limit,
+	// tool, hook and permission measurements. See Metrics.
+	Metrics Metrics `json:"-"`
+
+	// Budget, when non-nil, caps the cost and tokens of the client's
+	// turns. See BudgetGuard.
+	Budget *BudgetGuard `json:"-"`
+
+	// RateLimits, when non-nil, delays new turns while rate limits are
+	// under pressure. See RateLimitScheduler.
+	RateLimits *RateLimitScheduler `json:"-"`
+
+	// Audit records tool calls, permission decisions and session events.
+	// See WithAuditLogger.
+	Audit *AuditLogger `json:"-"`
+
+	// Redactor scrubs secrets from the messages and logs the client
+	// handles. See WithRedactor.
+	Redactor *Redactor `json:"-"`
+
+	// HookMiddleware are hook callbacks run as ordered chains within the
+	// SDK, in addition to Hooks. See HookMiddleware.
+	HookMiddleware map[HookType][]HookMiddleware `json:"-"`
+
 	// Transport, when non-nil, is used in place of the default subprocess
 	// transport. Primarily for testing with mock transports; real users should
 	// leave this unset.
 	Transport Transport `json:"-"`
 
+	// Network, when non-nil, runs the CLI on a remote host through a
+	// claude-bridge server instead of as a local subprocess. Unlike
+	// Transport, it is used for every connection the client makes,
+	// including reconnects and pooled clients.
+	Network *NetworkConfig `json:"-"`
+
+	// Isolation, when non-nil, isolates the CLI subprocess from the host
+	// with an IsolatedRunner. See IsolationOptions. This is independent of
+	// Sandbox, which configures the CLI's own sandbox for the commands it
+	// runs.
+	Isolation *IsolationOptions `json:"-"`
+
+	// NewRunner, when non-nil, creates the runner for each CLI subprocess
+	// in place of the default local or isolated runner. It receives the
+	// discovered CLI path.
+	NewRunner func(cliPath string) SubprocessRunner `json:"-"`
+
 	// Verbose enables debug logging from the CLI.
 	Verbose bool
 
@@ -787,6 +856,33 @@ func WithTransport(t Transport) Option {
 	}
 }
 
+// WithNetworkTransport runs the CLI on a remote host through the
+// claude-bridge server described by cfg. See NetworkTransport.
+func WithNetworkTransport(cfg NetworkConfig) Option {
+	return func(o *Options) {
+		o.Network = &cfg
+	}
+}
+
+// WithIsolation runs the CLI isolated from the host as described by opts:
+// in a bwrap sandbox or through a launcher such as docker exec, as another
+// user, or with cgroup resource limits. The CLI no longer inherits the host
+// environment; see IsolationOptions.
+func WithIsolation(opts IsolationOptions) Option {
+	return func(o *Options) {
+		o.Isolation = &opts
+	}
+}
+
+// WithSubprocessRunner supplies the runner for each CLI subprocess, for
+// example to launch it through a custom sandbox. newRunner is called with
+// the CLI path for every process, including reconnects.
+func WithSubprocessRunner(newRunner func(cliPath string) SubprocessRunner) Option {
+	return func(o *Options) {
+		o.NewRunner = newRunner
+	}
+}
+
 // WithExtraArgs sets arbitrary Claude CLI flags appended after SDK-managed flags.
 func WithExtraArgs(args map[string]*string) Option {
 	return func(o *Options) {
@@ -825,6 +921,27 @@ func WithCanUseTool(fn CanUseToolFunc) Option {
 	}
 }
 
+// WithPermissionPolicy enforces a declarative permission policy.
+//
+// The policy is compiled when the client is created. Its working directory
+// and additional directories default to those of the client, and ask
+// decisions are resolved by the callback set with WithCanUseTool, if any.
+//
+// Example:
+//
+//	policy, err := claudeagent.LoadPermissionPolicy("policy.yaml")
+//	if err != nil {
+//	    return err
+//	}
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithPermissionPolicy(policy),
+//	)
+func WithPermissionPolicy(policy *PermissionPolicy) Option {
+	return func(o *Options) {
+		o.PermissionPolicy = policy
+	}
+}
+
 // WithOnElicitation registers a callback that handles MCP elicitation requests.
 //
 // If unset, the SDK auto-declines all elicitation requests.
@@ -849,6 +966,30 @@ func WithHooks(hooks map[HookType][]HookConfig) Option {
 	}
 }
 
+// WithHookMiddleware adds middleware to the chain for hookType. Unlike
+// WithHooks, it adds to the hooks configured so far rather than replacing
+// them, so independent packages can each register their own.
+//
+// Example:
+//
+//	WithHookMiddleware(HookTypePreToolUse, HookMiddleware{
+//	    Name:     "audit",
+//	    Priority: -10,
+//	    Timeout:  2 * time.Second,
+//	    OnError:  HookFailClosed,
+//	    Callback: auditToolUse,
+//	})
+func WithHookMiddleware(hookType HookType, middleware ...HookMiddleware) Option {
+	return func(o *Options) {
+		if o.HookMiddleware == nil {
+			o.HookMiddleware = make(map[HookType][]HookMiddleware)
+		}
+		o.HookMiddleware[hookType] = append(
+			o.HookMiddleware[hookType], middleware...,
+		)
+	}
+}
+
 // WithAgents defines specialized subagents for task delegation.
 //
 // Claude will automatically invoke the appropriate subagent based on
@@ -897,6 +1038,62 @@ func WithForkSession(sessionID string) Option {
 	}
 }
 
+// WithAutoReconnect restarts the CLI when it exits unexpectedly, for example
+// after being killed for running out of memory.
+//
+// The client resumes the last session in a new process, re-runs the
+// initialize handshake so hooks and SDK MCP servers are registered again,
+// and yields a ReconnectedMessage. Restarts back off exponentially and stop
+// once the policy's restart budget is spent.
+//
+// Example:
+//
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithAutoReconnect(claudeagent.ReconnectPolicy{
+//	        MaxRestarts:    10,
+//	        InitialBackoff: time.Second,
+//	    }),
+//	)
+func WithAutoReconnect(policy ReconnectPolicy) Option {
+	return func(o *Options) {
+		o.Reconnect = &policy
+	}
+}
+
+// WithMessageBuffer sets how messages from the CLI are buffered while
+// queries and streams are not keeping up. See BufferPolicy.
+//
+// Example:
+//
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithIncludePartialMessages(true),
+//	    claudeagent.WithMessageBuffer(claudeagent.BufferPolicy{
+//	        Mode: claudeagent.BackpressureDropPartial,
+//	    }),
+//	)
+func WithMessageBuffer(policy BufferPolicy) Option {
+	return func(o *Options) {
+		o.MessageBuffer = policy
+	}
+}
+
+// WithShutdownPolicy sets the deadlines for stopping the CLI. See
+// Client.Shutdown.
+//
+// Example:
+//
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithShutdownPolicy(claudeagent.ShutdownPolicy{
+//	        DrainTimeout: 20 * time.Second,
+//	        TermTimeout:  10 * time.Second,
+//	    }),
+//	)
+func WithShutdownPolicy(policy ShutdownPolicy) Option {
+	return func(o *Options) {
+		o.Shutdown = policy
+	}
+}
+
 // WithForkOnResume forks to a new session ID when resuming.
 func WithForkOnResume(fork bool) Option {
 	return func(o *Options) {
@@ -1048,6 +1245,17 @@ type PermissionContext struct {
 	ToolUseID string
 	AgentID   string
 	Metadata  map[string]interface{}
+
+	// Suggestions are the permission updates the CLI would offer the user
+	// for this request, such as an "always allow" rule. Return them, or a
+	// subset, in PermissionAllow.UpdatedPermissions to apply them.
+	Suggestions []PermissionUpdate
+
+	// BlockedPath is the file path that triggered the request, if any.
+	BlockedPath string
+
+	// DecisionReason explains why the CLI is asking, if it said.
+	DecisionReason string
 }
 
 // PermissionDecisionClassification labels how a permission decision was reached
@@ -1072,6 +1280,15 @@ type PermissionResult interface {
 type PermissionAllow struct {
 	// Classification optionally labels the decision for telemetry. Empty = unset.
 	Classification PermissionDecisionClassification
+
+	// UpdatedInput replaces the tool input, for example to sanitize a Bash
+	// command or redirect a write. It must be a JSON object. Nil runs the
+	// tool with its original input.
+	UpdatedInput json.RawMessage
+
+	// UpdatedPermissions are permission updates to apply alongside the
+	// decision, typically taken from PermissionContext.Suggestions.
+	UpdatedPermissions []PermissionUpdate
 }
 
 // IsAllow implements PermissionResult.
@@ -1082,6 +1299,10 @@ type PermissionDeny struct {
 	Reason string
 	// Classification optionally labels the decision for telemetry. Empty = unset.
 	Classification PermissionDecisionClassification
+
+	// Interrupt stops the current turn instead of letting Claude continue
+	// without the tool.
+	Interrupt bool
 }
 
 // IsAllow implements PermissionResult.
@@ -1180,9 +1401,15 @@ const (
 )
 
 // HookConfig defines a lifecycle callback.
+//
+// Matcher is passed to the CLI verbatim and applied there: for tool hooks it
+// is an exact tool name, "*" or empty for every tool, or a regular
+// expression such as "Edit|Write". Filter is applied by the SDK and can
+// also match tool arguments, file paths and notification types.
 type HookConfig struct {
 	Type     HookType     // Hook event type
-	Matcher  string       // Glob pattern for tool names (e.g., "*", "fetch_*")
+	Matcher  string       // CLI matcher (e.g., "Bash", "Edit|Write", "*")
+	Filter   HookFilter   // Optional SDK-side filter; see HookFilter
 	Timeout  int          // Optional timeout in seconds; 0 = use default
 	Callback HookCallback // Callback function
 }
@@ -1375,8 +1602,9 @@ func (i PostToolUseFailureInput) Base() BaseHookInput { return i.BaseHookInput }
 // NotificationInput contains data for Notification hooks.
 type NotificationInput struct {
 	BaseHookInput
-	Message string `json:"message"`
-	Title   string `json:"title,omitempty"`
+	Message          string `json:"message"`
+	Title            string `json:"title,omitempty"`
+	NotificationType string `json:"notification_type,omitempty"`
 }
 
 // HookType implements HookInput.
@@ -1718,6 +1946,10 @@ const (
 // For PreToolUse hooks, Modify is automatically translated into the
 // hookSpecificOutput.updatedInput format expected by the CLI. Set
 // HookSpecificOutput directly for finer control over the response.
+//
+// HookResult does not check that its fields apply to the event. Use the
+// HookOutput constructors, such as PreToolUseAllow, with TypedHook to have
+// that checked at compile time.
 type HookResult struct {
 	Continue bool                   // Continue execution (false = abort)
 	Modify   map[string]interface{} // Modifications to apply
@@ -1741,6 +1973,13 @@ type HookResult struct {
 	// Use this to provide iteration counts or other status information.
 	SystemMessage string
 
+	// StopReason, when Continue is false, is shown to the user as the
+	// reason Claude stopped.
+	StopReason string
+
+	// SuppressOutput hides the hook's output from the transcript.
+	SuppressOutput bool
+
 	// HookSpecificOutput provides raw hookSpecificOutput for the CLI
 	// response. When set, this takes precedence over auto-translation
 	// of Modify. Use this for finer control over permissionDecision,
@@ -2221,6 +2460,84 @@ func WithStderr(callback func(data string)) Option {
 	}
 }
 
+// WithLogger sets the logger for the SDK's own log records. The client,
+// control protocol, subprocess transport and Skills loader log through it,
+// mostly at debug level, with warnings and errors for failures.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithTracerProvider enables OpenTelemetry tracing. Each turn gets a
+// "claude.turn" span carrying the result's cost, duration and token usage,
+// with child spans for tool uses, permission decisions, hook callbacks and
+// SDK MCP calls. The turn span is a child of the span in the context passed
+// to Query or Stream.Send.
+//
+// Example:
+//
+//	client, err := claudeagent.NewClient(
+//	    claudeagent.WithTracerProvider(otel.GetTracerProvider()),
+//	)
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *Options) {
+		o.TracerProvider = tp
+	}
+}
+
+// WithMetrics reports the client's measurements to m, such as the
+// Prometheus collector in the claudeagentprom package. Clients may share one
+// Metrics.
+func WithMetrics(m Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
+
+// WithBudgetGuard enforces the limits of guard on the client's turns. Pass
+// the same guard to several clients, or to a Pool, to give them a shared
+// budget.
+func WithBudgetGuard(guard *BudgetGuard) Option {
+	return func(o *Options) {
+		o.Budget = guard
+	}
+}
+
+// WithAuditLogger records the client's tool calls, permission decisions,
+// permission denials, configuration changes and session boundaries to
+// logger. Hook events are recorded by hook middleware that runs first among
+// the middleware with the same matcher; the merged decision of each
+// PreToolUse chain is recorded once the chain has run. Permission decisions
+// are recorded when the client has a CanUseTool callback or a
+// PermissionPolicy. Clients may share one logger.
+func WithAuditLogger(logger *AuditLogger) Option {
+	return func(o *Options) {
+		o.Audit = logger
+		for _, hookType := range auditHookTypes {
+			WithHookMiddleware(hookType, logger.middleware())(o)
+		}
+	}
+}
+
+// WithRedactor scrubs the secrets matched by redactor from user messages
+// sent to the CLI, hook outputs, SDK MCP tool results, messages yielded to
+// consumers and the client's logs.
+func WithRedactor(redactor *Redactor) Option {
+	return func(o *Options) {
+		o.Redactor = redactor
+	}
+}
+
+// WithRateLimitScheduler schedules the client's turns with scheduler. Pass
+// the same scheduler to several clients, or to a Pool, so that they back off
+// together.
+func WithRateLimitScheduler(scheduler *RateLimitScheduler) Option {
+	return func(o *Options) {
+		o.RateLimits = scheduler
+	}
+}
+
 // WithNoSessionPersistence disables session persistence.
 // Sessions will not be saved to disk and cannot be resumed.
 // Useful for testing to avoid polluting session history.
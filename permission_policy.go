@@ -0,0 +1,1116 @@
+package claudeagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyAction is the decision a permission policy rule produces.
+type PolicyAction string
+
+const (
+	// PolicyActionAllow permits the tool call.
+	PolicyActionAllow PolicyAction = "allow"
+
+	// PolicyActionDeny blocks the tool call.
+	PolicyActionDeny PolicyAction = "deny"
+
+	// PolicyActionAsk defers the decision to PermissionPolicy.Ask. If no
+	// Ask callback is configured, the call is denied.
+	PolicyActionAsk PolicyAction = "ask"
+)
+
+// PolicyMatchMode selects how a rule is chosen when several match.
+type PolicyMatchMode string
+
+const (
+	// PolicyMatchFirst uses the first matching rule in declaration order.
+	PolicyMatchFirst PolicyMatchMode = "first_match"
+
+	// PolicyMatchMostSpecific uses the matching rule with the most literal
+	// characters across its patterns. Ties go to deny over ask over allow,
+	// then to declaration order.
+	PolicyMatchMostSpecific PolicyMatchMode = "most_specific"
+)
+
+// PolicyRule is a single allow, deny or ask rule. Every pattern that is set
+// must match for the rule to apply; unset patterns match anything.
+//
+// Patterns are globs: "*" matches within a path segment, "**" matches across
+// segments and "?" matches one character.
+type PolicyRule struct {
+	// Name identifies the rule in denial reasons.
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+
+	// Action is allow, deny or ask.
+	Action PolicyAction `json:"action" yaml:"action"`
+
+	// Tool is a glob over the tool name, such as "Bash", "Web*" or
+	// "mcp__github__*".
+	Tool string `json:"tool,omitempty" yaml:"tool,omitempty"`
+
+	// Command is a Bash command prefix matched word by word, such as
+	// "git status" or "go test". "*" matches any command. Setting Command
+	// restricts the rule to the Bash tool.
+	Command string `json:"command,omitempty" yaml:"command,omitempty"`
+
+	// Path is a glob over the target path of file tools (Read, Edit,
+	// MultiEdit, Write, NotebookEdit, Glob, Grep, LS). Relative patterns
+	// are matched against the path relative to the working directory and
+	// each additional directory; absolute patterns against the absolute
+	// path. Setting Path restricts the rule to file tools.
+	Path string `json:"path,omitempty" yaml:"path,omitempty"`
+
+	// MCPServer is a glob over the MCP server name of mcp__<server>__<tool>
+	// tools. Setting it restricts the rule to MCP tools.
+	MCPServer string `json:"mcp_server,omitempty" yaml:"mcp_server,omitempty"`
+
+	// MCPTool is a glob over the MCP tool name of mcp__<server>__<tool>
+	// tools. Setting it restricts the rule to MCP tools.
+	MCPTool string `json:"mcp_tool,omitempty" yaml:"mcp_tool,omitempty"`
+
+	// Reason is included in the denial reason when the rule fires.
+	Reason string `json:"reason,omitempty" yaml:"reason,omitempty"`
+}
+
+// PermissionPolicy is a declarative set of permission rules that compiles to
+// a CanUseToolFunc.
+//
+// File tools are additionally confined to the working directory and the
+// additional directories: a request whose target path resolves outside all
+// of them is denied before any rule is consulted. A Glob pattern or Grep
+// glob that is absolute or contains ".." is confined by the directory it is
+// anchored at, and one whose reach cannot be determined is denied.
+//
+// Bash commands are split on ;, &&, ||, | and & and every segment is
+// evaluated on its own. The strictest segment decision wins, so
+// "ls && rm -rf /" is denied by a deny rule for "rm" even when "ls" is
+// allowed. Each segment is matched as the shell would run it: quotes and
+// escapes are removed, leading variable assignments and wrappers such as
+// env, command, exec and nohup are skipped, and "/bin/rm" matches "rm".
+// Commands that contain substitutions ($(...) or backticks), output
+// redirection, subshells, groups, compound commands or an expanded command
+// name never match allow rules that set Command, and are asked about rather
+// than allowed when a deny or ask rule sets Command.
+//
+// Example policy file:
+//
+//	default: ask
+//	match: first_match
+//	rules:
+//	  - name: no-force-push
+//	    action: deny
+//	    command: git push --force
+//	    reason: force pushes are not allowed
+//	  - action: allow
+//	    command: git
+//	  - action: allow
+//	    tool: Read
+//	    path: "**"
+//	  - action: deny
+//	    mcp_server: prod-*
+type PermissionPolicy struct {
+	// Rules are evaluated according to Match.
+	Rules []PolicyRule `json:"rules" yaml:"rules"`
+
+	// Default is the action taken when no rule matches. Empty means ask.
+	Default PolicyAction `json:"default,omitempty" yaml:"default,omitempty"`
+
+	// Match selects the rule when several match. Empty means first_match.
+	Match PolicyMatchMode `json:"match,omitempty" yaml:"match,omitempty"`
+
+	// Cwd is the working directory file paths are resolved against. When
+	// the policy is installed with WithPermissionPolicy, it defaults to
+	// the client's Cwd, and to the process working directory otherwise.
+	Cwd string `json:"-" yaml:"-"`
+
+	// AdditionalDirectories are further directories file tools may access.
+	// With WithPermissionPolicy, they default to the client's.
+	AdditionalDirectories []string `json:"-" yaml:"-"`
+
+	// Ask resolves ask decisions. With WithPermissionPolicy, it defaults to
+	// the callback set with WithCanUseTool.
+	Ask CanUseToolFunc `json:"-" yaml:"-"`
+}
+
+// PolicyDecision explains the outcome of evaluating a permission policy.
+type PolicyDecision struct {
+	// Action is the resulting decision.
+	Action PolicyAction
+
+	// Rule is the rule that fired, or nil if the default action or the
+	// directory confinement applied.
+	Rule *PolicyRule
+
+	// Reason describes why the decision was reached.
+	Reason string
+}
+
+// ParsePermissionPolicy parses a policy from YAML or JSON. Unknown fields are
+// rejected so that typos cannot silently weaken a policy.
+func ParsePermissionPolicy(data []byte) (*PermissionPolicy, error) {
+	var policy PermissionPolicy
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse permission policy: %w", err)
+	}
+
+	if _, err := compilePolicy(&policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// LoadPermissionPolicy reads a YAML or JSON policy file.
+func LoadPermissionPolicy(path string) (*PermissionPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePermissionPolicy(data)
+}
+
+// Compile validates the policy and returns a CanUseToolFunc that enforces
+// it. Denials carry the rule that fired in PermissionDeny.Reason.
+func (p *PermissionPolicy) Compile() (CanUseToolFunc, error) {
+	compiled, err := compilePolicy(p)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.canUseTool, nil
+}
+
+// Explain evaluates req against the policy without resolving ask decisions.
+// It is intended for testing and debugging policies.
+func (p *PermissionPolicy) Explain(req ToolPermissionRequest) (PolicyDecision, error) {
+	compiled, err := compilePolicy(p)
+	if err != nil {
+		return PolicyDecision{}, err
+	}
+	return compiled.evaluate(req), nil
+}
+
+// compiledRule is a PolicyRule with its patterns compiled.
+type compiledRule struct {
+	index       int
+	rule        PolicyRule
+	tool        *regexp.Regexp
+	mcpServer   *regexp.Regexp
+	mcpTool     *regexp.Regexp
+	path        *regexp.Regexp
+	pathAbs     bool
+	command     []string
+	specificity int
+}
+
+// compiledPolicy is the evaluated form of a PermissionPolicy.
+type compiledPolicy struct {
+	rules        []compiledRule
+	defaultAct   PolicyAction
+	mostSpecific bool
+	cwd          string
+	roots        []string
+	ask          CanUseToolFunc
+
+	// restrictsCommands is set when a deny or ask rule matches Bash
+	// commands, so commands that cannot be parsed are escalated.
+	restrictsCommands bool
+}
+
+// compilePolicy validates p and compiles its patterns.
+func compilePolicy(p *PermissionPolicy) (*compiledPolicy, error) {
+	compiled := &compiledPolicy{
+		defaultAct: p.Default,
+		ask:        p.Ask,
+	}
+	if compiled.defaultAct == "" {
+		compiled.defaultAct = PolicyActionAsk
+	}
+	if !validPolicyAction(compiled.defaultAct) {
+		return nil, &ErrInvalidConfiguration{
+			Field:  "PermissionPolicy.Default",
+			Reason: fmt.Sprintf("invalid action %q", p.Default),
+		}
+	}
+
+	switch p.Match {
+	case "", PolicyMatchFirst:
+	case PolicyMatchMostSpecific:
+		compiled.mostSpecific = true
+	default:
+		return nil, &ErrInvalidConfiguration{
+			Field:  "PermissionPolicy.Match",
+			Reason: fmt.Sprintf("invalid match mode %q", p.Match),
+		}
+	}
+
+	cwd := p.Cwd
+	if cwd == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine working "+
+				"directory: %w", err)
+		}
+		cwd = wd
+	}
+	compiled.cwd = resolvePolicyPath("", cwd)
+	compiled.roots = append(compiled.roots, compiled.cwd)
+	for _, dir := range p.AdditionalDirectories {
+		compiled.roots = append(
+			compiled.roots, resolvePolicyPath(compiled.cwd, dir),
+		)
+	}
+
+	for i, rule := range p.Rules {
+		cr, err := compileRule(i, rule)
+		if err != nil {
+			return nil, err
+		}
+		compiled.rules = append(compiled.rules, cr)
+		if cr.command != nil && rule.Action != PolicyActionAllow {
+			compiled.restrictsCommands = true
+		}
+	}
+
+	return compiled, nil
+}
+
+// compileRule validates and compiles a single rule.
+func compileRule(index int, rule PolicyRule) (compiledRule, error) {
+	field := func(name string) string {
+		return fmt.Sprintf("PermissionPolicy.Rules[%d].%s", index, name)
+	}
+
+	if !validPolicyAction(rule.Action) {
+		return compiledRule{}, &ErrInvalidConfiguration{
+			Field:  field("Action"),
+			Reason: fmt.Sprintf("invalid action %q", rule.Action),
+		}
+	}
+
+	cr := compiledRule{index: index, rule: rule}
+	patterns := []struct {
+		name    string
+		pattern string
+		target  **regexp.Regexp
+	}{
+		{"Tool", rule.Tool, &cr.tool},
+		{"MCPServer", rule.MCPServer, &cr.mcpServer},
+		{"MCPTool", rule.MCPTool, &cr.mcpTool},
+		{"Path", filepath.ToSlash(rule.Path), &cr.path},
+	}
+	for _, pat := range patterns {
+		if pat.pattern == "" {
+			continue
+		}
+		re, err := globToRegexp(pat.pattern)
+		if err != nil {
+			return compiledRule{}, &ErrInvalidConfiguration{
+				Field:  field(pat.name),
+				Reason: err.Error(),
+			}
+		}
+		*pat.target = re
+		cr.specificity += globLiteralLen(pat.pattern)
+	}
+	cr.pathAbs = rule.Path != "" && filepath.IsAbs(rule.Path)
+
+	if rule.Command != "" {
+		cr.command = strings.Fields(rule.Command)
+		if rule.Command != "*" {
+			cr.specificity += len(strings.Join(cr.command, " "))
+			cr.command[0] = filepath.Base(cr.command[0])
+		}
+	}
+
+	if rule.Command != "" && (rule.Path != "" || rule.MCPServer != "" ||
+		rule.MCPTool != "") {
+
+		return compiledRule{}, &ErrInvalidConfiguration{
+			Field:  field("Command"),
+			Reason: "command cannot be combined with path or MCP patterns",
+		}
+	}
+	if rule.Path != "" && (rule.MCPServer != "" || rule.MCPTool != "") {
+		return compiledRule{}, &ErrInvalidConfiguration{
+			Field:  field("Path"),
+			Reason: "path cannot be combined with MCP patterns",
+		}
+	}
+
+	return cr, nil
+}
+
+// canUseTool enforces the policy.
+func (c *compiledPolicy) canUseTool(ctx context.Context,
+	req ToolPermissionRequest) PermissionResult {
+
+	decision := c.evaluate(req)
+	switch decision.Action {
+	case PolicyActionAllow:
+		return PermissionAllow{}
+
+	case PolicyActionAsk:
+		if c.ask != nil {
+			return c.ask(ctx, req)
+		}
+		return PermissionDeny{
+			Reason: decision.Reason + " (approval required but no " +
+				"approver is configured)",
+		}
+
+	default:
+		return PermissionDeny{Reason: decision.Reason}
+	}
+}
+
+// policyRequest holds the parts of a tool request rules match against.
+type policyRequest struct {
+	toolName string
+
+	isMCP     bool
+	mcpServer string
+	mcpTool   string
+
+	isBash  bool
+	command string
+	words   []string
+	unsafe  bool
+
+	isFile   bool
+	absPath  string
+	relPaths []string
+}
+
+// evaluate decides req without resolving ask decisions.
+func (c *compiledPolicy) evaluate(req ToolPermissionRequest) PolicyDecision {
+	base := policyRequest{toolName: req.ToolName}
+
+	if server, tool, ok := splitMCPToolName(req.ToolName); ok {
+		base.isMCP = true
+		base.mcpServer = server
+		base.mcpTool = tool
+	}
+
+	if isPolicyFileTool(req.ToolName) {
+		target, err := policyFileTarget(req.ToolName, req.Arguments)
+		if err != nil {
+			return PolicyDecision{
+				Action: PolicyActionDeny,
+				Reason: fmt.Sprintf("cannot determine target path for "+
+					"%s: %v", req.ToolName, err),
+			}
+		}
+
+		base.isFile = true
+		base.absPath = resolvePolicyPath(c.cwd, target)
+		for _, root := range c.roots {
+			if rel, ok := pathWithin(root, base.absPath); ok {
+				base.relPaths = append(base.relPaths, rel)
+			}
+		}
+		if len(base.relPaths) == 0 {
+			return PolicyDecision{
+				Action: PolicyActionDeny,
+				Reason: fmt.Sprintf("path %s is outside the working "+
+					"directory and additional directories",
+					base.absPath),
+			}
+		}
+	}
+
+	if req.ToolName != "Bash" {
+		return c.decide(base)
+	}
+
+	bash, err := As[BashInput](req.Arguments)
+	if err != nil {
+		return PolicyDecision{
+			Action: PolicyActionDeny,
+			Reason: fmt.Sprintf("cannot parse Bash input: %v", err),
+		}
+	}
+
+	segments, unsafe := splitShellCommand(bash.Command)
+	if len(segments) == 0 {
+		segments = []string{""}
+	}
+
+	// Evaluate each segment on its own and keep the strictest decision.
+	var result PolicyDecision
+	words := make([][]string, len(segments))
+	for i, segment := range segments {
+		var wordsUnsafe bool
+		words[i], wordsUnsafe = commandWords(segment)
+		unsafe = unsafe || wordsUnsafe
+	}
+	for i, segment := range segments {
+		sub := base
+		sub.isBash = true
+		sub.command = segment
+		sub.words = words[i]
+		sub.unsafe = unsafe
+
+		decision := c.decide(sub)
+		if i == 0 || actionRank(decision.Action) > actionRank(result.Action) {
+			result = decision
+		}
+	}
+
+	// A command the policy cannot fully parse may hide one a deny or
+	// ask rule would match, so it is never allowed outright.
+	if unsafe && c.restrictsCommands && result.Action == PolicyActionAllow {
+		return PolicyDecision{
+			Action: PolicyActionAsk,
+			Reason: fmt.Sprintf("Bash command %q cannot be fully "+
+				"parsed by the permission policy", bash.Command),
+		}
+	}
+	return result
+}
+
+// decide picks the rule that applies to req, or the default action.
+func (c *compiledPolicy) decide(req policyRequest) PolicyDecision {
+	var matched *compiledRule
+	for i := range c.rules {
+		rule := &c.rules[i]
+		if !rule.matches(req) {
+			continue
+		}
+		if !c.mostSpecific {
+			matched = rule
+			break
+		}
+		if matched == nil || moreSpecific(rule, matched) {
+			matched = rule
+		}
+	}
+
+	if matched == nil {
+		return PolicyDecision{
+			Action: c.defaultAct,
+			Reason: fmt.Sprintf("no permission policy rule matched "+
+				"%s; default is %s", describePolicyRequest(req),
+				c.defaultAct),
+		}
+	}
+
+	rule := matched.rule
+	reason := fmt.Sprintf("%s by permission policy %s",
+		policyActionVerb(rule.Action), matched.describe())
+	if rule.Reason != "" {
+		reason += ": " + rule.Reason
+	}
+	return PolicyDecision{
+		Action: rule.Action,
+		Rule:   &rule,
+		Reason: reason,
+	}
+}
+
+// matches reports whether every pattern of the rule matches req.
+func (r *compiledRule) matches(req policyRequest) bool {
+	if r.tool != nil && !r.tool.MatchString(req.toolName) {
+		return false
+	}
+
+	if r.mcpServer != nil || r.mcpTool != nil {
+		if !req.isMCP {
+			return false
+		}
+		if r.mcpServer != nil && !r.mcpServer.MatchString(req.mcpServer) {
+			return false
+		}
+		if r.mcpTool != nil && !r.mcpTool.MatchString(req.mcpTool) {
+			return false
+		}
+	}
+
+	if r.command != nil {
+		if !req.isBash {
+			return false
+		}
+		if r.rule.Action == PolicyActionAllow && req.unsafe {
+			return false
+		}
+		if !commandHasPrefix(req.words, r.command) {
+			return false
+		}
+	}
+
+	if r.path != nil {
+		if !req.isFile {
+			return false
+		}
+		if r.pathAbs {
+			return r.path.MatchString(filepath.ToSlash(req.absPath))
+		}
+		for _, rel := range req.relPaths {
+			if r.path.MatchString(filepath.ToSlash(rel)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// describe names the rule for use in reasons.
+func (r *compiledRule) describe() string {
+	if r.rule.Name != "" {
+		return fmt.Sprintf("rule %q (#%d)", r.rule.Name, r.index+1)
+	}
+	return fmt.Sprintf("rule #%d", r.index+1)
+}
+
+// moreSpecific reports whether a should win over b in most_specific mode.
+func moreSpecific(a, b *compiledRule) bool {
+	if a.specificity != b.specificity {
+		return a.specificity > b.specificity
+	}
+	if actionRank(a.rule.Action) != actionRank(b.rule.Action) {
+		return actionRank(a.rule.Action) > actionRank(b.rule.Action)
+	}
+	return a.index < b.index
+}
+
+// actionRank orders actions from least to most restrictive.
+func actionRank(action PolicyAction) int {
+	switch action {
+	case PolicyActionAllow:
+		return 0
+	case PolicyActionAsk:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// policyActionVerb returns the past tense of an action for reasons.
+func policyActionVerb(action PolicyAction) string {
+	switch action {
+	case PolicyActionAllow:
+		return "allowed"
+	case PolicyActionAsk:
+		return "approval requested"
+	default:
+		return "denied"
+	}
+}
+
+// describePolicyRequest summarizes a request for use in reasons.
+func describePolicyRequest(req policyRequest) string {
+	switch {
+	case req.isBash:
+		return fmt.Sprintf("Bash command %q", req.command)
+	case req.isFile:
+		return fmt.Sprintf("%s on %s", req.toolName, req.absPath)
+	default:
+		return req.toolName
+	}
+}
+
+// validPolicyAction reports whether action is a known action.
+func validPolicyAction(action PolicyAction) bool {
+	switch action {
+	case PolicyActionAllow, PolicyActionDeny, PolicyActionAsk:
+		return true
+	default:
+		return false
+	}
+}
+
+// splitMCPToolName splits an mcp__<server>__<tool> tool name.
+func splitMCPToolName(name string) (string, string, bool) {
+	parts := strings.SplitN(name, "__", 3)
+	if len(parts) != 3 || parts[0] != "mcp" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// isPolicyFileTool reports whether the tool operates on a file path.
+func isPolicyFileTool(name string) bool {
+	switch name {
+	case "Read", "Edit", "MultiEdit", "Write", "NotebookEdit", "Glob",
+		"Grep", "LS":
+
+		return true
+	default:
+		return false
+	}
+}
+
+// policyFileTarget extracts the target path of a file tool call. Glob, Grep
+// and LS default to the working directory when no path is given. A Glob
+// pattern or Grep glob that is absolute or climbs out with ".." moves the
+// target to the directory it is anchored at, so that it is confined like
+// any other path.
+func policyFileTarget(tool string, raw json.RawMessage) (string, error) {
+	input, err := As[struct {
+		FilePath     string `json:"file_path"`
+		NotebookPath string `json:"notebook_path"`
+		Path         string `json:"path"`
+		Pattern      string `json:"pattern"`
+		Glob         string `json:"glob"`
+	}](raw)
+	if err != nil {
+		return "", err
+	}
+
+	switch tool {
+	case "NotebookEdit":
+		if input.NotebookPath == "" {
+			return "", fmt.Errorf("notebook_path is empty")
+		}
+		return input.NotebookPath, nil
+
+	case "Glob", "Grep", "LS":
+		path := input.Path
+		if path == "" {
+			path = "."
+		}
+
+		var pattern string
+		switch tool {
+		case "Glob":
+			pattern = input.Pattern
+		case "Grep":
+			pattern = input.Glob
+		}
+		base, err := policyPatternBase(pattern)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case base == "":
+			return path, nil
+		case filepath.IsAbs(base):
+			return base, nil
+		default:
+			return filepath.Join(path, base), nil
+		}
+
+	default:
+		if input.FilePath == "" {
+			return "", fmt.Errorf("file_path is empty")
+		}
+		return input.FilePath, nil
+	}
+}
+
+// policyPatternBase returns the literal directory prefix of a path glob that
+// is absolute or contains "..", or "" for a glob that stays below the
+// directory it is searched from. Globs whose reach cannot be determined,
+// such as "**/../x" or "~/x", are rejected.
+func policyPatternBase(pattern string) (string, error) {
+	if pattern == "" {
+		return "", nil
+	}
+	if strings.HasPrefix(pattern, "~") {
+		return "", fmt.Errorf("pattern %q is relative to a home "+
+			"directory", pattern)
+	}
+
+	slashed := filepath.ToSlash(pattern)
+	abs := filepath.IsAbs(pattern) || strings.HasPrefix(slashed, "/")
+
+	var (
+		prefix   []string
+		wildcard bool
+		climbs   bool
+	)
+	for _, segment := range strings.Split(slashed, "/") {
+		if strings.ContainsAny(segment, "*?[{") {
+			wildcard = true
+			continue
+		}
+		if segment == ".." {
+			if wildcard {
+				return "", fmt.Errorf("pattern %q has .. after "+
+					"a wildcard", pattern)
+			}
+			climbs = true
+		}
+		if !wildcard {
+			prefix = append(prefix, segment)
+		}
+	}
+	if !abs && !climbs {
+		return "", nil
+	}
+
+	base := strings.Join(prefix, "/")
+	if abs && !strings.HasPrefix(base, "/") {
+		base = "/" + base
+	}
+	return filepath.FromSlash(base), nil
+}
+
+// resolvePolicyPath makes path absolute relative to base, cleans it and
+// resolves symlinks in the longest existing prefix, so that links cannot be
+// used to escape the allowed directories.
+func resolvePolicyPath(base, path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	path = filepath.Clean(path)
+
+	var suffix []string
+	current := path
+	for {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			parts := append([]string{resolved}, suffix...)
+			return filepath.Join(parts...)
+		}
+
+		parent := filepath.Dir(current)
+		if parent == current {
+			return path
+		}
+		suffix = append([]string{filepath.Base(current)}, suffix...)
+		current = parent
+	}
+}
+
+// pathWithin returns path relative to root if it lies inside root.
+func pathWithin(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", false
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// commandHasPrefix reports whether the words of a command start with the
+// words in prefix. A prefix of "*" matches any command.
+func commandHasPrefix(words []string, prefix []string) bool {
+	if len(prefix) == 1 && prefix[0] == "*" {
+		return true
+	}
+
+	if len(words) < len(prefix) {
+		return false
+	}
+	for i, word := range prefix {
+		if words[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// shellReservedWords start compound commands, whose bodies prefix matching
+// cannot see.
+var shellReservedWords = map[string]bool{
+	"if": true, "then": true, "else": true, "elif": true, "fi": true,
+	"do": true, "done": true, "while": true, "until": true, "for": true,
+	"case": true, "esac": true, "select": true, "function": true,
+	"{": true, "}": true, "[[": true, "]]": true,
+}
+
+// commandWords returns the words of a simple command as the shell would
+// run it: with quotes and escapes removed, leading variable assignments and
+// wrappers such as env and nohup stripped, and a path-qualified command
+// name reduced to its base name. unsafe reports syntax the words cannot
+// represent, such as subshells, groups, compound commands or a command name
+// the shell expands.
+func commandWords(segment string) (words []string, unsafe bool) {
+	var (
+		current  strings.Builder
+		inWord   bool
+		quoted   bool
+		expands  bool
+		inSingle bool
+		inDouble bool
+		escaped  bool
+
+		// expanded records, for each word, whether it contains
+		// unquoted expansions or glob characters.
+		expanded []bool
+	)
+	endWord := func() {
+		if !inWord {
+			return
+		}
+		word := current.String()
+		if !quoted && shellReservedWords[word] {
+			unsafe = true
+		}
+		words = append(words, word)
+		expanded = append(expanded, expands)
+		current.Reset()
+		inWord, quoted, expands = false, false, false
+	}
+
+	for i := 0; i < len(segment); i++ {
+		ch := segment[i]
+
+		switch {
+		case escaped:
+			escaped = false
+			current.WriteByte(ch)
+
+		case inSingle:
+			if ch == '\'' {
+				inSingle = false
+			} else {
+				current.WriteByte(ch)
+			}
+
+		case inDouble && ch == '"':
+			inDouble = false
+
+		case inDouble && ch == '\\' && i+1 < len(segment) &&
+			strings.IndexByte("$`\"\\", segment[i+1]) >= 0:
+
+			escaped = true
+
+		case inDouble:
+			if ch == '$' || ch == '`' {
+				expands = true
+			}
+			current.WriteByte(ch)
+
+		case ch == '\\':
+			escaped, inWord, quoted = true, true, true
+
+		case ch == '\'':
+			inSingle, inWord, quoted = true, true, true
+
+		case ch == '"':
+			inDouble, inWord, quoted = true, true, true
+
+		case ch == ' ' || ch == '\t':
+			endWord()
+
+		case ch == '(' || ch == ')':
+			unsafe = true
+			endWord()
+
+		default:
+			if strings.IndexByte("$`*?[~", ch) >= 0 {
+				expands = true
+			}
+			current.WriteByte(ch)
+			inWord = true
+		}
+	}
+	endWord()
+	if inSingle || inDouble || escaped {
+		unsafe = true
+	}
+
+	// Strip what runs before the command itself.
+	for len(words) > 0 {
+		skip := shellPrefixLen(words)
+		if skip == 0 {
+			break
+		}
+		words, expanded = words[skip:], expanded[skip:]
+	}
+
+	if len(words) > 0 {
+		if expanded[0] {
+			unsafe = true
+		}
+		if strings.Contains(words[0], "/") {
+			words[0] = filepath.Base(words[0])
+		}
+	}
+	return words, unsafe
+}
+
+// shellPrefixLen returns the number of leading words that precede the
+// command proper: a variable assignment, or a wrapper such as env, command,
+// exec, nohup or time with its options. It returns 0 if words starts with
+// the command.
+func shellPrefixLen(words []string) int {
+	if isShellAssignment(words[0]) {
+		return 1
+	}
+
+	// optArgs lists the wrapper options that take an argument.
+	var optArgs string
+	switch filepath.Base(words[0]) {
+	case "env":
+		optArgs = "uCS"
+	case "exec":
+		optArgs = "a"
+	case "nice":
+		optArgs = "n"
+	case "command", "nohup", "builtin", "time":
+
+	// Reserved words that introduce a command. commandWords already
+	// marked the command unsafe.
+	case "!", "{", "if", "then", "else", "elif", "do", "while", "until":
+		return 1
+
+	default:
+		return 0
+	}
+
+	n := 1
+	for n < len(words) && strings.HasPrefix(words[n], "-") {
+		word := words[n]
+		n++
+		if word == "--" {
+			break
+		}
+		if len(word) == 2 && strings.ContainsRune(optArgs, rune(word[1])) {
+			n++
+		}
+	}
+	return min(n, len(words))
+}
+
+// isShellAssignment reports whether word is a NAME=value assignment.
+func isShellAssignment(word string) bool {
+	name, _, ok := strings.Cut(word, "=")
+	if !ok || name == "" {
+		return false
+	}
+	for i, ch := range name {
+		isAlpha := ch == '_' || (ch >= 'a' && ch <= 'z') ||
+			(ch >= 'A' && ch <= 'Z')
+		if !isAlpha && (i == 0 || ch < '0' || ch > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// splitShellCommand splits a shell command line into simple commands on ;,
+// newlines, &&, ||, | and &, honoring quotes. unsafe reports whether the
+// command contains substitutions or output redirection that make prefix
+// matching unreliable.
+func splitShellCommand(command string) (segments []string, unsafe bool) {
+	var (
+		current  strings.Builder
+		inSingle bool
+		inDouble bool
+		escaped  bool
+	)
+	flush := func() {
+		if segment := strings.TrimSpace(current.String()); segment != "" {
+			segments = append(segments, segment)
+		}
+		current.Reset()
+	}
+
+	for i := 0; i < len(command); i++ {
+		ch := command[i]
+
+		switch {
+		case escaped:
+			escaped = false
+
+		case ch == '\\' && !inSingle:
+			escaped = true
+
+		case ch == '\'' && !inDouble:
+			inSingle = !inSingle
+
+		case ch == '"' && !inSingle:
+			inDouble = !inDouble
+
+		case inSingle:
+
+		case ch == '`' || (ch == '$' && i+1 < len(command) &&
+			command[i+1] == '('):
+
+			unsafe = true
+
+		case inDouble:
+
+		case ch == '>' || (ch == '<' && i+1 < len(command) &&
+			command[i+1] == '('):
+
+			unsafe = true
+
+		case ch == ';' || ch == '\n' || ch == '|' || ch == '&':
+			flush()
+			continue
+		}
+
+		current.WriteByte(ch)
+	}
+	flush()
+
+	if inSingle || inDouble || escaped {
+		unsafe = true
+	}
+	return segments, unsafe
+}
+
+// globToRegexp compiles a glob into an anchored regular expression. "**/"
+// matches zero or more directories, "**" matches anything, "*" matches
+// within a segment and "?" matches one non-separator character.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// globLiteralLen counts the non-wildcard characters in a glob.
+func globLiteralLen(glob string) int {
+	n := 0
+	for _, ch := range glob {
+		if ch != '*' && ch != '?' {
+			n++
+		}
+	}
+	return n
+}
+
+// compileOptionsPolicy compiles opts.PermissionPolicy, filling in the working
+// directory, additional directories and ask callback from opts.
+func compileOptionsPolicy(opts *Options) (CanUseToolFunc, error) {
+	policy := *opts.PermissionPolicy
+	if policy.Cwd == "" {
+		policy.Cwd = opts.Cwd
+	}
+	if policy.AdditionalDirectories == nil {
+		policy.AdditionalDirectories = opts.AdditionalDirectories
+	}
+	if policy.Ask == nil {
+		policy.Ask = opts.CanUseTool
+	}
+	return policy.Compile()
+}
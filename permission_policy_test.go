@@ -0,0 +1,470 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPolicyRequest builds a permission request for tool with JSON arguments.
+func newPolicyRequest(t *testing.T, tool string,
+	args map[string]any) ToolPermissionRequest {
+
+	t.Helper()
+
+	data, err := json.Marshal(args)
+	require.NoError(t, err)
+	return ToolPermissionRequest{ToolName: tool, Arguments: data}
+}
+
+// TestPermissionPolicyBash covers prefix matching and compound commands.
+func TestPermissionPolicyBash(t *testing.T) {
+	policy := &PermissionPolicy{
+		Default: PolicyActionDeny,
+		Rules: []PolicyRule{
+			{
+				Name:    "no-force-push",
+				Action:  PolicyActionDeny,
+				Command: "git push --force",
+				Reason:  "force pushes are not allowed",
+			},
+			{Action: PolicyActionAllow, Command: "git"},
+			{Action: PolicyActionAllow, Command: "ls"},
+			{Action: PolicyActionDeny, Command: "rm"},
+		},
+	}
+
+	tests := []struct {
+		command string
+		want    PolicyAction
+	}{
+		{"git status", PolicyActionAllow},
+		{"git   log  --oneline", PolicyActionAllow},
+		{"gitk", PolicyActionDeny},
+		{"git push --force origin main", PolicyActionDeny},
+		{"ls && git status", PolicyActionAllow},
+		{"ls; rm -rf /", PolicyActionDeny},
+		{"ls | grep foo", PolicyActionDeny},
+		{"ls $(rm -rf /)", PolicyActionDeny},
+		{"git status > /etc/passwd", PolicyActionDeny},
+		{"git commit -m 'a; b'", PolicyActionAllow},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.command, func(t *testing.T) {
+			decision, err := policy.Explain(newPolicyRequest(
+				t, "Bash", map[string]any{"command": tc.command},
+			))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, decision.Action, decision.Reason)
+		})
+	}
+
+	decision, err := policy.Explain(newPolicyRequest(
+		t, "Bash", map[string]any{"command": "git push --force"},
+	))
+	require.NoError(t, err)
+	require.NotNil(t, decision.Rule)
+	assert.Equal(t, "no-force-push", decision.Rule.Name)
+	assert.Contains(t, decision.Reason, `"no-force-push" (#1)`)
+	assert.Contains(t, decision.Reason, "force pushes are not allowed")
+}
+
+// TestPermissionPolicyBashBypasses verifies that deny and ask rules see
+// through quoting, escapes, paths, assignments, wrappers and compound
+// commands, and that commands the policy cannot parse are not allowed
+// outright.
+func TestPermissionPolicyBashBypasses(t *testing.T) {
+	policy := &PermissionPolicy{
+		Default: PolicyActionAllow,
+		Rules: []PolicyRule{
+			{Action: PolicyActionDeny, Command: "rm"},
+			{Action: PolicyActionAsk, Command: "curl"},
+		},
+	}
+
+	tests := []struct {
+		command string
+		want    PolicyAction
+	}{
+		{`"rm" -rf /`, PolicyActionDeny},
+		{`'rm' -rf /`, PolicyActionDeny},
+		{`r''m -rf /`, PolicyActionDeny},
+		{`\rm -rf /`, PolicyActionDeny},
+		{`/bin/rm -rf /`, PolicyActionDeny},
+		{`FOO=1 rm -rf /`, PolicyActionDeny},
+		{`env rm -rf /`, PolicyActionDeny},
+		{`env -i -u HOME FOO=1 /bin/rm -rf /`, PolicyActionDeny},
+		{`command rm -rf /`, PolicyActionDeny},
+		{`exec rm -rf /`, PolicyActionDeny},
+		{`nohup rm -rf / &`, PolicyActionDeny},
+		{`(rm -rf /)`, PolicyActionDeny},
+		{`{ rm -rf /; }`, PolicyActionDeny},
+		{`if true; then rm -rf /; fi`, PolicyActionDeny},
+		{`FOO=1 env curl example.com`, PolicyActionAsk},
+		{`$CMD -rf /`, PolicyActionAsk},
+		{`r*m -rf /`, PolicyActionAsk},
+		{`echo "rm -rf /"`, PolicyActionAllow},
+		{`ls -la`, PolicyActionAllow},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.command, func(t *testing.T) {
+			decision, err := policy.Explain(newPolicyRequest(
+				t, "Bash", map[string]any{"command": tc.command},
+			))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, decision.Action, decision.Reason)
+		})
+	}
+
+	// Without deny or ask rules for commands there is nothing to
+	// escalate to.
+	allowAll := &PermissionPolicy{Default: PolicyActionAllow}
+	decision, err := allowAll.Explain(newPolicyRequest(
+		t, "Bash", map[string]any{"command": "$CMD"},
+	))
+	require.NoError(t, err)
+	assert.Equal(t, PolicyActionAllow, decision.Action)
+}
+
+// TestPermissionPolicyPaths covers path globs and directory confinement.
+func TestPermissionPolicyPaths(t *testing.T) {
+	cwd := t.TempDir()
+	extra := t.TempDir()
+	outside := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(cwd, "src", "pkg"), 0o755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(cwd, "escape")))
+
+	policy := &PermissionPolicy{
+		Cwd:                   cwd,
+		AdditionalDirectories: []string{extra},
+		Default:               PolicyActionDeny,
+		Rules: []PolicyRule{
+			{Action: PolicyActionDeny, Path: "**/.env"},
+			{Action: PolicyActionAllow, Tool: "Read", Path: "**"},
+			{Action: PolicyActionAllow, Tool: "Edit", Path: "src/**/*.go"},
+			{Action: PolicyActionAllow, Tool: "Glob"},
+			{Action: PolicyActionAllow, Tool: "Grep"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		tool string
+		args map[string]any
+		want PolicyAction
+	}{
+		{
+			name: "read relative",
+			tool: "Read",
+			args: map[string]any{"file_path": "README.md"},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "read additional directory",
+			tool: "Read",
+			args: map[string]any{"file_path": filepath.Join(extra, "a")},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "read env file",
+			tool: "Read",
+			args: map[string]any{"file_path": "src/.env"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "read outside",
+			tool: "Read",
+			args: map[string]any{"file_path": "/etc/passwd"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "read dot dot",
+			tool: "Read",
+			args: map[string]any{"file_path": "../../etc/passwd"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "read through symlink",
+			tool: "Read",
+			args: map[string]any{"file_path": "escape/secret"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "edit go file",
+			tool: "Edit",
+			args: map[string]any{"file_path": "src/pkg/main.go"},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "edit non go file",
+			tool: "Edit",
+			args: map[string]any{"file_path": "src/pkg/main.c"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "glob defaults to cwd",
+			tool: "Glob",
+			args: map[string]any{"pattern": "*.go"},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "glob absolute pattern",
+			tool: "Glob",
+			args: map[string]any{"pattern": "/etc/**/*"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "glob pattern climbs out",
+			tool: "Glob",
+			args: map[string]any{"pattern": "../../**/*.pem"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "glob pattern climbs after wildcard",
+			tool: "Glob",
+			args: map[string]any{"pattern": "src/**/../../../x"},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "glob pattern within cwd",
+			tool: "Glob",
+			args: map[string]any{"pattern": "src/../**/*.go"},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "glob absolute pattern in additional directory",
+			tool: "Glob",
+			args: map[string]any{
+				"pattern": filepath.Join(extra, "**", "*.go"),
+			},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "grep glob within cwd",
+			tool: "Grep",
+			args: map[string]any{"pattern": "BEGIN", "glob": "*.pem"},
+			want: PolicyActionAllow,
+		},
+		{
+			name: "grep glob climbs out",
+			tool: "Grep",
+			args: map[string]any{
+				"pattern": "BEGIN",
+				"glob":    "../../**/*.pem",
+			},
+			want: PolicyActionDeny,
+		},
+		{
+			name: "missing path",
+			tool: "Write",
+			args: map[string]any{"content": "x"},
+			want: PolicyActionDeny,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			decision, err := policy.Explain(
+				newPolicyRequest(t, tc.tool, tc.args),
+			)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, decision.Action, decision.Reason)
+		})
+	}
+}
+
+// TestPermissionPolicyMCP covers MCP server and tool patterns.
+func TestPermissionPolicyMCP(t *testing.T) {
+	policy := &PermissionPolicy{
+		Rules: []PolicyRule{
+			{Action: PolicyActionDeny, MCPServer: "prod-*"},
+			{Action: PolicyActionAllow, MCPServer: "github", MCPTool: "get_*"},
+		},
+	}
+
+	tests := []struct {
+		tool string
+		want PolicyAction
+	}{
+		{"mcp__prod-db__query", PolicyActionDeny},
+		{"mcp__github__get_issue", PolicyActionAllow},
+		{"mcp__github__create_issue", PolicyActionAsk},
+		{"WebFetch", PolicyActionAsk},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.tool, func(t *testing.T) {
+			decision, err := policy.Explain(ToolPermissionRequest{
+				ToolName: tc.tool,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, decision.Action)
+		})
+	}
+}
+
+// TestPermissionPolicyMostSpecific verifies that the most specific rule wins
+// regardless of order, and that deny wins ties.
+func TestPermissionPolicyMostSpecific(t *testing.T) {
+	policy := &PermissionPolicy{
+		Match: PolicyMatchMostSpecific,
+		Rules: []PolicyRule{
+			{Action: PolicyActionDeny, Command: "git"},
+			{Action: PolicyActionAllow, Command: "git status"},
+			{Action: PolicyActionAllow, Tool: "Web*"},
+			{Action: PolicyActionDeny, Tool: "*Fetch"},
+		},
+	}
+
+	explain := func(req ToolPermissionRequest) PolicyAction {
+		decision, err := policy.Explain(req)
+		require.NoError(t, err)
+		return decision.Action
+	}
+
+	assert.Equal(t, PolicyActionAllow, explain(newPolicyRequest(
+		t, "Bash", map[string]any{"command": "git status"},
+	)))
+	assert.Equal(t, PolicyActionDeny, explain(newPolicyRequest(
+		t, "Bash", map[string]any{"command": "git push"},
+	)))
+	assert.Equal(t, PolicyActionDeny, explain(ToolPermissionRequest{
+		ToolName: "WebFetch",
+	}))
+
+	policy.Match = PolicyMatchFirst
+	assert.Equal(t, PolicyActionDeny, explain(newPolicyRequest(
+		t, "Bash", map[string]any{"command": "git status"},
+	)))
+}
+
+// TestPermissionPolicyAsk verifies that ask decisions are delegated.
+func TestPermissionPolicyAsk(t *testing.T) {
+	policy := &PermissionPolicy{
+		Rules: []PolicyRule{{Action: PolicyActionAsk, Tool: "Write"}},
+	}
+
+	canUseTool, err := policy.Compile()
+	require.NoError(t, err)
+
+	result := canUseTool(context.Background(), ToolPermissionRequest{
+		ToolName: "WebSearch",
+	})
+	deny, ok := result.(PermissionDeny)
+	require.True(t, ok)
+	assert.Contains(t, deny.Reason, "no approver")
+
+	var asked []string
+	policy.Ask = func(_ context.Context,
+		req ToolPermissionRequest) PermissionResult {
+
+		asked = append(asked, req.ToolName)
+		return PermissionAllow{}
+	}
+	canUseTool, err = policy.Compile()
+	require.NoError(t, err)
+
+	result = canUseTool(context.Background(), ToolPermissionRequest{
+		ToolName: "WebSearch",
+	})
+	assert.True(t, result.IsAllow())
+	assert.Equal(t, []string{"WebSearch"}, asked)
+}
+
+// TestParsePermissionPolicy covers YAML and JSON loading and validation.
+func TestParsePermissionPolicy(t *testing.T) {
+	yamlPolicy := `
+default: deny
+match: most_specific
+rules:
+  - name: safe-git
+    action: allow
+    command: git status
+  - action: deny
+    mcp_server: prod-*
+    reason: production is off limits
+`
+	policy, err := ParsePermissionPolicy([]byte(yamlPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, PolicyActionDeny, policy.Default)
+	assert.Equal(t, PolicyMatchMostSpecific, policy.Match)
+	require.Len(t, policy.Rules, 2)
+	assert.Equal(t, "prod-*", policy.Rules[1].MCPServer)
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"rules":[`+
+		`{"action":"allow","tool":"Read","path":"**"}]}`), 0o600))
+	policy, err = LoadPermissionPolicy(path)
+	require.NoError(t, err)
+	require.Len(t, policy.Rules, 1)
+	assert.Equal(t, "**", policy.Rules[0].Path)
+
+	invalid := []string{
+		`rules: [{action: maybe}]`,
+		`rules: [{action: allow, toool: Bash}]`,
+		`match: best`,
+		`rules: [{action: allow, command: ls, path: "*"}]`,
+	}
+	for _, data := range invalid {
+		_, err := ParsePermissionPolicy([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+// TestWithPermissionPolicy verifies that NewClient compiles the policy into
+// CanUseTool using the client's directories and fallback callback.
+func TestWithPermissionPolicy(t *testing.T) {
+	cwd := t.TempDir()
+	fallback := func(context.Context, ToolPermissionRequest) PermissionResult {
+		return PermissionAllow{}
+	}
+
+	client, err := NewClient(
+		WithTransport(newMockTransport(10)),
+		WithCwd(cwd),
+		WithCanUseTool(fallback),
+		WithPermissionPolicy(&PermissionPolicy{
+			Rules: []PolicyRule{
+				{Action: PolicyActionAllow, Tool: "Read", Path: "**"},
+				{Action: PolicyActionDeny, Tool: "Bash"},
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	canUseTool := client.options.CanUseTool
+	require.NotNil(t, canUseTool)
+
+	ctx := context.Background()
+	assert.True(t, canUseTool(ctx, newPolicyRequest(
+		t, "Read", map[string]any{"file_path": "a.go"},
+	)).IsAllow())
+	assert.False(t, canUseTool(ctx, newPolicyRequest(
+		t, "Read", map[string]any{"file_path": "/etc/passwd"},
+	)).IsAllow())
+	assert.False(t, canUseTool(ctx, newPolicyRequest(
+		t, "Bash", map[string]any{"command": "ls"},
+	)).IsAllow())
+
+	// Unmatched requests fall through to the WithCanUseTool callback.
+	assert.True(t, canUseTool(ctx, ToolPermissionRequest{
+		ToolName: "WebSearch",
+	}).IsAllow())
+
+	_, err = NewClient(
+		WithTransport(newMockTransport(10)),
+		WithPermissionPolicy(&PermissionPolicy{Default: "sometimes"}),
+	)
+	var invalid *ErrInvalidConfiguration
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "PermissionPolicy.Default", invalid.Field)
+}
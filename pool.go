@@ -0,0 +1,539 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPoolSize is the number of clients a ClientPool keeps when
+	// PoolOptions.Size is zero.
+	DefaultPoolSize = 4
+
+	// DefaultPoolMaxTurns is the number of turns a pooled client serves
+	// before it is replaced when PoolOptions.MaxTurns is zero. A value of
+	// one gives every lease a fresh conversation.
+	DefaultPoolMaxTurns = 1
+
+	// DefaultPoolConnectTimeout bounds starting and initializing a pooled
+	// client when PoolOptions.ConnectTimeout is zero.
+	DefaultPoolConnectTimeout = 60 * time.Second
+
+	// DefaultPoolHealthCheckInterval is how often idle clients are checked
+	// when PoolOptions.HealthCheckInterval is zero.
+	DefaultPoolHealthCheckInterval = 30 * time.Second
+
+	// poolRespawnMaxBackoff caps the delay between attempts to replace a
+	// retired client.
+	poolRespawnMaxBackoff = 30 * time.Second
+)
+
+// PoolOptions configures a ClientPool. Zero-valued fields use the
+// DefaultPool* constants.
+type PoolOptions struct {
+	// Size is the number of clients kept running, idle or leased.
+	Size int
+
+	// MaxTurns is the number of turns a client serves, across leases,
+	// before it is closed and replaced. Negative means unlimited. Clients
+	// keep their conversation between leases, so values above one let a
+	// lease see the history of earlier ones.
+	MaxTurns int
+
+	// MaxCostUSD retires a client once the session cost reported by the
+	// CLI reaches it. Zero means unlimited.
+	MaxCostUSD float64
+
+	// ConnectTimeout bounds starting and initializing each client.
+	ConnectTimeout time.Duration
+
+	// HealthCheckInterval is how often idle clients are checked with
+	// IsReady. Unhealthy clients are replaced.
+	HealthCheckInterval time.Duration
+
+	// NewTransport builds the transport for each pooled client from the
+	// pool's client options. If nil, each client spawns its own CLI
+	// subprocess. It is required when WithTransport is used, since a
+	// transport cannot be shared between clients.
+	NewTransport func(opts *Options) (Transport, error)
+}
+
+// withDefaults returns the options with zero values replaced by defaults.
+func (o PoolOptions) withDefaults() PoolOptions {
+	if o.Size <= 0 {
+		o.Size = DefaultPoolSize
+	}
+	if o.MaxTurns == 0 {
+		o.MaxTurns = DefaultPoolMaxTurns
+	}
+	if o.ConnectTimeout <= 0 {
+		o.ConnectTimeout = DefaultPoolConnectTimeout
+	}
+	if o.HealthCheckInterval <= 0 {
+		o.HealthCheckInterval = DefaultPoolHealthCheckInterval
+	}
+	return o
+}
+
+// ClientPool keeps a set of connected, initialized clients ready to be
+// leased, hiding the seconds it takes to spawn and initialize the CLI.
+//
+// Clients are recycled after PoolOptions.MaxTurns turns or once their cost
+// reaches PoolOptions.MaxCostUSD, and replaced in the background. A
+// ClientPool is safe for concurrent use.
+//
+// Example:
+//
+//	pool, err := claudeagent.NewClientPool(ctx,
+//	    claudeagent.PoolOptions{Size: 8},
+//	    claudeagent.WithPermissionMode(claudeagent.PermissionModeDontAsk),
+//	)
+//	if err != nil {
+//	    return err
+//	}
+//	defer pool.Shutdown(ctx)
+//
+//	lease, err := pool.Acquire(ctx, claudeagent.WithModel("haiku"))
+//	if err != nil {
+//	    return err
+//	}
+//	defer lease.Release()
+//
+//	for msg := range lease.Client().Query(ctx, prompt) {
+//	    // ...
+//	}
+type ClientPool struct {
+	cfg  PoolOptions
+	opts []Option
+	base Options
+
+	// idle holds clients ready to be leased. Its capacity is the pool
+	// size, so returning a client never blocks.
+	idle chan *pooledClient
+
+	// ctx is canceled on shutdown and stops background work.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// mu guards closed and leased. leases tracks outstanding leases for
+	// Shutdown.
+	mu     sync.Mutex
+	closed bool
+	leased map[*pooledClient]struct{}
+	leases sync.WaitGroup
+}
+
+// pooledClient is a client owned by a pool, along with the model and
+// permission mode it is currently set to.
+type pooledClient struct {
+	client *Client
+	model  string
+	mode   PermissionMode
+}
+
+// NewClientPool starts cfg.Size clients configured with opts and waits for
+// all of them to connect and initialize. If any fails, the others are closed
+// and the error is returned.
+func NewClientPool(ctx context.Context, cfg PoolOptions,
+	opts ...Option) (*ClientPool, error) {
+
+	cfg = cfg.withDefaults()
+
+	base := DefaultOptions()
+	for _, opt := range opts {
+		opt(&base)
+	}
+	if base.Transport != nil && cfg.NewTransport == nil {
+		return nil, &ErrInvalidConfiguration{
+			Field:  "PoolOptions.NewTransport",
+			Reason: "required when a custom transport is configured",
+		}
+	}
+
+	poolCtx, cancel := context.WithCancel(context.Background())
+	p := &ClientPool{
+		cfg:    cfg,
+		opts:   opts,
+		base:   base,
+		idle:   make(chan *pooledClient, cfg.Size),
+		ctx:    poolCtx,
+		cancel: cancel,
+		leased: make(map[*pooledClient]struct{}),
+	}
+
+	// Warm up every client concurrently.
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for range cfg.Size {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pc, err := p.spawn(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			p.idle <- pc
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		p.Close()
+		return nil, firstErr
+	}
+
+	p.wg.Add(1)
+	go p.healthCheck()
+
+	return p, nil
+}
+
+// spawn creates, connects and initializes a new pooled client.
+func (p *ClientPool) spawn(ctx context.Context) (*pooledClient, error) {
+	opts := slices.Clone(p.opts)
+
+	var transport Transport
+	if p.cfg.NewTransport != nil {
+		options := p.base
+		var err error
+		transport, err = p.cfg.NewTransport(&options)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create transport: %w", err)
+		}
+		opts = append(opts, WithTransport(transport))
+	}
+
+	client, err := NewClient(opts...)
+	if err != nil {
+		if transport != nil {
+			_ = transport.Close()
+		}
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ConnectTimeout)
+	defer cancel()
+
+	if err := client.Connect(ctx); err != nil {
+		_ = client.Close()
+		if transport != nil {
+			_ = transport.Close()
+		}
+		return nil, err
+	}
+
+	return &pooledClient{
+		client: client,
+		model:  p.base.Model,
+		mode:   p.base.PermissionMode,
+	}, nil
+}
+
+// Acquire leases an idle client, waiting for one to become available.
+//
+// Options adjust the client for this lease where the CLI allows it at
+// runtime: WithModel and WithPermissionMode are applied with control
+// requests, and later leases without them get the pool's settings back.
+// Other options are fixed when the pool starts its clients and are ignored
+// here.
+//
+// The lease must be released with Release or Discard when done.
+func (p *ClientPool) Acquire(ctx context.Context,
+	opts ...Option) (*Lease, error) {
+
+	desired := DefaultOptions()
+	for _, opt := range p.opts {
+		opt(&desired)
+	}
+	for _, opt := range opts {
+		opt(&desired)
+	}
+
+	for {
+		var pc *pooledClient
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-p.ctx.Done():
+			return nil, &ErrPoolClosed{}
+		case pc = <-p.idle:
+		}
+
+		if !pc.healthy() {
+			p.retire(pc)
+			continue
+		}
+
+		if err := pc.configure(ctx, &desired); err != nil {
+			// The client may be half configured; replace it.
+			p.retire(pc)
+			return nil, err
+		}
+
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = pc.client.Close()
+			return nil, &ErrPoolClosed{}
+		}
+		p.leased[pc] = struct{}{}
+		p.leases.Add(1)
+		p.mu.Unlock()
+
+		return &Lease{pool: p, pc: pc}, nil
+	}
+}
+
+// healthy reports whether the client's CLI is running and its message
+// stream has not failed.
+func (pc *pooledClient) healthy() bool {
+	transport, _ := pc.client.conn()
+	return transport != nil && transport.IsReady() && pc.client.Err() == nil
+}
+
+// configure switches the client to the model and permission mode in opts.
+func (pc *pooledClient) configure(ctx context.Context, opts *Options) error {
+	if opts.Model != pc.model {
+		_, err := pc.client.sendSDKControlRequest(ctx, SDKControlRequestBody{
+			Subtype: "set_model",
+			Model:   opts.Model,
+		})
+		if err != nil {
+			return err
+		}
+		pc.model = opts.Model
+	}
+
+	if opts.PermissionMode != pc.mode {
+		_, err := pc.client.sendSDKControlRequest(ctx, SDKControlRequestBody{
+			Subtype: "set_permission_mode",
+			Mode:    string(opts.PermissionMode),
+		})
+		if err != nil {
+			return err
+		}
+		pc.mode = opts.PermissionMode
+	}
+
+	return nil
+}
+
+// expired reports whether the client has used up its turn or cost budget.
+func (p *ClientPool) expired(pc *pooledClient) bool {
+	turns, cost := pc.client.usage()
+	if p.cfg.MaxTurns > 0 && turns >= p.cfg.MaxTurns {
+		return true
+	}
+	return p.cfg.MaxCostUSD > 0 && cost >= p.cfg.MaxCostUSD
+}
+
+// put returns a client to the idle set, or closes it if the pool has shut
+// down. It reports whether the client was kept.
+func (p *ClientPool) put(pc *pooledClient) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = pc.client.Close()
+		return false
+	}
+	p.idle <- pc
+	return true
+}
+
+// retire closes a client and starts a replacement in the background, unless
+// the pool has shut down.
+func (p *ClientPool) retire(pc *pooledClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		_ = pc.client.Close()
+		return
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		_ = pc.client.Close()
+		p.replenish()
+	}()
+}
+
+// replenish starts a new client and adds it to the idle set, retrying with
+// backoff until it succeeds or the pool shuts down.
+func (p *ClientPool) replenish() {
+	backoff := DefaultReconnectInitialBackoff
+	for {
+		pc, err := p.spawn(p.ctx)
+		if err == nil {
+			p.put(pc)
+			return
+		}
+
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, poolRespawnMaxBackoff)
+	}
+}
+
+// healthCheck periodically replaces idle clients that are no longer ready.
+func (p *ClientPool) healthCheck() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.cfg.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Check each client that is idle right now once.
+		for range len(p.idle) {
+			var pc *pooledClient
+			select {
+			case pc = <-p.idle:
+			default:
+			}
+			if pc == nil {
+				break
+			}
+
+			if pc.healthy() {
+				p.put(pc)
+			} else {
+				p.retire(pc)
+			}
+		}
+	}
+}
+
+// Shutdown stops leasing, closes idle clients and waits for outstanding
+// leases to be released, closing each client as it comes back. If ctx is
+// done first, the remaining leased clients are closed and ctx's error is
+// returned.
+func (p *ClientPool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	// Stop health checks and replacements, and close idle clients.
+	p.cancel()
+	p.wg.Wait()
+	p.closeIdle()
+
+	done := make(chan struct{})
+	go func() {
+		p.leases.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	for pc := range p.leased {
+		_ = pc.client.Close()
+	}
+	p.mu.Unlock()
+
+	return ctx.Err()
+}
+
+// Close shuts the pool down immediately, closing leased clients as well as
+// idle ones.
+func (p *ClientPool) Close() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := p.Shutdown(ctx); !errors.Is(err, context.Canceled) {
+		return err
+	}
+	return nil
+}
+
+// closeIdle closes every idle client.
+func (p *ClientPool) closeIdle() {
+	for {
+		select {
+		case pc := <-p.idle:
+			_ = pc.client.Close()
+		default:
+			return
+		}
+	}
+}
+
+// Lease is a client borrowed from a ClientPool. The client must not be used
+// after the lease is released.
+type Lease struct {
+	pool *ClientPool
+	pc   *pooledClient
+	once sync.Once
+}
+
+// Client returns the leased client.
+func (l *Lease) Client() *Client {
+	return l.pc.client
+}
+
+// Release returns the client to the pool. It is closed and replaced instead
+// if it is unhealthy or has reached its turn or cost budget. Calling Release
+// more than once has no effect.
+func (l *Lease) Release() {
+	l.done(false)
+}
+
+// Discard closes the client instead of returning it to the pool, for
+// example after abandoning a query mid-turn. A replacement is started in
+// the background.
+func (l *Lease) Discard() {
+	l.done(true)
+}
+
+// done ends the lease, recycling the client if discard is set or it can no
+// longer be reused.
+func (l *Lease) done(discard bool) {
+	l.once.Do(func() {
+		p, pc := l.pool, l.pc
+
+		p.mu.Lock()
+		delete(p.leased, pc)
+		p.mu.Unlock()
+		defer p.leases.Done()
+
+		if discard || !pc.healthy() || p.expired(pc) {
+			p.retire(pc)
+			return
+		}
+		p.put(pc)
+	})
+}
@@ -0,0 +1,218 @@
+package claudeagent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoFactory creates echo transports for a pool and remembers them.
+type echoFactory struct {
+	mu         sync.Mutex
+	transports []*echoTransport
+	turnCost   float64
+}
+
+func (f *echoFactory) newTransport(*Options) (Transport, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	transport := newEchoTransport()
+	transport.turnCost = f.turnCost
+	f.transports = append(f.transports, transport)
+	return transport, nil
+}
+
+func (f *echoFactory) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.transports)
+}
+
+// controlRequests returns the subtypes of control requests written to
+// transport, other than initialize.
+func controlRequests(transport *echoTransport) []SDKControlRequestBody {
+	transport.mockTransport.mu.Lock()
+	defer transport.mockTransport.mu.Unlock()
+
+	var bodies []SDKControlRequestBody
+	for _, msg := range transport.written {
+		req, ok := msg.(SDKControlRequest)
+		if ok && req.Request.Subtype != "initialize" {
+			bodies = append(bodies, req.Request)
+		}
+	}
+	return bodies
+}
+
+// newTestPool creates a pool backed by echo transports.
+func newTestPool(t *testing.T, cfg PoolOptions,
+	factory *echoFactory) *ClientPool {
+
+	t.Helper()
+
+	cfg.NewTransport = factory.newTransport
+	pool, err := NewClientPool(context.Background(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pool.Close() })
+	return pool
+}
+
+// acquire leases a client with a timeout.
+func acquire(t *testing.T, pool *ClientPool, opts ...Option) *Lease {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lease, err := pool.Acquire(ctx, opts...)
+	require.NoError(t, err)
+	return lease
+}
+
+// TestClientPoolWarmsUp verifies that every client is started up front.
+func TestClientPoolWarmsUp(t *testing.T) {
+	factory := &echoFactory{}
+	newTestPool(t, PoolOptions{Size: 3}, factory)
+
+	require.Equal(t, 3, factory.count())
+	for _, transport := range factory.transports {
+		assert.True(t, transport.IsReady())
+	}
+}
+
+// TestClientPoolRecyclesAfterTurns verifies that a client is replaced once
+// it has served its turn budget.
+func TestClientPoolRecyclesAfterTurns(t *testing.T) {
+	factory := &echoFactory{}
+	pool := newTestPool(t, PoolOptions{Size: 1, MaxTurns: 2}, factory)
+
+	lease := acquire(t, pool)
+	first := lease.Client()
+	collectQuery(t, first, "one")
+	lease.Release()
+
+	lease = acquire(t, pool)
+	require.Same(t, first, lease.Client())
+	collectQuery(t, first, "two")
+	lease.Release()
+
+	lease = acquire(t, pool)
+	defer lease.Release()
+	assert.NotSame(t, first, lease.Client())
+	assert.Equal(t, 2, factory.count())
+	assert.False(t, factory.transports[0].IsReady())
+}
+
+// TestClientPoolRecyclesAfterCost verifies that a client is replaced once
+// the session cost reaches the budget.
+func TestClientPoolRecyclesAfterCost(t *testing.T) {
+	factory := &echoFactory{turnCost: 0.3}
+	pool := newTestPool(t, PoolOptions{
+		Size:       1,
+		MaxTurns:   -1,
+		MaxCostUSD: 0.5,
+	}, factory)
+
+	lease := acquire(t, pool)
+	first := lease.Client()
+	collectQuery(t, first, "cheap")
+	lease.Release()
+
+	lease = acquire(t, pool)
+	require.Same(t, first, lease.Client())
+	collectQuery(t, first, "expensive")
+	lease.Release()
+
+	lease = acquire(t, pool)
+	defer lease.Release()
+	assert.NotSame(t, first, lease.Client())
+}
+
+// TestClientPoolLeaseOptions verifies that model and permission mode are
+// applied per lease and restored for the next one.
+func TestClientPoolLeaseOptions(t *testing.T) {
+	factory := &echoFactory{}
+	pool := newTestPool(t, PoolOptions{Size: 1, MaxTurns: -1}, factory)
+
+	lease := acquire(t, pool,
+		WithModel("claude-haiku-4-5"),
+		WithPermissionMode(PermissionModePlan),
+	)
+	lease.Release()
+
+	lease = acquire(t, pool)
+	lease.Release()
+
+	assert.Equal(t, []SDKControlRequestBody{
+		{Subtype: "set_model", Model: "claude-haiku-4-5"},
+		{Subtype: "set_permission_mode", Mode: string(PermissionModePlan)},
+		{Subtype: "set_model", Model: DefaultOptions().Model},
+		{
+			Subtype: "set_permission_mode",
+			Mode:    string(PermissionModeDefault),
+		},
+	}, controlRequests(factory.transports[0]))
+}
+
+// TestClientPoolReplacesUnhealthy verifies that a client whose CLI is gone
+// is not leased.
+func TestClientPoolReplacesUnhealthy(t *testing.T) {
+	factory := &echoFactory{}
+	pool := newTestPool(t, PoolOptions{Size: 1, MaxTurns: -1}, factory)
+
+	require.NoError(t, factory.transports[0].Close())
+
+	lease := acquire(t, pool)
+	defer lease.Release()
+
+	assert.Equal(t, 2, factory.count())
+	assert.Len(t, collectQuery(t, lease.Client(), "hello"), 2)
+}
+
+// TestClientPoolShutdown verifies that Shutdown waits for outstanding
+// leases and that the pool cannot be used afterwards.
+func TestClientPoolShutdown(t *testing.T) {
+	factory := &echoFactory{}
+	pool := newTestPool(t, PoolOptions{Size: 2, MaxTurns: -1}, factory)
+
+	lease := acquire(t, pool)
+
+	done := make(chan error)
+	go func() {
+		done <- pool.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("shutdown returned with a lease outstanding")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	lease.Release()
+	require.NoError(t, <-done)
+
+	for _, transport := range factory.transports {
+		assert.False(t, transport.IsReady())
+	}
+
+	_, err := pool.Acquire(context.Background())
+	var closed *ErrPoolClosed
+	assert.ErrorAs(t, err, &closed)
+}
+
+// TestNewClientPoolRequiresFactory verifies that a custom transport cannot
+// be shared by pooled clients.
+func TestNewClientPoolRequiresFactory(t *testing.T) {
+	_, err := NewClientPool(
+		context.Background(), PoolOptions{},
+		WithTransport(newMockTransport(1)),
+	)
+	var invalid *ErrInvalidConfiguration
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "PoolOptions.NewTransport", invalid.Field)
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package claudeagent
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op on platforms without process groups.
+func setProcessGroup(*exec.Cmd) {}
+
+// signalProcessGroup sends sig to p alone on platforms without process
+// groups.
+func signalProcessGroup(p *os.Process, sig os.Signal) error {
+	if sig == os.Kill {
+		return p.Kill()
+	}
+	return p.Signal(sig)
+}
@@ -0,0 +1,34 @@
+//go:build unix
+
+package claudeagent
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup makes cmd the leader of a new process group, so that
+// signals reach the tools the CLI starts as well as the CLI itself.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalProcessGroup sends sig to the process group led by p. It returns
+// os.ErrProcessDone if no process in the group is left.
+func signalProcessGroup(p *os.Process, sig os.Signal) error {
+	signal, ok := sig.(syscall.Signal)
+	if !ok {
+		return p.Signal(sig)
+	}
+
+	err := syscall.Kill(-p.Pid, signal)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
@@ -52,13 +52,25 @@ func (p *Protocol) Initialize(ctx context.Context) error {
 		return nil // Already initialized
 	}
 
-	// Build hook configuration in TypeScript SDK format.
+	// Build hook configuration in TypeScript SDK format. Each middleware
+	// chain is registered as one more callback.
+	allHooks := make(map[HookType][]HookConfig)
+	for hookType, configs := range p.options.Hooks {
+		allHooks[hookType] = append(allHooks[hookType], configs...)
+	}
+	chains := hookChainConfigs(
+		p.options.HookMiddleware, p.options.Audit, p.options.logger(),
+	)
+	for hookType, configs := range chains {
+		allHooks[hookType] = append(allHooks[hookType], configs...)
+	}
+
 	var hooks map[string][]SDKHookCallbackMatcher
-	if len(p.options.Hooks) > 0 {
+	if len(allHooks) > 0 {
 		hooks = make(map[string][]SDKHookCallbackMatcher)
 		hookID := 0
 
-		for hookType, configs := range p.options.Hooks {
+		for hookType, configs := range allHooks {
 			hookMatchers := []SDKHookCallbackMatcher{}
 			for _, cfg := range configs {
 				id := fmt.Sprintf("hook_%d", hookID)
@@ -121,13 +133,18 @@ func (p *Protocol) Initialize(ctx context.Context) error {
 		},
 	}
 
+	// Register before writing so a fast CLI response cannot race the waiter.
+	ch := make(chan SDKControlResponse, 1)
+	p.pendingReqs.Store(requestID, ch)
+
 	// Send request.
 	if err := p.transport.Write(ctx, req); err != nil {
+		p.pendingReqs.Delete(requestID)
 		return fmt.Errorf("failed to send initialize request: %w", err)
 	}
 
 	// Wait for response.
-	resp, err := p.waitForSDKResponse(ctx, requestID)
+	resp, err := p.waitForSDKResponse(ctx, requestID, ch)
 	if err != nil {
 		return fmt.Errorf("initialization failed: %w", err)
 	}
@@ -156,6 +173,7 @@ func (p *Protocol) initResult() *SDKControlInitializeResponse {
 // SendMessage sends a user message to the CLI.
 // Note: Initialize() should be called before SendMessage().
 func (p *Protocol) SendMessage(ctx context.Context, msg UserMessage) error {
+	msg = p.options.Redactor.redactUserMessage(msg)
 	return p.transport.Write(ctx, msg)
 }
 
@@ -184,6 +202,21 @@ func (p *Protocol) HandleControlMessage(ctx context.Context, msg Message) error
 func (p *Protocol) handleControlRequest(ctx context.Context, req ControlRequest) error {
 	var resp SDKControlResponse
 
+	p.options.logger().Debug("Handling control request",
+		"subtype", req.Subtype, "request_id", req.RequestID)
+
+	message, _ := req.Payload["message"].(map[string]interface{})
+	input, _ := req.Payload["input"].(map[string]interface{})
+	ctx, call := p.startControl(ctx, SDKControlRequestBody{
+		Subtype:    req.Subtype,
+		ToolName:   getString(req.Payload, "tool_name"),
+		ToolUseID:  getString(req.Payload, "tool_use_id"),
+		CallbackID: getString(req.Payload, "callback_id"),
+		Input:      input,
+		ServerName: getString(req.Payload, "server_name"),
+		Message:    message,
+	})
+
 	switch req.Subtype {
 	// Permission request from CLI (can_use_tool).
 	case "can_use_tool":
@@ -211,6 +244,8 @@ func (p *Protocol) handleControlRequest(ctx context.Context, req ControlRequest)
 			},
 		}
 	}
+	p.endControl(call, resp)
+	p.logControlError(req.Subtype, resp)
 
 	// Send response.
 	return p.transport.Write(ctx, resp)
@@ -240,7 +275,10 @@ func (p *Protocol) handlePermissionRequest(ctx context.Context, req ControlReque
 		result = p.options.CanUseTool(ctx, permReq)
 	}
 
-	// Build response in SDK format.
+	// Build response in SDK format. As with can_use_tool requests in the
+	// TypeScript SDK format, a rewritten input, permission updates and an
+	// interrupt are passed on, and an allow whose rewritten input cannot
+	// be delivered is turned into a deny.
 	respData := map[string]interface{}{
 		"allowed": result.IsAllow(),
 	}
@@ -248,10 +286,33 @@ func (p *Protocol) handlePermissionRequest(ctx context.Context, req ControlReque
 	switch r := result.(type) {
 	case PermissionAllow:
 		classification = r.Classification
+		if !result.IsAllow() {
+			break
+		}
+
+		respData["updatedInput"] = input
+		if r.UpdatedInput != nil {
+			updated, err := decodeUpdatedInput(toolName, r.UpdatedInput)
+			if err != nil {
+				respData = map[string]interface{}{
+					"allowed": false,
+					"reason":  err.Error(),
+				}
+				break
+			}
+			respData["updatedInput"] = updated
+		}
+		if len(r.UpdatedPermissions) > 0 {
+			respData["updatedPermissions"] = r.UpdatedPermissions
+		}
+
 	case PermissionDeny:
 		classification = r.Classification
 		if !result.IsAllow() {
 			respData["reason"] = r.Reason
+			if r.Interrupt {
+				respData["interrupt"] = true
+			}
 		}
 	}
 	if classification != "" {
@@ -420,9 +481,10 @@ func (p *Protocol) handleHookCallback(ctx context.Context, req ControlRequest) S
 		}
 	case HookTypeNotification:
 		input = NotificationInput{
-			BaseHookInput: base,
-			Message:       getString(inputData, "message"),
-			Title:         getString(inputData, "title"),
+			BaseHookInput:    base,
+			Message:          getString(inputData, "message"),
+			Title:            getString(inputData, "title"),
+			NotificationType: getString(inputData, "notification_type"),
 		}
 	case HookTypeSessionStart:
 		input = SessionStartInput{
@@ -567,7 +629,9 @@ func (p *Protocol) handleHookCallback(ctx context.Context, req ControlRequest) S
 	}
 
 	// Build response in SDK format.
-	respData := buildHookResponse(hookType, result)
+	respData := p.options.Redactor.redactMap(
+		buildHookResponse(hookType, result),
+	)
 
 	return SDKControlResponse{
 		Type: "control_response",
@@ -636,7 +700,7 @@ func (p *Protocol) handleMCPMessage(ctx context.Context, req ControlRequest) SDK
 				Response: SDKControlResponseBody{
 					Subtype:   "error",
 					RequestID: req.RequestID,
-					Error:     err.Error(),
+					Error:     p.options.Redactor.RedactString(err.Error()),
 				},
 			}
 		}
@@ -645,7 +709,9 @@ func (p *Protocol) handleMCPMessage(ctx context.Context, req ControlRequest) SDK
 		responseData = map[string]interface{}{
 			"message_id": messageID,
 			"result": map[string]interface{}{
-				"content": result.Content,
+				"content": p.options.Redactor.redactToolContent(
+					result.Content,
+				),
 				"isError": result.IsError,
 			},
 		}
@@ -721,6 +787,10 @@ func (p *Protocol) handleControlResponse(resp ControlResponse) error {
 func (p *Protocol) handleSDKControlRequest(ctx context.Context, req SDKControlRequest) error {
 	var resp SDKControlResponse
 
+	p.options.logger().Debug("Handling control request",
+		"subtype", req.Request.Subtype, "request_id", req.RequestID)
+	ctx, call := p.startControl(ctx, req.Request)
+
 	switch req.Request.Subtype {
 	case "can_use_tool":
 		resp = p.handleSDKPermissionRequest(ctx, req)
@@ -741,11 +811,23 @@ func (p *Protocol) handleSDKControlRequest(ctx context.Context, req SDKControlRe
 			},
 		}
 	}
+	p.endControl(call, resp)
+	p.logControlError(req.Request.Subtype, resp)
 
 	// Send response.
 	return p.transport.Write(ctx, resp)
 }
 
+// logControlError logs resp if it reports that a control request failed.
+func (p *Protocol) logControlError(subtype string, resp SDKControlResponse) {
+	if resp.Response.Subtype != "error" {
+		return
+	}
+	p.options.logger().Warn("Control request failed", "subtype", subtype,
+		"request_id", resp.Response.RequestID,
+		"err", resp.Response.Error)
+}
+
 // handleSDKPermissionRequest processes a permission check request (TypeScript SDK format).
 func (p *Protocol) handleSDKPermissionRequest(ctx context.Context, req SDKControlRequest) SDKControlResponse {
 	// Extract request details.
@@ -756,7 +838,13 @@ func (p *Protocol) handleSDKPermissionRequest(ctx context.Context, req SDKContro
 	permReq := ToolPermissionRequest{
 		ToolName:  toolName,
 		Arguments: marshalJSON(arguments),
-		Context:   PermissionContext{},
+		Context: PermissionContext{
+			ToolUseID:      req.Request.ToolUseID,
+			AgentID:        req.Request.AgentID,
+			Suggestions:    req.Request.PermissionSuggestions,
+			BlockedPath:    req.Request.BlockedPath,
+			DecisionReason: req.Request.DecisionReason,
+		},
 	}
 
 	// Check permission callback.
@@ -766,8 +854,9 @@ func (p *Protocol) handleSDKPermissionRequest(ctx context.Context, req SDKContro
 	}
 
 	// Build response. The CLI expects:
-	//   allow: {"behavior": "allow", "updatedInput": <original input>}
-	//   deny:  {"behavior": "deny", "message": "<reason>"}
+	//   allow: {"behavior": "allow", "updatedInput": <input>,
+	//           "updatedPermissions": [...]}
+	//   deny:  {"behavior": "deny", "message": "<reason>", "interrupt": true}
 	// The updatedInput field is required for allow responses — it
 	// contains the (possibly modified) tool input. For a simple
 	// allow, pass the original input through unchanged.
@@ -776,16 +865,41 @@ func (p *Protocol) handleSDKPermissionRequest(ctx context.Context, req SDKContro
 	}
 	var classification PermissionDecisionClassification
 	if result.IsAllow() {
-		// Pass the original tool input through unchanged.
+		// Pass the original tool input through unless the callback
+		// rewrote it.
 		responseData["updatedInput"] = arguments
 		if allow, ok := result.(PermissionAllow); ok {
 			classification = allow.Classification
+
+			if allow.UpdatedInput != nil {
+				updated, err := decodeUpdatedInput(
+					toolName, allow.UpdatedInput,
+				)
+				if err != nil {
+					// Fail closed rather than run the tool with
+					// input the callback did not intend.
+					responseData = map[string]interface{}{
+						"behavior": "deny",
+						"message":  err.Error(),
+					}
+				} else {
+					responseData["updatedInput"] = updated
+				}
+			}
+			if len(allow.UpdatedPermissions) > 0 &&
+				responseData["behavior"] == "allow" {
+
+				responseData["updatedPermissions"] = allow.UpdatedPermissions
+			}
 		}
 	} else {
 		responseData["behavior"] = "deny"
 		if deny, ok := result.(PermissionDeny); ok {
 			responseData["message"] = deny.Reason
 			classification = deny.Classification
+			if deny.Interrupt {
+				responseData["interrupt"] = true
+			}
 		}
 	}
 	if classification != "" {
@@ -803,6 +917,19 @@ func (p *Protocol) handleSDKPermissionRequest(ctx context.Context, req SDKContro
 	}
 }
 
+// decodeUpdatedInput decodes the tool input a permission callback rewrote,
+// which must be a JSON object.
+func decodeUpdatedInput(toolName string,
+	raw json.RawMessage) (map[string]interface{}, error) {
+
+	var updated map[string]interface{}
+	if err := json.Unmarshal(raw, &updated); err != nil || updated == nil {
+		return nil, fmt.Errorf("permission callback returned invalid "+
+			"updated input for %s: must be a JSON object", toolName)
+	}
+	return updated, nil
+}
+
 // handleSDKHookCallback processes a hook callback request (TypeScript SDK format).
 func (p *Protocol) handleSDKHookCallback(ctx context.Context, req SDKControlRequest) SDKControlResponse {
 	// Extract hook details.
@@ -914,9 +1041,10 @@ func (p *Protocol) handleSDKHookCallback(ctx context.Context, req SDKControlRequ
 		}
 	case "Notification":
 		input = NotificationInput{
-			BaseHookInput: base,
-			Message:       getString(hookInput, "message"),
-			Title:         getString(hookInput, "title"),
+			BaseHookInput:    base,
+			Message:          getString(hookInput, "message"),
+			Title:            getString(hookInput, "title"),
+			NotificationType: getString(hookInput, "notification_type"),
 		}
 	case "SessionStart":
 		input = SessionStartInput{
@@ -1061,7 +1189,9 @@ func (p *Protocol) handleSDKHookCallback(ctx context.Context, req SDKControlRequ
 	}
 
 	// Build response.
-	responseData := buildHookResponse(hookEventName, result)
+	responseData := p.options.Redactor.redactMap(
+		buildHookResponse(hookEventName, result),
+	)
 
 	return SDKControlResponse{
 		Type: "control_response",
@@ -1159,7 +1289,7 @@ func (p *Protocol) handleSDKMCPMessage(ctx context.Context, req SDKControlReques
 				Response: SDKControlResponseBody{
 					Subtype:   "error",
 					RequestID: req.RequestID,
-					Error:     err.Error(),
+					Error:     p.options.Redactor.RedactString(err.Error()),
 				},
 			}
 		}
@@ -1169,7 +1299,9 @@ func (p *Protocol) handleSDKMCPMessage(ctx context.Context, req SDKControlReques
 			"jsonrpc": "2.0",
 			"id":      messageID,
 			"result": map[string]interface{}{
-				"content": result.Content,
+				"content": p.options.Redactor.redactToolContent(
+					result.Content,
+				),
 				"isError": result.IsError,
 			},
 		}
@@ -1260,10 +1392,10 @@ func (p *Protocol) handleSDKControlResponse(resp SDKControlResponse) error {
 	return nil
 }
 
-// waitForSDKResponse waits for an SDK control response with the given request ID.
-func (p *Protocol) waitForSDKResponse(ctx context.Context, requestID string) (SDKControlResponse, error) {
-	ch := make(chan SDKControlResponse, 1)
-	p.pendingReqs.Store(requestID, ch)
+// waitForSDKResponse waits for the SDK control response with the given
+// request ID on ch, which must have been registered in pendingReqs.
+func (p *Protocol) waitForSDKResponse(ctx context.Context, requestID string,
+	ch <-chan SDKControlResponse) (SDKControlResponse, error) {
 
 	select {
 	case <-ctx.Done():
@@ -1429,6 +1561,16 @@ func buildHookResponse(hookType string, result HookResult) map[string]interface{
 		// For non-Stop hooks (PreToolUse, PostToolUse, etc.),
 		// emit the continue field as before.
 		resp["continue"] = result.Continue
+
+		if !result.Continue && result.StopReason != "" {
+			resp["stopReason"] = result.StopReason
+		}
+		if result.SystemMessage != "" {
+			resp["systemMessage"] = result.SystemMessage
+		}
+	}
+	if result.SuppressOutput {
+		resp["suppressOutput"] = true
 	}
 
 	// If HookSpecificOutput is set explicitly, use it directly.
@@ -591,6 +591,117 @@ func TestProtocolHandlePermissionRequestClassification(t *testing.T) {
 	}
 }
 
+// TestProtocolHandlePermissionRequestUpdates verifies that the legacy
+// permission path passes on rewritten input, permission updates and
+// interrupts, and fails closed on input it cannot deliver.
+func TestProtocolHandlePermissionRequestUpdates(t *testing.T) {
+	suggestion := PermissionUpdate{
+		Type:        PermissionUpdateTypeAddRules,
+		Rules:       []PermissionRule{{ToolName: "Bash", RuleContent: "ls:*"}},
+		Behavior:    PermissionBehaviorAllow,
+		Destination: PermissionDestinationSession,
+	}
+
+	tests := []struct {
+		name       string
+		result     PermissionResult
+		expected   map[string]interface{}
+		unexpected []string
+	}{
+		{
+			name:   "allow passes the original input",
+			result: PermissionAllow{},
+			expected: map[string]interface{}{
+				"allowed": true,
+				"updatedInput": map[string]interface{}{
+					"command": "rm -rf /",
+				},
+			},
+			unexpected: []string{"updatedPermissions"},
+		},
+		{
+			name: "allow with updated input",
+			result: PermissionAllow{
+				UpdatedInput: json.RawMessage(`{"command":"ls"}`),
+			},
+			expected: map[string]interface{}{
+				"allowed": true,
+				"updatedInput": map[string]interface{}{
+					"command": "ls",
+				},
+			},
+		},
+		{
+			name: "allow with updated permissions",
+			result: PermissionAllow{
+				UpdatedPermissions: []PermissionUpdate{suggestion},
+			},
+			expected: map[string]interface{}{
+				"allowed":            true,
+				"updatedPermissions": []PermissionUpdate{suggestion},
+			},
+		},
+		{
+			name: "invalid updated input fails closed",
+			result: PermissionAllow{
+				UpdatedInput:       json.RawMessage(`"ls"`),
+				UpdatedPermissions: []PermissionUpdate{suggestion},
+			},
+			expected: map[string]interface{}{
+				"allowed": false,
+			},
+			unexpected: []string{"updatedInput", "updatedPermissions"},
+		},
+		{
+			name:   "deny with interrupt",
+			result: PermissionDeny{Reason: "stop", Interrupt: true},
+			expected: map[string]interface{}{
+				"allowed":   false,
+				"reason":    "stop",
+				"interrupt": true,
+			},
+			unexpected: []string{"updatedInput"},
+		},
+		{
+			name:       "deny without interrupt",
+			result:     PermissionDeny{Reason: "no"},
+			unexpected: []string{"interrupt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewOptions()
+			opts.CanUseTool = func(ctx context.Context, req ToolPermissionRequest) PermissionResult {
+				return tt.result
+			}
+			protocol := NewProtocol(nil, opts)
+
+			resp := protocol.handlePermissionRequest(context.Background(), ControlRequest{
+				Type:      "control",
+				Subtype:   "can_use_tool",
+				RequestID: "req_1",
+				Payload: map[string]interface{}{
+					"tool_name":   "Bash",
+					"tool_use_id": "tool_1",
+					"input": map[string]interface{}{
+						"command": "rm -rf /",
+					},
+				},
+			})
+
+			require.Equal(t, "success", resp.Response.Subtype)
+			respData := resp.Response.Response
+			for key, want := range tt.expected {
+				assert.Equal(t, want, respData[key], key)
+			}
+			for _, key := range tt.unexpected {
+				assert.NotContains(t, respData, key)
+			}
+		})
+	}
+}
+
 func TestProtocolHandleSDKPermissionRequestClassification(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -674,6 +785,118 @@ func TestProtocolHandleSDKPermissionRequestClassification(t *testing.T) {
 	}
 }
 
+// TestProtocolHandleSDKPermissionRequestUpdates verifies that rewritten input,
+// permission updates and interrupts reach the CLI, and that the CLI's
+// suggestions reach the callback.
+func TestProtocolHandleSDKPermissionRequestUpdates(t *testing.T) {
+	suggestion := PermissionUpdate{
+		Type:        PermissionUpdateTypeAddRules,
+		Rules:       []PermissionRule{{ToolName: "Bash", RuleContent: "ls:*"}},
+		Behavior:    PermissionBehaviorAllow,
+		Destination: PermissionDestinationSession,
+	}
+
+	tests := []struct {
+		name       string
+		result     PermissionResult
+		expected   map[string]interface{}
+		unexpected []string
+	}{
+		{
+			name: "allow with updated input",
+			result: PermissionAllow{
+				UpdatedInput: json.RawMessage(`{"command":"ls -la"}`),
+			},
+			expected: map[string]interface{}{
+				"behavior": "allow",
+				"updatedInput": map[string]interface{}{
+					"command": "ls -la",
+				},
+			},
+			unexpected: []string{"updatedPermissions"},
+		},
+		{
+			name: "allow with updated permissions",
+			result: PermissionAllow{
+				UpdatedPermissions: []PermissionUpdate{suggestion},
+			},
+			expected: map[string]interface{}{
+				"behavior": "allow",
+				"updatedInput": map[string]interface{}{
+					"command": "ls",
+				},
+				"updatedPermissions": []PermissionUpdate{suggestion},
+			},
+		},
+		{
+			name: "invalid updated input fails closed",
+			result: PermissionAllow{
+				UpdatedInput: json.RawMessage(`"ls"`),
+			},
+			expected: map[string]interface{}{
+				"behavior": "deny",
+			},
+			unexpected: []string{"updatedInput"},
+		},
+		{
+			name:   "deny with interrupt",
+			result: PermissionDeny{Reason: "stop", Interrupt: true},
+			expected: map[string]interface{}{
+				"behavior":  "deny",
+				"message":   "stop",
+				"interrupt": true,
+			},
+		},
+		{
+			name:       "deny without interrupt",
+			result:     PermissionDeny{Reason: "no"},
+			unexpected: []string{"interrupt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got ToolPermissionRequest
+			opts := NewOptions()
+			opts.CanUseTool = func(ctx context.Context, req ToolPermissionRequest) PermissionResult {
+				got = req
+				return tt.result
+			}
+			protocol := NewProtocol(nil, opts)
+
+			resp := protocol.handleSDKPermissionRequest(context.Background(), SDKControlRequest{
+				Type:      "control_request",
+				RequestID: "req_1",
+				Request: SDKControlRequestBody{
+					Subtype:               "can_use_tool",
+					ToolName:              "Bash",
+					ToolUseID:             "tool_1",
+					AgentID:               "agent_1",
+					Input:                 map[string]interface{}{"command": "ls"},
+					PermissionSuggestions: []PermissionUpdate{suggestion},
+					BlockedPath:           "/tmp",
+					DecisionReason:        "not in allowlist",
+				},
+			})
+
+			assert.Equal(t, "tool_1", got.Context.ToolUseID)
+			assert.Equal(t, "agent_1", got.Context.AgentID)
+			assert.Equal(t, []PermissionUpdate{suggestion}, got.Context.Suggestions)
+			assert.Equal(t, "/tmp", got.Context.BlockedPath)
+			assert.Equal(t, "not in allowlist", got.Context.DecisionReason)
+
+			require.Equal(t, "success", resp.Response.Subtype)
+			respData := resp.Response.Response
+			for key, want := range tt.expected {
+				assert.Equal(t, want, respData[key], key)
+			}
+			for _, key := range tt.unexpected {
+				assert.NotContains(t, respData, key)
+			}
+		})
+	}
+}
+
 func TestProtocolHandleElicitationRequest(t *testing.T) {
 	basePayload := map[string]interface{}{
 		"mcp_server_name":  "auth-server",
@@ -142,6 +142,14 @@ func (r *RalphLoop) Run(ctx context.Context, clientOpts ...Option) iter.Seq[*Ite
 		// Build the initial prompt with completion instructions.
 		initialPrompt := r.buildPrompt(1)
 
+		// A budget guard in the client options ends the loop once the
+		// budget is used up.
+		resolved := DefaultOptions()
+		for _, opt := range clientOpts {
+			opt(&resolved)
+		}
+		budget := resolved.Budget
+
 		// Create the Stop hook that implements Ralph logic.
 		stopHook := func(ctx context.Context, input HookInput) (HookResult, error) {
 			r.mu.Lock()
@@ -152,7 +160,9 @@ func (r *RalphLoop) Run(ctx context.Context, clientOpts ...Option) iter.Seq[*Ite
 			r.iteration++
 
 			// Check termination conditions.
-			if r.complete || r.iteration >= r.config.MaxIterations {
+			if r.complete || r.iteration >= r.config.MaxIterations ||
+				budget.Err() != nil {
+
 				// Allow exit.
 				return HookResult{
 					Continue: true,
@@ -249,6 +259,9 @@ func (r *RalphLoop) Run(ctx context.Context, clientOpts ...Option) iter.Seq[*Ite
 		if iterError == nil && ctx.Err() != nil {
 			iterError = ctx.Err()
 		}
+		if iterError == nil && !r.complete {
+			iterError = budget.Err()
+		}
 
 		// Yield final iteration.
 		r.mu.Lock()
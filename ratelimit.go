@@ -0,0 +1,288 @@
+package claudeagent
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"time"
+)
+
+// DefaultRateLimitPause is how long new turns wait after a rate limit
+// rejects requests without reporting when it resets, when
+// RateLimitConfig.RejectedPause is zero.
+const DefaultRateLimitPause = time.Minute
+
+// RateLimitConfig configures a RateLimitScheduler.
+type RateLimitConfig struct {
+	// MaxConcurrent caps the turns running at once across the clients
+	// sharing the scheduler. Further turns wait for one to finish. Zero
+	// means no cap.
+	MaxConcurrent int
+
+	// WarningInterval is the minimum time between the starts of turns
+	// while a limit reports RateLimitStatusAllowedWarning. Zero disables
+	// spacing.
+	WarningInterval time.Duration
+
+	// RejectedPause is how long new turns wait after a limit rejects
+	// requests without a reset time. Defaults to DefaultRateLimitPause.
+	RejectedPause time.Duration
+
+	// OnOverage, if set, is called when a rate limit event changes the
+	// overage status, such as when the account starts or stops using
+	// overage. It is called from the client's message pump and must not
+	// block.
+	OnOverage func(RateLimitInfo)
+}
+
+// RateLimitScheduler delays new turns across one or more clients based on
+// the rate limit events and API retries the CLI reports. Share a scheduler
+// between clients, for example every client of a Pool, so that a limit hit
+// by one holds back the others.
+//
+// Before a Query, QueryContent or Stream.Send starts a turn it waits until:
+//
+//   - no limit is rejecting requests. A RateLimitEventMessage with status
+//     RateLimitStatusRejected pauses new turns until the limit's resetsAt
+//     time, or for RejectedPause if it has none, or until a later event
+//     reports the limit allowed again.
+//   - the delay of an APIRetryMessage for a rate limit has passed, so that
+//     other clients do not add to the burst the CLI is backing off from.
+//   - WarningInterval has passed since the last turn started, while a limit
+//     is close to being reached.
+//   - fewer than MaxConcurrent turns are running.
+//
+// Turns already running are not affected. The wait ends early with an error
+// if the caller's context is done, which also bounds waits for long resets.
+type RateLimitScheduler struct {
+	cfg RateLimitConfig
+
+	mu sync.Mutex
+
+	// limits holds the last event for each rate limit type. Events
+	// without a type are stored under the empty type.
+	limits map[RateLimitType]RateLimitInfo
+
+	// holds are the times rejected limits reset.
+	holds map[RateLimitType]time.Time
+
+	// retryUntil is when the last rate limited API retry is due.
+	retryUntil time.Time
+
+	lastStart time.Time
+	running   int
+	overage   overageState
+
+	// changed is closed and replaced whenever a waiting turn may be able
+	// to start.
+	changed chan struct{}
+}
+
+// overageState is the overage status a rate limit event reports.
+type overageState struct {
+	status RateLimitStatus
+	using  bool
+}
+
+// NewRateLimitScheduler creates a scheduler with no limits observed yet.
+func NewRateLimitScheduler(cfg RateLimitConfig) *RateLimitScheduler {
+	if cfg.RejectedPause <= 0 {
+		cfg.RejectedPause = DefaultRateLimitPause
+	}
+
+	return &RateLimitScheduler{
+		cfg:     cfg,
+		limits:  make(map[RateLimitType]RateLimitInfo),
+		holds:   make(map[RateLimitType]time.Time),
+		changed: make(chan struct{}),
+	}
+}
+
+// Limits returns the last rate limit event reported for each limit type.
+func (s *RateLimitScheduler) Limits() map[RateLimitType]RateLimitInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.limits)
+}
+
+// PausedUntil returns when new turns may start again, or the zero time if
+// they are not paused by a rejected limit or a rate limited API retry.
+func (s *RateLimitScheduler) PausedUntil() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until := s.pausedUntil()
+	if !until.After(time.Now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// pausedUntil returns the latest of the holds and retryUntil. The caller
+// must hold mu.
+func (s *RateLimitScheduler) pausedUntil() time.Time {
+	until := s.retryUntil
+	for _, hold := range s.holds {
+		if hold.After(until) {
+			until = hold
+		}
+	}
+	return until
+}
+
+// delay returns how long a turn must wait before starting at now. The
+// caller must hold mu.
+func (s *RateLimitScheduler) delay(now time.Time) time.Duration {
+	wait := s.pausedUntil().Sub(now)
+
+	if s.cfg.WarningInterval > 0 && !s.lastStart.IsZero() {
+		for _, info := range s.limits {
+			if info.Status != RateLimitStatusAllowedWarning {
+				continue
+			}
+			next := s.lastStart.Add(s.cfg.WarningInterval)
+			wait = max(wait, next.Sub(now))
+			break
+		}
+	}
+	return wait
+}
+
+// notify wakes the turns waiting in acquire. The caller must hold mu.
+func (s *RateLimitScheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// acquire waits until a turn may start and returns the function that frees
+// its slot once the turn ends.
+func (s *RateLimitScheduler) acquire(ctx context.Context) (func(), error) {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		wait := s.delay(now)
+		full := s.cfg.MaxConcurrent > 0 &&
+			s.running >= s.cfg.MaxConcurrent
+
+		if wait <= 0 && !full {
+			s.running++
+			s.lastStart = now
+			s.mu.Unlock()
+
+			var once sync.Once
+			return func() {
+				once.Do(s.release)
+			}, nil
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		var (
+			timer   *time.Timer
+			timeout <-chan time.Time
+		)
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			timeout = timer.C
+		}
+
+		var err error
+		select {
+		case <-changed:
+		case <-timeout:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("waiting for rate limit: %w", err)
+		}
+	}
+}
+
+// release frees the slot of a turn that ended.
+func (s *RateLimitScheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.notify()
+}
+
+// observe updates the scheduler from the rate limit events and API retries
+// in msg.
+func (s *RateLimitScheduler) observe(log *slog.Logger, msg Message) {
+	switch m := msg.(type) {
+	case RateLimitEventMessage:
+		s.observeLimit(log, m.RateLimitInfo)
+
+	case APIRetryMessage:
+		rateLimited := m.Error == APIRetryErrorRateLimit ||
+			(m.ErrorStatus != nil && *m.ErrorStatus == 429)
+		if !rateLimited {
+			return
+		}
+
+		delay := time.Duration(m.RetryDelayMS) * time.Millisecond
+		until := time.Now().Add(delay)
+
+		s.mu.Lock()
+		if until.After(s.retryUntil) {
+			s.retryUntil = until
+			s.notify()
+		}
+		s.mu.Unlock()
+
+		log.Info("API request rate limited, delaying new turns",
+			"attempt", m.Attempt, "delay", delay)
+	}
+}
+
+// observeLimit records a rate limit event.
+func (s *RateLimitScheduler) observeLimit(log *slog.Logger,
+	info RateLimitInfo) {
+
+	var kind RateLimitType
+	if info.RateLimitType != nil {
+		kind = *info.RateLimitType
+	}
+
+	var overage overageState
+	if info.OverageStatus != nil {
+		overage.status = *info.OverageStatus
+	}
+	if info.IsUsingOverage != nil {
+		overage.using = *info.IsUsingOverage
+	}
+
+	s.mu.Lock()
+	s.limits[kind] = info
+
+	var until time.Time
+	if info.Status == RateLimitStatusRejected {
+		until = time.Now().Add(s.cfg.RejectedPause)
+		if info.ResetsAt != nil {
+			until = time.Unix(*info.ResetsAt, 0)
+		}
+		s.holds[kind] = until
+	} else {
+		delete(s.holds, kind)
+	}
+
+	overageChanged := overage != s.overage
+	s.overage = overage
+	s.notify()
+	s.mu.Unlock()
+
+	if !until.IsZero() {
+		log.Warn("Rate limit reached, pausing new turns",
+			"type", kind, "until", until)
+	}
+	if overageChanged && s.cfg.OnOverage != nil {
+		s.cfg.OnOverage(info)
+	}
+}
@@ -0,0 +1,179 @@
+package claudeagent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rateLimitEvent builds a rate limit event for the five hour limit.
+func rateLimitEvent(status RateLimitStatus) RateLimitEventMessage {
+	limit := RateLimitTypeFiveHour
+	return RateLimitEventMessage{
+		Type: "rate_limit_event",
+		RateLimitInfo: RateLimitInfo{
+			Status:        status,
+			RateLimitType: &limit,
+		},
+	}
+}
+
+// acquireAsync calls acquire on its own goroutine and delivers the result.
+func acquireAsync(ctx context.Context, s *RateLimitScheduler) chan error {
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.acquire(ctx)
+		done <- err
+	}()
+	return done
+}
+
+// TestRateLimitSchedulerRejected verifies that a rejected limit pauses new
+// turns until it is reported allowed again.
+func TestRateLimitSchedulerRejected(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := NewRateLimitScheduler(RateLimitConfig{RejectedPause: time.Hour})
+	s.observe(discardLogger, rateLimitEvent(RateLimitStatusRejected))
+	assert.WithinDuration(t, time.Now().Add(time.Hour), s.PausedUntil(),
+		time.Minute)
+
+	done := acquireAsync(ctx, s)
+	select {
+	case <-done:
+		t.Fatal("turn started while rate limited")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.observe(discardLogger, rateLimitEvent(RateLimitStatusAllowed))
+	require.NoError(t, <-done)
+	assert.True(t, s.PausedUntil().IsZero())
+
+	limits := s.Limits()
+	assert.Equal(t, RateLimitStatusAllowed,
+		limits[RateLimitTypeFiveHour].Status)
+
+	// A turn waiting for a reset gives up with its context.
+	s.observe(discardLogger, rateLimitEvent(RateLimitStatusRejected))
+	shortCtx, shortCancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer shortCancel()
+	_, err := s.acquire(shortCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestRateLimitSchedulerRetryAndConcurrency verifies that rate limited API
+// retries delay new turns and that MaxConcurrent caps running turns.
+func TestRateLimitSchedulerRetryAndConcurrency(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	s := NewRateLimitScheduler(RateLimitConfig{MaxConcurrent: 1})
+
+	// Retries for other errors are ignored.
+	s.observe(discardLogger, APIRetryMessage{
+		Error:        APIRetryErrorServerError,
+		RetryDelayMS: 60_000,
+	})
+	assert.True(t, s.PausedUntil().IsZero())
+
+	s.observe(discardLogger, APIRetryMessage{
+		Error:        APIRetryErrorRateLimit,
+		RetryDelayMS: 100,
+	})
+	start := time.Now()
+	release, err := s.acquire(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond)
+
+	done := acquireAsync(ctx, s)
+	select {
+	case <-done:
+		t.Fatal("turn started beyond MaxConcurrent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release()
+	release()
+	require.NoError(t, <-done)
+}
+
+// TestRateLimitSchedulerOverage verifies that OnOverage is called when the
+// overage status changes.
+func TestRateLimitSchedulerOverage(t *testing.T) {
+	var reported []RateLimitInfo
+	s := NewRateLimitScheduler(RateLimitConfig{
+		OnOverage: func(info RateLimitInfo) {
+			reported = append(reported, info)
+		},
+	})
+
+	using := true
+	event := rateLimitEvent(RateLimitStatusAllowedWarning)
+	event.RateLimitInfo.IsUsingOverage = &using
+
+	s.observe(discardLogger, rateLimitEvent(RateLimitStatusAllowed))
+	s.observe(discardLogger, event)
+	s.observe(discardLogger, event)
+	require.Len(t, reported, 1)
+	assert.True(t, *reported[0].IsUsingOverage)
+
+	s.observe(discardLogger, rateLimitEvent(RateLimitStatusAllowed))
+	assert.Len(t, reported, 2)
+}
+
+// TestClientRateLimitScheduler verifies that a limit rejected on one client
+// delays the turns of another client sharing the scheduler.
+func TestClientRateLimitScheduler(t *testing.T) {
+	const pause = 200 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scheduler := NewRateLimitScheduler(RateLimitConfig{
+		RejectedPause: pause,
+	})
+
+	serve := func(server *PipeServer, limited bool) {
+		for msg, err := range server.Messages(ctx) {
+			if err != nil {
+				continue
+			}
+
+			switch m := msg.(type) {
+			case SDKControlRequest:
+				_ = server.RespondControl(ctx, m.RequestID, nil)
+
+			case UserMessage:
+				if limited {
+					_ = server.Write(ctx, rateLimitEvent(
+						RateLimitStatusRejected,
+					))
+				}
+				_ = server.SendResult(ctx, "sess_pipe", "done")
+			}
+		}
+	}
+
+	var clients []*Client
+	for _, limited := range []bool{true, false} {
+		transport, server := NewPipeTransport()
+		go serve(server, limited)
+
+		client, err := NewClient(
+			WithTransport(transport),
+			WithRateLimitScheduler(scheduler),
+		)
+		require.NoError(t, err)
+		defer client.Close()
+		clients = append(clients, client)
+	}
+
+	start := time.Now()
+	collectQuery(t, clients[0], "first")
+	collectQuery(t, clients[1], "second")
+	assert.GreaterOrEqual(t, time.Since(start), pause)
+}
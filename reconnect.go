@@ -0,0 +1,309 @@
+package claudeagent
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultMaxRestarts is the restart budget used when
+	// ReconnectPolicy.MaxRestarts is zero.
+	DefaultMaxRestarts = 5
+
+	// DefaultReconnectInitialBackoff is the delay before the first restart
+	// attempt when ReconnectPolicy.InitialBackoff is zero.
+	DefaultReconnectInitialBackoff = 500 * time.Millisecond
+
+	// DefaultReconnectMaxBackoff caps the delay between restart attempts
+	// when ReconnectPolicy.MaxBackoff is zero.
+	DefaultReconnectMaxBackoff = 30 * time.Second
+
+	// DefaultReconnectInitTimeout bounds the initialize handshake of a
+	// restarted CLI when ReconnectPolicy.InitTimeout is zero.
+	DefaultReconnectInitTimeout = 60 * time.Second
+
+	// DefaultAlivePollInterval is how often the supervisor checks that the
+	// CLI process is still running when ReconnectPolicy.PollInterval is
+	// zero.
+	DefaultAlivePollInterval = time.Second
+)
+
+// ReconnectPolicy configures automatic recovery when the CLI exits
+// unexpectedly. Zero-valued fields use the Default* constants.
+type ReconnectPolicy struct {
+	// MaxRestarts is the number of restart attempts allowed over the
+	// lifetime of the client, including failed ones. Negative means
+	// unlimited.
+	MaxRestarts int
+
+	// InitialBackoff is the delay before the first restart attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between consecutive attempts.
+	MaxBackoff time.Duration
+
+	// Multiplier scales the delay after each failed attempt. Values below
+	// 1 use 2.
+	Multiplier float64
+
+	// InitTimeout bounds the initialize handshake of the restarted CLI.
+	InitTimeout time.Duration
+
+	// PollInterval is how often the process is checked with IsAlive, for
+	// transports that implement it. This catches a dead CLI whose stdout
+	// is held open by a surviving child process.
+	PollInterval time.Duration
+
+	// NewTransport builds the replacement transport. It receives a copy of
+	// the client options with SessionOptions set to resume the last
+	// session. If nil, a new SubprocessTransport is created. It is
+	// required when WithTransport is used.
+	NewTransport func(opts *Options) (Transport, error)
+}
+
+// ReconnectedMessage is yielded after the client restarted a CLI that exited
+// unexpectedly and resumed the session.
+//
+// Any turn in flight when the CLI died is lost: Query ends after yielding
+// this message, and the prompt should be sent again if needed. Streams keep
+// running on the new process.
+type ReconnectedMessage struct {
+	Type      string `json:"type"`       // Always "reconnected"
+	SessionID string `json:"session_id"` // Resumed session, empty if none was known
+	Attempt   int    `json:"attempt"`    // Restarts performed so far, including this one
+}
+
+// MessageType implements Message.
+func (m ReconnectedMessage) MessageType() string { return "reconnected" }
+
+// aliveChecker is implemented by transports that can report whether their
+// process is still running, such as SubprocessTransport.
+type aliveChecker interface {
+	IsAlive() bool
+}
+
+// withDefaults returns the policy with zero values replaced by defaults.
+func (p ReconnectPolicy) withDefaults() ReconnectPolicy {
+	if p.MaxRestarts == 0 {
+		p.MaxRestarts = DefaultMaxRestarts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultReconnectInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultReconnectMaxBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.InitTimeout <= 0 {
+		p.InitTimeout = DefaultReconnectInitTimeout
+	}
+	if p.PollInterval <= 0 {
+		p.PollInterval = DefaultAlivePollInterval
+	}
+	return p
+}
+
+// backoff returns the delay before the given attempt, starting at 1.
+func (p ReconnectPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+		if delay >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+	return time.Duration(delay)
+}
+
+// startReader pumps messages from transport in a new goroutine. The returned
+// channel is closed once the transport's message stream ends.
+func (c *Client) startReader(transport Transport,
+	protocol *Protocol) <-chan struct{} {
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.pumpTransport(transport, protocol)
+	}()
+
+	if c.options.Reconnect != nil {
+		if alive, ok := transport.(aliveChecker); ok {
+			go c.watchAlive(transport, alive, done)
+		}
+	}
+
+	return done
+}
+
+// watchAlive closes transport once its process is no longer running, which
+// unblocks a reader stuck on a pipe that a child process still holds open.
+func (c *Client) watchAlive(transport Transport, alive aliveChecker,
+	done <-chan struct{}) {
+
+	policy := c.options.Reconnect.withDefaults()
+	ticker := time.NewTicker(policy.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.msgCtx.Done():
+			return
+		case <-ticker.C:
+			if !alive.IsAlive() {
+				_ = transport.Close()
+				return
+			}
+		}
+	}
+}
+
+// restart replaces a failed transport, retrying with backoff until the
+// restart budget is spent. It returns the reader channel of the new
+// transport, or nil if the client was closed or is shutting down, or the
+// budget is exhausted.
+func (c *Client) restart(failed Transport) <-chan struct{} {
+	_ = failed.Close()
+
+	policy := c.options.Reconnect.withDefaults()
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if policy.MaxRestarts > 0 && c.restarts >= policy.MaxRestarts {
+			// Keep the crash itself as the reported error, if any.
+			if c.Err() == nil && lastErr != nil {
+				c.setPumpErr(fmt.Errorf("reconnect failed after %d "+
+					"attempts: %w", attempt-1, lastErr))
+			}
+			return nil
+		}
+		c.restarts++
+
+		select {
+		case <-c.msgCtx.Done():
+			return nil
+		case <-time.After(policy.backoff(attempt)):
+		}
+		if c.stopping.Load() {
+			return nil
+		}
+
+		c.options.logger().Warn("Restarting CLI", "attempt", c.restarts,
+			"session_id", c.currentSessionID())
+
+		done, err := c.respawn(policy)
+		if err != nil {
+			if c.msgCtx.Err() != nil {
+				return nil
+			}
+			c.options.logger().Error("Failed to restart CLI",
+				"attempt", c.restarts, "err", err)
+			lastErr = err
+			continue
+		}
+
+		// The stream is healthy again.
+		c.setPumpErr(nil)
+
+		msg := ReconnectedMessage{
+			Type:      "reconnected",
+			SessionID: c.currentSessionID(),
+			Attempt:   c.restarts,
+		}
+		c.enqueue(msg)
+		return done
+	}
+}
+
+// respawn starts a new CLI resuming the last session, re-runs the initialize
+// handshake, which re-registers hooks and SDK MCP servers, and installs the
+// new transport and protocol on the client.
+func (c *Client) respawn(policy ReconnectPolicy) (<-chan struct{}, error) {
+	opts := c.options
+	if sessionID := c.currentSessionID(); sessionID != "" {
+		opts.SessionOptions.Resume = sessionID
+		opts.SessionOptions.SessionID = ""
+		opts.SessionOptions.ForkFrom = ""
+		opts.SessionOptions.ForkSession = false
+		opts.SessionOptions.ResumeSessionAt = ""
+	}
+
+	var (
+		transport Transport
+		err       error
+	)
+	if policy.NewTransport != nil {
+		transport, err = policy.NewTransport(&opts)
+	} else {
+		transport, err = c.newTransport(&opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create transport: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(c.msgCtx, policy.InitTimeout)
+	defer cancel()
+
+	if err := transport.Connect(ctx); err != nil {
+		_ = transport.Close()
+		return nil, err
+	}
+
+	protocol := NewProtocol(transport, &c.options)
+	done := c.startReader(transport, protocol)
+
+	if err := protocol.Initialize(ctx); err != nil {
+		_ = transport.Close()
+		<-done
+		return nil, fmt.Errorf("failed to initialize: %w", err)
+	}
+
+	c.connMu.Lock()
+	c.transport = transport
+	c.protocol = protocol
+	c.connMu.Unlock()
+
+	// Close may have run while the handshake was in flight, in which
+	// case it closed the previous transport rather than this one.
+	if c.msgCtx.Err() != nil {
+		_ = transport.Close()
+	}
+
+	return done, nil
+}
+
+// trackSessionID records the session ID carried by msg, if any, so that a
+// restarted CLI can resume it.
+func (c *Client) trackSessionID(msg Message) {
+	var sessionID string
+	switch m := msg.(type) {
+	case SystemMessage:
+		sessionID = m.SessionID
+	case AssistantMessage:
+		sessionID = m.SessionID
+	case ResultMessage:
+		sessionID = m.SessionID
+	}
+	if sessionID == "" {
+		return
+	}
+
+	c.connMu.Lock()
+	c.lastSessionID = sessionID
+	c.connMu.Unlock()
+}
+
+// currentSessionID returns the most recent session ID seen from the CLI,
+// falling back to the session the client was configured to resume.
+func (c *Client) currentSessionID() string {
+	c.connMu.RLock()
+	defer c.connMu.RUnlock()
+
+	if c.lastSessionID != "" {
+		return c.lastSessionID
+	}
+	return c.options.SessionOptions.Resume
+}
@@ -0,0 +1,268 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// crashingTransport answers initialize and replies to each user message with
+// a system init, an assistant message and a result. If crash is set, it dies
+// after the assistant message instead of sending the result.
+type crashingTransport struct {
+	*mockTransport
+
+	sessionID string
+	crash     bool
+	alive     atomic.Bool
+}
+
+func newCrashingTransport(sessionID string, crash bool) *crashingTransport {
+	t := &crashingTransport{
+		mockTransport: newMockTransport(16),
+		sessionID:     sessionID,
+		crash:         crash,
+	}
+	t.alive.Store(true)
+	return t
+}
+
+func (t *crashingTransport) Write(ctx context.Context, msg Message) error {
+	if err := t.mockTransport.Write(ctx, msg); err != nil {
+		return err
+	}
+
+	switch m := msg.(type) {
+	case SDKControlRequest:
+		if m.Request.Subtype == "initialize" {
+			t.incoming <- SDKControlResponse{
+				Type: "control_response",
+				Response: SDKControlResponseBody{
+					Subtype:   "success",
+					RequestID: m.RequestID,
+					Response:  map[string]interface{}{},
+				},
+			}
+		}
+
+	case UserMessage:
+		t.incoming <- SystemMessage{
+			Type:      "system",
+			Subtype:   "init",
+			SessionID: t.sessionID,
+		}
+		assistant := AssistantMessage{Type: "assistant", SessionID: t.sessionID}
+		assistant.Message.Role = "assistant"
+		t.incoming <- assistant
+
+		if t.crash {
+			t.die()
+			return nil
+		}
+		t.incoming <- ResultMessage{
+			Type:      "result",
+			Subtype:   "success",
+			SessionID: t.sessionID,
+		}
+	}
+
+	return nil
+}
+
+// die simulates the CLI process exiting: the process is no longer alive and
+// its output stream ends.
+func (t *crashingTransport) die() {
+	t.alive.Store(false)
+	if t.closed.CompareAndSwap(false, true) {
+		close(t.incoming)
+	}
+}
+
+// IsAlive implements aliveChecker.
+func (t *crashingTransport) IsAlive() bool {
+	return t.alive.Load()
+}
+
+// initializeRequest returns the initialize request written to t.
+func (t *crashingTransport) initializeRequest() *SDKControlRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, msg := range t.written {
+		req, ok := msg.(SDKControlRequest)
+		if ok && req.Request.Subtype == "initialize" {
+			return &req
+		}
+	}
+	return nil
+}
+
+// collectQuery runs a query and returns every yielded message.
+func collectQuery(t *testing.T, client *Client, prompt string) []Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var msgs []Message
+	for msg := range client.Query(ctx, prompt) {
+		msgs = append(msgs, msg)
+	}
+	require.NoError(t, ctx.Err(), "query timed out")
+	return msgs
+}
+
+// TestClientReconnectResumesSession verifies that a crashed CLI is replaced
+// by one resuming the same session, not the session it was forked from,
+// with hooks registered again.
+func TestClientReconnectResumesSession(t *testing.T) {
+	first := newCrashingTransport("sess_1", true)
+	second := newCrashingTransport("sess_1", false)
+
+	var (
+		mu      sync.Mutex
+		resumes []string
+		forks   []string
+	)
+	client, err := NewClient(
+		WithTransport(first),
+		WithForkSession("parent"),
+		WithHooks(map[HookType][]HookConfig{
+			HookTypePreToolUse: {{
+				Matcher: "Bash",
+				Callback: func(context.Context, HookInput) (HookResult, error) {
+					return HookResult{Continue: true}, nil
+				},
+			}},
+		}),
+		WithAutoReconnect(ReconnectPolicy{
+			InitialBackoff: time.Millisecond,
+			NewTransport: func(opts *Options) (Transport, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				resumes = append(resumes, opts.SessionOptions.Resume)
+				forks = append(forks, opts.SessionOptions.ForkFrom)
+				return second, nil
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	msgs := collectQuery(t, client, "hello")
+	require.NotEmpty(t, msgs)
+	assert.Equal(t, ReconnectedMessage{
+		Type:      "reconnected",
+		SessionID: "sess_1",
+		Attempt:   1,
+	}, msgs[len(msgs)-1])
+
+	mu.Lock()
+	assert.Equal(t, []string{"sess_1"}, resumes)
+	assert.Equal(t, []string{""}, forks)
+	mu.Unlock()
+
+	init := second.initializeRequest()
+	require.NotNil(t, init, "restarted CLI should be initialized")
+	assert.Contains(t, init.Request.Hooks, string(HookTypePreToolUse))
+
+	// The next query runs on the new process.
+	msgs = collectQuery(t, client, "again")
+	require.NotEmpty(t, msgs)
+	assert.IsType(t, ResultMessage{}, msgs[len(msgs)-1])
+}
+
+// TestClientReconnectBudget verifies that restarts stop once the budget is
+// spent and the message stream then ends.
+func TestClientReconnectBudget(t *testing.T) {
+	var attempts atomic.Int32
+	client, err := NewClient(
+		WithTransport(newCrashingTransport("sess_1", true)),
+		WithAutoReconnect(ReconnectPolicy{
+			MaxRestarts:    2,
+			InitialBackoff: time.Millisecond,
+			NewTransport: func(*Options) (Transport, error) {
+				attempts.Add(1)
+				return nil, errors.New("spawn failed")
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	msgs := collectQuery(t, client, "hello")
+	for _, msg := range msgs {
+		assert.NotEqual(t, "reconnected", msg.MessageType())
+	}
+	assert.EqualValues(t, 2, attempts.Load())
+}
+
+// TestClientReconnectDetectsDeadProcess verifies that a process reported dead
+// by IsAlive is replaced even if its output stream never ends.
+func TestClientReconnectDetectsDeadProcess(t *testing.T) {
+	first := newCrashingTransport("", false)
+	second := newCrashingTransport("sess_2", false)
+
+	client, err := NewClient(
+		WithTransport(first),
+		WithAutoReconnect(ReconnectPolicy{
+			InitialBackoff: time.Millisecond,
+			PollInterval:   5 * time.Millisecond,
+			NewTransport: func(*Options) (Transport, error) {
+				return second, nil
+			},
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Stream(ctx)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	first.alive.Store(false)
+	for msg := range stream.Messages() {
+		if reconnected, ok := msg.(ReconnectedMessage); ok {
+			assert.Equal(t, 1, reconnected.Attempt)
+			assert.Empty(t, reconnected.SessionID)
+			break
+		}
+	}
+	require.NoError(t, ctx.Err(), "no reconnect before timeout")
+	assert.NotNil(t, second.initializeRequest())
+}
+
+// TestReconnectPolicyBackoff covers the exponential backoff schedule.
+func TestReconnectPolicyBackoff(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     time.Second,
+	}.withDefaults()
+
+	assert.Equal(t, 100*time.Millisecond, policy.backoff(1))
+	assert.Equal(t, 200*time.Millisecond, policy.backoff(2))
+	assert.Equal(t, 800*time.Millisecond, policy.backoff(4))
+	assert.Equal(t, time.Second, policy.backoff(5))
+	assert.Equal(t, DefaultMaxRestarts, policy.MaxRestarts)
+}
+
+// TestWithAutoReconnectRequiresFactory verifies that a custom transport
+// cannot be combined with reconnects unless a factory is provided.
+func TestWithAutoReconnectRequiresFactory(t *testing.T) {
+	_, err := NewClient(
+		WithTransport(newMockTransport(1)),
+		WithAutoReconnect(ReconnectPolicy{}),
+	)
+	var invalid *ErrInvalidConfiguration
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "Reconnect.NewTransport", invalid.Field)
+}
@@ -0,0 +1,338 @@
+package claudeagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultRedaction replaces redacted text unless RedactorConfig.Replacement
+// is set.
+const DefaultRedaction = "[REDACTED]"
+
+// minEnvSecretLen is the shortest environment variable value redacted by
+// RedactorConfig.RedactEnv. Shorter values, such as "1" or "true", would
+// redact unrelated text.
+const minEnvSecretLen = 8
+
+// DefaultRedactionPatterns match common credential formats: Anthropic and
+// OpenAI style API keys, GitHub, Slack and Google tokens, AWS access key
+// IDs, bearer tokens, JWTs and PEM private keys.
+var DefaultRedactionPatterns = []string{
+	`\bsk-(?:ant-)?[A-Za-z0-9_-]{20,}`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,}`,
+	`\bxox[abposr]-[A-Za-z0-9-]{10,}`,
+	`\bAIza[0-9A-Za-z_-]{35}\b`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`,
+	`\beyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`,
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?` +
+		`-----END [A-Z ]*PRIVATE KEY-----`,
+}
+
+// RedactorConfig configures a Redactor.
+type RedactorConfig struct {
+	// Patterns are regular expressions whose matches are redacted, in
+	// addition to DefaultRedactionPatterns.
+	Patterns []string
+
+	// Literals are exact strings to redact, such as a token read from a
+	// secret store.
+	Literals []string
+
+	// RedactEnv redacts the values of the environment variables passed
+	// with WithEnv that are at least eight characters long.
+	RedactEnv bool
+
+	// DisableDefaultPatterns leaves out DefaultRedactionPatterns.
+	DisableDefaultPatterns bool
+
+	// Replacement replaces redacted text. Empty means DefaultRedaction.
+	Replacement string
+}
+
+// Redactor scrubs secrets from the text the SDK handles. Installed with
+// WithRedactor, it redacts user messages sent to the CLI, hook outputs, SDK
+// MCP tool results, messages yielded to consumers and the client's logs. It
+// can also be set on GetSessionMessagesOptions to redact transcripts read
+// from disk, or used on its own.
+//
+// A nil Redactor redacts nothing.
+type Redactor struct {
+	patterns    []*regexp.Regexp
+	literals    []string
+	redactEnv   bool
+	replacement string
+}
+
+// NewRedactor compiles the patterns in cfg.
+func NewRedactor(cfg RedactorConfig) (*Redactor, error) {
+	r := &Redactor{
+		redactEnv:   cfg.RedactEnv,
+		replacement: cfg.Replacement,
+	}
+	if r.replacement == "" {
+		r.replacement = DefaultRedaction
+	}
+	for _, literal := range cfg.Literals {
+		if literal != "" {
+			r.literals = append(r.literals, literal)
+		}
+	}
+
+	patterns := cfg.Patterns
+	if !cfg.DisableDefaultPatterns {
+		patterns = append(slices.Clone(DefaultRedactionPatterns),
+			patterns...)
+	}
+	for i, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, &ErrInvalidConfiguration{
+				Field:  fmt.Sprintf("RedactorConfig.Patterns[%d]", i),
+				Reason: err.Error(),
+			}
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// withEnv returns a copy of r that also redacts the values in env, if
+// RedactEnv is set.
+func (r *Redactor) withEnv(env map[string]string) *Redactor {
+	if r == nil || !r.redactEnv || len(env) == 0 {
+		return r
+	}
+
+	out := *r
+	out.literals = slices.Clone(r.literals)
+	for _, value := range env {
+		if len(value) >= minEnvSecretLen {
+			out.literals = append(out.literals, value)
+		}
+	}
+	return &out
+}
+
+// RedactString returns s with every secret replaced.
+func (r *Redactor) RedactString(s string) string {
+	if r == nil || s == "" {
+		return s
+	}
+
+	for _, literal := range r.literals {
+		s = strings.ReplaceAll(s, literal, r.replacement)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllLiteralString(s, r.replacement)
+	}
+	return s
+}
+
+// RedactJSON redacts every string in a JSON value, leaving its structure
+// intact. Input that is not valid JSON is redacted as text.
+func (r *Redactor) RedactJSON(raw json.RawMessage) json.RawMessage {
+	if r == nil || len(raw) == 0 {
+		return raw
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return json.RawMessage(r.RedactString(string(raw)))
+	}
+
+	data, err := json.Marshal(r.redactValue(value))
+	if err != nil {
+		return json.RawMessage(r.RedactString(string(raw)))
+	}
+	return data
+}
+
+// redactValue redacts the strings within a decoded JSON value.
+func (r *Redactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			v[key] = r.redactValue(inner)
+		}
+		return v
+
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = r.redactValue(inner)
+		}
+		return v
+
+	case string:
+		return r.RedactString(v)
+
+	default:
+		return v
+	}
+}
+
+// redactMap redacts the strings in a response about to be sent to the CLI.
+func (r *Redactor) redactMap(
+	m map[string]interface{}) map[string]interface{} {
+
+	if r == nil || m == nil {
+		return m
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return m
+	}
+	redacted := r.RedactJSON(data)
+	if bytes.Equal(redacted, data) {
+		return m
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(redacted))
+	decoder.UseNumber()
+	var out map[string]interface{}
+	if err := decoder.Decode(&out); err != nil {
+		return m
+	}
+	return out
+}
+
+// redactMessage redacts the strings in msg. Messages without secrets are
+// returned as is.
+func (r *Redactor) redactMessage(msg Message) Message {
+	if r == nil {
+		return msg
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return msg
+	}
+	redacted := r.RedactJSON(data)
+	if bytes.Equal(redacted, data) {
+		return msg
+	}
+
+	parsed, err := ParseMessage(redacted)
+	if err != nil {
+		return msg
+	}
+	return parsed
+}
+
+// redactUserMessage redacts the strings in a user message.
+func (r *Redactor) redactUserMessage(msg UserMessage) UserMessage {
+	if redacted, ok := r.redactMessage(msg).(UserMessage); ok {
+		return redacted
+	}
+	return msg
+}
+
+// redactToolContent redacts the text of MCP tool result content.
+func (r *Redactor) redactToolContent(content []ToolContent) []ToolContent {
+	if r == nil {
+		return content
+	}
+
+	out := make([]ToolContent, len(content))
+	for i, item := range content {
+		item.Text = r.RedactString(item.Text)
+		item.Resource = r.RedactString(item.Resource)
+		out[i] = item
+	}
+	return out
+}
+
+// Logger returns a logger that redacts the messages and attributes logged
+// through it before passing them to log. A nil log returns nil.
+func (r *Redactor) Logger(log *slog.Logger) *slog.Logger {
+	if r == nil || log == nil {
+		return log
+	}
+	return slog.New(&redactingHandler{
+		handler:  log.Handler(),
+		redactor: r,
+	})
+}
+
+// redactingHandler is a slog.Handler that redacts records before passing
+// them on.
+type redactingHandler struct {
+	handler  slog.Handler
+	redactor *Redactor
+}
+
+// Enabled implements slog.Handler.
+func (h *redactingHandler) Enabled(ctx context.Context,
+	level slog.Level) bool {
+
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *redactingHandler) Handle(ctx context.Context,
+	record slog.Record) error {
+
+	out := slog.NewRecord(record.Time, record.Level,
+		h.redactor.RedactString(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		out.AddAttrs(h.redactor.redactAttr(attr))
+		return true
+	})
+	return h.handler.Handle(ctx, out)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = h.redactor.redactAttr(attr)
+	}
+	return &redactingHandler{
+		handler:  h.handler.WithAttrs(redacted),
+		redactor: h.redactor,
+	}
+}
+
+// WithGroup implements slog.Handler.
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{
+		handler:  h.handler.WithGroup(name),
+		redactor: h.redactor,
+	}
+}
+
+// redactAttr redacts a log attribute. Values that are not strings, such as
+// errors, are redacted through their formatted text.
+func (r *Redactor) redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, r.RedactString(value.String()))
+
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]slog.Attr, len(group))
+		for i, inner := range group {
+			redacted[i] = r.redactAttr(inner)
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(redacted...)}
+
+	case slog.KindAny:
+		text := fmt.Sprint(value.Any())
+		if redacted := r.RedactString(text); redacted != text {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,356 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// subscriberBufferSize is the number of messages buffered for each query or
+// stream before the message pump waits for it to catch up.
+const subscriberBufferSize = 64
+
+// errRouterClosed is returned by acquire once the message stream has ended.
+var errRouterClosed = errors.New("message stream closed")
+
+// errRouterStopped is returned by acquire once the client is shutting down.
+var errRouterStopped = errors.New("no new turns accepted")
+
+// messageRouter delivers messages read from the CLI to the query or stream
+// they belong to.
+//
+// The CLI runs a single conversation and works on one prompt at a time, and
+// its messages carry the conversation's session ID rather than the prompt
+// they answer. The router therefore serializes prompts into turns. A turn
+// is started by writing its user message and owns every message the CLI
+// produces until the next result message, including subagent messages with
+// a parent_tool_use_id. Only then is the next queued turn released.
+//
+// Messages that arrive outside any turn go to every stream that is reading.
+// A reconnect is reported to the active turn, which it ends, and to every
+// reading stream.
+type messageRouter struct {
+	mu      sync.Mutex
+	active  *turn
+	pending []*turn
+	streams map[*subscriber]struct{}
+
+	// stopped is closed by stop. Queued turns are then abandoned and no
+	// new ones are accepted.
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	// idle, if non-nil, is closed when the active turn ends without
+	// another taking its place.
+	idle chan struct{}
+
+	// closed is closed once the client's message stream has ended.
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// newMessageRouter creates a router with no turns.
+func newMessageRouter() *messageRouter {
+	return &messageRouter{
+		streams: make(map[*subscriber]struct{}),
+		stopped: make(chan struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// subscriber receives the messages routed to one query or stream.
+type subscriber struct {
+	ch chan Message
+
+	// done is closed when the consumer stops reading. Messages routed to
+	// it afterwards are discarded.
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// newSubscriber creates a subscriber with a buffered message channel.
+func newSubscriber() *subscriber {
+	return &subscriber{
+		ch:   make(chan Message, subscriberBufferSize),
+		done: make(chan struct{}),
+	}
+}
+
+// leave marks the subscriber as no longer reading.
+func (s *subscriber) leave() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// next waits for the next message routed to s. It returns false once the
+// router has closed and every buffered message was received, or when ctx is
+// done.
+func (s *subscriber) next(ctx context.Context, r *messageRouter) (Message,
+	bool) {
+
+	select {
+	case msg := <-s.ch:
+		return msg, true
+	case <-ctx.Done():
+		return nil, false
+	case <-r.closed:
+		// Messages routed before the close are still buffered.
+		select {
+		case msg := <-s.ch:
+			return msg, true
+		default:
+			return nil, false
+		}
+	}
+}
+
+// turn is a single prompt and the messages the CLI produces in response.
+type turn struct {
+	sub *subscriber
+
+	// ready is closed when the turn becomes active and its user message
+	// may be written.
+	ready chan struct{}
+
+	// span traces the turn once it has started. It is guarded by the
+	// router's mutex.
+	span *turnSpan
+
+	// release, if set, frees the turn's RateLimitScheduler slot. It is
+	// guarded by the router's mutex.
+	release func()
+}
+
+// end finishes the turn's span and frees its slot. The caller must hold the
+// router's mutex.
+func (t *turn) end() {
+	t.span.finish(nil)
+	if t.release != nil {
+		t.release()
+		t.release = nil
+	}
+}
+
+// acquire queues a turn owned by sub and waits until it is active. The
+// caller must write the turn's user message and call release if that
+// fails. It returns errRouterClosed if the message stream ended first, and
+// errRouterStopped if the router was stopped.
+func (r *messageRouter) acquire(ctx context.Context,
+	sub *subscriber) (*turn, error) {
+
+	t := &turn{
+		sub:   sub,
+		ready: make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	select {
+	case <-r.closed:
+		r.mu.Unlock()
+		return nil, errRouterClosed
+	case <-r.stopped:
+		r.mu.Unlock()
+		return nil, errRouterStopped
+	default:
+	}
+	if r.active == nil && len(r.pending) == 0 {
+		r.active = t
+		close(t.ready)
+	} else {
+		r.pending = append(r.pending, t)
+	}
+	r.mu.Unlock()
+
+	var err error
+	select {
+	case <-t.ready:
+		return t, nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-sub.done:
+		err = &ErrTransportClosed{}
+	case <-r.closed:
+		err = errRouterClosed
+	case <-r.stopped:
+		err = errRouterStopped
+	}
+
+	// Give up our place, which may have been granted in the meantime.
+	r.release(t)
+	return nil, err
+}
+
+// release ends t if it is active, or removes it from the queue, so that
+// the next turn can start.
+func (r *messageRouter) release(t *turn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active == t {
+		r.advance()
+		return
+	}
+	for i, queued := range r.pending {
+		if queued == t {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// advance ends the active turn and activates the next queued one, unless
+// the router was stopped. The caller must hold r.mu.
+func (r *messageRouter) advance() {
+	r.active.end()
+	r.active = nil
+	if len(r.pending) == 0 || isClosedChan(r.stopped) {
+		if r.idle != nil {
+			close(r.idle)
+			r.idle = nil
+		}
+		return
+	}
+
+	r.active = r.pending[0]
+	r.pending = r.pending[1:]
+	close(r.active.ready)
+}
+
+// setSpan attaches the span tracing t.
+func (r *messageRouter) setSpan(t *turn, span *turnSpan) {
+	r.mu.Lock()
+	t.span = span
+	r.mu.Unlock()
+}
+
+// setRelease attaches the function that frees t's RateLimitScheduler slot.
+// If t has already ended, release is called right away.
+func (r *messageRouter) setRelease(t *turn, release func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active != t || isClosedChan(r.closed) {
+		release()
+		return
+	}
+	t.release = release
+}
+
+// activeSpan returns the span of the active turn, or nil if there is none.
+func (r *messageRouter) activeSpan() *turnSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.active == nil {
+		return nil
+	}
+	return r.active.span
+}
+
+// stop abandons queued turns and rejects new ones. The active turn, if any,
+// runs to completion.
+func (r *messageRouter) stop() {
+	r.stopOnce.Do(func() {
+		r.mu.Lock()
+		close(r.stopped)
+		r.mu.Unlock()
+	})
+}
+
+// busy reports whether a turn is active.
+func (r *messageRouter) busy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.active != nil
+}
+
+// waitIdle waits until no turn is active or the message stream ends. Once
+// the router is stopped, the next turn cannot start in the meantime.
+func (r *messageRouter) waitIdle(ctx context.Context) error {
+	r.mu.Lock()
+	if r.active == nil {
+		r.mu.Unlock()
+		return nil
+	}
+	if r.idle == nil {
+		r.idle = make(chan struct{})
+	}
+	idle := r.idle
+	r.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-r.closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// listen adds a stream that receives messages outside any turn.
+func (r *messageRouter) listen(sub *subscriber) {
+	r.mu.Lock()
+	r.streams[sub] = struct{}{}
+	r.mu.Unlock()
+}
+
+// unlisten removes a stream added by listen.
+func (r *messageRouter) unlisten(sub *subscriber) {
+	r.mu.Lock()
+	delete(r.streams, sub)
+	r.mu.Unlock()
+}
+
+// route returns the subscribers msg should be delivered to, ending the
+// active turn if msg completes it.
+func (r *messageRouter) route(msg Message) []*subscriber {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var targets []*subscriber
+	if r.active != nil {
+		targets = append(targets, r.active.sub)
+	}
+
+	switch msg.(type) {
+	case ResultMessage:
+		if r.active != nil {
+			r.advance()
+			return targets
+		}
+
+	case ReconnectedMessage:
+		// The turn in flight died with the CLI; no result will follow.
+		if r.active != nil {
+			r.advance()
+		}
+		for sub := range r.streams {
+			if len(targets) == 0 || sub != targets[0] {
+				targets = append(targets, sub)
+			}
+		}
+		return targets
+	}
+
+	if len(targets) > 0 {
+		return targets
+	}
+	for sub := range r.streams {
+		targets = append(targets, sub)
+	}
+	return targets
+}
+
+// close marks the message stream as ended.
+func (r *messageRouter) close() {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		if r.active != nil {
+			r.active.end()
+		}
+		close(r.closed)
+		r.mu.Unlock()
+	})
+}
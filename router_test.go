@@ -0,0 +1,253 @@
+package claudeagent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// echoTransport acknowledges control requests and replies to each user
+// prompt with an assistant message and a result that both echo the prompt.
+// Replies are sent from a separate goroutine, after a delay, like a real CLI.
+type echoTransport struct {
+	*mockTransport
+
+	// hold, if set, delays the reply to the prompt "hold" until closed.
+	hold chan struct{}
+
+	// turnCost is added to the session cost reported by each result.
+	turnCost float64
+
+	countMu sync.Mutex
+	active  int
+	max     int
+	cost    float64
+}
+
+func newEchoTransport() *echoTransport {
+	return &echoTransport{mockTransport: newMockTransport(64)}
+}
+
+func (t *echoTransport) Write(ctx context.Context, msg Message) error {
+	if err := t.mockTransport.Write(ctx, msg); err != nil {
+		return err
+	}
+
+	switch m := msg.(type) {
+	case SDKControlRequest:
+		t.incoming <- SDKControlResponse{
+			Type: "control_response",
+			Response: SDKControlResponseBody{
+				Subtype:   "success",
+				RequestID: m.RequestID,
+				Response:  map[string]interface{}{},
+			},
+		}
+
+	case UserMessage:
+		prompt := m.Message.Content[0].Text
+
+		t.countMu.Lock()
+		t.active++
+		t.max = max(t.max, t.active)
+		t.cost += t.turnCost
+		cost := t.cost
+		t.countMu.Unlock()
+
+		go func() {
+			if prompt == "hold" && t.hold != nil {
+				<-t.hold
+			}
+			time.Sleep(time.Millisecond)
+
+			assistant := AssistantMessage{Type: "assistant"}
+			assistant.Message.Role = "assistant"
+			assistant.Message.Content = []ContentBlock{
+				{Type: "text", Text: prompt},
+			}
+			t.incoming <- assistant
+
+			t.countMu.Lock()
+			t.active--
+			t.countMu.Unlock()
+
+			t.incoming <- ResultMessage{
+				Type:         "result",
+				Subtype:      "success",
+				Result:       prompt,
+				TotalCostUSD: cost,
+			}
+		}()
+	}
+
+	return nil
+}
+
+// maxActive returns the largest number of prompts the transport worked on
+// at once.
+func (t *echoTransport) maxActive() int {
+	t.countMu.Lock()
+	defer t.countMu.Unlock()
+	return t.max
+}
+
+// echoedText returns the assistant text and result of a query's messages.
+func echoedText(t *testing.T, msgs []Message) (string, string) {
+	t.Helper()
+
+	require.Len(t, msgs, 2)
+	assistant, ok := msgs[0].(AssistantMessage)
+	require.True(t, ok)
+	result, ok := msgs[1].(ResultMessage)
+	require.True(t, ok)
+	return assistant.ContentText(), result.Result
+}
+
+// TestClientConcurrentQueries verifies that concurrent queries each receive
+// only their own responses and that prompts reach the CLI one at a time.
+func TestClientConcurrentQueries(t *testing.T) {
+	transport := newEchoTransport()
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+
+	const queries = 20
+
+	var wg sync.WaitGroup
+	results := make([][]Message, queries)
+	for i := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = collectQuery(t, client, fmt.Sprintf("prompt %d", i))
+		}()
+	}
+	wg.Wait()
+
+	for i, msgs := range results {
+		want := fmt.Sprintf("prompt %d", i)
+		text, result := echoedText(t, msgs)
+		assert.Equal(t, want, text)
+		assert.Equal(t, want, result)
+	}
+	assert.Equal(t, 1, transport.maxActive())
+}
+
+// TestClientQueryAndStreamRouting verifies that a stream and a query on the
+// same client do not see each other's messages.
+func TestClientQueryAndStreamRouting(t *testing.T) {
+	client, err := NewClient(WithTransport(newEchoTransport()))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Stream(ctx)
+	require.NoError(t, err)
+	defer stream.Close()
+
+	require.NoError(t, stream.Send(ctx, "stream 1"))
+	require.NoError(t, stream.Send(ctx, "stream 2"))
+
+	queryDone := make(chan []Message)
+	go func() {
+		queryDone <- collectQuery(t, client, "query")
+	}()
+
+	var results []string
+	for msg := range stream.Messages() {
+		if result, ok := msg.(ResultMessage); ok {
+			results = append(results, result.Result)
+		}
+		if len(results) == 2 {
+			break
+		}
+	}
+	require.NoError(t, ctx.Err())
+	assert.ElementsMatch(t, []string{"stream 1", "stream 2"}, results)
+
+	text, _ := echoedText(t, <-queryDone)
+	assert.Equal(t, "query", text)
+}
+
+// TestClientAbandonedQuery verifies that messages for a query whose caller
+// stopped early are not delivered to the next query.
+func TestClientAbandonedQuery(t *testing.T) {
+	transport := newEchoTransport()
+	transport.hold = make(chan struct{})
+
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Connect(context.Background()))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	for range client.Query(ctx, "hold") {
+		t.Fatal("no message expected before cancellation")
+	}
+
+	// Queued behind the abandoned turn until its result arrives.
+	next := make(chan []Message)
+	go func() {
+		next <- collectQuery(t, client, "next")
+	}()
+
+	select {
+	case <-next:
+		t.Fatal("query ran before the previous turn finished")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(transport.hold)
+	text, result := echoedText(t, <-next)
+	assert.Equal(t, "next", text)
+	assert.Equal(t, "next", result)
+}
+
+// TestClientQueuedQueryCanceled verifies that a query canceled while queued
+// gives up its place without sending its prompt.
+func TestClientQueuedQueryCanceled(t *testing.T) {
+	transport := newEchoTransport()
+	transport.hold = make(chan struct{})
+
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Connect(context.Background()))
+
+	first := make(chan []Message)
+	go func() {
+		first <- collectQuery(t, client, "hold")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 20*time.Millisecond,
+	)
+	defer cancel()
+	for _, err := range client.QueryWithErrors(ctx, "canceled") {
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+
+	close(transport.hold)
+	text, _ := echoedText(t, <-first)
+	assert.Equal(t, "hold", text)
+
+	transport.mockTransport.mu.Lock()
+	defer transport.mockTransport.mu.Unlock()
+	for _, msg := range transport.written {
+		if user, ok := msg.(UserMessage); ok {
+			assert.NotEqual(t, "canceled", user.Message.Content[0].Text)
+		}
+	}
+}
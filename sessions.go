@@ -59,6 +59,9 @@ type GetSessionMessagesOptions struct {
 	Offset                int
 	IncludeSystemMessages bool
 	BaseDir               string
+
+	// Redactor, if set, scrubs secrets from the returned messages.
+	Redactor *Redactor
 }
 
 // GetSubagentMessagesOptions controls GetSubagentMessages.
@@ -67,6 +70,9 @@ type GetSubagentMessagesOptions struct {
 	Limit   int
 	Offset  int
 	BaseDir string
+
+	// Redactor, if set, scrubs secrets from the returned messages.
+	Redactor *Redactor
 }
 
 // ListSubagentsOptions controls ListSubagents.
@@ -154,11 +160,15 @@ func GetSessionMessages(sessionID string, opts *GetSessionMessagesOptions) ([]Se
 		return nil, err
 	}
 	offset, limit := 0, 0
+	var redactor *Redactor
 	if opts != nil {
 		offset = opts.Offset
 		limit = opts.Limit
+		redactor = opts.Redactor
 	}
-	return paginateMessages(msgs, offset, limit), nil
+	return redactSessionMessages(
+		redactor, paginateMessages(msgs, offset, limit),
+	), nil
 }
 
 // ListSubagents returns subagent IDs recorded under a session.
@@ -210,11 +220,28 @@ func GetSubagentMessages(sessionID, agentID string, opts *GetSubagentMessagesOpt
 		return nil, err
 	}
 	offset, limit := 0, 0
+	var redactor *Redactor
 	if opts != nil {
 		offset = opts.Offset
 		limit = opts.Limit
+		redactor = opts.Redactor
+	}
+	return redactSessionMessages(
+		redactor, paginateMessages(msgs, offset, limit),
+	), nil
+}
+
+// redactSessionMessages scrubs the secrets in the messages of a transcript.
+func redactSessionMessages(redactor *Redactor,
+	msgs []SessionMessage) []SessionMessage {
+
+	if redactor == nil {
+		return msgs
+	}
+	for i := range msgs {
+		msgs[i].Message = redactor.RedactJSON(msgs[i].Message)
 	}
-	return paginateMessages(msgs, offset, limit), nil
+	return msgs
 }
 
 // RenameSession appends a custom-title entry to a session transcript.
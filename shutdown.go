@@ -0,0 +1,170 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultShutdownDrainTimeout bounds how long Shutdown waits for an
+	// interrupted turn to end when ShutdownPolicy.DrainTimeout is zero.
+	DefaultShutdownDrainTimeout = 30 * time.Second
+
+	// DefaultShutdownExitTimeout is how long the CLI is given to exit after
+	// its input ends when ShutdownPolicy.ExitTimeout is zero.
+	DefaultShutdownExitTimeout = 5 * time.Second
+
+	// DefaultShutdownTermTimeout is how long the CLI is given to exit after
+	// SIGTERM when ShutdownPolicy.TermTimeout is zero.
+	DefaultShutdownTermTimeout = 5 * time.Second
+
+	// killWaitTimeout bounds how long Shutdown waits for the message stream
+	// to end once the CLI was killed.
+	killWaitTimeout = exitWaitTimeout + stderrDrainTimeout
+)
+
+// ShutdownPolicy sets the deadlines for stopping the CLI. Zero-valued fields
+// use the Default* constants.
+type ShutdownPolicy struct {
+	// DrainTimeout bounds how long Shutdown waits for the CLI to
+	// acknowledge the interrupt and finish the turn in flight.
+	DrainTimeout time.Duration
+
+	// ExitTimeout is how long the CLI is given to exit on its own once its
+	// input has ended.
+	ExitTimeout time.Duration
+
+	// TermTimeout is how long the CLI is given to exit after SIGTERM before
+	// it is killed.
+	TermTimeout time.Duration
+}
+
+// withDefaults returns the policy with zero values replaced by defaults.
+func (p ShutdownPolicy) withDefaults() ShutdownPolicy {
+	if p.DrainTimeout <= 0 {
+		p.DrainTimeout = DefaultShutdownDrainTimeout
+	}
+	if p.ExitTimeout <= 0 {
+		p.ExitTimeout = DefaultShutdownExitTimeout
+	}
+	if p.TermTimeout <= 0 {
+		p.TermTimeout = DefaultShutdownTermTimeout
+	}
+	return p
+}
+
+// terminator is implemented by transports that run the CLI as a process
+// which can be asked to exit and, failing that, killed.
+type terminator interface {
+	Terminate() error
+	Kill() error
+}
+
+// Shutdown stops the client gracefully, so that the CLI finishes writing
+// the session transcript and the tool processes it started do not outlive
+// it:
+//
+//  1. New prompts are rejected with ErrClientShutdown and queued ones are
+//     abandoned.
+//  2. If a turn is in flight, the CLI is interrupted and Shutdown waits for
+//     its ResultMessage, which is delivered to the turn's consumer as usual.
+//     Hook callbacks, permission prompts and SDK MCP requests the CLI makes
+//     before the result are answered first.
+//  3. The CLI's input is ended and it is given ExitTimeout to exit.
+//  4. For a local subprocess, SIGTERM is sent to the CLI and its tools,
+//     followed by SIGKILL after TermTimeout.
+//
+// ctx bounds the whole sequence: once it is done, the remaining steps are
+// skipped and the CLI is killed. The deadlines come from the client's
+// ShutdownPolicy.
+//
+// Shutdown returns nil if the CLI exited with status zero. Otherwise it
+// returns ErrSubprocessFailed with the exit status, joined with the context
+// error if ctx ended first. The client is closed when Shutdown returns.
+func (c *Client) Shutdown(ctx context.Context) error {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return nil
+	}
+	c.stopping.Store(true)
+	c.mu.Unlock()
+
+	policy := c.options.Shutdown.withDefaults()
+	transport, _ := c.conn()
+	c.router.stop()
+
+	log := c.options.logger()
+	log.Debug("Shutting down client")
+
+	var errs []error
+	if c.router.busy() {
+		if err := c.drain(ctx, policy.DrainTimeout); err != nil {
+			log.Warn("Failed to drain turn", "err", err)
+			errs = append(errs, err)
+		}
+	}
+
+	// The CLI exits once its input ends. Control requests it sends in
+	// the meantime are still answered by the message pump.
+	_ = transport.EndInput()
+
+	exited := c.waitPumpDone(ctx, policy.ExitTimeout)
+	if term, ok := transport.(terminator); ok && !exited {
+		if ctx.Err() == nil {
+			log.Warn("CLI did not exit, sending SIGTERM")
+			_ = term.Terminate()
+			exited = c.waitPumpDone(ctx, policy.TermTimeout)
+		}
+		if !exited {
+			log.Warn("CLI did not exit, killing it")
+			_ = term.Kill()
+			c.waitPumpDone(context.Background(), killWaitTimeout)
+		}
+	}
+
+	err := ctx.Err()
+	if err != nil && !errors.Is(errors.Join(errs...), err) {
+		errs = append(errs, err)
+	}
+	errs = append(errs, c.Err())
+	_ = c.Close()
+
+	return errors.Join(errs...)
+}
+
+// drain interrupts the turn in flight and waits for it to end.
+func (c *Client) drain(ctx context.Context, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	_, err := c.sendSDKControlRequest(ctx, SDKControlRequestBody{
+		Subtype: "interrupt",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to interrupt turn: %w", err)
+	}
+
+	if err := c.router.waitIdle(ctx); err != nil {
+		return fmt.Errorf("waiting for interrupted turn: %w", err)
+	}
+	return nil
+}
+
+// waitPumpDone waits up to timeout for the message stream to end, which
+// happens once the CLI has exited. It reports whether it did.
+func (c *Client) waitPumpDone(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-c.router.closed:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
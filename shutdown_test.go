@@ -0,0 +1,160 @@
+package claudeagent
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// servePipeInterruptible plays a CLI on server that keeps working on a prompt
+// until it is interrupted, then ends the turn and exits with exitErr once
+// its input ends.
+func servePipeInterruptible(ctx context.Context, server *PipeServer,
+	exitErr error) {
+
+	for msg, err := range server.Messages(ctx) {
+		if err != nil {
+			continue
+		}
+
+		switch m := msg.(type) {
+		case SDKControlRequest:
+			_ = server.RespondControl(ctx, m.RequestID, nil)
+			if m.Request.Subtype == "interrupt" {
+				_ = server.SendResult(ctx, "sess_pipe", "interrupted")
+			}
+
+		case UserMessage:
+			prompt := m.Message.Content[0].Text
+			_ = server.SendAssistantText(ctx, "sess_pipe", prompt)
+		}
+	}
+	_ = server.CloseWithError(exitErr)
+}
+
+// TestClientShutdownInterruptsTurn verifies that Shutdown interrupts the
+// turn in flight, lets it deliver its result, and rejects queued prompts.
+func TestClientShutdownInterruptsTurn(t *testing.T) {
+	transport, server := NewPipeTransport()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go servePipeInterruptible(ctx, server, nil)
+
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+	require.NoError(t, client.Connect(ctx))
+
+	working := make(chan []Message)
+	go func() {
+		working <- collectQuery(t, client, "work")
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	queued := make(chan error, 1)
+	go func() {
+		for _, err := range client.QueryWithErrors(ctx, "queued") {
+			queued <- err
+			return
+		}
+		close(queued)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	require.NoError(t, client.Shutdown(ctx))
+
+	text, result := echoedText(t, <-working)
+	assert.Equal(t, "work", text)
+	assert.Equal(t, "interrupted", result)
+
+	var shutdown *ErrClientShutdown
+	assert.ErrorAs(t, <-queued, &shutdown)
+
+	select {
+	case <-server.Done():
+	case <-ctx.Done():
+		t.Fatal("transport not closed")
+	}
+}
+
+// TestClientShutdownExitStatus verifies that Shutdown returns the CLI's
+// exit status.
+func TestClientShutdownExitStatus(t *testing.T) {
+	transport, server := NewPipeTransport()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go servePipeInterruptible(ctx, server, &ErrSubprocessFailed{
+		ExitCode: 2,
+	})
+
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	require.NoError(t, client.Connect(ctx))
+
+	err = client.Shutdown(ctx)
+	var failed *ErrSubprocessFailed
+	require.ErrorAs(t, err, &failed)
+	assert.Equal(t, 2, failed.ExitCode)
+	require.NoError(t, ctx.Err())
+}
+
+// TestSubprocessTransportCloseEscalates verifies that Close sends SIGTERM to
+// a CLI that does not exit when its input ends, and kills one that also
+// ignores SIGTERM.
+func TestSubprocessTransportCloseEscalates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals not supported")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	tests := []struct {
+		name string
+		trap string
+	}{
+		{name: "terminated", trap: "exit 0"},
+		{name: "killed", trap: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The fake CLI ignores its input and arguments.
+			cli := filepath.Join(t.TempDir(), "cli")
+			script := "#!/bin/sh\ntrap '" + tc.trap + "' TERM\n" +
+				"while :; do sleep 0.05; done\n"
+			require.NoError(t, os.WriteFile(cli, []byte(script), 0o755))
+
+			runner := NewLocalSubprocessRunner(cli)
+			transport := NewSubprocessTransportWithRunner(runner, &Options{
+				Shutdown: ShutdownPolicy{
+					ExitTimeout: 50 * time.Millisecond,
+					TermTimeout: 500 * time.Millisecond,
+				},
+			})
+			require.NoError(t, transport.Connect(context.Background()))
+
+			start := time.Now()
+			require.NoError(t, transport.Close())
+			elapsed := time.Since(start)
+
+			<-transport.wait()
+			if tc.trap == "" {
+				assert.GreaterOrEqual(t, elapsed, 500*time.Millisecond)
+				assert.ErrorContains(t, transport.waitErr, "killed")
+			} else {
+				assert.Less(t, elapsed, 500*time.Millisecond)
+				assert.NoError(t, transport.waitErr)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -57,6 +58,7 @@ type SkillMetadata struct {
 type SkillLoader struct {
 	userSkillsDir    string
 	projectSkillsDir string
+	logger           *slog.Logger
 }
 
 // NewSkillLoader creates a loader with the given Skills directories.
@@ -86,6 +88,20 @@ func NewSkillLoader(userSkillsDir, projectSkillsDir string) *SkillLoader {
 	}
 }
 
+// SetLogger sets where the loader reports Skills it cannot load. By
+// default, nothing is logged.
+func (l *SkillLoader) SetLogger(logger *slog.Logger) {
+	l.logger = logger
+}
+
+// log returns the loader's logger, or one that discards everything.
+func (l *SkillLoader) log() *slog.Logger {
+	if l.logger == nil {
+		return discardLogger
+	}
+	return l.logger
+}
+
 // Load discovers and loads all Skills from configured directories.
 //
 // Load scans user Skills directory and project Skills directory in that order.
@@ -98,8 +114,8 @@ func (l *SkillLoader) Load() ([]Skill, error) {
 		userSkills, err := l.loadFromDirectory(l.userSkillsDir, "user")
 		if err != nil && !os.IsNotExist(err) {
 			// Log warning but continue
-			// In production, use structured logging here
-			_ = err
+			l.log().Warn("Failed to load user skills",
+				"dir", l.userSkillsDir, "err", err)
 		}
 		skills = append(skills, userSkills...)
 	}
@@ -109,7 +125,8 @@ func (l *SkillLoader) Load() ([]Skill, error) {
 		projectSkills, err := l.loadFromDirectory(l.projectSkillsDir, "project")
 		if err != nil && !os.IsNotExist(err) {
 			// Log warning but continue
-			_ = err
+			l.log().Warn("Failed to load project skills",
+				"dir", l.projectSkillsDir, "err", err)
 		}
 		skills = append(skills, projectSkills...)
 	}
@@ -141,6 +158,8 @@ func (l *SkillLoader) loadFromDirectory(dir string, scope string) ([]Skill, erro
 		if err != nil {
 			// Log warning but continue loading other Skills
 			// Invalid Skills are skipped
+			l.log().Warn("Skipping invalid skill", "path", skillPath,
+				"err", err)
 			continue
 		}
 
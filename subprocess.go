@@ -15,6 +15,8 @@ import (
 //
 // This interface allows swapping implementations for testing (mock subprocess),
 // containerized execution (Docker/Kubernetes), or remote execution (SSH, gRPC).
+// IsolatedRunner covers bwrap sandboxes, launcher commands, user switching
+// and cgroup limits; see WithIsolation and WithSubprocessRunner.
 type SubprocessRunner interface {
 	// Start spawns the subprocess with the given arguments, environment, and
 	// working directory. Returns stdin, stdout, stderr pipes.
@@ -42,6 +44,7 @@ type SubprocessRunner interface {
 type LocalSubprocessRunner struct {
 	cliPath string
 	cmd     *exec.Cmd
+	exit    *processExit
 }
 
 // NewLocalSubprocessRunner creates a runner for the local Claude CLI.
@@ -77,74 +80,151 @@ func (r *LocalSubprocessRunner) Start(
 	// Set working directory if specified. Empty string uses the parent
 	// process's cwd.
 	if cwd != "" {
-		// Validate the directory exists and is accessible.
-		fi, err := os.Stat(cwd)
-		if err != nil {
-			return nil, nil, nil, fmt.Errorf("invalid working directory: %w", err)
-		}
-		if !fi.IsDir() {
-			return nil, nil, nil, fmt.Errorf("cwd is not a directory: %s", cwd)
+		if err := checkWorkingDir(cwd); err != nil {
+			return nil, nil, nil, err
 		}
 		r.cmd.Dir = cwd
 	}
 
-	// Set up pipes
-	stdin, err := r.cmd.StdinPipe()
+	stdin, stdout, stderr, exit, err := startWithPipes(r.cmd)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+		return nil, nil, nil, err
 	}
+	r.exit = exit
+
+	return stdin, stdout, stderr, nil
+}
 
-	stdout, err := r.cmd.StdoutPipe()
+// checkWorkingDir validates that cwd exists and is a directory.
+func checkWorkingDir(cwd string) error {
+	fi, err := os.Stat(cwd)
 	if err != nil {
-		stdin.Close()
-		return nil, nil, nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+		return fmt.Errorf("invalid working directory: %w", err)
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("cwd is not a directory: %s", cwd)
 	}
+	return nil
+}
+
+// startWithPipes connects stdin, stdout and stderr pipes to cmd and starts
+// it in a new process group. The returned processExit reaps the process as
+// soon as it exits.
+//
+// The pipes are created with os.Pipe rather than cmd.StdoutPipe and friends
+// so that reaping the process does not close them: output the CLI wrote
+// before exiting stays readable after Wait returns.
+func startWithPipes(cmd *exec.Cmd) (io.WriteCloser, io.ReadCloser,
+	io.ReadCloser, *processExit, error) {
 
-	stderr, err := r.cmd.StderrPipe()
+	setProcessGroup(cmd)
+
+	// Each pair is (parent end, child end).
+	stdinR, stdinW, err := os.Pipe()
 	if err != nil {
-		stdin.Close()
-		stdout.Close()
-		return nil, nil, nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+		return nil, nil, nil, nil, fmt.Errorf("failed to create stdin "+
+			"pipe: %w", err)
 	}
 
-	// Start the subprocess
-	if err := r.cmd.Start(); err != nil {
-		stdin.Close()
-		stdout.Close()
-		stderr.Close()
-		return nil, nil, nil, fmt.Errorf("failed to start subprocess: %w", err)
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW)
+		return nil, nil, nil, nil, fmt.Errorf("failed to create stdout "+
+			"pipe: %w", err)
 	}
 
-	return stdin, stdout, stderr, nil
+	stderrR, stderrW, err := os.Pipe()
+	if err != nil {
+		closeFiles(stdinR, stdinW, stdoutR, stdoutW)
+		return nil, nil, nil, nil, fmt.Errorf("failed to create stderr "+
+			"pipe: %w", err)
+	}
+
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	// Start the subprocess. The child has its own copies of its ends, so
+	// ours are closed either way; stdout then reaches EOF once the child
+	// and anything it started have exited.
+	err = cmd.Start()
+	closeFiles(stdinR, stdoutW, stderrW)
+	if err != nil {
+		closeFiles(stdinW, stdoutR, stderrR)
+		return nil, nil, nil, nil, fmt.Errorf("failed to start "+
+			"subprocess: %w", err)
+	}
+
+	return stdinW, stdoutR, stderrR, waitProcess(cmd), nil
+}
+
+// closeFiles closes each of files, ignoring errors.
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// processExit records the exit of a started process. A goroutine reaps the
+// process as soon as it exits, so exited reports the process state without
+// anyone having to call Wait first.
+type processExit struct {
+	done chan struct{}
+	err  error
+}
+
+// waitProcess reaps the started cmd in the background.
+func waitProcess(cmd *exec.Cmd) *processExit {
+	p := &processExit{done: make(chan struct{})}
+	go func() {
+		p.err = cmd.Wait()
+		close(p.done)
+	}()
+	return p
+}
+
+// wait blocks until the process has exited and returns its exit error. It
+// may be called any number of times.
+func (p *processExit) wait() error {
+	<-p.done
+	return p.err
+}
+
+// exited reports whether the process has exited.
+func (p *processExit) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
 }
 
 // Wait blocks until the subprocess exits.
 func (r *LocalSubprocessRunner) Wait() error {
-	if r.cmd == nil || r.cmd.Process == nil {
+	if r.exit == nil {
 		return fmt.Errorf("subprocess not started")
 	}
-	return r.cmd.Wait()
+	return r.exit.wait()
 }
 
-// Kill forcefully terminates the subprocess.
-func (r *LocalSubprocessRunner) Kill() error {
+// Signal sends sig to the subprocess and the processes it started, such as
+// running tools.
+func (r *LocalSubprocessRunner) Signal(sig os.Signal) error {
 	if r.cmd == nil || r.cmd.Process == nil {
 		return nil
 	}
-	return r.cmd.Process.Kill()
+	return signalProcessGroup(r.cmd.Process, sig)
 }
 
-// IsAlive returns true if the subprocess is still running.
-func (r *LocalSubprocessRunner) IsAlive() bool {
-	if r.cmd == nil || r.cmd.Process == nil {
-		return false
-	}
+// Kill forcefully terminates the subprocess and the processes it started.
+func (r *LocalSubprocessRunner) Kill() error {
+	return r.Signal(os.Kill)
+}
 
-	// Check process state
-	// On Unix: try to send signal 0 (doesn't actually send signal, just checks)
-	// For now, assume alive if we have a process handle
-	// TODO: Add platform-specific liveness check
-	return true
+// IsAlive returns true if the subprocess was started and has not exited.
+func (r *LocalSubprocessRunner) IsAlive() bool {
+	return r.exit != nil && !r.exit.exited()
 }
 
 // MockSubprocessRunner simulates a Claude CLI subprocess for testing.
@@ -0,0 +1,287 @@
+package claudeagent
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// instrumentationName names the tracer the SDK creates its spans with.
+const instrumentationName = "github.com/roasbeef/claude-agent-sdk-go"
+
+// Span names. Each turn span covers one prompt up to its result, and the
+// tool, permission, hook and MCP spans created during the turn are its
+// children.
+const (
+	spanTurn       = "claude.turn"
+	spanToolUse    = "claude.tool_use"
+	spanPermission = "claude.permission"
+	spanHook       = "claude.hook"
+	spanMCP        = "claude.mcp"
+)
+
+// discardLogger is used when no logger is configured.
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// logger returns the configured logger, or one that discards everything.
+func (o *Options) logger() *slog.Logger {
+	if o == nil || o.Logger == nil {
+		return discardLogger
+	}
+	return o.Logger
+}
+
+// tracer returns the tracer spans are created with. Without a configured
+// TracerProvider it creates no-op spans.
+func (o *Options) tracer() trace.Tracer {
+	if o == nil || o.TracerProvider == nil {
+		return noop.NewTracerProvider().Tracer(instrumentationName)
+	}
+	return o.TracerProvider.Tracer(instrumentationName)
+}
+
+// turnSpan is the span of a single turn. It is ended once, with the turn's
+// result if the CLI produced one. A nil turnSpan is valid and does nothing.
+type turnSpan struct {
+	span trace.Span
+	once sync.Once
+}
+
+// context returns parent carrying the turn's span, so that spans created
+// with it become children of the turn.
+func (s *turnSpan) context(parent context.Context) context.Context {
+	if s == nil {
+		return parent
+	}
+	return trace.ContextWithSpan(parent, s.span)
+}
+
+// finish ends the span with the attributes of result. A nil result marks a
+// turn that ended without one, because it failed to start or the CLI went
+// away.
+func (s *turnSpan) finish(result *ResultMessage) {
+	if s == nil {
+		return
+	}
+
+	s.once.Do(func() {
+		if result == nil {
+			s.span.SetStatus(codes.Error, "turn ended without a result")
+			s.span.End()
+			return
+		}
+
+		s.span.SetAttributes(resultAttributes(result)...)
+		if result.IsError {
+			s.span.SetStatus(codes.Error, result.Subtype)
+		}
+		s.span.End()
+	})
+}
+
+// resultAttributes describes a turn's result.
+func resultAttributes(result *ResultMessage) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("claude.session_id", result.SessionID),
+		attribute.String("claude.result.subtype", result.Subtype),
+		attribute.Int("claude.num_turns", result.NumTurns),
+		attribute.Int64("claude.duration_ms", result.DurationMs),
+		attribute.Int64("claude.duration_api_ms", result.DurationAPIMs),
+		attribute.Float64("claude.total_cost_usd", result.TotalCostUSD),
+	}
+	if usage := result.Usage; usage != nil {
+		attrs = append(attrs,
+			attribute.Int("claude.usage.input_tokens",
+				usage.InputTokens),
+			attribute.Int("claude.usage.output_tokens",
+				usage.OutputTokens),
+			attribute.Int("claude.usage.cache_read_input_tokens",
+				usage.CacheReadInputTokens),
+			attribute.Int("claude.usage.cache_creation_input_tokens",
+				usage.CacheCreationInputTokens),
+		)
+	}
+	return attrs
+}
+
+// toolUse is a tool use the CLI started and has not reported a result for.
+type toolUse struct {
+	name  string
+	start time.Time
+	span  trace.Span
+}
+
+// toolTracker traces and times tool uses from the tool_use block that starts
+// them to their tool_result. It is safe for concurrent use.
+type toolTracker struct {
+	mu   sync.Mutex
+	uses map[string]toolUse
+}
+
+// observe starts and ends tool uses as msg reports them. A result ends
+// every tool use left, along with the turn's span.
+func (t *toolTracker) observe(tracer trace.Tracer, metrics Metrics,
+	turn *turnSpan, msg Message) {
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch m := msg.(type) {
+	case AssistantMessage:
+		ctx := turn.context(context.Background())
+		for _, block := range m.Message.Content {
+			if block.Type != "tool_use" {
+				continue
+			}
+
+			_, span := tracer.Start(ctx, spanToolUse,
+				trace.WithAttributes(
+					attribute.String("claude.tool.name",
+						block.Name),
+					attribute.String("claude.tool.use_id",
+						block.ID),
+				),
+			)
+			if t.uses == nil {
+				t.uses = make(map[string]toolUse)
+			}
+			t.uses[block.ID] = toolUse{
+				name:  block.Name,
+				start: time.Now(),
+				span:  span,
+			}
+		}
+
+	case UserMessage:
+		for _, block := range m.Message.Content {
+			use, ok := t.uses[block.ToolUseID]
+			if block.Type != "tool_result" || !ok {
+				continue
+			}
+
+			if block.IsError {
+				use.span.SetStatus(codes.Error,
+					"tool returned an error")
+			}
+			use.span.End()
+			metrics.ToolCompleted(use.name, time.Since(use.start),
+				block.IsError)
+			delete(t.uses, block.ToolUseID)
+		}
+
+	case ResultMessage:
+		for id, use := range t.uses {
+			use.span.End()
+			delete(t.uses, id)
+		}
+		turn.finish(&m)
+	}
+}
+
+// controlCall is a control request from the CLI being handled, for tracing
+// and Metrics. A nil controlCall is valid and does nothing.
+type controlCall struct {
+	subtype string
+	tool    string
+	event   string
+	start   time.Time
+	span    trace.Span
+}
+
+// startControl starts tracing and timing a control request from the CLI. It
+// returns a nil controlCall for a request that is not observed.
+func (p *Protocol) startControl(ctx context.Context,
+	body SDKControlRequestBody) (context.Context, *controlCall) {
+
+	call := &controlCall{
+		subtype: body.Subtype,
+		tool:    body.ToolName,
+		start:   time.Now(),
+	}
+
+	var (
+		name  string
+		attrs []attribute.KeyValue
+	)
+	switch body.Subtype {
+	case "can_use_tool":
+		name = spanPermission
+		attrs = []attribute.KeyValue{
+			attribute.String("claude.tool.name", body.ToolName),
+			attribute.String("claude.tool.use_id", body.ToolUseID),
+		}
+
+	case "hook_callback":
+		call.event = getString(body.Input, "hook_event_name")
+		if call.event == "" {
+			call.event = getString(body.Input, "hook_event")
+		}
+		name = spanHook
+		attrs = []attribute.KeyValue{
+			attribute.String("claude.hook.event", call.event),
+			attribute.String("claude.hook.callback_id",
+				body.CallbackID),
+		}
+
+	case "mcp_message":
+		method := getString(body.Message, "method")
+		name = spanMCP
+		attrs = []attribute.KeyValue{
+			attribute.String("claude.mcp.server", body.ServerName),
+			attribute.String("claude.mcp.method", method),
+		}
+		if params, ok := body.Message["params"].(map[string]interface{}); ok {
+			attrs = append(attrs, attribute.String(
+				"claude.tool.name", getString(params, "name"),
+			))
+		}
+
+	default:
+		return ctx, nil
+	}
+
+	ctx, call.span = p.options.tracer().Start(ctx, name,
+		trace.WithAttributes(attrs...))
+	return ctx, call
+}
+
+// endControl ends a control request started by startControl with the
+// outcome of the response, and reports it to Metrics.
+func (p *Protocol) endControl(call *controlCall, resp SDKControlResponse) {
+	if call == nil {
+		return
+	}
+
+	failed := resp.Response.Subtype == "error"
+	behavior := getString(resp.Response.Response, "behavior")
+
+	switch call.subtype {
+	case "can_use_tool":
+		if !failed {
+			p.options.metrics().PermissionDecision(
+				call.tool, behavior == "allow",
+			)
+		}
+
+	case "hook_callback":
+		p.options.metrics().HookCompleted(
+			call.event, time.Since(call.start), failed,
+		)
+	}
+
+	if behavior != "" {
+		call.span.SetAttributes(
+			attribute.String("claude.permission.decision", behavior),
+		)
+	}
+	if failed {
+		call.span.SetStatus(codes.Error, resp.Response.Error)
+	}
+	call.span.End()
+}
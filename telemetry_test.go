@@ -0,0 +1,156 @@
+package claudeagent
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanAttrs returns the attributes of span as a map.
+func spanAttrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+// TestClientTracing verifies the spans recorded for a turn that uses a tool
+// after asking for permission.
+func TestClientTracing(t *testing.T) {
+	transport, server := NewPipeTransport()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		for msg, err := range server.Messages(ctx) {
+			if err != nil {
+				continue
+			}
+
+			switch m := msg.(type) {
+			case SDKControlRequest:
+				_ = server.RespondControl(ctx, m.RequestID, nil)
+
+			case SDKControlResponse:
+				_ = server.Write(ctx, UserMessage{
+					Type: "user",
+					Message: APIUserMessage{
+						Role: "user",
+						Content: []UserContentBlock{{
+							Type:      "tool_result",
+							ToolUseID: "tool_1",
+						}},
+					},
+				})
+				_ = server.Write(ctx, ResultMessage{
+					Type:         "result",
+					Subtype:      "success",
+					SessionID:    "sess_pipe",
+					NumTurns:     2,
+					TotalCostUSD: 0.25,
+					Usage: &NonNullableUsage{
+						InputTokens:  100,
+						OutputTokens: 20,
+					},
+				})
+
+			case UserMessage:
+				assistant := AssistantMessage{Type: "assistant"}
+				assistant.Message.Role = "assistant"
+				assistant.Message.Content = []ContentBlock{{
+					Type: "tool_use",
+					ID:   "tool_1",
+					Name: "Bash",
+				}}
+				_ = server.Write(ctx, assistant)
+				_ = server.Write(ctx, SDKControlRequest{
+					Type:      "control_request",
+					RequestID: "perm_1",
+					Request: SDKControlRequestBody{
+						Subtype:   "can_use_tool",
+						ToolName:  "Bash",
+						ToolUseID: "tool_1",
+					},
+				})
+			}
+		}
+	}()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(recorder),
+	)
+
+	client, err := NewClient(
+		WithTransport(transport),
+		WithTracerProvider(provider),
+		WithCanUseTool(func(context.Context,
+			ToolPermissionRequest) PermissionResult {
+
+			return PermissionAllow{}
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	for range client.Query(ctx, "run ls") {
+	}
+	require.NoError(t, ctx.Err())
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+	require.Contains(t, spans, spanTurn)
+	require.Contains(t, spans, spanToolUse)
+	require.Contains(t, spans, spanPermission)
+
+	turn := spans[spanTurn]
+	attrs := spanAttrs(turn)
+	assert.Equal(t, "sess_pipe", attrs["claude.session_id"].AsString())
+	assert.Equal(t, 0.25, attrs["claude.total_cost_usd"].AsFloat64())
+	assert.EqualValues(t, 100,
+		attrs["claude.usage.input_tokens"].AsInt64())
+	assert.EqualValues(t, 20,
+		attrs["claude.usage.output_tokens"].AsInt64())
+	assert.Equal(t, codes.Unset, turn.Status().Code)
+
+	tool := spans[spanToolUse]
+	assert.Equal(t, turn.SpanContext().SpanID(), tool.Parent().SpanID())
+	assert.Equal(t, "Bash", spanAttrs(tool)["claude.tool.name"].AsString())
+
+	permission := spans[spanPermission]
+	assert.Equal(t, turn.SpanContext().SpanID(),
+		permission.Parent().SpanID())
+	assert.Equal(t, "allow",
+		spanAttrs(permission)["claude.permission.decision"].AsString())
+}
+
+// TestSkillLoaderLogsInvalidSkills verifies that Skills that fail to load
+// are reported to the logger.
+func TestSkillLoaderLogsInvalidSkills(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "broken"), 0o755))
+
+	var buf bytes.Buffer
+	loader := NewSkillLoader(dir, filepath.Join(dir, "missing"))
+	loader.SetLogger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	skills, err := loader.Load()
+	require.NoError(t, err)
+	assert.Empty(t, skills)
+	assert.Contains(t, buf.String(), "Skipping invalid skill")
+	assert.Contains(t, buf.String(), "broken")
+}
@@ -1,5 +1,11 @@
 package claudeagent
 
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
 // Tool input types for parsing tool calls from the SDK.
 // These match the TypeScript SDK input types for common Claude Code tools.
 
@@ -142,3 +148,156 @@ type QuestionOption struct {
 	// Description explains what this option means or what happens if chosen.
 	Description string `json:"description"`
 }
+
+// toolInputDecoder decodes raw tool input JSON into a typed value.
+type toolInputDecoder func(raw json.RawMessage) (any, error)
+
+var (
+	// toolInputMu guards toolInputDecoders.
+	toolInputMu sync.RWMutex
+
+	// toolInputDecoders maps tool names to the decoder for their input
+	// type. Built-in Claude Code tools are registered here; callers can add
+	// their own (for example MCP tools) with RegisterToolInput.
+	toolInputDecoders = map[string]toolInputDecoder{
+		"Agent":           decodeToolInputAs[TaskInput],
+		"Task":            decodeToolInputAs[TaskInput],
+		"Bash":            decodeToolInputAs[BashInput],
+		"Edit":            decodeToolInputAs[FileEditInput],
+		"Read":            decodeToolInputAs[FileReadInput],
+		"Write":           decodeToolInputAs[FileWriteInput],
+		"Glob":            decodeToolInputAs[GlobInput],
+		"Grep":            decodeToolInputAs[GrepInput],
+		"LSP":             decodeToolInputAs[LSPInput],
+		"WebFetch":        decodeToolInputAs[WebFetchInput],
+		"WebSearch":       decodeToolInputAs[WebSearchInput],
+		"NotebookEdit":    decodeToolInputAs[NotebookEditInput],
+		"TodoWrite":       decodeToolInputAs[TodoWriteInput],
+		"Skill":           decodeToolInputAs[SkillInput],
+		"AskUserQuestion": decodeToolInputAs[AskUserQuestionInput],
+	}
+)
+
+// RegisterToolInput associates a tool name with the input type T, so that
+// DecodeToolInput returns a T for that tool. Registering a name again
+// replaces the previous type.
+//
+// Example:
+//
+//	claudeagent.RegisterToolInput[QuoteArgs]("mcp__tickertape__fetch_quote")
+func RegisterToolInput[T any](name string) {
+	toolInputMu.Lock()
+	defer toolInputMu.Unlock()
+
+	toolInputDecoders[name] = decodeToolInputAs[T]
+}
+
+// DecodeToolInput decodes raw tool input into the registered type for the
+// named tool, such as BashInput for "Bash". The result is a value, not a
+// pointer, so it can be used directly in a type switch. Tools without a
+// registered type return ErrUnknownToolInput.
+//
+// Example:
+//
+//	input, err := claudeagent.DecodeToolInput(req.ToolName, req.Arguments)
+//	if err != nil {
+//	    return claudeagent.PermissionDeny{Reason: err.Error()}
+//	}
+//	switch in := input.(type) {
+//	case claudeagent.BashInput:
+//	    // inspect in.Command
+//	case claudeagent.FileWriteInput:
+//	    // inspect in.FilePath
+//	}
+func DecodeToolInput(name string, raw json.RawMessage) (any, error) {
+	toolInputMu.RLock()
+	decode, ok := toolInputDecoders[name]
+	toolInputMu.RUnlock()
+
+	if !ok {
+		return nil, &ErrUnknownToolInput{Name: name}
+	}
+
+	input, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s input: %w", name, err)
+	}
+	return input, nil
+}
+
+// As decodes raw tool input into T. Unlike DecodeToolInput it does not
+// consult the registry, so it also works for tools without a registered
+// type.
+//
+// Example:
+//
+//	bash, err := claudeagent.As[claudeagent.BashInput](req.Arguments)
+func As[T any](raw json.RawMessage) (T, error) {
+	var input T
+	if len(raw) == 0 {
+		return input, nil
+	}
+	if err := json.Unmarshal(raw, &input); err != nil {
+		return input, err
+	}
+	return input, nil
+}
+
+// decodeToolInputAs adapts As to the toolInputDecoder signature.
+func decodeToolInputAs[T any](raw json.RawMessage) (any, error) {
+	return As[T](raw)
+}
+
+// DecodeInput decodes the request arguments into the registered type for
+// the tool. See DecodeToolInput.
+func (r ToolPermissionRequest) DecodeInput() (any, error) {
+	return DecodeToolInput(r.ToolName, r.Arguments)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (i PreToolUseInput) DecodeInput() (any, error) {
+	return DecodeToolInput(i.ToolName, i.ToolInput)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (i PostToolUseInput) DecodeInput() (any, error) {
+	return DecodeToolInput(i.ToolName, i.ToolInput)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (i PostToolUseFailureInput) DecodeInput() (any, error) {
+	return DecodeToolInput(i.ToolName, i.ToolInput)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (i PermissionRequestInput) DecodeInput() (any, error) {
+	return DecodeToolInput(i.ToolName, i.ToolInput)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (i PermissionDeniedInput) DecodeInput() (any, error) {
+	return DecodeToolInput(i.ToolName, i.ToolInput)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (c PostToolBatchToolCall) DecodeInput() (any, error) {
+	return DecodeToolInput(c.ToolName, c.ToolInput)
+}
+
+// DecodeInput decodes a tool_use block's input into the registered type for
+// the tool. See DecodeToolInput.
+func (c ContentBlock) DecodeInput() (any, error) {
+	return DecodeToolInput(c.Name, c.Input)
+}
+
+// DecodeInput decodes the tool input into the registered type for the
+// tool. See DecodeToolInput.
+func (b ToolUseContentBlock) DecodeInput() (any, error) {
+	return DecodeToolInput(b.Name, b.Input)
+}
@@ -0,0 +1,125 @@
+package claudeagent
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDecodeToolInputBuiltins verifies that built-in tools decode into their
+// input structs.
+func TestDecodeToolInputBuiltins(t *testing.T) {
+	tests := []struct {
+		name string
+		tool string
+		raw  string
+		want any
+	}{
+		{
+			name: "bash",
+			tool: "Bash",
+			raw:  `{"command":"ls -la","run_in_background":true}`,
+			want: BashInput{Command: "ls -la", RunInBackground: true},
+		},
+		{
+			name: "write",
+			tool: "Write",
+			raw:  `{"file_path":"/tmp/a.txt","content":"hi"}`,
+			want: FileWriteInput{FilePath: "/tmp/a.txt", Content: "hi"},
+		},
+		{
+			name: "agent alias",
+			tool: "Agent",
+			raw:  `{"description":"d","prompt":"p","subagent_type":"s"}`,
+			want: TaskInput{Description: "d", Prompt: "p", SubagentType: "s"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeToolInput(tc.tool, json.RawMessage(tc.raw))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+// TestDecodeToolInputErrors covers unknown tools and malformed input.
+func TestDecodeToolInputErrors(t *testing.T) {
+	_, err := DecodeToolInput("mcp__unknown__tool", json.RawMessage(`{}`))
+	var unknown *ErrUnknownToolInput
+	require.ErrorAs(t, err, &unknown)
+	assert.Equal(t, "mcp__unknown__tool", unknown.Name)
+
+	_, err = DecodeToolInput("Bash", json.RawMessage(`{"command":42}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Bash")
+}
+
+// TestRegisterToolInput verifies that custom tools can be registered.
+func TestRegisterToolInput(t *testing.T) {
+	type quoteArgs struct {
+		Symbol string `json:"symbol"`
+	}
+	const name = "mcp__tickertape__fetch_quote_test"
+
+	RegisterToolInput[quoteArgs](name)
+	t.Cleanup(func() {
+		toolInputMu.Lock()
+		delete(toolInputDecoders, name)
+		toolInputMu.Unlock()
+	})
+
+	got, err := DecodeToolInput(name, json.RawMessage(`{"symbol":"AAPL"}`))
+	require.NoError(t, err)
+	assert.Equal(t, quoteArgs{Symbol: "AAPL"}, got)
+}
+
+// TestAs verifies generic decoding independent of the registry.
+func TestAs(t *testing.T) {
+	bash, err := As[BashInput](json.RawMessage(`{"command":"make"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "make", bash.Command)
+
+	empty, err := As[BashInput](nil)
+	require.NoError(t, err)
+	assert.Equal(t, BashInput{}, empty)
+
+	_, err = As[BashInput](json.RawMessage(`not json`))
+	assert.Error(t, err)
+}
+
+// TestDecodeInputAccessors verifies the typed accessors on permission
+// requests, hook inputs and content blocks.
+func TestDecodeInputAccessors(t *testing.T) {
+	raw := json.RawMessage(`{"file_path":"main.go"}`)
+	want := FileReadInput{FilePath: "main.go"}
+
+	decoders := map[string]func() (any, error){
+		"permission request": ToolPermissionRequest{
+			ToolName: "Read", Arguments: raw,
+		}.DecodeInput,
+		"pre tool use": PreToolUseInput{
+			ToolName: "Read", ToolInput: raw,
+		}.DecodeInput,
+		"post tool use": PostToolUseInput{
+			ToolName: "Read", ToolInput: raw,
+		}.DecodeInput,
+		"content block": ContentBlock{
+			Type: "tool_use", Name: "Read", Input: raw,
+		}.DecodeInput,
+		"typed tool use": ToolUseContentBlock{
+			Name: "Read", Input: raw,
+		}.DecodeInput,
+	}
+
+	for name, decode := range decoders {
+		t.Run(name, func(t *testing.T) {
+			got, err := decode()
+			require.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+}
@@ -4,14 +4,17 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"iter"
 	"os"
+	"os/exec"
 	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -26,8 +29,10 @@ type writerRef struct {
 	w io.Writer
 }
 
-// Transport abstracts CLI communication so the SDK can swap implementations
-// (subprocess today; in-memory or network transports in the future).
+// Transport abstracts CLI communication so the SDK can swap implementations:
+// SubprocessTransport runs the CLI locally, NetworkTransport reaches one run
+// by a claude-bridge server on another host, and PipeTransport connects to
+// an in-process PipeServer.
 //
 // All methods must be safe for concurrent use unless documented otherwise:
 // implementations are responsible for serializing Write calls. ReadMessages
@@ -70,19 +75,73 @@ type SubprocessTransport struct {
 	options   *Options
 	mu        sync.Mutex
 	errLogger atomic.Pointer[writerRef]
+
+	// stderrTail keeps the last StderrTailBytes of stderr output, and
+	// stderrDone is closed once stderr has been drained.
+	stderrTail tailBuffer
+	stderrDone chan struct{}
+
+	// waitOnce guards the single call to runner.Wait, whose result is
+	// stored in waitErr before waitDone is closed.
+	waitOnce sync.Once
+	waitDone chan struct{}
+	waitErr  error
+
+	// observer, if set, is called with every line written and read.
+	observer atomic.Pointer[func(CassetteDirection, []byte)]
 }
 
+// StderrTailBytes is the amount of trailing CLI stderr output kept for
+// ErrSubprocessFailed.
+const StderrTailBytes = 8 * 1024
+
+const (
+	// stderrDrainTimeout bounds how long ReadMessages waits for the rest of
+	// stderr once stdout has closed. A child process may hold it open.
+	stderrDrainTimeout = 250 * time.Millisecond
+
+	// exitWaitTimeout bounds how long ReadMessages waits for the exit
+	// status of a CLI whose stdout closed.
+	exitWaitTimeout = 2 * time.Second
+)
+
 // NewSubprocessTransport creates a new transport for the Claude CLI.
 //
-// The CLI path is discovered from options or PATH. The transport is not
-// connected until Connect() is called.
+// The CLI path is discovered from options or PATH. The CLI is started by
+// Options.NewRunner if set, by an IsolatedRunner if Options.Isolation is
+// set, and as a local subprocess otherwise. The transport is not connected
+// until Connect() is called.
 func NewSubprocessTransport(options *Options) (*SubprocessTransport, error) {
-	cliPath, err := DiscoverCLIPath(options)
-	if err != nil {
-		return nil, err
+	// A launcher command runs the CLI in its own environment, where the
+	// host's PATH means nothing, so only an explicit path is used.
+	cliPath := "claude"
+	if options.Isolation != nil && len(options.Isolation.Command) > 0 {
+		if options.CLIPath != "" {
+			cliPath = options.CLIPath
+		}
+	} else {
+		var err error
+		cliPath, err = DiscoverCLIPath(options)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	runner := NewLocalSubprocessRunner(cliPath)
+	var runner SubprocessRunner
+	switch {
+	case options.NewRunner != nil:
+		runner = options.NewRunner(cliPath)
+
+	case options.Isolation != nil:
+		isolated, err := NewIsolatedRunner(cliPath, *options.Isolation)
+		if err != nil {
+			return nil, err
+		}
+		runner = isolated
+
+	default:
+		runner = NewLocalSubprocessRunner(cliPath)
+	}
 
 	t := &SubprocessTransport{
 		runner:  runner,
@@ -137,6 +196,68 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 		return &ErrTransportClosed{}
 	}
 
+	args, err := buildCLIArgs(t.options)
+	if err != nil {
+		return err
+	}
+
+	// Start with the current process env, then overlay options. An
+	// isolated CLI only gets the host variables it is allowed.
+	env := append(os.Environ(), cliEnv(t.options)...)
+	if t.options.Isolation != nil {
+		env = t.options.Isolation.environ(cliEnv(t.options))
+	}
+
+	// Start subprocess via runner with working directory.
+	stdin, stdout, stderr, err := t.runner.Start(ctx, args, env, t.options.Cwd)
+	if err != nil {
+		t.options.logger().Error("Failed to start CLI", "err", err)
+		return &ErrSubprocessFailed{Cause: err, ExitCode: -1}
+	}
+	t.options.logger().Debug("Started CLI", "cwd", t.options.Cwd)
+
+	t.stdin = stdin
+	t.stdout = stdout
+	t.stderr = stderr
+	t.scanner = bufio.NewScanner(stdout)
+
+	// Increase the scanner buffer to handle large tool outputs. The default
+	// bufio.MaxScanTokenSize is 64KB, but tool results (e.g., git diff)
+	// can produce JSON lines far exceeding that limit.
+	const maxLineSize = 10 * 1024 * 1024 // 10MB.
+	t.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+
+	// Forward stderr to logger. We must check scanner.Err() after the
+	// loop exits to avoid silently swallowing I/O errors (e.g., EISDIR
+	// from pipe cleanup during multi-process lock contention).
+	stderrDone := make(chan struct{})
+	t.stderrDone = stderrDone
+	go func() {
+		defer close(stderrDone)
+
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			t.stderrTail.WriteLine(scanner.Text())
+			if ref := t.errLogger.Load(); ref != nil && ref.w != nil {
+				fmt.Fprintln(ref.w, scanner.Text())
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			t.options.logger().Warn("Failed to read CLI stderr",
+				"err", err)
+			if ref := t.errLogger.Load(); ref != nil && ref.w != nil {
+				fmt.Fprintf(ref.w, "stderr scanner error: %v\n", err)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// buildCLIArgs returns the CLI arguments for opts, matching the TypeScript
+// SDK. They are shared by SubprocessTransport and the bridge used by
+// NetworkTransport.
+func buildCLIArgs(opts *Options) ([]string, error) {
 	// Build CLI arguments matching TypeScript SDK.
 	// --output-format stream-json returns line-delimited JSON responses on stdout.
 	// --verbose is required when using stream-json output format.
@@ -148,95 +269,95 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 		"--input-format", "stream-json",
 	}
 
-	if t.options.Model != "" {
-		args = append(args, "--model", t.options.Model)
+	if opts.Model != "" {
+		args = append(args, "--model", opts.Model)
 	}
 
-	if t.options.MainAgent != "" {
-		args = append(args, "--agent", t.options.MainAgent)
+	if opts.MainAgent != "" {
+		args = append(args, "--agent", opts.MainAgent)
 	}
 
-	if t.options.SystemPrompt != "" {
-		args = append(args, "--system-prompt", t.options.SystemPrompt)
+	if opts.SystemPrompt != "" {
+		args = append(args, "--system-prompt", opts.SystemPrompt)
 	}
 
-	if t.options.PermissionMode != "" {
-		args = append(args, "--permission-mode", string(t.options.PermissionMode))
+	if opts.PermissionMode != "" {
+		args = append(args, "--permission-mode", string(opts.PermissionMode))
 	}
 
-	if t.options.Thinking != nil {
-		switch t.options.Thinking.Type {
+	if opts.Thinking != nil {
+		switch opts.Thinking.Type {
 		case "enabled":
-			if t.options.Thinking.BudgetTokens == nil {
+			if opts.Thinking.BudgetTokens == nil {
 				args = append(args, "--thinking", "adaptive")
 			} else {
 				args = append(args, "--max-thinking-tokens",
-					fmt.Sprintf("%d", *t.options.Thinking.BudgetTokens))
+					fmt.Sprintf("%d", *opts.Thinking.BudgetTokens))
 			}
 		case "disabled":
 			args = append(args, "--thinking", "disabled")
 		case "adaptive":
 			args = append(args, "--thinking", "adaptive")
 		}
-		if t.options.Thinking.Type != "disabled" && t.options.Thinking.Display != "" {
-			args = append(args, "--thinking-display", string(t.options.Thinking.Display))
+		if opts.Thinking.Type != "disabled" && opts.Thinking.Display != "" {
+			args = append(args, "--thinking-display", string(opts.Thinking.Display))
 		}
-	} else if t.options.MaxThinkingTokens != nil {
-		if *t.options.MaxThinkingTokens == 0 {
+	} else if opts.MaxThinkingTokens != nil {
+		if *opts.MaxThinkingTokens == 0 {
 			args = append(args, "--thinking", "disabled")
 		} else {
 			args = append(args, "--max-thinking-tokens",
-				fmt.Sprintf("%d", *t.options.MaxThinkingTokens))
+				fmt.Sprintf("%d", *opts.MaxThinkingTokens))
 		}
 	}
 
-	if t.options.Effort != "" {
-		args = append(args, "--effort", string(t.options.Effort))
+	if opts.Effort != "" {
+		args = append(args, "--effort", string(opts.Effort))
 	}
 
-	if t.options.TaskBudget != nil {
-		args = append(args, "--task-budget", fmt.Sprintf("%d", t.options.TaskBudget.Total))
+	if opts.TaskBudget != nil {
+		args = append(args, "--task-budget", fmt.Sprintf("%d", opts.TaskBudget.Total))
 	}
 
 	// Add permission bypass flags if configured.
-	if t.options.AllowDangerouslySkipPermissions {
+	if opts.AllowDangerouslySkipPermissions {
 		args = append(args, "--dangerously-skip-permissions")
 	}
 
 	// Route permission prompts through SDK control channel if callback is set.
-	if t.options.CanUseTool != nil {
+	if opts.CanUseTool != nil {
 		args = append(args, "--permission-prompt-tool", "stdio")
 	}
 
 	// Note: --verbose is already added above (required for stream-json).
 
 	// Add settings sources for Skills
-	if t.options.SkillsConfig.EnableSkills && len(t.options.SkillsConfig.SettingSources) > 0 {
+	if opts.SkillsConfig.EnableSkills && len(opts.SkillsConfig.SettingSources) > 0 {
 		// --setting-sources takes a comma-separated list
-		args = append(args, "--setting-sources", strings.Join(t.options.SkillsConfig.SettingSources, ","))
+		args = append(args, "--setting-sources", strings.Join(opts.SkillsConfig.SettingSources, ","))
 	}
 
-	if t.options.SettingsPath != "" {
-		args = append(args, "--settings", t.options.SettingsPath)
-	} else if t.options.Settings != nil {
-		settingsJSON, err := json.Marshal(t.options.Settings)
+	if opts.SettingsPath != "" {
+		args = append(args, "--settings", opts.SettingsPath)
+	} else if opts.Settings != nil {
+		settingsJSON, err := json.Marshal(opts.Settings)
 		if err != nil {
-			return fmt.Errorf("failed to marshal settings: %w", err)
+			return nil, fmt.Errorf("failed to marshal settings: %w", err)
 		}
 		args = append(args, "--settings", string(settingsJSON))
 	}
 
-	if t.options.ManagedSettings != nil {
-		settingsJSON, err := json.Marshal(t.options.ManagedSettings)
+	if opts.ManagedSettings != nil {
+		settingsJSON, err := json.Marshal(opts.ManagedSettings)
 		if err != nil {
-			return fmt.Errorf("failed to marshal managed settings: %w", err)
+			return nil, fmt.Errorf("failed to marshal managed settings: %w", err)
 		}
 		args = append(args, "--managed-settings", string(settingsJSON))
 	}
 
 	// Add MCP server configurations.
 	// The CLI uses --mcp-config which takes JSON configuration.
-	for name, config := range t.options.MCPServers {
+	for name, config := range opts.MCPServers {
 		serverType := config.Type
 		if serverType == "" {
 			serverType = "stdio"
@@ -280,58 +401,58 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 	}
 
 	// Add strict MCP config flag if set.
-	if t.options.StrictMCPConfig {
+	if opts.StrictMCPConfig {
 		args = append(args, "--strict-mcp-config")
 	}
 
 	// Add no-session-persistence flag if set.
-	if t.options.NoSessionPersistence {
+	if opts.NoSessionPersistence {
 		args = append(args, "--no-session-persistence")
 	}
 
 	// Add session resume flag if set.
-	if t.options.SessionOptions.Resume != "" {
-		args = append(args, "--resume", t.options.SessionOptions.Resume)
+	if opts.SessionOptions.Resume != "" {
+		args = append(args, "--resume", opts.SessionOptions.Resume)
 	}
 
 	// Fork from a parent session: resume the parent then branch to a new ID.
-	if t.options.SessionOptions.ForkFrom != "" {
-		args = append(args, "--resume", t.options.SessionOptions.ForkFrom,
+	if opts.SessionOptions.ForkFrom != "" {
+		args = append(args, "--resume", opts.SessionOptions.ForkFrom,
 			"--fork-session")
 	}
 
 	// Add fork-session flag if set (used with --resume or --continue).
-	if t.options.SessionOptions.ForkSession {
+	if opts.SessionOptions.ForkSession {
 		args = append(args, "--fork-session")
 	}
 
 	// Add resume-session-at flag if set (used with --resume to resume from a specific message).
-	if t.options.SessionOptions.ResumeSessionAt != "" {
-		args = append(args, "--resume-session-at", t.options.SessionOptions.ResumeSessionAt)
+	if opts.SessionOptions.ResumeSessionAt != "" {
+		args = append(args, "--resume-session-at", opts.SessionOptions.ResumeSessionAt)
 	}
 
 	// Add additional directories for tool access (e.g., /tmp for
 	// temp file writes). Each directory is passed as a separate
 	// --add-dir flag.
-	for _, dir := range t.options.AdditionalDirectories {
+	for _, dir := range opts.AdditionalDirectories {
 		args = append(args, "--add-dir", dir)
 	}
 
 	// Add include-partial-messages flag for streaming deltas.
-	if t.options.IncludePartialMessages {
+	if opts.IncludePartialMessages {
 		args = append(args, "--include-partial-messages")
 	}
 
 	// Add beta headers. The CLI accepts --betas as a variadic flag; we
 	// pass a single comma-separated value to match the Python SDK and keep
 	// parsing unambiguous when additional flags follow.
-	if len(t.options.Betas) > 0 {
-		args = append(args, "--betas", strings.Join(t.options.Betas, ","))
+	if len(opts.Betas) > 0 {
+		args = append(args, "--betas", strings.Join(opts.Betas, ","))
 	}
 
-	if t.options.DebugFile != "" {
-		args = append(args, "--debug-file", t.options.DebugFile)
-	} else if t.options.Debug {
+	if opts.DebugFile != "" {
+		args = append(args, "--debug-file", opts.DebugFile)
+	} else if opts.Debug {
 		args = append(args, "--debug")
 	}
 
@@ -339,28 +460,34 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 	// into the first user message. Stabilizes the system prompt prefix for
 	// cross-invocation prompt-cache reuse. The CLI ignores this flag when
 	// --system-prompt is set.
-	if t.options.ExcludeDynamicSystemPromptSections {
+	if opts.ExcludeDynamicSystemPromptSections {
 		args = append(args, "--exclude-dynamic-system-prompt-sections")
 	}
 
-	if len(t.options.ExtraArgs) > 0 {
-		keys := make([]string, 0, len(t.options.ExtraArgs))
-		for key := range t.options.ExtraArgs {
+	if len(opts.ExtraArgs) > 0 {
+		keys := make([]string, 0, len(opts.ExtraArgs))
+		for key := range opts.ExtraArgs {
 			keys = append(keys, key)
 		}
 		sort.Strings(keys)
 
 		for _, key := range keys {
 			args = append(args, "--"+key)
-			if value := t.options.ExtraArgs[key]; value != nil {
+			if value := opts.ExtraArgs[key]; value != nil {
 				args = append(args, *value)
 			}
 		}
 	}
 
-	// Build environment - start with current process env, then overlay options.
-	env := os.Environ()
-	for k, v := range t.options.Env {
+	return args, nil
+}
+
+// cliEnv returns the environment variables the CLI needs on top of its
+// inherited environment: Options.Env, the SDK markers and the config
+// directory.
+func cliEnv(opts *Options) []string {
+	var env []string
+	for k, v := range opts.Env {
 		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
 	// Add SDK markers.
@@ -370,45 +497,10 @@ func (t *SubprocessTransport) Connect(ctx context.Context) error {
 	)
 
 	// Set custom config directory for isolation if specified.
-	if t.options.ConfigDir != "" {
-		env = append(env, "CLAUDE_CONFIG_DIR="+t.options.ConfigDir)
-	}
-
-	// Start subprocess via runner with working directory.
-	stdin, stdout, stderr, err := t.runner.Start(ctx, args, env, t.options.Cwd)
-	if err != nil {
-		return &ErrSubprocessFailed{Cause: err}
+	if opts.ConfigDir != "" {
+		env = append(env, "CLAUDE_CONFIG_DIR="+opts.ConfigDir)
 	}
-
-	t.stdin = stdin
-	t.stdout = stdout
-	t.stderr = stderr
-	t.scanner = bufio.NewScanner(stdout)
-
-	// Increase the scanner buffer to handle large tool outputs. The default
-	// bufio.MaxScanTokenSize is 64KB, but tool results (e.g., git diff)
-	// can produce JSON lines far exceeding that limit.
-	const maxLineSize = 10 * 1024 * 1024 // 10MB.
-	t.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
-
-	// Forward stderr to logger. We must check scanner.Err() after the
-	// loop exits to avoid silently swallowing I/O errors (e.g., EISDIR
-	// from pipe cleanup during multi-process lock contention).
-	go func() {
-		scanner := bufio.NewScanner(stderr)
-		for scanner.Scan() {
-			if ref := t.errLogger.Load(); ref != nil && ref.w != nil {
-				fmt.Fprintln(ref.w, scanner.Text())
-			}
-		}
-		if err := scanner.Err(); err != nil {
-			if ref := t.errLogger.Load(); ref != nil && ref.w != nil {
-				fmt.Fprintf(ref.w, "stderr scanner error: %v\n", err)
-			}
-		}
-	}()
-
-	return nil
+	return env
 }
 
 // Write sends a JSON message to the CLI stdin.
@@ -430,6 +522,10 @@ func (t *SubprocessTransport) Write(ctx context.Context, msg Message) error {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
+	if observe := t.observer.Load(); observe != nil {
+		(*observe)(CassetteSend, data)
+	}
+
 	// Write as a single line
 	data = append(data, '\n')
 
@@ -469,9 +565,12 @@ func (t *SubprocessTransport) ReadMessages(ctx context.Context) iter.Seq2[Messag
 			// Read next line using the pre-created scanner.
 			if !t.scanner.Scan() {
 				// EOF or error - subprocess likely exited.
-				if err := t.scanner.Err(); err != nil {
+				if err := t.scanner.Err(); err != nil && !t.closed.Load() {
 					yield(nil, fmt.Errorf("scanner error: %w", err))
 				}
+				if err := t.exitError(); err != nil {
+					yield(nil, err)
+				}
 				return
 			}
 
@@ -479,6 +578,9 @@ func (t *SubprocessTransport) ReadMessages(ctx context.Context) iter.Seq2[Messag
 			if len(line) == 0 {
 				continue // Skip empty lines.
 			}
+			if observe := t.observer.Load(); observe != nil {
+				(*observe)(CassetteRecv, line)
+			}
 
 			// Parse message.
 			msg, err := ParseMessage(line)
@@ -497,6 +599,13 @@ func (t *SubprocessTransport) ReadMessages(ctx context.Context) iter.Seq2[Messag
 	}
 }
 
+// ObserveLines implements LineTransport.
+func (t *SubprocessTransport) ObserveLines(
+	fn func(dir CassetteDirection, line []byte)) {
+
+	t.observer.Store(&fn)
+}
+
 // EndInput closes the CLI subprocess's stdin without terminating the process.
 // Use this to signal end-of-input while continuing to drain stdout. Idempotent.
 func (t *SubprocessTransport) EndInput() error {
@@ -516,10 +625,100 @@ func (t *SubprocessTransport) EndInput() error {
 	return err
 }
 
+// wait reaps the subprocess once and returns a channel closed when it has
+// exited. The exit error is then available in waitErr.
+func (t *SubprocessTransport) wait() <-chan struct{} {
+	t.waitOnce.Do(func() {
+		t.waitDone = make(chan struct{})
+		go func() {
+			t.waitErr = t.runner.Wait()
+			close(t.waitDone)
+		}()
+	})
+	return t.waitDone
+}
+
+// exitError describes why the CLI stopped producing output. It returns nil
+// if the transport was closed or the CLI exited with status zero.
+func (t *SubprocessTransport) exitError() error {
+	if t.closed.Load() || t.runner == nil {
+		return nil
+	}
+
+	// Drain stderr first so the tail includes the final lines the CLI
+	// wrote before exiting.
+	select {
+	case <-t.stderrDone:
+	case <-time.After(stderrDrainTimeout):
+	}
+
+	exitCode := -1
+	var cause error
+	select {
+	case <-t.wait():
+		if t.waitErr == nil {
+			return nil
+		}
+		cause = t.waitErr
+
+		var exitErr *exec.ExitError
+		if errors.As(cause, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+
+	case <-time.After(exitWaitTimeout):
+		cause = errors.New("stdout closed but process is still running")
+	}
+
+	if t.closed.Load() {
+		return nil
+	}
+
+	return &ErrSubprocessFailed{
+		Cause:    cause,
+		ExitCode: exitCode,
+		Stderr:   t.stderrTail.String(),
+	}
+}
+
+// StderrTail returns the last StderrTailBytes of the CLI's stderr output.
+func (t *SubprocessTransport) StderrTail() string {
+	return t.stderrTail.String()
+}
+
+// tailBuffer keeps the most recent StderrTailBytes of line-oriented output.
+// It is safe for concurrent use.
+type tailBuffer struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+// WriteLine appends line and a newline, discarding the oldest output beyond
+// StderrTailBytes.
+func (b *tailBuffer) WriteLine(line string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.buf = append(b.buf, line...)
+	b.buf = append(b.buf, '\n')
+	if over := len(b.buf) - StderrTailBytes; over > 0 {
+		b.buf = append(b.buf[:0], b.buf[over:]...)
+	}
+}
+
+// String returns the buffered output.
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
 // Close terminates the CLI subprocess and cleans up resources.
 //
 // Close attempts a graceful shutdown by closing stdin, which signals the
-// CLI to exit. If the process doesn't exit within a timeout, it is killed.
+// CLI to exit. If the process doesn't exit within the ShutdownPolicy's
+// ExitTimeout, it is sent SIGTERM, and if it is still running after
+// TermTimeout, it is killed.
 func (t *SubprocessTransport) Close() error {
 	if !t.closed.CompareAndSwap(false, true) {
 		return nil // Already closed
@@ -530,20 +729,27 @@ func (t *SubprocessTransport) Close() error {
 		t.stdin.Close()
 	}
 
-	// Wait for process to exit with timeout
+	// Wait for process to exit, escalating to SIGTERM and then SIGKILL.
 	if t.runner != nil {
-		done := make(chan error, 1)
-		go func() {
-			done <- t.runner.Wait()
-		}()
+		var policy ShutdownPolicy
+		if t.options != nil {
+			policy = t.options.Shutdown
+		}
+		policy = policy.withDefaults()
 
-		// Wait with timeout
 		select {
-		case <-done:
+		case <-t.wait():
 			// Process exited gracefully
-		case <-time.After(5 * time.Second):
-			// Timeout - force kill
-			_ = t.runner.Kill()
+		case <-time.After(policy.ExitTimeout):
+			log := t.options.logger()
+			log.Warn("CLI did not exit, sending SIGTERM")
+			_ = t.Terminate()
+			select {
+			case <-t.wait():
+			case <-time.After(policy.TermTimeout):
+				log.Warn("CLI did not exit, killing it")
+				_ = t.Kill()
+			}
 		}
 	}
 
@@ -558,6 +764,40 @@ func (t *SubprocessTransport) Close() error {
 	return nil
 }
 
+// signaler is implemented by runners that can deliver signals other than
+// SIGKILL, such as LocalSubprocessRunner and IsolatedRunner.
+type signaler interface {
+	Signal(sig os.Signal) error
+}
+
+// Terminate asks the CLI and the tool processes it started to exit by
+// sending them SIGTERM. A runner that cannot deliver signals is killed
+// instead.
+func (t *SubprocessTransport) Terminate() error {
+	if t.runner == nil {
+		return nil
+	}
+
+	s, ok := t.runner.(signaler)
+	if !ok {
+		return t.runner.Kill()
+	}
+
+	err := s.Signal(syscall.SIGTERM)
+	if errors.Is(err, os.ErrProcessDone) {
+		return nil
+	}
+	return err
+}
+
+// Kill forcefully terminates the CLI and the tool processes it started.
+func (t *SubprocessTransport) Kill() error {
+	if t.runner == nil {
+		return nil
+	}
+	return t.runner.Kill()
+}
+
 // IsAlive returns true if the subprocess is still running.
 func (t *SubprocessTransport) IsAlive() bool {
 	if t.closed.Load() {
@@ -574,4 +814,4 @@ func (t *SubprocessTransport) IsReady() bool {
 	return t.IsAlive()
 }
 
-var _ Transport = (*SubprocessTransport)(nil)
+var _ LineTransport = (*SubprocessTransport)(nil)
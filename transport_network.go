@@ -0,0 +1,415 @@
+package claudeagent
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/coder/websocket"
+)
+
+// DefaultNetworkDialTimeout bounds connecting to a bridge and its handshake
+// when NetworkConfig.DialTimeout is zero.
+const DefaultNetworkDialTimeout = 30 * time.Second
+
+// NetworkConfig describes how to reach a claude-bridge server.
+type NetworkConfig struct {
+	// Address is the bridge URL. The scheme selects the transport:
+	// ws:// and wss:// for WebSocket, tcp:// and tls:// for a raw stream.
+	Address string
+
+	// Token is the bearer token the bridge expects. It is sent in the
+	// Authorization header for WebSocket and in the handshake for TCP.
+	Token string
+
+	// TLSConfig is used for wss:// and tls:// addresses. If nil, the system
+	// roots and the address's host name are used.
+	TLSConfig *tls.Config
+
+	// DialTimeout bounds connecting and the bridge handshake.
+	DialTimeout time.Duration
+}
+
+// NetworkTransport runs the CLI on a remote host through a claude-bridge
+// server, speaking the same newline-delimited stream-json as
+// SubprocessTransport over WebSocket or TCP.
+//
+// The CLI arguments and Options.Env are built from the client options
+// exactly as for a local subprocess and sent to the bridge, which starts
+// the CLI with them in its own environment. Paths in the options, such as
+// Cwd and AdditionalDirectories, refer to the bridge host. The CLI's stderr
+// and exit status are relayed, so failures surface as ErrSubprocessFailed
+// just like local ones.
+//
+// Use WithNetworkTransport rather than constructing one directly, so that
+// reconnects and client pools can create new connections.
+type NetworkTransport struct {
+	config  NetworkConfig
+	options *Options
+
+	conn    net.Conn
+	scanner *bufio.Scanner
+	mu      sync.Mutex
+
+	closed    atomic.Bool
+	ready     atomic.Bool
+	exited    atomic.Bool
+	errLogger atomic.Pointer[writerRef]
+
+	// stderrTail keeps the last StderrTailBytes of the remote CLI's stderr.
+	stderrTail tailBuffer
+}
+
+// NewNetworkTransport creates a transport for the bridge described by
+// config. The transport is not connected until Connect() is called.
+func NewNetworkTransport(config NetworkConfig,
+	options *Options) (*NetworkTransport, error) {
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = DefaultNetworkDialTimeout
+	}
+
+	t := &NetworkTransport{
+		config:  config,
+		options: options,
+	}
+	t.errLogger.Store(&writerRef{w: io.Discard})
+	return t, nil
+}
+
+// validate checks that the address has a supported scheme.
+func (c NetworkConfig) validate() error {
+	u, err := url.Parse(c.Address)
+	if err != nil {
+		return &ErrInvalidConfiguration{
+			Field:  "NetworkConfig.Address",
+			Reason: err.Error(),
+		}
+	}
+
+	switch u.Scheme {
+	case "ws", "wss", "tcp", "tls":
+	default:
+		return &ErrInvalidConfiguration{
+			Field: "NetworkConfig.Address",
+			Reason: fmt.Sprintf("unsupported scheme %q, want ws, wss, "+
+				"tcp or tls", u.Scheme),
+		}
+	}
+	if u.Host == "" {
+		return &ErrInvalidConfiguration{
+			Field:  "NetworkConfig.Address",
+			Reason: "missing host",
+		}
+	}
+	return nil
+}
+
+// SetStderrLogger sets the writer that receives the remote CLI's stderr,
+// one line per write.
+func (t *NetworkTransport) SetStderrLogger(w io.Writer) {
+	t.errLogger.Store(&writerRef{w: w})
+}
+
+// Connect dials the bridge and asks it to start the CLI.
+func (t *NetworkTransport) Connect(ctx context.Context) error {
+	if t.closed.Load() {
+		return &ErrTransportClosed{}
+	}
+	if t.ready.Load() {
+		return nil
+	}
+
+	args, err := buildCLIArgs(t.options)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, t.config.DialTimeout)
+	defer cancel()
+
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Bound the handshake by the dial deadline.
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	hello := bridgeHello{
+		Type: bridgeTypeHello,
+		Args: args,
+		Env:  cliEnv(t.options),
+		Cwd:  t.options.Cwd,
+	}
+	if u, _ := url.Parse(t.config.Address); u.Scheme == "tcp" ||
+		u.Scheme == "tls" {
+
+		hello.Token = t.config.Token
+	}
+	if err := writeBridgeLine(conn, hello); err != nil {
+		conn.Close()
+		return fmt.Errorf("bridge handshake: %w", err)
+	}
+
+	scanner := newLineScanner(conn)
+	if !scanner.Scan() {
+		conn.Close()
+		err := scanner.Err()
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("bridge handshake: %w", err)
+	}
+
+	var reply bridgeEvent
+	if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+		conn.Close()
+		return fmt.Errorf("bridge handshake: %w", err)
+	}
+	switch reply.Type {
+	case bridgeTypeReady:
+	case bridgeTypeError:
+		conn.Close()
+		return &ErrBridgeRejected{Reason: reply.Error}
+	default:
+		conn.Close()
+		return &ErrProtocolViolation{
+			Message: fmt.Sprintf("unexpected bridge reply: %s",
+				reply.Type),
+		}
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+
+	t.conn = conn
+	t.scanner = scanner
+	t.ready.Store(true)
+	return nil
+}
+
+// dial opens the connection for the configured address.
+func (t *NetworkTransport) dial(ctx context.Context) (net.Conn, error) {
+	u, err := url.Parse(t.config.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := t.config.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+
+	switch u.Scheme {
+	case "tcp":
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", u.Host)
+
+	case "tls":
+		dialer := tls.Dialer{Config: tlsConfig}
+		return dialer.DialContext(ctx, "tcp", u.Host)
+	}
+
+	header := http.Header{}
+	if t.config.Token != "" {
+		header.Set("Authorization", "Bearer "+t.config.Token)
+	}
+	opts := &websocket.DialOptions{HTTPHeader: header}
+	if u.Scheme == "wss" {
+		opts.HTTPClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		}
+	}
+
+	ws, resp, err := websocket.Dial(ctx, t.config.Address, opts)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			return nil, &ErrBridgeRejected{Reason: resp.Status}
+		}
+		return nil, fmt.Errorf("failed to dial bridge: %w", err)
+	}
+
+	// The connection outlives ctx, which only bounds the dial.
+	return websocket.NetConn(
+		context.Background(), ws, websocket.MessageText,
+	), nil
+}
+
+// Write sends a JSON message to the remote CLI's stdin.
+func (t *NetworkTransport) Write(ctx context.Context, msg Message) error {
+	if t.closed.Load() || !t.ready.Load() {
+		return &ErrTransportClosed{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Write with context awareness.
+	done := make(chan error, 1)
+	go func() {
+		done <- writeBridgeLine(t.conn, msg)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-done:
+		return err
+	}
+}
+
+// ReadMessages returns an iterator over messages from the remote CLI.
+//
+// Stderr relayed by the bridge goes to the stderr logger. The iterator ends
+// when the remote CLI exits, yielding ErrSubprocessFailed if it failed or
+// if the connection dropped first.
+func (t *NetworkTransport) ReadMessages(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		if t.scanner == nil {
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			if !t.scanner.Scan() {
+				if t.closed.Load() {
+					return
+				}
+				cause := t.scanner.Err()
+				if cause == nil {
+					cause = io.ErrUnexpectedEOF
+				}
+				yield(nil, &ErrSubprocessFailed{
+					Cause: fmt.Errorf("bridge connection lost: %w",
+						cause),
+					ExitCode: -1,
+					Stderr:   t.stderrTail.String(),
+				})
+				return
+			}
+
+			line := t.scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+
+			if isBridgeLine(line) {
+				done, err := t.handleBridgeEvent(line)
+				if err != nil && !yield(nil, err) {
+					return
+				}
+				if done {
+					return
+				}
+				continue
+			}
+
+			msg, err := ParseMessage(line)
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// handleBridgeEvent processes a line generated by the bridge itself. It
+// returns whether the stream has ended and the error to yield, if any.
+func (t *NetworkTransport) handleBridgeEvent(line []byte) (bool, error) {
+	var event bridgeEvent
+	if err := json.Unmarshal(line, &event); err != nil {
+		return false, fmt.Errorf("invalid bridge event: %w", err)
+	}
+
+	switch event.Type {
+	case bridgeTypeStderr:
+		t.stderrTail.WriteLine(event.Line)
+		if ref := t.errLogger.Load(); ref != nil && ref.w != nil {
+			fmt.Fprintln(ref.w, event.Line)
+		}
+		return false, nil
+
+	case bridgeTypeExit:
+		t.exited.Store(true)
+		if event.ExitCode == 0 || t.closed.Load() {
+			return true, nil
+		}
+		return true, &ErrSubprocessFailed{
+			Cause:    errors.New(event.Error),
+			ExitCode: event.ExitCode,
+			Stderr:   t.stderrTail.String(),
+		}
+
+	default:
+		return false, &ErrProtocolViolation{
+			Message: fmt.Sprintf("unexpected bridge event: %s",
+				event.Type),
+		}
+	}
+}
+
+// EndInput asks the bridge to close the remote CLI's stdin. Idempotent.
+func (t *NetworkTransport) EndInput() error {
+	if t.closed.Load() || !t.ready.Load() {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return writeBridgeLine(t.conn, bridgeEvent{Type: bridgeTypeEndInput})
+}
+
+// StderrTail returns the last StderrTailBytes of the remote CLI's stderr.
+func (t *NetworkTransport) StderrTail() string {
+	return t.stderrTail.String()
+}
+
+// Close drops the connection, which makes the bridge stop the CLI.
+func (t *NetworkTransport) Close() error {
+	if !t.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+	return nil
+}
+
+// IsAlive reports whether the remote CLI is still running as far as the
+// transport knows.
+func (t *NetworkTransport) IsAlive() bool {
+	return t.ready.Load() && !t.closed.Load() && !t.exited.Load()
+}
+
+// IsReady reports whether the transport is connected and able to send.
+func (t *NetworkTransport) IsReady() bool {
+	return t.IsAlive()
+}
+
+var _ Transport = (*NetworkTransport)(nil)
@@ -0,0 +1,334 @@
+package claudeagent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBridgeToken = "secret"
+
+// fakeCLIRunner is a SubprocessRunner whose "CLI" acknowledges control
+// requests and echoes each prompt back, like echoTransport does in-process.
+// The prompt "exit" makes it exit with status 3.
+type fakeCLIRunner struct {
+	args []string
+	env  []string
+
+	stdin    *io.PipeReader
+	done     chan struct{}
+	exitCode int
+}
+
+// fakeExitError carries an exit status, like exec.ExitError.
+type fakeExitError struct {
+	code int
+}
+
+func (e *fakeExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+func (e *fakeExitError) ExitCode() int { return e.code }
+
+func (r *fakeCLIRunner) Start(_ context.Context, args []string,
+	env []string, _ string) (io.WriteCloser, io.ReadCloser, io.ReadCloser,
+	error) {
+
+	r.args = args
+	r.env = env
+	r.done = make(chan struct{})
+
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	r.stdin = stdinR
+
+	go func() {
+		defer close(r.done)
+		defer stderrW.Close()
+		defer stdoutW.Close()
+
+		fmt.Fprintln(stderrW, "cli started")
+
+		reply := func(msg any) {
+			data, _ := json.Marshal(msg)
+			fmt.Fprintf(stdoutW, "%s\n", data)
+		}
+
+		scanner := bufio.NewScanner(stdinR)
+		for scanner.Scan() {
+			msg, err := ParseMessage(scanner.Bytes())
+			if err != nil {
+				continue
+			}
+
+			switch m := msg.(type) {
+			case SDKControlRequest:
+				reply(SDKControlResponse{
+					Type: "control_response",
+					Response: SDKControlResponseBody{
+						Subtype:   "success",
+						RequestID: m.RequestID,
+						Response:  map[string]interface{}{},
+					},
+				})
+
+			case UserMessage:
+				prompt := m.Message.Content[0].Text
+				if prompt == "exit" {
+					fmt.Fprintln(stderrW, "boom")
+					r.exitCode = 3
+					return
+				}
+
+				assistant := AssistantMessage{Type: "assistant"}
+				assistant.Message.Role = "assistant"
+				assistant.Message.Content = []ContentBlock{
+					{Type: "text", Text: prompt},
+				}
+				reply(assistant)
+				reply(ResultMessage{
+					Type:    "result",
+					Subtype: "success",
+					Result:  prompt,
+				})
+			}
+		}
+	}()
+
+	return stdinW, stdoutR, stderrR, nil
+}
+
+func (r *fakeCLIRunner) Wait() error {
+	<-r.done
+	if r.exitCode != 0 {
+		return &fakeExitError{code: r.exitCode}
+	}
+	return nil
+}
+
+func (r *fakeCLIRunner) Kill() error {
+	return r.stdin.Close()
+}
+
+func (r *fakeCLIRunner) IsAlive() bool {
+	select {
+	case <-r.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// fakeCLIRunners hands out fake runners to a bridge and remembers them.
+type fakeCLIRunners struct {
+	mu      sync.Mutex
+	runners []*fakeCLIRunner
+}
+
+func (f *fakeCLIRunners) newRunner() SubprocessRunner {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	runner := &fakeCLIRunner{}
+	f.runners = append(f.runners, runner)
+	return runner
+}
+
+// startTCPBridge serves a bridge over TCP and returns its address.
+func startTCPBridge(t *testing.T, runners *fakeCLIRunners) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	server := &BridgeServer{
+		Token:     testBridgeToken,
+		NewRunner: runners.newRunner,
+	}
+	go server.Serve(ln)
+
+	return "tcp://" + ln.Addr().String()
+}
+
+// startWSBridge serves a bridge over WebSocket and returns its address.
+func startWSBridge(t *testing.T, runners *fakeCLIRunners) string {
+	t.Helper()
+
+	srv := httptest.NewServer(&BridgeServer{
+		Token:     testBridgeToken,
+		NewRunner: runners.newRunner,
+	})
+	t.Cleanup(srv.Close)
+
+	return "ws://" + strings.TrimPrefix(srv.URL, "http://")
+}
+
+// TestNetworkTransportRoundTrip verifies that a client can query a CLI run
+// by a bridge over both TCP and WebSocket.
+func TestNetworkTransportRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		start func(*testing.T, *fakeCLIRunners) string
+	}{
+		{name: "tcp", start: startTCPBridge},
+		{name: "websocket", start: startWSBridge},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			runners := &fakeCLIRunners{}
+			addr := tc.start(t, runners)
+
+			var (
+				mu     sync.Mutex
+				stderr []string
+			)
+			client, err := NewClient(
+				WithNetworkTransport(NetworkConfig{
+					Address: addr,
+					Token:   testBridgeToken,
+				}),
+				WithEnv(map[string]string{"FOO": "bar"}),
+				WithStderr(func(data string) {
+					mu.Lock()
+					stderr = append(stderr, data)
+					mu.Unlock()
+				}),
+			)
+			require.NoError(t, err)
+			defer client.Close()
+
+			text, result := echoedText(t, collectQuery(t, client, "hello"))
+			assert.Equal(t, "hello", text)
+			assert.Equal(t, "hello", result)
+
+			runners.mu.Lock()
+			require.Len(t, runners.runners, 1)
+			runner := runners.runners[0]
+			runners.mu.Unlock()
+
+			assert.Contains(t, runner.args, "stream-json")
+			assert.Contains(t, runner.env, "FOO=bar")
+
+			mu.Lock()
+			assert.Contains(t, stderr, "cli started\n")
+			mu.Unlock()
+		})
+	}
+}
+
+// TestBridgeServerEnv verifies that a CLI started by the bridge receives
+// the client's variables and the allowed host ones, but not the rest of the
+// bridge's environment.
+func TestBridgeServerEnv(t *testing.T) {
+	t.Setenv("CLAUDE_BRIDGE_TOKEN", testBridgeToken)
+	t.Setenv("SERVICE_TOKEN", "secret")
+	t.Setenv("LANG", "C.UTF-8")
+
+	runners := &fakeCLIRunners{}
+	client, err := NewClient(
+		WithNetworkTransport(NetworkConfig{
+			Address: startTCPBridge(t, runners),
+			Token:   testBridgeToken,
+		}),
+		WithEnv(map[string]string{"FOO": "bar"}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	collectQuery(t, client, "hello")
+
+	runners.mu.Lock()
+	require.Len(t, runners.runners, 1)
+	env := runners.runners[0].env
+	runners.mu.Unlock()
+
+	assert.Contains(t, env, "FOO=bar")
+	assert.Contains(t, env, "LANG=C.UTF-8")
+	for _, kv := range env {
+		assert.NotContains(t, kv, testBridgeToken)
+		assert.NotContains(t, kv, "SERVICE_TOKEN")
+	}
+}
+
+// TestNetworkTransportRejectsBadToken verifies that a wrong token is
+// reported as ErrBridgeRejected without starting a CLI.
+func TestNetworkTransportRejectsBadToken(t *testing.T) {
+	for _, start := range []func(*testing.T, *fakeCLIRunners) string{
+		startTCPBridge, startWSBridge,
+	} {
+		runners := &fakeCLIRunners{}
+		addr := start(t, runners)
+
+		transport, err := NewNetworkTransport(NetworkConfig{
+			Address: addr,
+			Token:   "wrong",
+		}, &Options{})
+		require.NoError(t, err)
+
+		err = transport.Connect(context.Background())
+		var rejected *ErrBridgeRejected
+		require.ErrorAs(t, err, &rejected, addr)
+		assert.Empty(t, runners.runners)
+	}
+}
+
+// TestNetworkTransportExitStatus verifies that a failing remote CLI
+// surfaces as ErrSubprocessFailed with its exit code and stderr.
+func TestNetworkTransportExitStatus(t *testing.T) {
+	addr := startTCPBridge(t, &fakeCLIRunners{})
+
+	transport, err := NewNetworkTransport(NetworkConfig{
+		Address: addr,
+		Token:   testBridgeToken,
+	}, &Options{})
+	require.NoError(t, err)
+	defer transport.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, transport.Connect(ctx))
+	require.True(t, transport.IsAlive())
+
+	require.NoError(t, transport.Write(ctx, UserMessage{
+		Type: "user",
+		Message: APIUserMessage{
+			Role:    "user",
+			Content: []UserContentBlock{{Type: "text", Text: "exit"}},
+		},
+	}))
+
+	var failed *ErrSubprocessFailed
+	for _, err := range transport.ReadMessages(ctx) {
+		require.ErrorAs(t, err, &failed)
+	}
+	require.NotNil(t, failed)
+	assert.Equal(t, 3, failed.ExitCode)
+	assert.Contains(t, failed.Stderr, "boom")
+	assert.False(t, transport.IsAlive())
+}
+
+// TestNetworkConfigValidate verifies that unsupported addresses are
+// rejected up front.
+func TestNetworkConfigValidate(t *testing.T) {
+	for _, addr := range []string{"http://host", "tcp://", "host:1234"} {
+		_, err := NewNetworkTransport(NetworkConfig{Address: addr}, nil)
+		var invalid *ErrInvalidConfiguration
+		assert.ErrorAs(t, err, &invalid, addr)
+	}
+}
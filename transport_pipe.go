@@ -0,0 +1,378 @@
+package claudeagent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// pipeBufferSize is the number of messages each direction of a pipe
+// transport buffers before writes block, like a subprocess pipe.
+const pipeBufferSize = 64
+
+// pipeHalf carries encoded messages in one direction of a pipe transport.
+type pipeHalf struct {
+	ch chan []byte
+
+	// closed is closed when the writing end is done. Reads drain the
+	// buffer and then return err.
+	closed    chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// newPipeHalf creates an open pipe half.
+func newPipeHalf() *pipeHalf {
+	return &pipeHalf{
+		ch:     make(chan []byte, pipeBufferSize),
+		closed: make(chan struct{}),
+	}
+}
+
+// send queues msg, encoded exactly as it would be on the wire.
+func (h *pipeHalf) send(ctx context.Context, msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	select {
+	case <-h.closed:
+		return &ErrTransportClosed{}
+	default:
+	}
+
+	select {
+	case h.ch <- data:
+		return nil
+	case <-h.closed:
+		return &ErrTransportClosed{}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recv returns the next encoded message. Once the half is closed and
+// drained it returns the close error, io.EOF unless closed with another.
+func (h *pipeHalf) recv(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-h.ch:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-h.closed:
+		select {
+		case data := <-h.ch:
+			return data, nil
+		default:
+			return nil, h.err
+		}
+	}
+}
+
+// close ends the half. Reads return err, or io.EOF if err is nil, once the
+// buffered messages are drained.
+func (h *pipeHalf) close(err error) {
+	h.closeOnce.Do(func() {
+		if err == nil {
+			err = io.EOF
+		}
+		h.err = err
+		close(h.closed)
+	})
+}
+
+// NewPipeTransport returns the two ends of an in-memory connection. The
+// PipeTransport is given to a Client in place of the CLI, and the
+// PipeServer plays the CLI: it reads the messages the SDK sends and writes
+// the messages the SDK receives.
+//
+// Messages are JSON-encoded in both directions, so each end sees them
+// exactly as they would appear on the CLI's stdin and stdout. Unlike
+// MockSubprocessRunner there is no process to start or reap, which makes
+// the pair a building block for fakes, proxies and multiplexers that sit
+// between a Client and another Transport.
+//
+// Example:
+//
+//	transport, server := claudeagent.NewPipeTransport()
+//	go func() {
+//	    for msg, err := range server.Messages(ctx) {
+//	        ...
+//	    }
+//	}()
+//	client, _ := claudeagent.NewClient(claudeagent.WithTransport(transport))
+func NewPipeTransport() (*PipeTransport, *PipeServer) {
+	toServer := newPipeHalf()
+	toClient := newPipeHalf()
+
+	transport := &PipeTransport{
+		in:     toClient,
+		out:    toServer,
+		closed: make(chan struct{}),
+	}
+	server := &PipeServer{
+		in:        toServer,
+		out:       toClient,
+		transport: transport,
+	}
+	return transport, server
+}
+
+// PipeTransport is the SDK end of an in-memory connection created by
+// NewPipeTransport.
+type PipeTransport struct {
+	in  *pipeHalf
+	out *pipeHalf
+
+	ready     atomic.Bool
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// Compile-time check that PipeTransport implements Transport.
+var _ Transport = (*PipeTransport)(nil)
+
+// Connect marks the transport ready. The server end needs no setup.
+func (t *PipeTransport) Connect(ctx context.Context) error {
+	if t.isClosed() {
+		return &ErrTransportClosed{}
+	}
+	t.ready.Store(true)
+	return nil
+}
+
+// Write sends msg to the server end. It blocks while the server's buffer
+// is full.
+func (t *PipeTransport) Write(ctx context.Context, msg Message) error {
+	if t.isClosed() {
+		return &ErrTransportClosed{}
+	}
+	return t.out.send(ctx, msg)
+}
+
+// ReadMessages returns an iterator over messages written by the server
+// end. The iterator ends when the server closes its end, after yielding
+// the error it was closed with, if any.
+func (t *PipeTransport) ReadMessages(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		for {
+			data, err := t.in.recv(ctx)
+			if t.isClosed() || ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					yield(nil, err)
+				}
+				return
+			}
+
+			msg, err := ParseMessage(data)
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// EndInput tells the server end that no more messages will be written.
+// Its reads return io.EOF once the buffered messages are drained. Safe to
+// call multiple times.
+func (t *PipeTransport) EndInput() error {
+	t.out.close(nil)
+	return nil
+}
+
+// Close closes both directions. The server end's reads return io.EOF and
+// its writes fail. Safe to call multiple times.
+func (t *PipeTransport) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closed)
+		t.out.close(nil)
+		t.in.close(&ErrTransportClosed{})
+	})
+	return nil
+}
+
+// IsReady reports whether the transport is connected and not closed.
+func (t *PipeTransport) IsReady() bool {
+	return t.ready.Load() && !t.isClosed()
+}
+
+// IsAlive reports whether the server end is still writing, the way a
+// subprocess transport reports whether the CLI is running.
+func (t *PipeTransport) IsAlive() bool {
+	return t.IsReady() && !isClosedChan(t.in.closed)
+}
+
+// isClosed reports whether Close was called.
+func (t *PipeTransport) isClosed() bool {
+	return isClosedChan(t.closed)
+}
+
+// isClosedChan reports whether ch is closed without blocking.
+func isClosedChan(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// PipeServer is the CLI end of an in-memory connection created by
+// NewPipeTransport. It is safe for concurrent use.
+type PipeServer struct {
+	in        *pipeHalf
+	out       *pipeHalf
+	transport *PipeTransport
+}
+
+// Read returns the next message written by the SDK. It returns io.EOF once
+// the SDK has ended its input or closed the transport and every buffered
+// message was read.
+func (s *PipeServer) Read(ctx context.Context) (Message, error) {
+	data, err := s.in.recv(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMessage(data)
+}
+
+// Messages returns an iterator over the messages written by the SDK. It
+// ends where Read would return io.EOF, or when ctx is done. Parse errors
+// are yielded.
+func (s *PipeServer) Messages(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		for {
+			data, err := s.in.recv(ctx)
+			if err != nil {
+				return
+			}
+
+			msg, err := ParseMessage(data)
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+
+			if !yield(msg, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Write sends msg to the SDK. It blocks while the SDK's buffer is full and
+// fails with ErrTransportClosed once either end is closed.
+func (s *PipeServer) Write(ctx context.Context, msg Message) error {
+	if s.transport.isClosed() {
+		return &ErrTransportClosed{}
+	}
+	return s.out.send(ctx, msg)
+}
+
+// SendSystemInit sends the system init message the CLI emits at the start
+// of each turn.
+func (s *PipeServer) SendSystemInit(ctx context.Context,
+	sessionID string) error {
+
+	return s.Write(ctx, SystemMessage{
+		Type:           "system",
+		Subtype:        "init",
+		SessionID:      sessionID,
+		PermissionMode: PermissionModeDefault,
+	})
+}
+
+// SendAssistantText sends an assistant message with a single text block.
+func (s *PipeServer) SendAssistantText(ctx context.Context, sessionID,
+	text string) error {
+
+	msg := AssistantMessage{
+		Type:      "assistant",
+		SessionID: sessionID,
+	}
+	msg.Message.Role = "assistant"
+	msg.Message.Content = []ContentBlock{{Type: "text", Text: text}}
+	return s.Write(ctx, msg)
+}
+
+// SendResult sends the successful result message that ends a turn.
+func (s *PipeServer) SendResult(ctx context.Context, sessionID,
+	result string) error {
+
+	return s.Write(ctx, ResultMessage{
+		Type:      "result",
+		Subtype:   "success",
+		SessionID: sessionID,
+		Result:    result,
+	})
+}
+
+// RespondControl answers the SDK's control request requestID with success.
+// A nil response is sent as an empty object.
+func (s *PipeServer) RespondControl(ctx context.Context, requestID string,
+	response map[string]interface{}) error {
+
+	if response == nil {
+		response = map[string]interface{}{}
+	}
+	return s.Write(ctx, SDKControlResponse{
+		Type: "control_response",
+		Response: SDKControlResponseBody{
+			Subtype:   "success",
+			RequestID: requestID,
+			Response:  response,
+		},
+	})
+}
+
+// RespondControlError answers the SDK's control request requestID with an
+// error.
+func (s *PipeServer) RespondControlError(ctx context.Context, requestID,
+	errMsg string) error {
+
+	return s.Write(ctx, SDKControlResponse{
+		Type: "control_response",
+		Response: SDKControlResponseBody{
+			Subtype:   "error",
+			RequestID: requestID,
+			Error:     errMsg,
+		},
+	})
+}
+
+// Close ends the SDK's message stream once it has read every message
+// written so far, like the CLI exiting cleanly.
+func (s *PipeServer) Close() error {
+	s.out.close(nil)
+	return nil
+}
+
+// CloseWithError ends the SDK's message stream with err, which
+// ReadMessages yields after the buffered messages, like the CLI failing.
+func (s *PipeServer) CloseWithError(err error) error {
+	s.out.close(err)
+	return nil
+}
+
+// Done returns a channel that is closed when the SDK closes its transport.
+func (s *PipeServer) Done() <-chan struct{} {
+	return s.transport.closed
+}
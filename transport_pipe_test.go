@@ -0,0 +1,151 @@
+package claudeagent
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// textUserMessage builds a user message with a single text block.
+func textUserMessage(text string) UserMessage {
+	return UserMessage{
+		Type: "user",
+		Message: APIUserMessage{
+			Role:    "user",
+			Content: []UserContentBlock{{Type: "text", Text: text}},
+		},
+	}
+}
+
+// servePipeEcho plays a CLI on server that acknowledges control requests and
+// echoes each prompt, until the SDK ends its input.
+func servePipeEcho(ctx context.Context, server *PipeServer) {
+	for msg, err := range server.Messages(ctx) {
+		if err != nil {
+			continue
+		}
+
+		switch m := msg.(type) {
+		case SDKControlRequest:
+			_ = server.RespondControl(ctx, m.RequestID, nil)
+
+		case UserMessage:
+			prompt := m.Message.Content[0].Text
+			_ = server.SendSystemInit(ctx, "sess_pipe")
+			_ = server.SendAssistantText(ctx, "sess_pipe", prompt)
+			_ = server.SendResult(ctx, "sess_pipe", prompt)
+		}
+	}
+	_ = server.Close()
+}
+
+// TestPipeTransportClient verifies that a Client can run queries against a
+// CLI played through the server end.
+func TestPipeTransportClient(t *testing.T) {
+	transport, server := NewPipeTransport()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	go servePipeEcho(ctx, server)
+
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+
+	var (
+		text   string
+		result ResultMessage
+	)
+	for msg := range client.Query(ctx, "hello") {
+		switch m := msg.(type) {
+		case AssistantMessage:
+			text = m.ContentText()
+		case ResultMessage:
+			result = m
+		}
+	}
+	require.NoError(t, ctx.Err())
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, "hello", result.Result)
+	assert.Equal(t, "sess_pipe", result.SessionID)
+
+	require.NoError(t, client.Close())
+	select {
+	case <-server.Done():
+	case <-ctx.Done():
+		t.Fatal("server not told about close")
+	}
+}
+
+// TestPipeTransportEndInput verifies that the server reads buffered
+// messages and then io.EOF after EndInput, and that the SDK reads what the
+// server wrote before closing.
+func TestPipeTransportEndInput(t *testing.T) {
+	transport, server := NewPipeTransport()
+	ctx := context.Background()
+
+	require.NoError(t, transport.Connect(ctx))
+	require.NoError(t, transport.Write(ctx, textUserMessage("one")))
+	require.NoError(t, transport.EndInput())
+
+	msg, err := server.Read(ctx)
+	require.NoError(t, err)
+	user, ok := msg.(UserMessage)
+	require.True(t, ok)
+	assert.Equal(t, "one", user.Message.Content[0].Text)
+
+	_, err = server.Read(ctx)
+	assert.ErrorIs(t, err, io.EOF)
+
+	require.NoError(t, server.SendResult(ctx, "", "done"))
+	require.NoError(t, server.Close())
+	assert.False(t, transport.IsAlive())
+
+	var msgs []Message
+	for msg, err := range transport.ReadMessages(ctx) {
+		require.NoError(t, err)
+		msgs = append(msgs, msg)
+	}
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "done", msgs[0].(ResultMessage).Result)
+}
+
+// TestPipeTransportCloseWithError verifies that an error the server closes
+// with is yielded to the SDK.
+func TestPipeTransportCloseWithError(t *testing.T) {
+	transport, server := NewPipeTransport()
+	ctx := context.Background()
+	require.NoError(t, transport.Connect(ctx))
+
+	crash := errors.New("crashed")
+	require.NoError(t, server.CloseWithError(crash))
+
+	var errs []error
+	for _, err := range transport.ReadMessages(ctx) {
+		errs = append(errs, err)
+	}
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], crash)
+}
+
+// TestPipeTransportClose verifies that closing the SDK end stops both
+// directions.
+func TestPipeTransportClose(t *testing.T) {
+	transport, server := NewPipeTransport()
+	ctx := context.Background()
+	require.NoError(t, transport.Connect(ctx))
+	require.NoError(t, transport.Close())
+
+	var closed *ErrTransportClosed
+	assert.ErrorAs(t, transport.Write(ctx, textUserMessage("x")), &closed)
+	assert.ErrorAs(t, server.SendResult(ctx, "", "x"), &closed)
+
+	_, err := server.Read(ctx)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.False(t, transport.IsReady())
+}
@@ -0,0 +1,607 @@
+package claudeagent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// CassetteDirection identifies which side of the transport produced a
+// cassette entry.
+type CassetteDirection string
+
+const (
+	// CassetteSend marks a message written by the SDK to the CLI.
+	CassetteSend CassetteDirection = "send"
+
+	// CassetteRecv marks a message read by the SDK from the CLI.
+	CassetteRecv CassetteDirection = "recv"
+)
+
+// CassetteEntry is a single line of a JSONL cassette.
+//
+// Entries are stored in the order they were observed on the wire, so a
+// recorded session captures both the messages and their interleaving. Control
+// requests keep the request IDs produced by the protocol (req_1, req_2, ...),
+// which are deterministic for a given sequence of SDK calls.
+type CassetteEntry struct {
+	// Direction is either CassetteSend or CassetteRecv.
+	Direction CassetteDirection `json:"dir"`
+
+	// Message is the JSON encoding of the message. When the wrapped
+	// transport implements LineTransport, it is the line exactly as
+	// exchanged with the CLI.
+	Message json.RawMessage `json:"msg,omitempty"`
+
+	// Line holds a received line that is not valid JSON, exactly as
+	// read. Replay yields the same parse error for it.
+	Line string `json:"line,omitempty"`
+
+	// Error holds the text of a read error surfaced by the wrapped
+	// transport. Only set for CassetteRecv entries.
+	Error string `json:"error,omitempty"`
+
+	// ErrorInfo holds the fields of a typed read error, so replay
+	// returns an error of the same type.
+	ErrorInfo *CassetteError `json:"error_info,omitempty"`
+}
+
+// CassetteError describes a read error whose type is preserved on replay.
+// Type is "subprocess_failed" for ErrSubprocessFailed, with Cause, ExitCode
+// and Stderr set, or "unknown_message_type" for ErrUnknownMessageType, with
+// MessageType set.
+type CassetteError struct {
+	Type        string `json:"type"`
+	Cause       string `json:"cause,omitempty"`
+	ExitCode    int    `json:"exit_code,omitempty"`
+	Stderr      string `json:"stderr,omitempty"`
+	MessageType string `json:"message_type,omitempty"`
+}
+
+const (
+	cassetteErrSubprocessFailed   = "subprocess_failed"
+	cassetteErrUnknownMessageType = "unknown_message_type"
+)
+
+// newCassetteError describes err if its type can be rebuilt on replay, and
+// returns nil otherwise.
+func newCassetteError(err error) *CassetteError {
+	var failed *ErrSubprocessFailed
+	if errors.As(err, &failed) {
+		info := &CassetteError{
+			Type:     cassetteErrSubprocessFailed,
+			ExitCode: failed.ExitCode,
+			Stderr:   failed.Stderr,
+		}
+		if failed.Cause != nil {
+			info.Cause = failed.Cause.Error()
+		}
+		return info
+	}
+
+	var unknown *ErrUnknownMessageType
+	if errors.As(err, &unknown) {
+		return &CassetteError{
+			Type:        cassetteErrUnknownMessageType,
+			MessageType: unknown.Type,
+		}
+	}
+	return nil
+}
+
+// err rebuilds the error recorded in the entry.
+func (e CassetteEntry) err() error {
+	info := e.ErrorInfo
+	switch {
+	case info == nil:
+		return errors.New(e.Error)
+
+	case info.Type == cassetteErrSubprocessFailed:
+		failed := &ErrSubprocessFailed{
+			ExitCode: info.ExitCode,
+			Stderr:   info.Stderr,
+		}
+		if info.Cause != "" {
+			failed.Cause = errors.New(info.Cause)
+		}
+		return failed
+
+	case info.Type == cassetteErrUnknownMessageType:
+		return &ErrUnknownMessageType{Type: info.MessageType}
+
+	default:
+		return errors.New(e.Error)
+	}
+}
+
+// LineTransport is implemented by transports that can report the exact
+// lines they exchange with the CLI. RecordingTransport uses it so cassettes
+// hold what the CLI sent, including fields the SDK does not model, rather
+// than the SDK's encoding of each parsed message.
+type LineTransport interface {
+	Transport
+
+	// ObserveLines makes the transport call fn with every line it
+	// writes, before writing it, and every non-empty line it reads,
+	// before parsing it. fn must not retain line.
+	ObserveLines(fn func(dir CassetteDirection, line []byte))
+}
+
+// ReadCassette parses a JSONL cassette from r.
+func ReadCassette(r io.Reader) ([]CassetteEntry, error) {
+	var entries []CassetteEntry
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry CassetteEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("cassette line %d: %w", lineNum, err)
+		}
+		switch entry.Direction {
+		case CassetteSend, CassetteRecv:
+		default:
+			return nil, fmt.Errorf("cassette line %d: unknown direction %q",
+				lineNum, entry.Direction)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// LoadCassette reads a JSONL cassette from the file at path.
+func LoadCassette(path string) ([]CassetteEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadCassette(f)
+}
+
+// RecordingTransport wraps another Transport and appends every message that
+// crosses it to a JSONL cassette. Control requests and responses are recorded
+// alongside regular messages, so the cassette can later be played back with
+// ReplayTransport. If the wrapped transport implements LineTransport, as
+// SubprocessTransport does, the raw lines are recorded; otherwise each
+// message is recorded as the SDK encodes it.
+//
+// Example:
+//
+//	f, _ := os.Create("testdata/session.jsonl")
+//	defer f.Close()
+//
+//	inner, _ := claudeagent.NewSubprocessTransport(&opts)
+//	client, _ := claudeagent.NewClient(
+//	    claudeagent.WithTransport(claudeagent.NewRecordingTransport(inner, f)),
+//	)
+type RecordingTransport struct {
+	inner Transport
+
+	// lines is set when inner reports its raw lines, which are then
+	// recorded instead of the messages passing through.
+	lines bool
+
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+
+	// pending counts the lines read but not yet yielded by inner. A
+	// read error yielded while none are pending did not come from a
+	// line, so it is recorded on its own.
+	pending int
+}
+
+// NewRecordingTransport creates a RecordingTransport that forwards to inner
+// and writes cassette entries to w.
+func NewRecordingTransport(inner Transport, w io.Writer) *RecordingTransport {
+	t := &RecordingTransport{
+		inner: inner,
+		w:     w,
+	}
+	if lines, ok := inner.(LineTransport); ok {
+		t.lines = true
+		lines.ObserveLines(t.recordLine)
+	}
+	return t
+}
+
+// Connect connects the wrapped transport.
+func (t *RecordingTransport) Connect(ctx context.Context) error {
+	return t.inner.Connect(ctx)
+}
+
+// Write records the message and forwards it to the wrapped transport.
+func (t *RecordingTransport) Write(ctx context.Context, msg Message) error {
+	if !t.lines {
+		t.record(CassetteSend, msg, nil)
+	}
+	return t.inner.Write(ctx, msg)
+}
+
+// ReadMessages forwards messages from the wrapped transport, recording each
+// one as it passes through.
+func (t *RecordingTransport) ReadMessages(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		for msg, err := range t.inner.ReadMessages(ctx) {
+			if !t.lines {
+				t.record(CassetteRecv, msg, err)
+			} else if !t.consumeLine() && err != nil {
+				t.record(CassetteRecv, nil, err)
+			}
+			if !yield(msg, err) {
+				return
+			}
+		}
+	}
+}
+
+// consumeLine marks the oldest pending line as yielded. It returns false if
+// no line was pending.
+func (t *RecordingTransport) consumeLine() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == 0 {
+		return false
+	}
+	t.pending--
+	return true
+}
+
+// EndInput signals end of input on the wrapped transport.
+func (t *RecordingTransport) EndInput() error {
+	return t.inner.EndInput()
+}
+
+// Close closes the wrapped transport.
+func (t *RecordingTransport) Close() error {
+	return t.inner.Close()
+}
+
+// IsReady reports whether the wrapped transport is ready.
+func (t *RecordingTransport) IsReady() bool {
+	return t.inner.IsReady()
+}
+
+// Err returns the first error encountered while writing the cassette, if
+// any. Recording failures never interrupt the session itself.
+func (t *RecordingTransport) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.err
+}
+
+// record appends a single entry to the cassette.
+func (t *RecordingTransport) record(dir CassetteDirection, msg Message,
+	msgErr error) {
+
+	entry := CassetteEntry{Direction: dir}
+	if msgErr != nil {
+		entry.Error = msgErr.Error()
+		entry.ErrorInfo = newCassetteError(msgErr)
+	}
+	if msg != nil {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			t.setErr(err)
+			return
+		}
+		entry.Message = data
+	}
+
+	t.writeEntry(entry, false)
+}
+
+// recordLine appends an entry for a line exchanged by the wrapped
+// transport.
+func (t *RecordingTransport) recordLine(dir CassetteDirection, line []byte) {
+	entry := CassetteEntry{Direction: dir}
+	if json.Valid(line) {
+		entry.Message = append(json.RawMessage(nil), line...)
+	} else {
+		entry.Line = string(line)
+	}
+
+	t.writeEntry(entry, dir == CassetteRecv)
+}
+
+// writeEntry writes entry as a cassette line. If read is set, the entry is
+// a line inner has yet to yield.
+func (t *RecordingTransport) writeEntry(entry CassetteEntry, read bool) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		t.setErr(err)
+		return
+	}
+	line = append(line, '\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if read {
+		t.pending++
+	}
+	if _, err := t.w.Write(line); err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+// setErr stores err if no earlier error was recorded.
+func (t *RecordingTransport) setErr(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// ReplayTransport plays back a cassette recorded by RecordingTransport.
+//
+// Received messages are yielded from ReadMessages in cassette order, and
+// every Write is compared against the next recorded send entry. A received
+// entry is only delivered once all send entries preceding it have been
+// matched, which preserves the request/response ordering of the original
+// session. Writes are compared as JSON values, so field order does not
+// matter but every field, including request IDs, must match.
+//
+// Example:
+//
+//	replay, _ := claudeagent.NewReplayTransportFromFile("testdata/session.jsonl")
+//	client, _ := claudeagent.NewClient(claudeagent.WithTransport(replay))
+//	for msg := range client.Query(ctx, "What is 2 + 2?") {
+//	    // ...
+//	}
+//	if err := replay.Done(); err != nil {
+//	    t.Fatal(err)
+//	}
+type ReplayTransport struct {
+	entries []CassetteEntry
+
+	// sends and recvs hold indexes into entries for each direction.
+	sends []int
+	recvs []int
+
+	mu       sync.Mutex
+	nextSend int
+	nextRecv int
+	changed  chan struct{}
+	closed   bool
+	ready    bool
+	mismatch error
+}
+
+// NewReplayTransport creates a ReplayTransport from cassette entries.
+func NewReplayTransport(entries []CassetteEntry) *ReplayTransport {
+	t := &ReplayTransport{
+		entries: entries,
+		changed: make(chan struct{}),
+	}
+	for i, entry := range entries {
+		switch entry.Direction {
+		case CassetteSend:
+			t.sends = append(t.sends, i)
+		case CassetteRecv:
+			t.recvs = append(t.recvs, i)
+		}
+	}
+	return t
+}
+
+// NewReplayTransportFromFile loads the cassette at path and creates a
+// ReplayTransport for it.
+func NewReplayTransportFromFile(path string) (*ReplayTransport, error) {
+	entries, err := LoadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayTransport(entries), nil
+}
+
+// Connect marks the transport ready.
+func (t *ReplayTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return &ErrTransportClosed{}
+	}
+	t.ready = true
+	return nil
+}
+
+// Write matches msg against the next recorded send entry.
+func (t *ReplayTransport) Write(ctx context.Context, msg Message) error {
+	got, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return &ErrTransportClosed{}
+	}
+
+	if t.nextSend >= len(t.sends) {
+		err := &ErrCassetteMismatch{
+			Index: len(t.entries),
+			Got:   got,
+		}
+		t.setMismatchLocked(err)
+		return err
+	}
+
+	index := t.sends[t.nextSend]
+	want := t.entries[index].Message
+	if !jsonEqual(want, got) {
+		err := &ErrCassetteMismatch{
+			Index:    index,
+			Expected: want,
+			Got:      got,
+		}
+		t.setMismatchLocked(err)
+		return err
+	}
+
+	t.nextSend++
+	t.notifyLocked()
+	return nil
+}
+
+// ReadMessages yields recorded messages in order. Each message is held back
+// until the writes recorded before it have been replayed. The iterator ends
+// once all received entries have been delivered, mirroring the CLI exiting.
+func (t *ReplayTransport) ReadMessages(ctx context.Context) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		for {
+			entry, ok := t.nextRecvEntry(ctx)
+			if !ok {
+				return
+			}
+
+			if entry.Error != "" {
+				if !yield(nil, entry.err()) {
+					return
+				}
+				continue
+			}
+
+			data := []byte(entry.Message)
+			if entry.Line != "" {
+				data = []byte(entry.Line)
+			}
+			msg, err := ParseMessage(data)
+			if !yield(msg, err) {
+				return
+			}
+		}
+	}
+}
+
+// nextRecvEntry blocks until the next received entry may be delivered. It
+// returns false when the cassette is exhausted, the transport is closed, or
+// the context is canceled.
+func (t *ReplayTransport) nextRecvEntry(ctx context.Context) (CassetteEntry, bool) {
+	for {
+		t.mu.Lock()
+		if t.closed || t.nextRecv >= len(t.recvs) {
+			t.mu.Unlock()
+			return CassetteEntry{}, false
+		}
+
+		index := t.recvs[t.nextRecv]
+		if t.nextSend >= len(t.sends) || t.sends[t.nextSend] > index {
+			t.nextRecv++
+			t.notifyLocked()
+			t.mu.Unlock()
+			return t.entries[index], true
+		}
+
+		changed := t.changed
+		t.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return CassetteEntry{}, false
+		}
+	}
+}
+
+// EndInput is a no-op for replay.
+func (t *ReplayTransport) EndInput() error {
+	return nil
+}
+
+// Close stops playback and unblocks any pending reads.
+func (t *ReplayTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	t.ready = false
+	t.notifyLocked()
+	return nil
+}
+
+// IsReady reports whether the transport is connected and not closed.
+func (t *ReplayTransport) IsReady() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.ready && !t.closed
+}
+
+// Done reports whether the cassette was replayed completely. It returns the
+// first write mismatch if one occurred, or an error describing how many
+// entries were left unconsumed.
+func (t *ReplayTransport) Done() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.mismatch != nil {
+		return t.mismatch
+	}
+
+	sendsLeft := len(t.sends) - t.nextSend
+	recvsLeft := len(t.recvs) - t.nextRecv
+	if sendsLeft > 0 || recvsLeft > 0 {
+		return fmt.Errorf("cassette not fully replayed: %d sends and "+
+			"%d receives remaining", sendsLeft, recvsLeft)
+	}
+	return nil
+}
+
+// notifyLocked wakes up any goroutine waiting on a state change. The caller
+// must hold t.mu.
+func (t *ReplayTransport) notifyLocked() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// setMismatchLocked records the first mismatch. The caller must hold t.mu.
+func (t *ReplayTransport) setMismatchLocked(err error) {
+	if t.mismatch == nil {
+		t.mismatch = err
+	}
+}
+
+// jsonEqual reports whether two JSON documents encode the same value.
+func jsonEqual(a, b []byte) bool {
+	var av, bv interface{}
+	if err := json.Unmarshal(a, &av); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &bv); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(av, bv)
+}
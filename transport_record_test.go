@@ -0,0 +1,366 @@
+package claudeagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedTransport wraps mockTransport and feeds canned CLI replies in
+// response to SDK writes. It stands in for the real CLI when recording.
+type scriptedTransport struct {
+	*mockTransport
+}
+
+func newScriptedTransport() *scriptedTransport {
+	return &scriptedTransport{mockTransport: newMockTransport(16)}
+}
+
+func (s *scriptedTransport) Write(ctx context.Context, msg Message) error {
+	if err := s.mockTransport.Write(ctx, msg); err != nil {
+		return err
+	}
+
+	switch m := msg.(type) {
+	case SDKControlRequest:
+		if m.Request.Subtype == "initialize" {
+			s.incoming <- SDKControlResponse{
+				Type: "control_response",
+				Response: SDKControlResponseBody{
+					Subtype:   "success",
+					RequestID: m.RequestID,
+					Response:  map[string]interface{}{},
+				},
+			}
+		}
+
+	case UserMessage:
+		s.incoming <- SDKControlRequest{
+			Type:      "control_request",
+			RequestID: "cli_1",
+			Request: SDKControlRequestBody{
+				Subtype:   "can_use_tool",
+				ToolName:  "Bash",
+				Input:     map[string]interface{}{"command": "ls"},
+				ToolUseID: "toolu_1",
+			},
+		}
+
+	case SDKControlResponse:
+		assistant := AssistantMessage{Type: "assistant"}
+		assistant.Message.Role = "assistant"
+		assistant.Message.Content = []ContentBlock{
+			{Type: "text", Text: "done"},
+		}
+		s.incoming <- assistant
+		s.incoming <- ResultMessage{
+			Type:    "result",
+			Subtype: "success",
+			Result:  "done",
+		}
+	}
+
+	return nil
+}
+
+// runRecordedQuery performs a single query with a permission callback over
+// the given transport and returns the text of every yielded message type.
+func runRecordedQuery(t *testing.T, transport Transport) []string {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := NewClient(
+		WithTransport(transport),
+		WithCanUseTool(func(ctx context.Context,
+			req ToolPermissionRequest) PermissionResult {
+
+			return PermissionAllow{}
+		}),
+	)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var types []string
+	for msg := range client.Query(ctx, "list files") {
+		types = append(types, msg.MessageType())
+	}
+	return types
+}
+
+// TestRecordingTransportReplayRoundTrip records a session that includes a
+// can_use_tool control request and verifies it replays byte-for-byte through
+// a fresh client.
+func TestRecordingTransportReplayRoundTrip(t *testing.T) {
+	var cassette bytes.Buffer
+	recorder := NewRecordingTransport(newScriptedTransport(), &cassette)
+
+	recorded := runRecordedQuery(t, recorder)
+	require.NoError(t, recorder.Err())
+	assert.Equal(t, []string{"assistant", "result"}, recorded)
+
+	entries, err := ReadCassette(bytes.NewReader(cassette.Bytes()))
+	require.NoError(t, err)
+
+	var dirs []CassetteDirection
+	for _, entry := range entries {
+		dirs = append(dirs, entry.Direction)
+	}
+	assert.Equal(t, []CassetteDirection{
+		CassetteSend, // initialize
+		CassetteRecv, // initialize response
+		CassetteSend, // user prompt
+		CassetteRecv, // can_use_tool
+		CassetteSend, // permission response
+		CassetteRecv, // assistant
+		CassetteRecv, // result
+	}, dirs)
+
+	var initReq SDKControlRequest
+	require.NoError(t, json.Unmarshal(entries[0].Message, &initReq))
+	assert.Equal(t, "req_1", initReq.RequestID)
+
+	replay := NewReplayTransport(entries)
+	replayed := runRecordedQuery(t, replay)
+	assert.Equal(t, recorded, replayed)
+	require.NoError(t, replay.Done())
+}
+
+// TestReplayTransportWriteMismatch verifies that a write which differs from
+// the cassette is rejected with ErrCassetteMismatch.
+func TestReplayTransportWriteMismatch(t *testing.T) {
+	replay := NewReplayTransport([]CassetteEntry{{
+		Direction: CassetteSend,
+		Message: json.RawMessage(
+			`{"type":"control_request","request_id":"req_1",` +
+				`"request":{"subtype":"interrupt"}}`,
+		),
+	}})
+	require.NoError(t, replay.Connect(context.Background()))
+
+	err := replay.Write(context.Background(), SDKControlRequest{
+		Type:      "control_request",
+		RequestID: "req_2",
+		Request:   SDKControlRequestBody{Subtype: "interrupt"},
+	})
+	var mismatch *ErrCassetteMismatch
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, 0, mismatch.Index)
+	assert.Contains(t, string(mismatch.Got), "req_2")
+	assert.ErrorAs(t, replay.Done(), &mismatch)
+
+	// A matching write still succeeds and a further write is unexpected.
+	require.NoError(t, replay.Write(context.Background(), SDKControlRequest{
+		Type:      "control_request",
+		RequestID: "req_1",
+		Request:   SDKControlRequestBody{Subtype: "interrupt"},
+	}))
+	err = replay.Write(context.Background(), SDKControlRequest{
+		Type: "control_request",
+	})
+	require.ErrorAs(t, err, &mismatch)
+	assert.Nil(t, mismatch.Expected)
+}
+
+// TestReplayTransportHoldsReadsUntilWrite verifies that a received entry is
+// not delivered before the send recorded ahead of it has been replayed.
+func TestReplayTransportHoldsReadsUntilWrite(t *testing.T) {
+	replay := NewReplayTransport([]CassetteEntry{
+		{
+			Direction: CassetteSend,
+			Message:   json.RawMessage(`{"type":"keep_alive"}`),
+		},
+		{
+			Direction: CassetteRecv,
+			Message:   json.RawMessage(`{"type":"keep_alive"}`),
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, replay.Connect(ctx))
+
+	got := make(chan Message, 1)
+	go func() {
+		for msg, err := range replay.ReadMessages(ctx) {
+			if err == nil {
+				got <- msg
+			}
+		}
+	}()
+
+	select {
+	case <-got:
+		t.Fatal("received entry delivered before recorded send")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, replay.Write(ctx, KeepAliveMessage{Type: "keep_alive"}))
+
+	select {
+	case msg := <-got:
+		assert.Equal(t, "keep_alive", msg.MessageType())
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for replayed message")
+	}
+	require.NoError(t, replay.Done())
+}
+
+// TestLoadCassette covers file loading and malformed input.
+func TestLoadCassette(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "session.jsonl")
+	content := `{"dir":"recv","msg":{"type":"keep_alive"}}` + "\n\n" +
+		`{"dir":"recv","error":"boom"}` + "\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	replay, err := NewReplayTransportFromFile(path)
+	require.NoError(t, err)
+	require.NoError(t, replay.Connect(context.Background()))
+
+	var msgs []Message
+	var errs []error
+	for msg, err := range replay.ReadMessages(context.Background()) {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	require.Len(t, msgs, 1)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "boom", errs[0].Error())
+
+	_, err = ReadCassette(strings.NewReader(`{"dir":"sideways"}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown direction")
+}
+
+// TestRecordingTransportRawLines verifies that a LineTransport's lines are
+// recorded exactly as exchanged with the CLI, and that replay reproduces
+// the messages and errors they yielded, including their types.
+func TestRecordingTransportRawLines(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	runner := NewMockSubprocessRunner()
+	inner := NewSubprocessTransportWithRunner(runner, NewOptions())
+
+	var cassette bytes.Buffer
+	recorder := NewRecordingTransport(inner, &cassette)
+	require.NoError(t, recorder.Connect(ctx))
+	defer recorder.Close()
+
+	const assistant = `{"type":"assistant","message":{"role":"assistant",` +
+		`"content":[{"type":"text","text":"hi"}]},"future_field":1}`
+	lines := []string{
+		assistant,
+		`{"type":"mystery"}`,
+		`not json`,
+	}
+	_, err := runner.StdoutPipe.Write(
+		[]byte(strings.Join(lines, "\n") + "\n"),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, recorder.Write(ctx, KeepAliveMessage{
+		Type: "keep_alive",
+	}))
+	runner.Exit(errors.New("killed"))
+
+	collect := func(transport Transport) ([]Message, []error) {
+		var msgs []Message
+		var errs []error
+		for msg, err := range transport.ReadMessages(ctx) {
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			msgs = append(msgs, msg)
+		}
+		return msgs, errs
+	}
+	recordedMsgs, recordedErrs := collect(recorder)
+	require.NoError(t, recorder.Err())
+	require.Len(t, recordedMsgs, 1)
+	require.Len(t, recordedErrs, 3)
+
+	entries, err := ReadCassette(bytes.NewReader(cassette.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, entries, 5)
+	assert.Equal(t, CassetteSend, entries[0].Direction)
+	assert.Equal(t, assistant, string(entries[1].Message))
+	assert.Equal(t, `{"type":"mystery"}`, string(entries[2].Message))
+	assert.Equal(t, "not json", entries[3].Line)
+	require.NotNil(t, entries[4].ErrorInfo)
+	assert.Equal(t, "subprocess_failed", entries[4].ErrorInfo.Type)
+
+	replay := NewReplayTransport(entries)
+	require.NoError(t, replay.Connect(ctx))
+	require.NoError(t, replay.Write(ctx, KeepAliveMessage{
+		Type: "keep_alive",
+	}))
+	replayedMsgs, replayedErrs := collect(replay)
+	require.NoError(t, replay.Done())
+
+	assert.Equal(t, recordedMsgs, replayedMsgs)
+	require.Len(t, replayedErrs, 3)
+	for i := range recordedErrs {
+		assert.Equal(t, recordedErrs[i].Error(), replayedErrs[i].Error())
+	}
+
+	var unknown *ErrUnknownMessageType
+	require.ErrorAs(t, replayedErrs[0], &unknown)
+	assert.Equal(t, "mystery", unknown.Type)
+
+	var failed *ErrSubprocessFailed
+	require.ErrorAs(t, replayedErrs[2], &failed)
+	assert.Equal(t, -1, failed.ExitCode)
+	assert.EqualError(t, failed.Cause, "killed")
+}
+
+// TestRecordingTransportErrorTypes verifies that typed read errors from a
+// transport without raw lines are rebuilt with their type on replay.
+func TestRecordingTransportErrorTypes(t *testing.T) {
+	errs := []error{
+		&ErrSubprocessFailed{
+			Cause:    errors.New("exit status 2"),
+			ExitCode: 2,
+			Stderr:   "fatal: bad flag",
+		},
+		&ErrUnknownMessageType{Type: "mystery"},
+		errors.New("boom"),
+	}
+
+	var cassette bytes.Buffer
+	recorder := NewRecordingTransport(newMockTransport(0), &cassette)
+	for _, err := range errs {
+		recorder.record(CassetteRecv, nil, err)
+	}
+	require.NoError(t, recorder.Err())
+
+	entries, err := ReadCassette(bytes.NewReader(cassette.Bytes()))
+	require.NoError(t, err)
+	require.Len(t, entries, len(errs))
+
+	for i, want := range errs {
+		got := entries[i].err()
+		assert.IsType(t, want, got)
+		assert.Equal(t, want.Error(), got.Error())
+	}
+
+	var failed *ErrSubprocessFailed
+	require.ErrorAs(t, entries[0].err(), &failed)
+	assert.Equal(t, 2, failed.ExitCode)
+	assert.Equal(t, "fatal: bad flag", failed.Stderr)
+}
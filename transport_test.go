@@ -1,10 +1,15 @@
 package claudeagent
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
 	"iter"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -763,6 +768,49 @@ func TestSubprocessTransportIsAlive(t *testing.T) {
 	assert.False(t, transport.IsAlive())
 }
 
+// TestLocalSubprocessRunnerIsAlive verifies that a real CLI process is
+// reported dead once it exits, even while a child it started keeps stdout
+// open, and that its output stays readable after it is reaped.
+func TestLocalSubprocessRunnerIsAlive(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh not available")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+
+	cli := filepath.Join(t.TempDir(), "cli")
+	script := "#!/bin/sh\necho hi\nsleep 5 &\nexit 3\n"
+	require.NoError(t, os.WriteFile(cli, []byte(script), 0o755))
+
+	runner := NewLocalSubprocessRunner(cli)
+	assert.False(t, runner.IsAlive())
+
+	stdin, stdout, stderr, err := runner.Start(
+		context.Background(), nil, nil, "",
+	)
+	require.NoError(t, err)
+	defer stdin.Close()
+	defer stdout.Close()
+	defer stderr.Close()
+
+	// The background sleep shares the process group; kill it on the way
+	// out.
+	defer runner.Kill()
+
+	require.Eventually(t, func() bool {
+		return !runner.IsAlive()
+	}, 2*time.Second, 10*time.Millisecond)
+
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, runner.Wait(), &exitErr)
+	assert.Equal(t, 3, exitErr.ExitCode())
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "hi\n", line)
+}
+
 // TestSubprocessTransportIteratorEarlyStop tests that stopping iteration
 // gracefully terminates the reader.
 func TestSubprocessTransportIteratorEarlyStop(t *testing.T) {
@@ -2066,3 +2114,43 @@ func TestSubprocessTransportPermissionModeArguments(t *testing.T) {
 		})
 	}
 }
+
+// TestSubprocessTransportReportsExit verifies that a CLI exiting with a
+// non-zero status ends ReadMessages with ErrSubprocessFailed carrying the
+// exit code and stderr tail.
+func TestSubprocessTransportReportsExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires a POSIX shell")
+	}
+
+	script := filepath.Join(t.TempDir(), "claude")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"+
+		"echo starting >&2\n"+
+		"echo 'FATAL: out of memory' >&2\n"+
+		"exit 3\n"), 0o755))
+
+	transport := NewSubprocessTransportWithRunner(
+		NewLocalSubprocessRunner(script), NewOptions(),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, transport.Connect(ctx))
+	defer transport.Close()
+
+	var errs []error
+	for _, err := range transport.ReadMessages(ctx) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	require.Len(t, errs, 1)
+	var failed *ErrSubprocessFailed
+	require.ErrorAs(t, errs[0], &failed)
+	assert.Equal(t, 3, failed.ExitCode)
+	assert.Equal(t, "starting\nFATAL: out of memory\n", failed.Stderr)
+	assert.Contains(t, failed.Error(), "exit status 3: FATAL: out of memory")
+	assert.Equal(t, failed.Stderr, transport.StderrTail())
+}
@@ -0,0 +1,334 @@
+package claudeagent
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+const (
+	// MaxImageBytes is the largest decoded image accepted by ImageBlock.
+	// This matches the per-image limit of the Messages API.
+	MaxImageBytes = 5 * 1024 * 1024
+
+	// MaxDocumentBytes is the largest decoded document accepted by
+	// DocumentBlock. This matches the request size limit of the Messages
+	// API.
+	MaxDocumentBytes = 32 * 1024 * 1024
+)
+
+// supportedImageTypes lists the image MIME types accepted by the API.
+var supportedImageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// TextBlock creates a text content block.
+func TextBlock(text string) UserContentBlock {
+	return UserContentBlock{Type: "text", Text: text}
+}
+
+// ImageBlock creates a base64 image block from raw image bytes. The MIME type
+// is sniffed from the data and must be JPEG, PNG, GIF or WebP.
+//
+// Example:
+//
+//	png, _ := os.ReadFile("screenshot.png")
+//	img, err := claudeagent.ImageBlock(png)
+//	if err != nil {
+//	    return err
+//	}
+//	for msg := range client.QueryContent(ctx,
+//	    claudeagent.TextBlock("What is wrong with this UI?"), img,
+//	) {
+//	    // ...
+//	}
+func ImageBlock(data []byte) (UserContentBlock, error) {
+	mediaType := sniffMediaType(data)
+	if !supportedImageTypes[mediaType] {
+		return UserContentBlock{}, &ErrUnsupportedMediaType{
+			MediaType: mediaType,
+		}
+	}
+	if len(data) > MaxImageBytes {
+		return UserContentBlock{}, &ErrContentTooLarge{
+			MediaType: mediaType,
+			Size:      len(data),
+			Limit:     MaxImageBytes,
+		}
+	}
+
+	return UserContentBlock{
+		Type: "image",
+		Source: &ContentSource{
+			Type:      "base64",
+			MediaType: mediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		},
+	}, nil
+}
+
+// ImageBlockFromFile reads the image at path and creates a base64 image
+// block from it.
+func ImageBlockFromFile(path string) (UserContentBlock, error) {
+	data, err := readContentFile(path, MaxImageBytes)
+	if err != nil {
+		return UserContentBlock{}, err
+	}
+	return ImageBlock(data)
+}
+
+// ImageURLBlock creates an image block that references an image by URL.
+func ImageURLBlock(url string) UserContentBlock {
+	return UserContentBlock{
+		Type:   "image",
+		Source: &ContentSource{Type: "url", URL: url},
+	}
+}
+
+// DocumentBlock creates a document block from raw document bytes. PDFs are
+// sent as base64 sources and UTF-8 text as plain text sources; other types
+// are rejected. The title is optional.
+func DocumentBlock(data []byte, title string) (UserContentBlock, error) {
+	mediaType := sniffMediaType(data)
+
+	var source *ContentSource
+	switch {
+	case mediaType == "application/pdf":
+		source = &ContentSource{
+			Type:      "base64",
+			MediaType: mediaType,
+			Data:      base64.StdEncoding.EncodeToString(data),
+		}
+
+	case mediaType == "text/plain" && utf8.Valid(data):
+		source = &ContentSource{
+			Type:      "text",
+			MediaType: mediaType,
+			Data:      string(data),
+		}
+
+	default:
+		return UserContentBlock{}, &ErrUnsupportedMediaType{
+			MediaType: mediaType,
+		}
+	}
+
+	if len(data) > MaxDocumentBytes {
+		return UserContentBlock{}, &ErrContentTooLarge{
+			MediaType: mediaType,
+			Size:      len(data),
+			Limit:     MaxDocumentBytes,
+		}
+	}
+
+	return UserContentBlock{
+		Type:   "document",
+		Source: source,
+		Title:  title,
+	}, nil
+}
+
+// DocumentBlockFromFile reads the document at path and creates a document
+// block from it. The file name is used as the title.
+func DocumentBlockFromFile(path string) (UserContentBlock, error) {
+	data, err := readContentFile(path, MaxDocumentBytes)
+	if err != nil {
+		return UserContentBlock{}, err
+	}
+	return DocumentBlock(data, filepath.Base(path))
+}
+
+// DocumentURLBlock creates a document block that references a PDF by URL.
+func DocumentURLBlock(url, title string) UserContentBlock {
+	return UserContentBlock{
+		Type:   "document",
+		Source: &ContentSource{Type: "url", URL: url},
+		Title:  title,
+	}
+}
+
+// FileImageBlock creates an image block that references a file previously
+// uploaded through the Files API.
+func FileImageBlock(fileID string) UserContentBlock {
+	return UserContentBlock{
+		Type:   "image",
+		Source: &ContentSource{Type: "file", FileID: fileID},
+	}
+}
+
+// FileDocumentBlock creates a document block that references a file
+// previously uploaded through the Files API.
+func FileDocumentBlock(fileID, title string) UserContentBlock {
+	return UserContentBlock{
+		Type:   "document",
+		Source: &ContentSource{Type: "file", FileID: fileID},
+		Title:  title,
+	}
+}
+
+// ToolResultBlock creates a tool_result block answering the tool call with
+// the given ID. Content may contain text and image blocks.
+func ToolResultBlock(toolUseID string,
+	content ...UserContentBlock) UserContentBlock {
+
+	return UserContentBlock{
+		Type:      "tool_result",
+		ToolUseID: toolUseID,
+		Content:   content,
+	}
+}
+
+// ToolResultErrorBlock creates a tool_result block reporting that the tool
+// call with the given ID failed.
+func ToolResultErrorBlock(toolUseID, message string) UserContentBlock {
+	return UserContentBlock{
+		Type:      "tool_result",
+		ToolUseID: toolUseID,
+		Content:   []UserContentBlock{TextBlock(message)},
+		IsError:   true,
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The CLI sends tool_result
+// content either as a plain string or as an array of blocks; a string is
+// decoded as a single text block.
+func (b *UserContentBlock) UnmarshalJSON(data []byte) error {
+	type plain UserContentBlock
+	var wire struct {
+		plain
+		Content json.RawMessage `json:"content,omitempty"`
+	}
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	*b = UserContentBlock(wire.plain)
+
+	content := bytes.TrimSpace(wire.Content)
+	switch {
+	case len(content) == 0 || bytes.Equal(content, []byte("null")):
+		return nil
+
+	case content[0] == '"':
+		var text string
+		if err := json.Unmarshal(content, &text); err != nil {
+			return err
+		}
+		b.Content = []UserContentBlock{TextBlock(text)}
+		return nil
+
+	default:
+		return json.Unmarshal(content, &b.Content)
+	}
+}
+
+// validateUserContent checks that blocks form a sendable user message. It
+// catches hand-built blocks that skip the constructors' checks.
+func validateUserContent(blocks []UserContentBlock) error {
+	if len(blocks) == 0 {
+		return &ErrInvalidConfiguration{
+			Field:  "content",
+			Reason: "at least one content block is required",
+		}
+	}
+
+	for i, block := range blocks {
+		if err := validateUserContentBlock(block); err != nil {
+			return fmt.Errorf("content block %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// validateUserContentBlock checks a single content block.
+func validateUserContentBlock(block UserContentBlock) error {
+	switch block.Type {
+	case "text":
+		return nil
+
+	case "image", "document":
+		if block.Source == nil {
+			return &ErrInvalidConfiguration{
+				Field:  "source",
+				Reason: fmt.Sprintf("%s block requires a source", block.Type),
+			}
+		}
+		if block.Source.Type != "base64" {
+			return nil
+		}
+
+		size := base64.StdEncoding.DecodedLen(len(block.Source.Data))
+		limit := MaxDocumentBytes
+		if block.Type == "image" {
+			limit = MaxImageBytes
+			if !supportedImageTypes[block.Source.MediaType] {
+				return &ErrUnsupportedMediaType{
+					MediaType: block.Source.MediaType,
+				}
+			}
+		}
+		if size > limit {
+			return &ErrContentTooLarge{
+				MediaType: block.Source.MediaType,
+				Size:      size,
+				Limit:     limit,
+			}
+		}
+		return nil
+
+	case "tool_result":
+		if block.ToolUseID == "" {
+			return &ErrInvalidConfiguration{
+				Field:  "tool_use_id",
+				Reason: "tool_result block requires a tool use ID",
+			}
+		}
+		for _, inner := range block.Content {
+			if err := validateUserContentBlock(inner); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return &ErrInvalidConfiguration{
+			Field:  "type",
+			Reason: fmt.Sprintf("unsupported content block type %q", block.Type),
+		}
+	}
+}
+
+// sniffMediaType detects the MIME type of data without parameters.
+func sniffMediaType(data []byte) string {
+	detected := http.DetectContentType(data)
+	mediaType, _, err := mime.ParseMediaType(detected)
+	if err != nil {
+		return detected
+	}
+	return mediaType
+}
+
+// readContentFile reads a file, refusing files larger than limit before
+// loading them into memory.
+func readContentFile(path string, limit int) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > int64(limit) {
+		return nil, &ErrContentTooLarge{
+			MediaType: "file",
+			Size:      int(info.Size()),
+			Limit:     limit,
+		}
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,267 @@
+package claudeagent
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdfHeader = []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+)
+
+// TestImageBlock covers MIME sniffing and size validation for images.
+func TestImageBlock(t *testing.T) {
+	t.Run("png", func(t *testing.T) {
+		block, err := ImageBlock(pngHeader)
+		require.NoError(t, err)
+		assert.Equal(t, "image", block.Type)
+		require.NotNil(t, block.Source)
+		assert.Equal(t, "base64", block.Source.Type)
+		assert.Equal(t, "image/png", block.Source.MediaType)
+
+		decoded, err := base64.StdEncoding.DecodeString(block.Source.Data)
+		require.NoError(t, err)
+		assert.Equal(t, pngHeader, decoded)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := ImageBlock(pdfHeader)
+		var unsupported *ErrUnsupportedMediaType
+		require.ErrorAs(t, err, &unsupported)
+		assert.Equal(t, "application/pdf", unsupported.MediaType)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		data := make([]byte, MaxImageBytes+1)
+		copy(data, pngHeader)
+
+		_, err := ImageBlock(data)
+		var tooLarge *ErrContentTooLarge
+		require.ErrorAs(t, err, &tooLarge)
+		assert.Equal(t, MaxImageBytes, tooLarge.Limit)
+	})
+
+	t.Run("from file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "shot.png")
+		require.NoError(t, os.WriteFile(path, pngHeader, 0o600))
+
+		block, err := ImageBlockFromFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "image/png", block.Source.MediaType)
+	})
+}
+
+// TestDocumentBlock covers PDF and plain text documents.
+func TestDocumentBlock(t *testing.T) {
+	t.Run("pdf", func(t *testing.T) {
+		block, err := DocumentBlock(pdfHeader, "report")
+		require.NoError(t, err)
+		assert.Equal(t, "document", block.Type)
+		assert.Equal(t, "report", block.Title)
+		assert.Equal(t, "base64", block.Source.Type)
+		assert.Equal(t, "application/pdf", block.Source.MediaType)
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		block, err := DocumentBlock([]byte("hello world"), "")
+		require.NoError(t, err)
+		assert.Equal(t, "text", block.Source.Type)
+		assert.Equal(t, "text/plain", block.Source.MediaType)
+		assert.Equal(t, "hello world", block.Source.Data)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := DocumentBlock(pngHeader, "")
+		var unsupported *ErrUnsupportedMediaType
+		require.ErrorAs(t, err, &unsupported)
+	})
+
+	t.Run("from file uses base name as title", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.pdf")
+		require.NoError(t, os.WriteFile(path, pdfHeader, 0o600))
+
+		block, err := DocumentBlockFromFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "report.pdf", block.Title)
+	})
+}
+
+// TestUserContentBlockJSON verifies the wire format of the non-text blocks.
+func TestUserContentBlockJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		block UserContentBlock
+		want  string
+	}{
+		{
+			name:  "text",
+			block: TextBlock("hi"),
+			want:  `{"type":"text","text":"hi"}`,
+		},
+		{
+			name:  "image url",
+			block: ImageURLBlock("https://example.com/a.png"),
+			want: `{"type":"image","source":{"type":"url",` +
+				`"url":"https://example.com/a.png"}}`,
+		},
+		{
+			name:  "file document",
+			block: FileDocumentBlock("file_123", "spec"),
+			want: `{"type":"document","source":{"type":"file",` +
+				`"file_id":"file_123"},"title":"spec"}`,
+		},
+		{
+			name:  "tool result",
+			block: ToolResultBlock("toolu_1", TextBlock("ok")),
+			want: `{"type":"tool_result","tool_use_id":"toolu_1",` +
+				`"content":[{"type":"text","text":"ok"}]}`,
+		},
+		{
+			name:  "tool result error",
+			block: ToolResultErrorBlock("toolu_1", "boom"),
+			want: `{"type":"tool_result","tool_use_id":"toolu_1",` +
+				`"content":[{"type":"text","text":"boom"}],"is_error":true}`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := json.Marshal(tc.block)
+			require.NoError(t, err)
+			assert.JSONEq(t, tc.want, string(data))
+		})
+	}
+}
+
+// TestValidateUserContent covers validation of hand-built blocks.
+func TestValidateUserContent(t *testing.T) {
+	oversized := base64.StdEncoding.EncodeToString(
+		bytes.Repeat([]byte{0}, MaxImageBytes+3),
+	)
+
+	tests := []struct {
+		name    string
+		blocks  []UserContentBlock
+		wantErr bool
+	}{
+		{name: "empty", blocks: nil, wantErr: true},
+		{name: "text", blocks: []UserContentBlock{TextBlock("hi")}},
+		{
+			name:    "unknown type",
+			blocks:  []UserContentBlock{{Type: "video"}},
+			wantErr: true,
+		},
+		{
+			name:    "image without source",
+			blocks:  []UserContentBlock{{Type: "image"}},
+			wantErr: true,
+		},
+		{
+			name: "oversized base64 image",
+			blocks: []UserContentBlock{{
+				Type: "image",
+				Source: &ContentSource{
+					Type:      "base64",
+					MediaType: "image/png",
+					Data:      oversized,
+				},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "tool result without id",
+			blocks:  []UserContentBlock{ToolResultBlock("")},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateUserContent(tc.blocks)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestClientQueryContentSendsBlocks verifies that QueryContent writes the
+// given blocks as the user message content.
+func TestClientQueryContentSendsBlocks(t *testing.T) {
+	transport := newScriptedTransport()
+	client, err := NewClient(WithTransport(transport))
+	require.NoError(t, err)
+	defer client.Close()
+
+	img, err := ImageBlock(pngHeader)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for range client.QueryContent(ctx, TextBlock("what is this?"), img) {
+	}
+
+	transport.mu.Lock()
+	defer transport.mu.Unlock()
+
+	var user *UserMessage
+	for _, msg := range transport.written {
+		if m, ok := msg.(UserMessage); ok {
+			user = &m
+			break
+		}
+	}
+	require.NotNil(t, user, "user message should be written")
+	require.Len(t, user.Message.Content, 2)
+	assert.Equal(t, "text", user.Message.Content[0].Type)
+	assert.Equal(t, "image", user.Message.Content[1].Type)
+	assert.Equal(t, "image/png", user.Message.Content[1].Source.MediaType)
+}
+
+// TestStreamSendContentValidates verifies that SendContent rejects invalid
+// blocks before queuing them.
+func TestStreamSendContentValidates(t *testing.T) {
+	stream, _, _ := newStreamControlTest(nil)
+
+	err := stream.SendContent(context.Background(), UserContentBlock{
+		Type: "image",
+	})
+	var invalid *ErrInvalidConfiguration
+	require.ErrorAs(t, err, &invalid)
+	assert.Equal(t, "source", invalid.Field)
+}
+
+// TestUserContentBlockUnmarshalToolResult verifies that tool_result content
+// sent by the CLI decodes in both its string and array forms.
+func TestUserContentBlockUnmarshalToolResult(t *testing.T) {
+	msg, err := ParseMessage([]byte(`{"type":"user","session_id":"s",` +
+		`"parent_tool_use_id":null,"message":{"role":"user","content":[` +
+		`{"type":"tool_result","tool_use_id":"toolu_1","content":"a.go"},` +
+		`{"type":"tool_result","tool_use_id":"toolu_2","is_error":true,` +
+		`"content":[{"type":"text","text":"boom"}]}]}}`))
+	require.NoError(t, err)
+
+	user, ok := msg.(UserMessage)
+	require.True(t, ok)
+	require.Len(t, user.Message.Content, 2)
+
+	first := user.Message.Content[0]
+	assert.Equal(t, "toolu_1", first.ToolUseID)
+	assert.Equal(t, []UserContentBlock{TextBlock("a.go")}, first.Content)
+
+	second := user.Message.Content[1]
+	assert.True(t, second.IsError)
+	assert.Equal(t, []UserContentBlock{TextBlock("boom")}, second.Content)
+}